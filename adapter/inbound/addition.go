@@ -0,0 +1,41 @@
+package inbound
+
+import (
+	C "github.com/Dreamacro/clash/constant"
+)
+
+// Addition sets an option of an inbound to the metadata of its connections
+type Addition func(metadata *C.Metadata)
+
+// WithSpecialRules routes the connections by the sub rule set instead of the global rules
+func WithSpecialRules(rules string) Addition {
+	return func(metadata *C.Metadata) {
+		metadata.SpecialRules = rules
+	}
+}
+
+// WithSpecialProxy sends the connections to the proxy
+func WithSpecialProxy(proxy string) Addition {
+	return func(metadata *C.Metadata) {
+		metadata.SpecialProxy = proxy
+	}
+}
+
+// RoutingAdditions returns the additions of the routing entry point of the inbound,
+// the options not configured are left to the global rules
+func RoutingAdditions(config C.Inbound) []Addition {
+	additions := []Addition{}
+	if config.Rules != "" {
+		additions = append(additions, WithSpecialRules(config.Rules))
+	}
+	if config.Proxy != "" {
+		additions = append(additions, WithSpecialProxy(config.Proxy))
+	}
+	return additions
+}
+
+func applyAdditions(metadata *C.Metadata, additions []Addition) {
+	for _, addition := range additions {
+		addition(metadata)
+	}
+}
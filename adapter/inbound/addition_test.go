@@ -0,0 +1,28 @@
+package inbound
+
+import (
+	"net"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/transport/socks5"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingAdditions(t *testing.T) {
+	left, right := net.Pipe()
+	defer left.Close()
+	defer right.Close()
+	target := socks5.ParseAddr("example.com:443")
+
+	ctx := NewSocket(target, left, C.SOCKS5, RoutingAdditions(C.Inbound{Rules: "office", Proxy: "DIRECT"})...)
+	assert.Equal(t, "office", ctx.Metadata().SpecialRules)
+	assert.Equal(t, "DIRECT", ctx.Metadata().SpecialProxy)
+
+	// the inbounds without the options are routed by the global rules
+	assert.Empty(t, RoutingAdditions(C.Inbound{}))
+	ctx = NewSocket(target, left, C.SOCKS5)
+	assert.Equal(t, "", ctx.Metadata().SpecialRules)
+	assert.Equal(t, "", ctx.Metadata().SpecialProxy)
+}
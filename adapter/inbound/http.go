@@ -10,7 +10,7 @@ import (
 )
 
 // NewHTTP receive normal http request and return HTTPContext
-func NewHTTP(target socks5.Addr, source net.Addr, originTarget net.Addr, conn net.Conn) *context.ConnContext {
+func NewHTTP(target socks5.Addr, source net.Addr, originTarget net.Addr, conn net.Conn, additions ...Addition) *context.ConnContext {
 	metadata := parseSocksAddr(target)
 	metadata.NetWork = C.TCP
 	metadata.Type = C.HTTP
@@ -23,5 +23,6 @@ func NewHTTP(target socks5.Addr, source net.Addr, originTarget net.Addr, conn ne
 			metadata.OriginDst = addrPort
 		}
 	}
+	applyAdditions(metadata, additions)
 	return context.NewConnContext(conn, metadata)
 }
@@ -10,7 +10,7 @@ import (
 )
 
 // NewHTTPS receive CONNECT request and return ConnContext
-func NewHTTPS(request *http.Request, conn net.Conn) *context.ConnContext {
+func NewHTTPS(request *http.Request, conn net.Conn, additions ...Addition) *context.ConnContext {
 	metadata := parseHTTPAddr(request)
 	metadata.Type = C.HTTPCONNECT
 	if ip, port, err := parseAddr(conn.RemoteAddr()); err == nil {
@@ -20,5 +20,6 @@ func NewHTTPS(request *http.Request, conn net.Conn) *context.ConnContext {
 	if addrPort, err := netip.ParseAddrPort(conn.LocalAddr().String()); err == nil {
 		metadata.OriginDst = addrPort
 	}
+	applyAdditions(metadata, additions)
 	return context.NewConnContext(conn, metadata)
 }
@@ -0,0 +1,103 @@
+package inbound
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/Dreamacro/clash/log"
+
+	"go.uber.org/atomic"
+)
+
+var (
+	globalIPFilter = atomic.NewPointer(&IPFilter{Allowed: []netip.Prefix{}, Disallowed: []netip.Prefix{}})
+	rejected       = atomic.NewInt64(0)
+)
+
+// IPFilter is the source IPs allowed to connect to the inbounds, an empty allowed list allows
+// all the IPs, the disallowed list takes precedence and the loopback IPs are always allowed
+type IPFilter struct {
+	Allowed    []netip.Prefix
+	Disallowed []netip.Prefix
+}
+
+// NewIPFilter returns the filter of an inbound, it returns nil if both lists are empty
+func NewIPFilter(allowed []netip.Prefix, disallowed []netip.Prefix) *IPFilter {
+	if len(allowed) == 0 && len(disallowed) == 0 {
+		return nil
+	}
+	return &IPFilter{Allowed: allowed, Disallowed: disallowed}
+}
+
+// SetIPFilter replaces the global filter checked before the filter of each inbound
+func SetIPFilter(allowed []netip.Prefix, disallowed []netip.Prefix) {
+	if allowed == nil {
+		allowed = []netip.Prefix{}
+	}
+	if disallowed == nil {
+		disallowed = []netip.Prefix{}
+	}
+	globalIPFilter.Store(&IPFilter{Allowed: allowed, Disallowed: disallowed})
+}
+
+// GlobalIPFilter returns the global filter
+func GlobalIPFilter() *IPFilter {
+	return globalIPFilter.Load()
+}
+
+// Rejected returns the number of the connections and the packets rejected by the filters
+func Rejected() int64 {
+	return rejected.Load()
+}
+
+func contains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *IPFilter) allow(ip netip.Addr) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Allowed) != 0 && !contains(f.Allowed, ip) {
+		return false
+	}
+	return !contains(f.Disallowed, ip)
+}
+
+// check reports whether the source is allowed by both the global filter and the filter,
+// the filter may be nil, the sources without an IP are rejected
+func check(addr net.Addr, f *IPFilter) bool {
+	if addrPort, err := netip.ParseAddrPort(addr.String()); err == nil {
+		ip := addrPort.Addr().Unmap()
+		if ip.IsLoopback() || (globalIPFilter.Load().allow(ip) && f.allow(ip)) {
+			return true
+		}
+	}
+	rejected.Inc()
+	return false
+}
+
+// Allowed reports whether the source of a connection is allowed by the global filter and
+// the filter of its inbound, the filter may be nil, the rejected connections are logged
+func Allowed(addr net.Addr, f *IPFilter) bool {
+	if check(addr, f) {
+		return true
+	}
+	log.Infoln("[Inbound] connection from %s rejected by lan-allowed-ips/lan-disallowed-ips", addr.String())
+	return false
+}
+
+// AllowedPacket reports whether the source of a packet is allowed like Allowed,
+// the rejected packets are only logged in debug level as they may flood
+func AllowedPacket(addr net.Addr, f *IPFilter) bool {
+	if check(addr, f) {
+		return true
+	}
+	log.Debugln("[Inbound] packet from %s rejected by lan-allowed-ips/lan-disallowed-ips", addr.String())
+	return false
+}
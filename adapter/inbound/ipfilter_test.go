@@ -0,0 +1,44 @@
+package inbound
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPFilter(t *testing.T) {
+	defer SetIPFilter(nil, nil)
+
+	addr := func(s string) net.Addr {
+		return net.TCPAddrFromAddrPort(netip.MustParseAddrPort(s))
+	}
+
+	assert.Nil(t, NewIPFilter(nil, nil))
+	assert.True(t, Allowed(addr("1.1.1.1:80"), nil))
+
+	SetIPFilter(
+		[]netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")},
+		[]netip.Prefix{netip.MustParsePrefix("192.168.0.1/32")},
+	)
+	rejected := Rejected()
+	assert.True(t, Allowed(addr("192.168.1.1:80"), nil))
+	// the IPv4-mapped IPv6 addresses are matched as IPv4
+	assert.True(t, Allowed(addr("[::ffff:192.168.1.1]:80"), nil))
+	assert.False(t, Allowed(addr("192.168.0.1:80"), nil))
+	assert.False(t, AllowedPacket(addr("10.0.0.1:53"), nil))
+	// the loopback IPs are always allowed
+	assert.True(t, Allowed(addr("127.0.0.1:80"), nil))
+	assert.True(t, Allowed(addr("[::1]:80"), nil))
+	assert.Equal(t, rejected+2, Rejected())
+
+	// the source must be allowed by both the global filter and the filter of the inbound
+	filter := NewIPFilter(nil, []netip.Prefix{netip.MustParsePrefix("192.168.2.0/24")})
+	assert.True(t, Allowed(addr("192.168.1.1:80"), filter))
+	assert.False(t, Allowed(addr("192.168.2.1:80"), filter))
+	assert.False(t, Allowed(addr("10.0.0.1:80"), filter))
+
+	// the unparseable sources are rejected
+	assert.False(t, Allowed(&net.UnixAddr{Name: "/tmp/clash.sock", Net: "unix"}, nil))
+}
@@ -0,0 +1,25 @@
+package inbound
+
+import (
+	"net"
+
+	"github.com/Dreamacro/clash/log"
+	"github.com/Dreamacro/clash/transport/proxyprotocol"
+)
+
+// AcceptProxied reads the PROXY protocol header of a connection accepted by an inbound and checks
+// its source like Allowed, the source in the header is checked rather than the proxy sending it.
+// The returned connection has the addresses in the header, the connection is closed if rejected
+func AcceptProxied(conn net.Conn, f *IPFilter, pp *proxyprotocol.Server) (net.Conn, bool) {
+	c, err := pp.Handshake(conn)
+	if err != nil {
+		log.Debugln("[Inbound] PROXY protocol from %s error: %s", conn.RemoteAddr(), err.Error())
+		conn.Close()
+		return nil, false
+	}
+	if !Allowed(c.RemoteAddr(), f) {
+		conn.Close()
+		return nil, false
+	}
+	return c, true
+}
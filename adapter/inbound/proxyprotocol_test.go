@@ -0,0 +1,61 @@
+package inbound
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/Dreamacro/clash/transport/proxyprotocol"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// proxiedConn is a connection from a proxy on the same host
+type proxiedConn struct {
+	net.Conn
+}
+
+func (c *proxiedConn) RemoteAddr() net.Addr {
+	return net.TCPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:40000"))
+}
+
+func TestAcceptProxied(t *testing.T) {
+	SetIPFilter(nil, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	defer SetIPFilter(nil, nil)
+
+	pp := proxyprotocol.NewServer(proxyprotocol.ModeRequire, nil)
+	accept := func(source string) (net.Conn, bool, net.Conn) {
+		local, remote := net.Pipe()
+		header := proxyprotocol.NewHeader(2, netip.MustParseAddrPort(source), netip.MustParseAddrPort("192.168.1.2:7890"))
+		go remote.Write(header.Encode())
+		c, ok := AcceptProxied(&proxiedConn{Conn: local}, nil, pp)
+		return c, ok, remote
+	}
+
+	c, ok, remote := accept("192.168.1.1:50000")
+	defer remote.Close()
+	require.True(t, ok)
+	assert.Equal(t, "192.168.1.1:50000", c.RemoteAddr().String())
+
+	// the source in the header is rejected even though the proxy is allowed
+	_, ok, remote = accept("10.0.0.1:50000")
+	defer remote.Close()
+	assert.False(t, ok)
+	_, err := remote.Read(make([]byte, 1))
+	assert.Error(t, err)
+
+	// the connection without the header is rejected in the require mode
+	local, remote := net.Pipe()
+	defer remote.Close()
+	go remote.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	_, ok = AcceptProxied(&proxiedConn{Conn: local}, nil, pp)
+	assert.False(t, ok)
+
+	// nothing is read without the PROXY protocol
+	local, remote = net.Pipe()
+	defer remote.Close()
+	c, ok = AcceptProxied(&proxiedConn{Conn: local}, nil, nil)
+	require.True(t, ok)
+	assert.Equal(t, local, c.(*proxiedConn).Conn)
+}
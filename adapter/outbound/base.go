@@ -39,6 +39,16 @@ func (b *Base) ListenPacketContext(ctx context.Context, metadata *C.Metadata, op
 	return nil, errors.New("no support")
 }
 
+// ListenPacketWithDialer implements C.ProxyAdapter
+func (b *Base) ListenPacketWithDialer(ctx context.Context, d C.Dialer, metadata *C.Metadata) (C.PacketConn, error) {
+	return nil, errors.New("no support")
+}
+
+// BindContext implements C.ProxyAdapter
+func (b *Base) BindContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (C.BindListener, error) {
+	return nil, errors.ErrUnsupported
+}
+
 // SupportUDP implements C.ProxyAdapter
 func (b *Base) SupportUDP() bool {
 	return b.udp
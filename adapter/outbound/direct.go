@@ -31,10 +31,72 @@ func (d *Direct) ListenPacketContext(ctx context.Context, metadata *C.Metadata,
 	return newPacketConn(&directPacketConn{pc}, d), nil
 }
 
+// ListenPacketWithDialer implements C.ProxyAdapter
+func (d *Direct) ListenPacketWithDialer(ctx context.Context, dialer C.Dialer, metadata *C.Metadata) (C.PacketConn, error) {
+	pc, err := dialer.ListenPacket(ctx, "udp", metadata.RemoteAddress())
+	if err != nil {
+		return nil, err
+	}
+	return newPacketConn(&directPacketConn{pc}, d), nil
+}
+
+// BindContext implements C.ProxyAdapter
+func (d *Direct) BindContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (C.BindListener, error) {
+	// the remote is resolved by connecting a UDP socket, which sends nothing
+	port := metadata.DstPort.String()
+	if metadata.DstPort == 0 {
+		port = "9"
+	}
+	c, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(metadata.String(), port), d.Base.DialOptions(opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	local := c.LocalAddr().(*net.UDPAddr)
+	remote := c.RemoteAddr().(*net.UDPAddr)
+	c.Close()
+
+	// the remote is told to connect to the address the client connected to,
+	// the local address routing to the remote is only used without it
+	laddr := &net.TCPAddr{IP: local.IP, Zone: local.Zone}
+	if origin := metadata.OriginDst.Addr().Unmap(); origin.IsValid() && !origin.IsUnspecified() {
+		laddr = &net.TCPAddr{IP: origin.AsSlice(), Zone: origin.Zone()}
+	}
+
+	l, err := net.ListenTCP("tcp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &directBindListener{TCPListener: l, remote: remote.IP, direct: d}, nil
+}
+
 type directPacketConn struct {
 	net.PacketConn
 }
 
+// directBindListener only accepts the connection from the IP of the remote
+type directBindListener struct {
+	*net.TCPListener
+	remote net.IP
+	direct *Direct
+}
+
+func (l *directBindListener) Accept() (C.Conn, error) {
+	for {
+		c, err := l.TCPListener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := c.RemoteAddr().(*net.TCPAddr).IP
+		if l.remote.IsUnspecified() || l.remote.Equal(ip) {
+			l.TCPListener.Close()
+			tcpKeepAlive(c)
+			return NewConn(c, l.direct), nil
+		}
+		c.Close()
+	}
+}
+
 func NewDirect() *Direct {
 	return &Direct{
 		Base: &Base{
@@ -23,6 +23,9 @@ type Http struct {
 	pass      string
 	tlsConfig *tls.Config
 	Headers   http.Header
+
+	// proxyProtocol is the version of the PROXY protocol header sent to the server, 0 sends none
+	proxyProtocol int
 }
 
 type HttpOption struct {
@@ -36,10 +39,15 @@ type HttpOption struct {
 	SNI            string            `proxy:"sni,omitempty"`
 	SkipCertVerify bool              `proxy:"skip-cert-verify,omitempty"`
 	Headers        map[string]string `proxy:"headers,omitempty"`
+	ProxyProtocol  int               `proxy:"proxy-protocol,omitempty"`
 }
 
 // StreamConn implements C.ProxyAdapter
 func (h *Http) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
+	if err := writeProxyProtocol(c, h.proxyProtocol, metadata); err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", h.addr, err)
+	}
+
 	if h.tlsConfig != nil {
 		cc := tls.Client(c, h.tlsConfig)
 		ctx, cancel := context.WithTimeout(context.Background(), C.DefaultTLSTimeout)
@@ -153,5 +161,7 @@ func NewHttp(option HttpOption) *Http {
 		pass:      option.Password,
 		tlsConfig: tlsConfig,
 		Headers:   headers,
+
+		proxyProtocol: option.ProxyProtocol,
 	}
 }
@@ -24,6 +24,11 @@ func (r *Reject) ListenPacketContext(ctx context.Context, metadata *C.Metadata,
 	return newPacketConn(&nopPacketConn{}, r), nil
 }
 
+// ListenPacketWithDialer implements C.ProxyAdapter
+func (r *Reject) ListenPacketWithDialer(ctx context.Context, d C.Dialer, metadata *C.Metadata) (C.PacketConn, error) {
+	return newPacketConn(&nopPacketConn{}, r), nil
+}
+
 func NewReject() *Reject {
 	return &Reject{
 		Base: &Base{
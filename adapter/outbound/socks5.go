@@ -13,6 +13,8 @@ import (
 	"github.com/Dreamacro/clash/component/dialer"
 	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/transport/socks5"
+
+	"go.uber.org/atomic"
 )
 
 type Socks5 struct {
@@ -22,6 +24,9 @@ type Socks5 struct {
 	tls            bool
 	skipCertVerify bool
 	tlsConfig      *tls.Config
+
+	// proxyProtocol is the version of the PROXY protocol header sent to the server, 0 sends none
+	proxyProtocol int
 }
 
 type Socks5Option struct {
@@ -34,10 +39,21 @@ type Socks5Option struct {
 	TLS            bool   `proxy:"tls,omitempty"`
 	UDP            bool   `proxy:"udp,omitempty"`
 	SkipCertVerify bool   `proxy:"skip-cert-verify,omitempty"`
+	ProxyProtocol  int    `proxy:"proxy-protocol,omitempty"`
 }
 
 // StreamConn implements C.ProxyAdapter
 func (ss *Socks5) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error) {
+	c, _, err := ss.streamConn(c, metadata, socks5.CmdConnect)
+	return c, err
+}
+
+// streamConn requests the command of the metadata, it returns the address replied by the server
+func (ss *Socks5) streamConn(c net.Conn, metadata *C.Metadata, command socks5.Command) (net.Conn, socks5.Addr, error) {
+	if err := writeProxyProtocol(c, ss.proxyProtocol, metadata); err != nil {
+		return nil, nil, fmt.Errorf("%s connect error: %w", ss.addr, err)
+	}
+
 	if ss.tls {
 		cc := tls.Client(c, ss.tlsConfig)
 		ctx, cancel := context.WithTimeout(context.Background(), C.DefaultTLSTimeout)
@@ -45,7 +61,7 @@ func (ss *Socks5) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error)
 		err := cc.HandshakeContext(ctx)
 		c = cc
 		if err != nil {
-			return nil, fmt.Errorf("%s connect error: %w", ss.addr, err)
+			return nil, nil, fmt.Errorf("%s connect error: %w", ss.addr, err)
 		}
 	}
 
@@ -56,10 +72,11 @@ func (ss *Socks5) StreamConn(c net.Conn, metadata *C.Metadata) (net.Conn, error)
 			Password: ss.pass,
 		}
 	}
-	if _, err := socks5.ClientHandshake(c, serializesSocksAddr(metadata), socks5.CmdConnect, user); err != nil {
-		return nil, err
+	addr, err := socks5.ClientHandshake(c, serializesSocksAddr(metadata), command, user)
+	if err != nil {
+		return nil, nil, err
 	}
-	return c, nil
+	return c, addr, nil
 }
 
 // DialContext implements C.ProxyAdapter
@@ -82,14 +99,58 @@ func (ss *Socks5) DialContext(ctx context.Context, metadata *C.Metadata, opts ..
 	return NewConn(c, ss), nil
 }
 
-// ListenPacketContext implements C.ProxyAdapter
-func (ss *Socks5) ListenPacketContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (_ C.PacketConn, err error) {
+// BindContext implements C.ProxyAdapter
+func (ss *Socks5) BindContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (_ C.BindListener, err error) {
 	c, err := dialer.DialContext(ctx, "tcp", ss.addr, ss.Base.DialOptions(opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", ss.addr, err)
+	}
+	tcpKeepAlive(c)
+
+	defer func(c net.Conn) {
+		safeConnClose(c, err)
+	}(c)
+
+	c, bound, err := ss.streamConn(c, metadata, socks5.CmdBind)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := bound.UDPAddr()
+	if addr == nil {
+		return nil, fmt.Errorf("%s bind error: unsupported address %s", ss.addr, bound)
+	}
+	// the servers replying the unspecified address listen on the address connected by the client
+	if addr.IP.IsUnspecified() {
+		addr.IP = c.RemoteAddr().(*net.TCPAddr).IP
+	}
+
+	return &socks5BindListener{
+		conn:   c,
+		addr:   &net.TCPAddr{IP: addr.IP, Port: addr.Port},
+		socks5: ss,
+	}, nil
+}
+
+// ListenPacketContext implements C.ProxyAdapter
+func (ss *Socks5) ListenPacketContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (C.PacketConn, error) {
+	return ss.ListenPacketWithDialer(ctx, dialer.NewDialer(ss.Base.DialOptions(opts...)...), metadata)
+}
+
+// ListenPacketWithDialer implements C.ProxyAdapter
+func (ss *Socks5) ListenPacketWithDialer(ctx context.Context, d C.Dialer, metadata *C.Metadata) (_ C.PacketConn, err error) {
+	c, err := d.DialContext(ctx, "tcp", ss.addr)
 	if err != nil {
 		err = fmt.Errorf("%s connect error: %w", ss.addr, err)
 		return
 	}
 
+	if err = writeProxyProtocol(c, ss.proxyProtocol, metadata); err != nil {
+		c.Close()
+		err = fmt.Errorf("%s connect error: %w", ss.addr, err)
+		return
+	}
+
 	if ss.tls {
 		cc := tls.Client(c, ss.tlsConfig)
 		ctx, cancel := context.WithTimeout(context.Background(), C.DefaultTLSTimeout)
@@ -118,26 +179,13 @@ func (ss *Socks5) ListenPacketContext(ctx context.Context, metadata *C.Metadata,
 		return
 	}
 
-	pc, err := dialer.ListenPacket(ctx, "udp", "", ss.Base.DialOptions(opts...)...)
-	if err != nil {
-		return
-	}
-
-	go func() {
-		io.Copy(io.Discard, c)
-		c.Close()
-		// A UDP association terminates when the TCP connection that the UDP
-		// ASSOCIATE request arrived on terminates. RFC1928
-		pc.Close()
-	}()
-
 	// Support unspecified UDP bind address.
 	bindUDPAddr := bindAddr.UDPAddr()
 	if bindUDPAddr == nil {
 		err = errors.New("invalid UDP bind address")
 		return
 	} else if bindUDPAddr.IP.IsUnspecified() {
-		serverAddr, err := resolveUDPAddr("udp", ss.Addr())
+		serverAddr, err := resolveUDPAddr(d, "udp", ss.Addr())
 		if err != nil {
 			return nil, err
 		}
@@ -145,6 +193,19 @@ func (ss *Socks5) ListenPacketContext(ctx context.Context, metadata *C.Metadata,
 		bindUDPAddr.IP = serverAddr.IP
 	}
 
+	pc, err := d.ListenPacket(ctx, "udp", bindUDPAddr.String())
+	if err != nil {
+		return
+	}
+
+	go func() {
+		io.Copy(io.Discard, c)
+		c.Close()
+		// A UDP association terminates when the TCP connection that the UDP
+		// ASSOCIATE request arrived on terminates. RFC1928
+		pc.Close()
+	}()
+
 	return newPacketConn(&socksPacketConn{PacketConn: pc, rAddr: bindUDPAddr, tcpConn: c}, ss), nil
 }
 
@@ -171,6 +232,8 @@ func NewSocks5(option Socks5Option) *Socks5 {
 		tls:            option.TLS,
 		skipCertVerify: option.SkipCertVerify,
 		tlsConfig:      tlsConfig,
+
+		proxyProtocol: option.ProxyProtocol,
 	}
 }
 
@@ -212,3 +275,49 @@ func (uc *socksPacketConn) Close() error {
 	uc.tcpConn.Close()
 	return uc.PacketConn.Close()
 }
+
+// socks5BindListener waits for the second reply of the BIND request,
+// the connection to the server becomes the connection of the remote
+type socks5BindListener struct {
+	conn     net.Conn
+	addr     net.Addr
+	socks5   *Socks5
+	accepted atomic.Bool
+}
+
+func (l *socks5BindListener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *socks5BindListener) Accept() (C.Conn, error) {
+	if l.accepted.Load() {
+		return nil, net.ErrClosed
+	}
+
+	remote, err := socks5.ReadReply(l.conn)
+	if err != nil {
+		return nil, fmt.Errorf("%s bind error: %w", l.socks5.addr, err)
+	}
+	l.accepted.Store(true)
+	return NewConn(&socks5BindConn{Conn: l.conn, remote: remote.UDPAddr()}, l.socks5), nil
+}
+
+func (l *socks5BindListener) Close() error {
+	if l.accepted.Load() {
+		return nil
+	}
+	return l.conn.Close()
+}
+
+type socks5BindConn struct {
+	net.Conn
+	remote *net.UDPAddr
+}
+
+// RemoteAddr returns the address of the remote replied by the server
+func (c *socks5BindConn) RemoteAddr() net.Addr {
+	if c.remote == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return &net.TCPAddr{IP: c.remote.IP, Port: c.remote.Port}
+}
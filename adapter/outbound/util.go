@@ -2,10 +2,12 @@ package outbound
 
 import (
 	"net"
+	"net/netip"
 	"time"
 
 	"github.com/Dreamacro/clash/component/resolver"
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/transport/proxyprotocol"
 	"github.com/Dreamacro/clash/transport/socks5"
 
 	"github.com/Dreamacro/protobytes"
@@ -18,6 +20,33 @@ func tcpKeepAlive(c net.Conn) {
 	}
 }
 
+// writeProxyProtocol sends the PROXY protocol header with the source of the metadata, the
+// destination is the target, or the unspecified address if the target is not an IP address
+// of the same family. The header is local if the source is unknown, e.g. the health checks.
+func writeProxyProtocol(c net.Conn, version int, metadata *C.Metadata) error {
+	if version == 0 {
+		return nil
+	}
+
+	src, _ := netip.AddrFromSlice(metadata.SrcIP)
+	dst, _ := netip.AddrFromSlice(metadata.DstIP)
+	src, dst = src.Unmap(), dst.Unmap()
+	if src.IsValid() && (!dst.IsValid() || dst.Is4() != src.Is4()) {
+		dst = netip.IPv6Unspecified()
+		if src.Is4() {
+			dst = netip.IPv4Unspecified()
+		}
+	}
+
+	header := proxyprotocol.NewHeader(
+		version,
+		netip.AddrPortFrom(src, uint16(metadata.SrcPort)),
+		netip.AddrPortFrom(dst, uint16(metadata.DstPort)),
+	)
+	_, err := c.Write(header.Encode())
+	return err
+}
+
 func serializesSocksAddr(metadata *C.Metadata) []byte {
 	buf := protobytes.BytesWriter{}
 
@@ -38,13 +67,20 @@ func serializesSocksAddr(metadata *C.Metadata) []byte {
 	return buf.Bytes()
 }
 
-func resolveUDPAddr(network, address string) (*net.UDPAddr, error) {
+// resolveUDPAddr resolves the address with the resolver of the dialer if it has one, e.g. the
+// proxies of DNS nameservers resolve their servers with the default nameservers
+func resolveUDPAddr(d C.Dialer, network, address string) (*net.UDPAddr, error) {
 	host, port, err := net.SplitHostPort(address)
 	if err != nil {
 		return nil, err
 	}
 
-	ip, err := resolver.ResolveIP(host)
+	var ip net.IP
+	if r, ok := d.(interface{ ResolveIP(string) (net.IP, error) }); ok {
+		ip, err = r.ResolveIP(host)
+	} else {
+		ip, err = resolver.ResolveIP(host)
+	}
 	if err != nil {
 		return nil, err
 	}
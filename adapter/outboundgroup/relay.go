@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 
 	"github.com/Dreamacro/clash/adapter/outbound"
 	"github.com/Dreamacro/clash/common/singledo"
@@ -20,12 +21,7 @@ type Relay struct {
 
 // DialContext implements C.ProxyAdapter
 func (r *Relay) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (C.Conn, error) {
-	var proxies []C.Proxy
-	for _, proxy := range r.proxies(metadata, true) {
-		if proxy.Type() != C.Direct {
-			proxies = append(proxies, proxy)
-		}
-	}
+	proxies := r.chain(metadata, true)
 
 	switch len(proxies) {
 	case 0:
@@ -66,6 +62,43 @@ func (r *Relay) DialContext(ctx context.Context, metadata *C.Metadata, opts ...d
 	return outbound.NewConn(c, r), nil
 }
 
+// ListenPacketContext implements C.ProxyAdapter
+func (r *Relay) ListenPacketContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (C.PacketConn, error) {
+	proxies := r.chain(metadata, true)
+
+	switch len(proxies) {
+	case 0:
+		return outbound.NewDirect().ListenPacketContext(ctx, metadata, r.Base.DialOptions(opts...)...)
+	case 1:
+		return proxies[0].ListenPacketContext(ctx, metadata, r.Base.DialOptions(opts...)...)
+	}
+
+	var d C.Dialer = dialer.NewDialer(r.Base.DialOptions(opts...)...)
+	for _, proxy := range proxies[:len(proxies)-1] {
+		d = &proxyDialer{proxy: proxy, dialer: d}
+	}
+
+	last := proxies[len(proxies)-1]
+	pc, err := last.ListenPacketWithDialer(ctx, d, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", last.Addr(), err)
+	}
+
+	pc.AppendToChains(r)
+	return pc, nil
+}
+
+// SupportUDP implements C.ProxyAdapter
+func (r *Relay) SupportUDP() bool {
+	// every hop of the chain dialed by ListenPacketContext has to be able to
+	// reach the next one with the transport the next hop needs for UDP.
+	udp := true
+	for _, proxy := range r.chain(&C.Metadata{NetWork: C.UDP}, false) {
+		udp = proxy.SupportUDP() && (udp || udpOverStream(proxy))
+	}
+	return udp
+}
+
 // MarshalJSON implements C.ProxyAdapter
 func (r *Relay) MarshalJSON() ([]byte, error) {
 	var all []string
@@ -87,7 +120,8 @@ func (r *Relay) rawProxies(touch bool) []C.Proxy {
 }
 
 func (r *Relay) proxies(metadata *C.Metadata, touch bool) []C.Proxy {
-	proxies := r.rawProxies(touch)
+	// the raw proxies are cached and shared, the groups are unwrapped in a copy
+	proxies := append([]C.Proxy{}, r.rawProxies(touch)...)
 
 	for n, proxy := range proxies {
 		subproxy := proxy.Unwrap(metadata)
@@ -100,6 +134,17 @@ func (r *Relay) proxies(metadata *C.Metadata, touch bool) []C.Proxy {
 	return proxies
 }
 
+// chain returns the unwrapped proxies of the relay without DIRECT
+func (r *Relay) chain(metadata *C.Metadata, touch bool) []C.Proxy {
+	var proxies []C.Proxy
+	for _, proxy := range r.proxies(metadata, touch) {
+		if proxy.Type() != C.Direct {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 func NewRelay(option *GroupCommonOption, providers []provider.ProxyProvider) *Relay {
 	return &Relay{
 		Base: outbound.NewBase(outbound.BaseOption{
@@ -112,3 +157,51 @@ func NewRelay(option *GroupCommonOption, providers []provider.ProxyProvider) *Re
 		providers: providers,
 	}
 }
+
+// udpOverStream reports whether the adapter carries UDP inside its TCP stream,
+// such a hop only needs a TCP connection from the previous one.
+func udpOverStream(proxy C.Proxy) bool {
+	switch proxy.Type() {
+	case C.Vmess, C.Trojan, C.Snell:
+		return true
+	default:
+		return false
+	}
+}
+
+// proxyDialer implements C.Dialer by reaching the address through proxy,
+// which itself reaches its server through dialer.
+type proxyDialer struct {
+	proxy  C.Proxy
+	dialer C.Dialer
+}
+
+func (pd *proxyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	metadata, err := addrToMetadata(address)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := pd.dialer.DialContext(ctx, "tcp", pd.proxy.Addr())
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", pd.proxy.Addr(), err)
+	}
+	tcpKeepAlive(c)
+
+	sc, err := pd.proxy.StreamConn(c, metadata)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("%s connect error: %w", pd.proxy.Addr(), err)
+	}
+	return sc, nil
+}
+
+func (pd *proxyDialer) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	metadata, err := addrToMetadata(address)
+	if err != nil {
+		return nil, err
+	}
+	metadata.NetWork = C.UDP
+
+	return pd.proxy.ListenPacketWithDialer(ctx, pd.dialer, metadata)
+}
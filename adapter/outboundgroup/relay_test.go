@@ -0,0 +1,92 @@
+package outboundgroup
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapter"
+	"github.com/Dreamacro/clash/adapter/outbound"
+	"github.com/Dreamacro/clash/adapter/provider"
+	"github.com/Dreamacro/clash/component/dialer"
+	C "github.com/Dreamacro/clash/constant"
+	types "github.com/Dreamacro/clash/constant/provider"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errRecorded = errors.New("recorded")
+
+// udpRecorder is a hop carrying UDP in its stream, it records the dialer reaching it
+type udpRecorder struct {
+	*outbound.Base
+	dialer C.Dialer
+}
+
+func (u *udpRecorder) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (C.Conn, error) {
+	return nil, errRecorded
+}
+
+func (u *udpRecorder) ListenPacketWithDialer(ctx context.Context, d C.Dialer, metadata *C.Metadata) (C.PacketConn, error) {
+	u.dialer = d
+	return nil, errRecorded
+}
+
+func newUDPRecorder(name string) *udpRecorder {
+	return &udpRecorder{Base: outbound.NewBase(outbound.BaseOption{Name: name, Addr: "127.0.0.1:1", Type: C.Trojan, UDP: true})}
+}
+
+func newTestProvider(t *testing.T, proxies ...C.Proxy) []types.ProxyProvider {
+	pd, err := provider.NewCompatibleProvider("test", proxies, provider.NewHealthCheck(proxies, "", 0, true))
+	require.NoError(t, err)
+	return []types.ProxyProvider{pd}
+}
+
+func newTestSelector(t *testing.T, name string, proxies ...C.Proxy) C.Proxy {
+	return adapter.NewProxy(NewSelector(&GroupCommonOption{Name: name}, newTestProvider(t, proxies...)))
+}
+
+func TestRelay_SupportUDP(t *testing.T) {
+	http := adapter.NewProxy(outbound.NewHttp(outbound.HttpOption{Name: "http", Server: "127.0.0.1", Port: 1}))
+	socks := adapter.NewProxy(outbound.NewSocks5(outbound.Socks5Option{Name: "socks", Server: "127.0.0.1", Port: 2, UDP: true}))
+	recorder := adapter.NewProxy(newUDPRecorder("recorder"))
+	direct := adapter.NewProxy(outbound.NewDirect())
+
+	for _, tt := range []struct {
+		name    string
+		proxies []C.Proxy
+		udp     bool
+	}{
+		{"stream hop after TCP only hop", []C.Proxy{http, recorder}, true},
+		{"group of stream hop after TCP only hop", []C.Proxy{http, newTestSelector(t, "select", recorder)}, true},
+		{"UDP hop after TCP only hop", []C.Proxy{http, socks}, false},
+		{"TCP only last hop", []C.Proxy{socks, http}, false},
+		{"group of DIRECT is skipped", []C.Proxy{newTestSelector(t, "select", direct), socks}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := NewRelay(&GroupCommonOption{Name: "relay"}, newTestProvider(t, tt.proxies...))
+			assert.Equal(t, tt.udp, relay.SupportUDP())
+		})
+	}
+}
+
+func TestRelay_ListenPacketContext(t *testing.T) {
+	http := adapter.NewProxy(outbound.NewHttp(outbound.HttpOption{Name: "http", Server: "127.0.0.1", Port: 1}))
+	recorder := newUDPRecorder("recorder")
+	selector := newTestSelector(t, "select", adapter.NewProxy(recorder))
+
+	relay := NewRelay(&GroupCommonOption{Name: "relay"}, newTestProvider(t, http, selector))
+	require.True(t, relay.SupportUDP())
+
+	_, err := relay.ListenPacketContext(context.Background(), &C.Metadata{NetWork: C.UDP})
+	assert.ErrorIs(t, err, errRecorded)
+
+	// the unwrapped last hop is reached through the first one
+	d, ok := recorder.dialer.(*proxyDialer)
+	require.True(t, ok)
+	assert.Equal(t, "http", d.proxy.Name())
+
+	// the cached proxies of the relay keep the group
+	assert.Equal(t, "select", relay.rawProxies(false)[1].Name())
+}
@@ -3,8 +3,10 @@ package provider
 import (
 	"bytes"
 	"crypto/md5"
+	"errors"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	types "github.com/Dreamacro/clash/constant/provider"
@@ -16,34 +18,56 @@ var (
 	dirMode  os.FileMode = 0o755
 )
 
-type parser = func([]byte) (any, error)
+// Parser parses the content pulled by a vehicle
+type Parser = func([]byte) (any, error)
 
-type fetcher struct {
+// conditionalVehicle is a vehicle requesting the content only if it's modified since
+// the last content accepted by the fetcher
+type conditionalVehicle interface {
+	types.Vehicle
+	accept()
+}
+
+// Fetcher pulls the content of a vehicle periodically, the local file is used as cache
+type Fetcher struct {
 	name      string
 	vehicle   types.Vehicle
 	interval  time.Duration
 	updatedAt *time.Time
 	ticker    *time.Ticker
 	done      chan struct{}
+	closeOnce sync.Once
 	hash      [16]byte
-	parser    parser
+	parser    Parser
 	onUpdate  func(any)
 }
 
-func (f *fetcher) Name() string {
+func (f *Fetcher) Name() string {
 	return f.name
 }
 
-func (f *fetcher) VehicleType() types.VehicleType {
+func (f *Fetcher) VehicleType() types.VehicleType {
 	return f.vehicle.Type()
 }
 
-func (f *fetcher) Initial() (any, error) {
+// Initial loads the content from the local file or the vehicle, the content is pulled
+// periodically afterwards even if it fails, so a vehicle unavailable at the start is
+// picked up by the following pulls
+func (f *Fetcher) Initial() (any, error) {
+	elm, immediatelyUpdate, err := f.initial()
+
+	// pull proxies automatically
+	if f.ticker != nil {
+		go f.pullLoop(immediatelyUpdate)
+	}
+
+	return elm, err
+}
+
+func (f *Fetcher) initial() (_ any, immediatelyUpdate bool, err error) {
 	var (
-		buf               []byte
-		err               error
-		isLocal           bool
-		immediatelyUpdate bool
+		buf     []byte
+		isLocal bool
 	)
 	if stat, fErr := os.Stat(f.vehicle.Path()); fErr == nil {
 		buf, err = os.ReadFile(f.vehicle.Path())
@@ -56,24 +80,24 @@ func (f *fetcher) Initial() (any, error) {
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	proxies, err := f.parser(buf)
 	if err != nil {
 		if !isLocal {
-			return nil, err
+			return nil, false, err
 		}
 
 		// parse local file error, fallback to remote
 		buf, err = f.vehicle.Read()
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
 		proxies, err = f.parser(buf)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
 		isLocal = false
@@ -81,31 +105,29 @@ func (f *fetcher) Initial() (any, error) {
 
 	if f.vehicle.Type() != types.File && !isLocal {
 		if err := safeWrite(f.vehicle.Path(), buf); err != nil {
-			return nil, err
+			return nil, false, err
 		}
+		f.accept()
 	}
 
 	f.hash = md5.Sum(buf)
-
-	// pull proxies automatically
-	if f.ticker != nil {
-		go f.pullLoop(immediatelyUpdate)
-	}
-
-	return proxies, nil
+	return proxies, immediatelyUpdate, nil
 }
 
-func (f *fetcher) Update() (any, bool, error) {
+func (f *Fetcher) Update() (any, bool, error) {
 	buf, err := f.vehicle.Read()
-	if err != nil {
+	now := time.Now()
+	if errors.Is(err, types.ErrNotModified) {
+		f.touch(now)
+		return nil, true, nil
+	} else if err != nil {
 		return nil, false, err
 	}
 
-	now := time.Now()
 	hash := md5.Sum(buf)
 	if bytes.Equal(f.hash[:], hash[:]) {
-		f.updatedAt = &now
-		os.Chtimes(f.vehicle.Path(), now, now)
+		f.accept()
+		f.touch(now)
 		return nil, true, nil
 	}
 
@@ -119,6 +141,7 @@ func (f *fetcher) Update() (any, bool, error) {
 			return nil, false, err
 		}
 	}
+	f.accept()
 
 	f.updatedAt = &now
 	f.hash = hash
@@ -126,14 +149,28 @@ func (f *fetcher) Update() (any, bool, error) {
 	return proxies, false, nil
 }
 
-func (f *fetcher) Destroy() error {
-	if f.ticker != nil {
-		f.done <- struct{}{}
+// accept sends the validators of the accepted content in the next conditional requests
+func (f *Fetcher) accept() {
+	if vehicle, ok := f.vehicle.(conditionalVehicle); ok {
+		vehicle.accept()
 	}
+}
+
+// touch marks the content as up to date without changing it
+func (f *Fetcher) touch(now time.Time) {
+	f.updatedAt = &now
+	os.Chtimes(f.vehicle.Path(), now, now)
+}
+
+// Destroy stops pulling the content, it's safe to call it more than once
+func (f *Fetcher) Destroy() error {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
 	return nil
 }
 
-func (f *fetcher) pullLoop(immediately bool) {
+func (f *Fetcher) pullLoop(immediately bool) {
 	update := func() {
 		elm, same, err := f.Update()
 		if err != nil {
@@ -179,13 +216,13 @@ func safeWrite(path string, buf []byte) error {
 	return os.WriteFile(path, buf, fileMode)
 }
 
-func newFetcher(name string, interval time.Duration, vehicle types.Vehicle, parser parser, onUpdate func(any)) *fetcher {
+func NewFetcher(name string, interval time.Duration, vehicle types.Vehicle, parser Parser, onUpdate func(any)) *Fetcher {
 	var ticker *time.Ticker
 	if interval != 0 {
 		ticker = time.NewTicker(interval)
 	}
 
-	return &fetcher{
+	return &Fetcher{
 		name:     name,
 		ticker:   ticker,
 		vehicle:  vehicle,
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	types "github.com/Dreamacro/clash/constant/provider"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// flakyVehicle fails until it's available
+type flakyVehicle struct {
+	path      string
+	available *atomic.Bool
+}
+
+func (v *flakyVehicle) Read() ([]byte, error) {
+	if !v.available.Load() {
+		return nil, errors.New("unavailable")
+	}
+	return []byte("content"), nil
+}
+
+func (v *flakyVehicle) Path() string { return v.path }
+
+func (v *flakyVehicle) Type() types.VehicleType { return types.HTTP }
+
+func TestFetcher_InitialFailure(t *testing.T) {
+	vehicle := &flakyVehicle{path: filepath.Join(t.TempDir(), "provider"), available: atomic.NewBool(false)}
+	updated := make(chan any, 1)
+	parser := func(buf []byte) (any, error) {
+		return string(buf), nil
+	}
+
+	fetcher := NewFetcher("flaky", 10*time.Millisecond, vehicle, parser, func(elm any) {
+		select {
+		case updated <- elm:
+		default:
+		}
+	})
+	defer fetcher.Destroy()
+
+	_, err := fetcher.Initial()
+	require.Error(t, err)
+
+	// the content is pulled once the vehicle is available
+	vehicle.available.Store(true)
+	select {
+	case elm := <-updated:
+		assert.Equal(t, "content", elm)
+	case <-time.After(time.Second):
+		assert.FailNow(t, "the content isn't pulled after the initial failure")
+	}
+}
+
+// countingVehicle counts the reads of the vehicle
+type countingVehicle struct {
+	*flakyVehicle
+	reads *atomic.Int32
+}
+
+func (v *countingVehicle) Read() ([]byte, error) {
+	v.reads.Inc()
+	return v.flakyVehicle.Read()
+}
+
+func TestFetcher_Destroy(t *testing.T) {
+	vehicle := &countingVehicle{
+		flakyVehicle: &flakyVehicle{path: filepath.Join(t.TempDir(), "provider"), available: atomic.NewBool(true)},
+		reads:        atomic.NewInt32(0),
+	}
+	parser := func(buf []byte) (any, error) {
+		return string(buf), nil
+	}
+
+	fetcher := NewFetcher("destroyed", 10*time.Millisecond, vehicle, parser, nil)
+	_, err := fetcher.Initial()
+	require.NoError(t, err)
+
+	// the explicit stop on reload is followed by the one of the finalizer
+	require.NoError(t, fetcher.Destroy())
+	require.NoError(t, fetcher.Destroy())
+	require.NoError(t, fetcher.Destroy())
+
+	time.Sleep(50 * time.Millisecond)
+	reads := vehicle.reads.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, reads, vehicle.reads.Load())
+}
@@ -0,0 +1,189 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	regexp "github.com/dlclark/regexp2"
+)
+
+// Override patches the proxies of a provider before they are parsed
+type Override struct {
+	UDP              *bool             `provider:"udp,omitempty"`
+	SkipCertVerify   *bool             `provider:"skip-cert-verify,omitempty"`
+	Interface        *string           `provider:"interface-name,omitempty"`
+	RoutingMark      *int              `provider:"routing-mark,omitempty"`
+	AdditionalPrefix string            `provider:"additional-prefix,omitempty"`
+	AdditionalSuffix string            `provider:"additional-suffix,omitempty"`
+	ProxyName        []NameReplacement `provider:"proxy-name,omitempty"`
+}
+
+// NameReplacement replaces the matched part of the proxy name with Target
+type NameReplacement struct {
+	Pattern string `provider:"pattern"`
+	Target  string `provider:"target"`
+}
+
+type nameReplacer struct {
+	pattern *regexp.Regexp
+	target  string
+}
+
+// proxyTransformer filters and patches the proxy mappings of a provider
+type proxyTransformer struct {
+	filter        *regexp.Regexp
+	excludeFilter *regexp.Regexp
+	excludeType   map[string]struct{}
+	override      Override
+	replacers     []nameReplacer
+}
+
+func newProxyTransformer(filter, excludeFilter, excludeType string, override Override) (*proxyTransformer, error) {
+	t := &proxyTransformer{override: override}
+
+	if filter != "" {
+		filterReg, err := regexp.Compile(filter, regexp.None)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter regex: %w", err)
+		}
+		t.filter = filterReg
+	}
+
+	if excludeFilter != "" {
+		excludeFilterReg, err := regexp.Compile(excludeFilter, regexp.None)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude-filter regex: %w", err)
+		}
+		t.excludeFilter = excludeFilterReg
+	}
+
+	if excludeType != "" {
+		t.excludeType = map[string]struct{}{}
+		for _, tp := range strings.Split(excludeType, "|") {
+			t.excludeType[strings.ToLower(strings.TrimSpace(tp))] = struct{}{}
+		}
+	}
+
+	for idx, replacement := range override.ProxyName {
+		pattern, err := regexp.Compile(replacement.Pattern, regexp.None)
+		if err != nil {
+			return nil, fmt.Errorf("invalid override proxy-name %d regex: %w", idx, err)
+		}
+		t.replacers = append(t.replacers, nameReplacer{pattern: pattern, target: replacement.Target})
+	}
+
+	return t, nil
+}
+
+// filtered reports whether a filter is configured, so an empty result
+// can be reported as a filter mismatch
+func (t *proxyTransformer) filtered() bool {
+	return t.filter != nil || t.excludeFilter != nil || t.excludeType != nil
+}
+
+// accept reports whether the mapping passes filter, exclude-filter and exclude-type,
+// filters match the original name of the proxy
+func (t *proxyTransformer) accept(mapping map[string]any) (bool, error) {
+	if tp, ok := mapping["type"].(string); ok && t.excludeType != nil {
+		if _, excluded := t.excludeType[strings.ToLower(tp)]; excluded {
+			return false, nil
+		}
+	}
+
+	name, ok := mapping["name"].(string)
+	if !ok {
+		return true, nil
+	}
+
+	if t.filter != nil {
+		matched, err := t.filter.MatchString(name)
+		if err != nil {
+			return false, fmt.Errorf("regex filter failed: %w", err)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
+	if t.excludeFilter != nil {
+		matched, err := t.excludeFilter.MatchString(name)
+		if err != nil {
+			return false, fmt.Errorf("regex exclude-filter failed: %w", err)
+		}
+		if matched {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// apply patches the mapping with the override, the mapping is copied so
+// the parsed content is never modified
+func (t *proxyTransformer) apply(mapping map[string]any) (map[string]any, error) {
+	patched := make(map[string]any, len(mapping))
+	for key, value := range mapping {
+		patched[key] = value
+	}
+
+	override := t.override
+	if override.UDP != nil {
+		patched["udp"] = *override.UDP
+	}
+	if override.SkipCertVerify != nil {
+		patched["skip-cert-verify"] = *override.SkipCertVerify
+	}
+	if override.Interface != nil {
+		patched["interface-name"] = *override.Interface
+	}
+	if override.RoutingMark != nil {
+		patched["routing-mark"] = *override.RoutingMark
+	}
+
+	if name, ok := patched["name"].(string); ok {
+		for _, replacer := range t.replacers {
+			replaced, err := replacer.pattern.Replace(name, replacer.target, -1, -1)
+			if err != nil {
+				return nil, fmt.Errorf("override proxy-name failed: %w", err)
+			}
+			name = replaced
+		}
+		patched["name"] = override.AdditionalPrefix + name + override.AdditionalSuffix
+	}
+
+	return patched, nil
+}
+
+// uniqueNames renames proxies whose name is already taken in the provider by
+// appending a sequence number, groups select proxies by name so it must be unique
+func uniqueNames(mappings []map[string]any) {
+	taken := make(map[string]struct{}, len(mappings))
+	for _, mapping := range mappings {
+		if name, ok := mapping["name"].(string); ok {
+			taken[name] = struct{}{}
+		}
+	}
+
+	seen := make(map[string]struct{}, len(mappings))
+	for _, mapping := range mappings {
+		name, ok := mapping["name"].(string)
+		if !ok {
+			continue
+		}
+
+		if _, exist := seen[name]; !exist {
+			seen[name] = struct{}{}
+			continue
+		}
+
+		for i := 2; ; i++ {
+			candidate := fmt.Sprintf("%s %d", name, i)
+			if _, exist := taken[candidate]; !exist {
+				mapping["name"] = candidate
+				taken[candidate] = struct{}{}
+				seen[candidate] = struct{}{}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const overrideProxies = `
+proxies:
+  - name: HK 01
+    type: ss
+    server: 127.0.0.1
+    port: 443
+    cipher: aes-128-gcm
+    password: password
+  - name: HK-01
+    type: trojan
+    server: 127.0.0.1
+    port: 443
+    password: password
+  - name: HK01 2
+    type: socks5
+    server: 127.0.0.1
+    port: 1080
+  - name: US 01
+    type: http
+    server: 127.0.0.1
+    port: 8080
+`
+
+func newTestProvider(t *testing.T, filter, excludeFilter, excludeType string, override Override) (*ProxySetProvider, error) {
+	path := filepath.Join(t.TempDir(), "provider.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(overrideProxies), 0o600))
+
+	hc := NewHealthCheck([]C.Proxy{}, "", 0, true)
+	pd, err := NewProxySetProvider("test", 0, filter, excludeFilter, excludeType, FormatAuto, override, NewFileVehicle(path), hc)
+	if err != nil {
+		return nil, err
+	}
+
+	return pd, pd.Initial()
+}
+
+func proxyNames(proxies []C.Proxy) []string {
+	return lo.Map(proxies, func(proxy C.Proxy, _ int) string {
+		return proxy.Name()
+	})
+}
+
+func TestOverride_Patch(t *testing.T) {
+	pd, err := newTestProvider(t, "", "", "", Override{
+		UDP:              lo.ToPtr(true),
+		AdditionalPrefix: "[sub] ",
+	})
+	require.NoError(t, err)
+
+	proxies := pd.Proxies()
+	assert.Equal(t, []string{"[sub] HK 01", "[sub] HK-01", "[sub] HK01 2", "[sub] US 01"}, proxyNames(proxies))
+
+	udp := lo.Map(proxies, func(proxy C.Proxy, _ int) bool {
+		return proxy.SupportUDP()
+	})
+	assert.Equal(t, []bool{true, true, true, false}, udp)
+}
+
+func TestOverride_Exclude(t *testing.T) {
+	_, err := newTestProvider(t, "HK", "-", "socks5|SS", Override{})
+	assert.EqualError(t, err, "doesn't match any proxy, please check your filter")
+
+	pd, err := newTestProvider(t, "", "^US", "socks5", Override{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HK 01", "HK-01"}, proxyNames(pd.Proxies()))
+}
+
+func TestOverride_RenameCollision(t *testing.T) {
+	// both "HK 01" and "HK-01" become "HK01", and "HK01 2" already exists
+	pd, err := newTestProvider(t, "", "", "", Override{
+		ProxyName: []NameReplacement{
+			{Pattern: `^(HK)[ -]`, Target: "$1"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HK01", "HK01 3", "HK01 2", "US 01"}, proxyNames(pd.Proxies()))
+}
+
+func TestOverride_RenameToExistingName(t *testing.T) {
+	// "US 01" is renamed to the name of an existing proxy
+	pd, err := newTestProvider(t, "", "", "", Override{
+		ProxyName: []NameReplacement{
+			{Pattern: `^US`, Target: "HK"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HK 01", "HK-01", "HK01 2", "HK 01 2"}, proxyNames(pd.Proxies()))
+}
+
+func TestOverride_UniqueNames(t *testing.T) {
+	mappings := []map[string]any{
+		{"name": "a"},
+		{"name": "a"},
+		{"name": "a 2"},
+		{"name": "a"},
+	}
+	uniqueNames(mappings)
+
+	names := lo.Map(mappings, func(mapping map[string]any, _ int) any {
+		return mapping["name"]
+	})
+	assert.Equal(t, []any{"a", "a 3", "a 2", "a 4"}, names)
+}
+
+func TestOverride_InvalidRegex(t *testing.T) {
+	_, err := newProxyTransformer("", "(", "", Override{})
+	assert.Error(t, err)
+
+	_, err = newProxyTransformer("", "", "", Override{
+		ProxyName: []NameReplacement{{Pattern: "("}},
+	})
+	assert.Error(t, err)
+}
@@ -13,6 +13,7 @@ import (
 var (
 	errVehicleType = errors.New("unsupport vehicle type")
 	errSubPath     = errors.New("path is not subpath of home directory")
+	errBehavior    = errors.New("unsupported rule provider behavior")
 )
 
 type healthCheckSchema struct {
@@ -23,15 +24,23 @@ type healthCheckSchema struct {
 }
 
 type proxyProviderSchema struct {
-	Type        string            `provider:"type"`
-	Path        string            `provider:"path"`
-	URL         string            `provider:"url,omitempty"`
-	Interval    int               `provider:"interval,omitempty"`
-	Filter      string            `provider:"filter,omitempty"`
-	HealthCheck healthCheckSchema `provider:"health-check,omitempty"`
+	Type          string              `provider:"type"`
+	Path          string              `provider:"path"`
+	URL           string              `provider:"url,omitempty"`
+	Header        map[string][]string `provider:"header,omitempty"`
+	Proxy         string              `provider:"proxy,omitempty"`
+	Interval      int                 `provider:"interval,omitempty"`
+	Filter        string              `provider:"filter,omitempty"`
+	Format        string              `provider:"format,omitempty"`
+	ExcludeFilter string              `provider:"exclude-filter,omitempty"`
+	ExcludeType   string              `provider:"exclude-type,omitempty"`
+	Override      Override            `provider:"override,omitempty"`
+	HealthCheck   healthCheckSchema   `provider:"health-check,omitempty"`
 }
 
-func ParseProxyProvider(name string, mapping map[string]any) (types.ProxyProvider, error) {
+// ParseProxyProvider parses a proxy provider, proxies is used to look up the
+// proxy which an http provider is fetched through
+func ParseProxyProvider(name string, mapping map[string]any, proxies map[string]C.Proxy) (types.ProxyProvider, error) {
 	decoder := structure.NewDecoder(structure.Option{TagName: "provider", WeaklyTypedInput: true})
 
 	schema := &proxyProviderSchema{
@@ -59,12 +68,64 @@ func ParseProxyProvider(name string, mapping map[string]any) (types.ProxyProvide
 		if !C.Path.IsSubPath(path) {
 			return nil, fmt.Errorf("%w: %s", errSubPath, path)
 		}
-		vehicle = NewHTTPVehicle(schema.URL, path)
+		vehicle = NewHTTPVehicle(schema.URL, path, schema.Header, schema.Proxy, proxies)
 	default:
 		return nil, fmt.Errorf("%w: %s", errVehicleType, schema.Type)
 	}
 
 	interval := time.Duration(uint(schema.Interval)) * time.Second
 	filter := schema.Filter
-	return NewProxySetProvider(name, interval, filter, vehicle, hc)
+	return NewProxySetProvider(name, interval, filter, schema.ExcludeFilter, schema.ExcludeType, schema.Format, schema.Override, vehicle, hc)
+}
+
+type ruleProviderSchema struct {
+	Type     string              `provider:"type"`
+	Behavior string              `provider:"behavior"`
+	Path     string              `provider:"path"`
+	URL      string              `provider:"url,omitempty"`
+	Header   map[string][]string `provider:"header,omitempty"`
+	Proxy    string              `provider:"proxy,omitempty"`
+	Interval int                 `provider:"interval,omitempty"`
+	Format   string              `provider:"format,omitempty"`
+}
+
+// ParseRuleProvider parses a rule provider, proxies is used to look up the
+// proxy which an http provider is fetched through
+func ParseRuleProvider(name string, mapping map[string]any, proxies map[string]C.Proxy) (types.RuleProvider, error) {
+	decoder := structure.NewDecoder(structure.Option{TagName: "provider", WeaklyTypedInput: true})
+
+	schema := &ruleProviderSchema{}
+	if err := decoder.Decode(mapping, schema); err != nil {
+		return nil, err
+	}
+
+	var behavior types.RuleType
+	switch schema.Behavior {
+	case "domain":
+		behavior = types.Domain
+	case "ipcidr":
+		behavior = types.IPCIDR
+	case "classical":
+		behavior = types.Classical
+	default:
+		return nil, fmt.Errorf("%w: %s", errBehavior, schema.Behavior)
+	}
+
+	path := C.Path.Resolve(schema.Path)
+
+	var vehicle types.Vehicle
+	switch schema.Type {
+	case "file":
+		vehicle = NewFileVehicle(path)
+	case "http":
+		if !C.Path.IsSubPath(path) {
+			return nil, fmt.Errorf("%w: %s", errSubPath, path)
+		}
+		vehicle = NewHTTPVehicle(schema.URL, path, schema.Header, schema.Proxy, proxies)
+	default:
+		return nil, fmt.Errorf("%w: %s", errVehicleType, schema.Type)
+	}
+
+	interval := time.Duration(uint(schema.Interval)) * time.Second
+	return NewRuleSetProvider(name, behavior, interval, schema.Format, vehicle)
 }
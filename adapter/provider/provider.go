@@ -4,18 +4,21 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"runtime"
 	"time"
 
 	"github.com/Dreamacro/clash/adapter"
 	"github.com/Dreamacro/clash/adapter/outbound"
 	"github.com/Dreamacro/clash/common/singledo"
+	"github.com/Dreamacro/clash/component/profile/cachefile"
 	C "github.com/Dreamacro/clash/constant"
 	types "github.com/Dreamacro/clash/constant/provider"
+	"github.com/Dreamacro/clash/log"
 
 	regexp "github.com/dlclark/regexp2"
 	"github.com/samber/lo"
-	"gopkg.in/yaml.v3"
+	"go.uber.org/atomic"
 )
 
 var reject = adapter.NewProxy(outbound.NewReject())
@@ -34,21 +37,61 @@ type ProxySetProvider struct {
 }
 
 type proxySetProvider struct {
-	*fetcher
-	proxies     []C.Proxy
-	healthCheck *HealthCheck
+	*Fetcher
+	proxies          []C.Proxy
+	healthCheck      *HealthCheck
+	subscriptionInfo *atomic.Pointer[SubscriptionInfo]
 }
 
 func (pp *proxySetProvider) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]any{
-		"name":        pp.Name(),
-		"type":        pp.Type().String(),
-		"vehicleType": pp.VehicleType().String(),
-		"proxies":     pp.Proxies(),
-		"updatedAt":   pp.updatedAt,
+		"name":             pp.Name(),
+		"type":             pp.Type().String(),
+		"vehicleType":      pp.VehicleType().String(),
+		"proxies":          pp.Proxies(),
+		"updatedAt":        pp.updatedAt,
+		"subscriptionInfo": pp.SubscriptionInfo(),
 	})
 }
 
+// SubscriptionInfo returns the quota of the subscription, nil if the
+// provider never received it
+func (pp *proxySetProvider) SubscriptionInfo() *SubscriptionInfo {
+	return pp.subscriptionInfo.Load()
+}
+
+func (pp *proxySetProvider) onHeader(header http.Header) {
+	userinfo := header.Get("Subscription-Userinfo")
+	if userinfo == "" {
+		return
+	}
+
+	info, err := parseSubscriptionInfo(userinfo)
+	if err != nil {
+		log.Debugln("[Provider] %s parse subscription userinfo %s error: %s", pp.Name(), userinfo, err.Error())
+		return
+	}
+	pp.subscriptionInfo.Store(info)
+
+	if buf, err := json.Marshal(info); err == nil {
+		cachefile.Cache().SetSubscriptionInfo(pp.Name(), buf)
+	}
+}
+
+// loadSubscriptionInfo restores the subscription info persisted by the last run
+func (pp *proxySetProvider) loadSubscriptionInfo() {
+	buf := cachefile.Cache().GetSubscriptionInfo(pp.Name())
+	if buf == nil {
+		return
+	}
+
+	info := &SubscriptionInfo{}
+	if err := json.Unmarshal(buf, info); err != nil {
+		return
+	}
+	pp.subscriptionInfo.Store(info)
+}
+
 func (pp *proxySetProvider) Name() string {
 	return pp.name
 }
@@ -58,7 +101,7 @@ func (pp *proxySetProvider) HealthCheck() {
 }
 
 func (pp *proxySetProvider) Update() error {
-	elm, same, err := pp.fetcher.Update()
+	elm, same, err := pp.Fetcher.Update()
 	if err == nil && !same {
 		pp.onUpdate(elm)
 	}
@@ -66,7 +109,7 @@ func (pp *proxySetProvider) Update() error {
 }
 
 func (pp *proxySetProvider) Initial() error {
-	elm, err := pp.fetcher.Initial()
+	elm, err := pp.Fetcher.Initial()
 	if err != nil {
 		return err
 	}
@@ -97,13 +140,17 @@ func (pp *proxySetProvider) setProxies(proxies []C.Proxy) {
 
 func stopProxyProvider(pd *ProxySetProvider) {
 	pd.healthCheck.close()
-	pd.fetcher.Destroy()
+	pd.Fetcher.Destroy()
 }
 
-func NewProxySetProvider(name string, interval time.Duration, filter string, vehicle types.Vehicle, hc *HealthCheck) (*ProxySetProvider, error) {
-	filterReg, err := regexp.Compile(filter, regexp.None)
+func NewProxySetProvider(name string, interval time.Duration, filter, excludeFilter, excludeType, format string, override Override, vehicle types.Vehicle, hc *HealthCheck) (*ProxySetProvider, error) {
+	transformer, err := newProxyTransformer(filter, excludeFilter, excludeType, override)
 	if err != nil {
-		return nil, fmt.Errorf("invalid filter regex: %w", err)
+		return nil, err
+	}
+
+	if err := checkFormat(format); err != nil {
+		return nil, err
 	}
 
 	if hc.auto() {
@@ -111,8 +158,9 @@ func NewProxySetProvider(name string, interval time.Duration, filter string, veh
 	}
 
 	pd := &proxySetProvider{
-		proxies:     []C.Proxy{},
-		healthCheck: hc,
+		proxies:          []C.Proxy{},
+		healthCheck:      hc,
+		subscriptionInfo: atomic.NewPointer[SubscriptionInfo](nil),
 	}
 
 	onUpdate := func(elm any) {
@@ -121,27 +169,31 @@ func NewProxySetProvider(name string, interval time.Duration, filter string, veh
 	}
 
 	proxiesParseAndFilter := func(buf []byte) (any, error) {
-		schema := &ProxySchema{}
-
-		if err := yaml.Unmarshal(buf, schema); err != nil {
+		mappings, err := parseProxySchema(buf, format)
+		if err != nil {
 			return nil, err
 		}
 
-		if schema.Proxies == nil {
-			return nil, errors.New("file must have a `proxies` field")
+		patched := []map[string]any{}
+		for _, mapping := range mappings {
+			accepted, err := transformer.accept(mapping)
+			if err != nil {
+				return nil, err
+			}
+			if !accepted {
+				continue
+			}
+
+			mapping, err = transformer.apply(mapping)
+			if err != nil {
+				return nil, err
+			}
+			patched = append(patched, mapping)
 		}
+		uniqueNames(patched)
 
 		proxies := []C.Proxy{}
-		for idx, mapping := range schema.Proxies {
-			if name, ok := mapping["name"].(string); ok && len(filter) > 0 {
-				matched, err := filterReg.MatchString(name)
-				if err != nil {
-					return nil, fmt.Errorf("regex filter failed: %w", err)
-				}
-				if !matched {
-					continue
-				}
-			}
+		for idx, mapping := range patched {
 			proxy, err := adapter.ParseProxy(mapping)
 			if err != nil {
 				return nil, fmt.Errorf("proxy %d error: %w", idx, err)
@@ -150,7 +202,7 @@ func NewProxySetProvider(name string, interval time.Duration, filter string, veh
 		}
 
 		if len(proxies) == 0 {
-			if len(filter) > 0 {
+			if transformer.filtered() {
 				return nil, errors.New("doesn't match any proxy, please check your filter")
 			}
 			return nil, errors.New("file doesn't have any proxy")
@@ -159,8 +211,13 @@ func NewProxySetProvider(name string, interval time.Duration, filter string, veh
 		return proxies, nil
 	}
 
-	fetcher := newFetcher(name, interval, vehicle, proxiesParseAndFilter, onUpdate)
-	pd.fetcher = fetcher
+	fetcher := NewFetcher(name, interval, vehicle, proxiesParseAndFilter, onUpdate)
+	pd.Fetcher = fetcher
+
+	if hv, ok := vehicle.(*HTTPVehicle); ok {
+		pd.loadSubscriptionInfo()
+		hv.onHeader = pd.onHeader
+	}
 
 	wrapper := &ProxySetProvider{pd}
 	runtime.SetFinalizer(wrapper, stopProxyProvider)
@@ -0,0 +1,303 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Dreamacro/clash/component/trie"
+	C "github.com/Dreamacro/clash/constant"
+	types "github.com/Dreamacro/clash/constant/provider"
+	R "github.com/Dreamacro/clash/rule"
+
+	"go.uber.org/atomic"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FormatText is the rule list with a rule per line, the lines starting with '#' are comments
+	FormatText = "text"
+)
+
+var errNoRules = errors.New("file doesn't have any rule")
+
+type RuleSchema struct {
+	Payload []string `yaml:"payload"`
+}
+
+// ruleSet matches the metadata with the rules of a behavior
+type ruleSet interface {
+	Match(metadata *C.Metadata) bool
+	ShouldResolveIP() bool
+	Count() int
+}
+
+// domainSet is the domain behavior, the rules are the domain patterns of the trie,
+// e.g. 'example.com', '+.example.com' and '*.example.com'
+type domainSet struct {
+	tree  *trie.DomainTrie
+	count int
+}
+
+func (ds *domainSet) Match(metadata *C.Metadata) bool {
+	return metadata.Host != "" && ds.tree.Search(strings.ToLower(metadata.Host)) != nil
+}
+
+func (ds *domainSet) ShouldResolveIP() bool { return false }
+
+func (ds *domainSet) Count() int { return ds.count }
+
+// ipcidrSet is the ipcidr behavior, the rules are the prefixes of the destination IP
+type ipcidrSet struct {
+	prefixes []netip.Prefix
+}
+
+func (is *ipcidrSet) Match(metadata *C.Metadata) bool {
+	ip, ok := netip.AddrFromSlice(metadata.DstIP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range is.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (is *ipcidrSet) ShouldResolveIP() bool { return true }
+
+func (is *ipcidrSet) Count() int { return len(is.prefixes) }
+
+// classicalSet is the classical behavior, the rules are the ones of the rules section
+// without the proxy, e.g. 'DOMAIN-SUFFIX,example.com' and 'IP-CIDR,10.0.0.0/8,no-resolve'
+type classicalSet struct {
+	rules     []C.Rule
+	resolveIP bool
+}
+
+func (cs *classicalSet) Match(metadata *C.Metadata) bool {
+	for _, rule := range cs.rules {
+		if rule.Match(metadata) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *classicalSet) ShouldResolveIP() bool { return cs.resolveIP }
+
+func (cs *classicalSet) Count() int { return len(cs.rules) }
+
+// for auto gc
+type RuleSetProvider struct {
+	*ruleSetProvider
+}
+
+type ruleSetProvider struct {
+	*Fetcher
+	behavior types.RuleType
+	rules    *atomic.Pointer[ruleSet]
+}
+
+func (rp *ruleSetProvider) MarshalJSON() ([]byte, error) {
+	count := 0
+	if rules := rp.rules.Load(); rules != nil {
+		count = (*rules).Count()
+	}
+	return json.Marshal(map[string]any{
+		"name":        rp.Name(),
+		"type":        rp.Type().String(),
+		"vehicleType": rp.VehicleType().String(),
+		"behavior":    rp.behavior.String(),
+		"ruleCount":   count,
+		"updatedAt":   rp.updatedAt,
+	})
+}
+
+func (rp *ruleSetProvider) Update() error {
+	elm, same, err := rp.Fetcher.Update()
+	if err == nil && !same {
+		rp.onUpdate(elm)
+	}
+	return err
+}
+
+func (rp *ruleSetProvider) Initial() error {
+	elm, err := rp.Fetcher.Initial()
+	if err != nil {
+		return err
+	}
+
+	rp.onUpdate(elm)
+	return nil
+}
+
+func (rp *ruleSetProvider) Type() types.ProviderType {
+	return types.Rule
+}
+
+func (rp *ruleSetProvider) Behavior() types.RuleType {
+	return rp.behavior
+}
+
+// Match reports whether the metadata matches a rule of the provider, nothing is matched
+// before the rules are loaded
+func (rp *ruleSetProvider) Match(metadata *C.Metadata) bool {
+	rules := rp.rules.Load()
+	return rules != nil && (*rules).Match(metadata)
+}
+
+func (rp *ruleSetProvider) ShouldResolveIP() bool {
+	return rp.behavior == types.IPCIDR || (rp.behavior == types.Classical && rp.classicalResolveIP())
+}
+
+func (rp *ruleSetProvider) classicalResolveIP() bool {
+	rules := rp.rules.Load()
+	return rules != nil && (*rules).ShouldResolveIP()
+}
+
+func (rp *ruleSetProvider) AsRule(adaptor string) C.Rule {
+	return &ruleSetRule{provider: rp, adapter: adaptor}
+}
+
+// ruleSetRule matches the metadata with the rules of the provider
+type ruleSetRule struct {
+	provider *ruleSetProvider
+	adapter  string
+}
+
+func (r *ruleSetRule) RuleType() C.RuleType { return C.RuleSet }
+
+func (r *ruleSetRule) Match(metadata *C.Metadata) bool { return r.provider.Match(metadata) }
+
+func (r *ruleSetRule) Adapter() string { return r.adapter }
+
+func (r *ruleSetRule) Payload() string { return r.provider.Name() }
+
+func (r *ruleSetRule) ShouldResolveIP() bool { return r.provider.ShouldResolveIP() }
+
+func (r *ruleSetRule) ShouldFindProcess() bool { return false }
+
+func stopRuleProvider(pd *RuleSetProvider) {
+	pd.Fetcher.Destroy()
+}
+
+func NewRuleSetProvider(name string, behavior types.RuleType, interval time.Duration, format string, vehicle types.Vehicle) (*RuleSetProvider, error) {
+	switch format {
+	case "", FormatYAML, FormatText:
+	default:
+		return nil, fmt.Errorf("%w: %s", errFormat, format)
+	}
+
+	pd := &ruleSetProvider{
+		behavior: behavior,
+		rules:    atomic.NewPointer[ruleSet](nil),
+	}
+
+	onUpdate := func(elm any) {
+		rules := elm.(ruleSet)
+		pd.rules.Store(&rules)
+	}
+
+	parser := func(buf []byte) (any, error) {
+		payload, err := parseRulePayload(buf, format)
+		if err != nil {
+			return nil, err
+		}
+		return newRuleSet(behavior, payload)
+	}
+
+	pd.Fetcher = NewFetcher(name, interval, vehicle, parser, onUpdate)
+
+	wrapper := &RuleSetProvider{pd}
+	runtime.SetFinalizer(wrapper, stopRuleProvider)
+	return wrapper, nil
+}
+
+// parseRulePayload returns the rules of the yaml payload or the text lines
+func parseRulePayload(buf []byte, format string) ([]string, error) {
+	var payload []string
+	if format == FormatText {
+		scanner := bufio.NewScanner(bytes.NewReader(buf))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			payload = append(payload, line)
+		}
+	} else {
+		schema := &RuleSchema{}
+		if err := yaml.Unmarshal(buf, schema); err != nil {
+			return nil, err
+		}
+		payload = schema.Payload
+	}
+
+	if len(payload) == 0 {
+		return nil, errNoRules
+	}
+	return payload, nil
+}
+
+func newRuleSet(behavior types.RuleType, payload []string) (ruleSet, error) {
+	switch behavior {
+	case types.Domain:
+		tree := trie.New()
+		for _, domain := range payload {
+			if err := tree.Insert(strings.ToLower(domain), true); err != nil {
+				return nil, fmt.Errorf("invalid domain %s: %w", domain, err)
+			}
+		}
+		return &domainSet{tree: tree, count: len(payload)}, nil
+	case types.IPCIDR:
+		prefixes := make([]netip.Prefix, 0, len(payload))
+		for _, cidr := range payload {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ipcidr %s: %w", cidr, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		}
+		return &ipcidrSet{prefixes: prefixes}, nil
+	case types.Classical:
+		set := &classicalSet{}
+		for _, line := range payload {
+			rule, err := parseClassicalRule(line)
+			if err != nil {
+				return nil, err
+			}
+			set.rules = append(set.rules, rule)
+			set.resolveIP = set.resolveIP || rule.ShouldResolveIP()
+		}
+		return set, nil
+	default:
+		return nil, fmt.Errorf("unsupported behavior: %s", behavior)
+	}
+}
+
+// parseClassicalRule parses the rule in the format of the rules section without the proxy
+func parseClassicalRule(line string) (C.Rule, error) {
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid rule: %s", line)
+	}
+
+	tp := strings.ToUpper(fields[0])
+	switch C.RuleConfig(tp) {
+	case C.RuleConfigMatch, C.RuleConfigRuleSet:
+		return nil, fmt.Errorf("rule %s is not supported in rule providers", tp)
+	}
+	return R.ParseRule(tp, fields[1], "", fields[2:])
+}
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+	types "github.com/Dreamacro/clash/constant/provider"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRuleProvider(t *testing.T, behavior, format, content string) (types.RuleProvider, error) {
+	path := filepath.Join(t.TempDir(), "rules")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	pd, err := ParseRuleProvider("rules", map[string]any{
+		"type":     "file",
+		"behavior": behavior,
+		"path":     path,
+		"format":   format,
+	}, nil)
+	require.NoError(t, err)
+	return pd, pd.Initial()
+}
+
+func TestRuleProvider_Match(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		behavior  string
+		format    string
+		content   string
+		matched   []*C.Metadata
+		unmatched []*C.Metadata
+		resolveIP bool
+	}{
+		{
+			name:     "domain",
+			behavior: "domain",
+			content:  "payload:\n  - '+.example.com'\n  - 'Exact.test'\n",
+			matched: []*C.Metadata{
+				{Host: "example.com"},
+				{Host: "www.Example.com"},
+				{Host: "exact.test"},
+			},
+			unmatched: []*C.Metadata{
+				{Host: "www.exact.test"},
+				{DstIP: net.ParseIP("1.2.3.4")},
+			},
+		},
+		{
+			name:     "ipcidr text",
+			behavior: "ipcidr",
+			format:   "text",
+			content:  "# private\n10.0.0.0/8\n\nfd00::/8\n",
+			matched: []*C.Metadata{
+				{DstIP: net.ParseIP("10.1.2.3")},
+				{DstIP: net.ParseIP("::ffff:10.1.2.3")},
+				{DstIP: net.ParseIP("fd00::1")},
+			},
+			unmatched: []*C.Metadata{
+				{DstIP: net.ParseIP("11.0.0.1")},
+				{Host: "example.com"},
+			},
+			resolveIP: true,
+		},
+		{
+			name:     "classical",
+			behavior: "classical",
+			content:  "payload:\n  - DOMAIN-SUFFIX,example.com\n  - DOMAIN-KEYWORD,google\n  - IP-CIDR,192.168.0.0/16,no-resolve\n",
+			matched: []*C.Metadata{
+				{Host: "www.example.com"},
+				{Host: "www.google.com"},
+				{DstIP: net.ParseIP("192.168.1.1")},
+			},
+			unmatched: []*C.Metadata{
+				{Host: "example.org"},
+				{DstIP: net.ParseIP("10.0.0.1")},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pd, err := newTestRuleProvider(t, tt.behavior, tt.format, tt.content)
+			require.NoError(t, err)
+
+			for _, metadata := range tt.matched {
+				assert.True(t, pd.Match(metadata), metadata)
+			}
+			for _, metadata := range tt.unmatched {
+				assert.False(t, pd.Match(metadata), metadata)
+			}
+			assert.Equal(t, tt.resolveIP, pd.ShouldResolveIP())
+
+			rule := pd.AsRule("DIRECT")
+			assert.Equal(t, C.RuleSet, rule.RuleType())
+			assert.Equal(t, "rules", rule.Payload())
+			assert.True(t, rule.Match(tt.matched[0]))
+		})
+	}
+}
+
+func TestRuleProvider_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		behavior string
+		content  string
+	}{
+		{"empty", "domain", "payload: []\n"},
+		{"invalid ipcidr", "ipcidr", "payload:\n  - 10.0.0.1\n"},
+		{"invalid classical rule", "classical", "payload:\n  - example.com\n"},
+		{"MATCH in classical", "classical", "payload:\n  - MATCH,DIRECT\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestRuleProvider(t, tt.behavior, "", tt.content)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := ParseRuleProvider("rules", map[string]any{"type": "file", "behavior": "unknown", "path": "rules"}, nil)
+	assert.ErrorIs(t, err, errBehavior)
+
+	_, err = ParseRuleProvider("rules", map[string]any{"type": "file", "behavior": "domain", "path": "rules", "format": "sip008"}, nil)
+	assert.ErrorIs(t, err, errFormat)
+}
@@ -0,0 +1,547 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Dreamacro/clash/log"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Proxy provider content format
+const (
+	FormatAuto   = "auto"
+	FormatYAML   = "yaml"
+	FormatURI    = "uri"
+	FormatSIP008 = "sip008"
+)
+
+var (
+	errFormat      = errors.New("unsupported provider format")
+	errNoProxies   = errors.New("file must have a `proxies` field")
+	errUnsupported = errors.New("unsupported share link scheme")
+)
+
+// sip008Schema is the online configuration delivery format of shadowsocks
+// https://shadowsocks.org/doc/sip008.html
+type sip008Schema struct {
+	Version int `json:"version"`
+	Servers []struct {
+		Remarks    string `json:"remarks"`
+		Server     string `json:"server"`
+		ServerPort int    `json:"server_port"`
+		Password   string `json:"password"`
+		Method     string `json:"method"`
+		Plugin     string `json:"plugin"`
+		PluginOpts string `json:"plugin_opts"`
+	} `json:"servers"`
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case "", FormatAuto, FormatYAML, FormatURI, FormatSIP008:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", errFormat, format)
+	}
+}
+
+// parseProxySchema converts the provider content into the proxy mappings
+// consumed by adapter.ParseProxy
+func parseProxySchema(buf []byte, format string) ([]map[string]any, error) {
+	switch format {
+	case FormatYAML:
+		return parseYAML(buf)
+	case FormatURI:
+		return parseURIList(buf)
+	case FormatSIP008:
+		return parseSIP008(buf)
+	case "", FormatAuto:
+	default:
+		return nil, fmt.Errorf("%w: %s", errFormat, format)
+	}
+
+	trimmed := bytes.TrimSpace(buf)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		if proxies, err := parseSIP008(trimmed); err == nil {
+			return proxies, nil
+		}
+	}
+
+	proxies, err := parseYAML(buf)
+	if err == nil {
+		return proxies, nil
+	}
+
+	if uriProxies, uriErr := parseURIList(buf); uriErr == nil {
+		return uriProxies, nil
+	}
+
+	return nil, err
+}
+
+func parseYAML(buf []byte) ([]map[string]any, error) {
+	schema := &ProxySchema{}
+	if err := yaml.Unmarshal(buf, schema); err != nil {
+		return nil, err
+	}
+
+	if schema.Proxies == nil {
+		return nil, errNoProxies
+	}
+
+	return schema.Proxies, nil
+}
+
+func parseSIP008(buf []byte) ([]map[string]any, error) {
+	schema := &sip008Schema{}
+	if err := json.Unmarshal(buf, schema); err != nil {
+		return nil, err
+	}
+
+	if schema.Servers == nil {
+		return nil, errors.New("file must have a `servers` field")
+	}
+
+	proxies := make([]map[string]any, 0, len(schema.Servers))
+	for _, server := range schema.Servers {
+		name := server.Remarks
+		if name == "" {
+			name = net.JoinHostPort(server.Server, strconv.Itoa(server.ServerPort))
+		}
+
+		mapping := map[string]any{
+			"name":     name,
+			"type":     "ss",
+			"server":   server.Server,
+			"port":     server.ServerPort,
+			"cipher":   server.Method,
+			"password": server.Password,
+			"udp":      true,
+		}
+		if server.Plugin != "" {
+			if err := setSSPlugin(mapping, server.Plugin+";"+server.PluginOpts); err != nil {
+				log.Warnln("[Provider] skip SIP008 server %s: %s", name, err.Error())
+				continue
+			}
+		}
+		proxies = append(proxies, mapping)
+	}
+
+	return proxies, nil
+}
+
+// parseURIList parses share links separated by new lines, the whole list
+// may be encoded in base64.
+func parseURIList(buf []byte) ([]map[string]any, error) {
+	content := string(bytes.TrimSpace(buf))
+	if !strings.Contains(content, "://") {
+		decoded, err := decodeBase64(content)
+		if err != nil {
+			return nil, errors.New("content is neither share links nor base64 encoded share links")
+		}
+		content = decoded
+	}
+
+	proxies := []map[string]any{}
+	for idx, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		mapping, err := parseURI(line)
+		if err != nil {
+			// the links carry the credentials, only the scheme is logged
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			scheme, _, _ := strings.Cut(line, "://")
+			log.Warnln("[Provider] skip share link %d (%s): %s", idx+1, scheme, err.Error())
+			continue
+		}
+		proxies = append(proxies, mapping)
+	}
+
+	if len(proxies) == 0 {
+		return nil, errors.New("doesn't have any valid share link")
+	}
+
+	return proxies, nil
+}
+
+func parseURI(uri string) (map[string]any, error) {
+	scheme, _, found := strings.Cut(uri, "://")
+	if !found {
+		return nil, errors.New("invalid share link")
+	}
+
+	switch strings.ToLower(scheme) {
+	case "ss":
+		return parseShadowsocksURI(uri)
+	case "vmess":
+		return parseVmessURI(uri)
+	case "trojan":
+		return parseTrojanURI(uri)
+	case "socks", "socks5":
+		return parseSocksURI(uri)
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupported, scheme)
+	}
+}
+
+// parseShadowsocksURI supports both SIP002 and the legacy base64 encoded format
+// https://shadowsocks.org/doc/sip002.html
+func parseShadowsocksURI(uri string) (map[string]any, error) {
+	// legacy: ss://base64(method:password@host:port)#tag
+	body, fragment, _ := strings.Cut(uri[len("ss://"):], "#")
+	if !strings.Contains(body, "@") {
+		decoded, err := decodeBase64(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shadowsocks link: %w", err)
+		}
+		uri = "ss://" + decoded
+		if fragment != "" {
+			uri += "#" + fragment
+		}
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.User == nil {
+		return nil, errors.New("invalid shadowsocks link: missing userinfo")
+	}
+
+	method := u.User.Username()
+	password, ok := u.User.Password()
+	if !ok {
+		decoded, err := decodeBase64(u.User.Username())
+		if err != nil {
+			return nil, fmt.Errorf("invalid shadowsocks userinfo: %w", err)
+		}
+		method, password, ok = strings.Cut(decoded, ":")
+		if !ok {
+			return nil, errors.New("invalid shadowsocks userinfo")
+		}
+	}
+
+	port, err := uriPort(u)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := map[string]any{
+		"name":     uriName(u),
+		"type":     "ss",
+		"server":   u.Hostname(),
+		"port":     port,
+		"cipher":   method,
+		"password": password,
+		"udp":      true,
+	}
+	if plugin := u.Query().Get("plugin"); plugin != "" {
+		if err := setSSPlugin(mapping, plugin); err != nil {
+			return nil, err
+		}
+	}
+
+	return mapping, nil
+}
+
+// setSSPlugin converts a SIP003 plugin string like
+// `obfs-local;obfs=http;obfs-host=example.com` into plugin and plugin-opts,
+// the plugins not supported by the shadowsocks outbound are rejected
+func setSSPlugin(mapping map[string]any, plugin string) error {
+	parts := strings.Split(plugin, ";")
+	opts := map[string]any{}
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			opts[key] = true
+			continue
+		}
+		opts[key] = value
+	}
+
+	switch parts[0] {
+	case "obfs-local", "simple-obfs":
+		pluginOpts := map[string]any{}
+		if mode, ok := opts["obfs"]; ok {
+			pluginOpts["mode"] = mode
+		}
+		if host, ok := opts["obfs-host"]; ok {
+			pluginOpts["host"] = host
+		}
+		mapping["plugin"] = "obfs"
+		mapping["plugin-opts"] = pluginOpts
+	case "v2ray-plugin":
+		pluginOpts := map[string]any{
+			"mode": "websocket",
+		}
+		for _, key := range []string{"mode", "host", "path", "tls"} {
+			if value, ok := opts[key]; ok {
+				pluginOpts[key] = value
+			}
+		}
+		mapping["plugin"] = "v2ray-plugin"
+		mapping["plugin-opts"] = pluginOpts
+	default:
+		return fmt.Errorf("unsupported shadowsocks plugin %s", parts[0])
+	}
+	return nil
+}
+
+// vmessShare is the v2rayN share link format
+// https://github.com/2dust/v2rayN/wiki/分享链接格式说明(ver-2)
+type vmessShare struct {
+	PS   string          `json:"ps"`
+	Add  string          `json:"add"`
+	Port json.RawMessage `json:"port"`
+	ID   string          `json:"id"`
+	Aid  json.RawMessage `json:"aid"`
+	Scy  string          `json:"scy"`
+	Net  string          `json:"net"`
+	Type string          `json:"type"`
+	Host string          `json:"host"`
+	Path string          `json:"path"`
+	TLS  string          `json:"tls"`
+	SNI  string          `json:"sni"`
+}
+
+func parseVmessURI(uri string) (map[string]any, error) {
+	decoded, err := decodeBase64(uri[len("vmess://"):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid vmess link: %w", err)
+	}
+
+	share := &vmessShare{}
+	if err := json.Unmarshal([]byte(decoded), share); err != nil {
+		return nil, fmt.Errorf("invalid vmess link: %w", err)
+	}
+
+	port, err := jsonNumber(share.Port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vmess port: %w", err)
+	}
+	alterID, _ := jsonNumber(share.Aid)
+
+	cipher := share.Scy
+	if cipher == "" {
+		cipher = "auto"
+	}
+
+	name := share.PS
+	if name == "" {
+		name = net.JoinHostPort(share.Add, strconv.Itoa(port))
+	}
+
+	mapping := map[string]any{
+		"name":    name,
+		"type":    "vmess",
+		"server":  share.Add,
+		"port":    port,
+		"uuid":    share.ID,
+		"alterId": alterID,
+		"cipher":  cipher,
+		"udp":     true,
+	}
+
+	if share.TLS == "tls" {
+		mapping["tls"] = true
+		if share.SNI != "" {
+			mapping["servername"] = share.SNI
+		}
+	}
+
+	switch share.Net {
+	case "ws":
+		wsOpts := map[string]any{"path": share.Path}
+		if share.Host != "" {
+			wsOpts["headers"] = map[string]any{"Host": share.Host}
+		}
+		mapping["network"] = "ws"
+		mapping["ws-opts"] = wsOpts
+	case "h2":
+		h2Opts := map[string]any{"path": share.Path}
+		if share.Host != "" {
+			h2Opts["host"] = strings.Split(share.Host, ",")
+		}
+		mapping["network"] = "h2"
+		mapping["h2-opts"] = h2Opts
+	case "http":
+		httpOpts := map[string]any{}
+		if share.Path != "" {
+			httpOpts["path"] = strings.Split(share.Path, ",")
+		}
+		if share.Host != "" {
+			httpOpts["headers"] = map[string]any{"Host": strings.Split(share.Host, ",")}
+		}
+		mapping["network"] = "http"
+		mapping["http-opts"] = httpOpts
+	case "grpc":
+		mapping["network"] = "grpc"
+		mapping["grpc-opts"] = map[string]any{"grpc-service-name": share.Path}
+	case "tcp", "":
+		// http obfuscation over tcp uses the http network
+		if share.Type == "http" {
+			httpOpts := map[string]any{}
+			if share.Path != "" {
+				httpOpts["path"] = strings.Split(share.Path, ",")
+			}
+			if share.Host != "" {
+				httpOpts["headers"] = map[string]any{"Host": strings.Split(share.Host, ",")}
+			}
+			mapping["network"] = "http"
+			mapping["http-opts"] = httpOpts
+		}
+	default:
+		return nil, fmt.Errorf("unsupported vmess network: %s", share.Net)
+	}
+
+	return mapping, nil
+}
+
+func parseTrojanURI(uri string) (map[string]any, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.User == nil {
+		return nil, errors.New("invalid trojan link: missing password")
+	}
+
+	port, err := uriPort(u)
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	mapping := map[string]any{
+		"name":     uriName(u),
+		"type":     "trojan",
+		"server":   u.Hostname(),
+		"port":     port,
+		"password": u.User.Username(),
+		"udp":      true,
+	}
+
+	if sni := query.Get("sni"); sni != "" {
+		mapping["sni"] = sni
+	} else if peer := query.Get("peer"); peer != "" {
+		mapping["sni"] = peer
+	}
+
+	if alpn := query.Get("alpn"); alpn != "" {
+		mapping["alpn"] = strings.Split(alpn, ",")
+	}
+
+	if insecure, _ := strconv.ParseBool(query.Get("allowInsecure")); insecure {
+		mapping["skip-cert-verify"] = true
+	}
+
+	switch network := query.Get("type"); network {
+	case "ws":
+		wsOpts := map[string]any{"path": query.Get("path")}
+		if host := query.Get("host"); host != "" {
+			wsOpts["headers"] = map[string]any{"Host": host}
+		}
+		mapping["network"] = "ws"
+		mapping["ws-opts"] = wsOpts
+	case "grpc":
+		mapping["network"] = "grpc"
+		mapping["grpc-opts"] = map[string]any{"grpc-service-name": query.Get("serviceName")}
+	case "tcp", "":
+	default:
+		return nil, fmt.Errorf("unsupported trojan network: %s", network)
+	}
+
+	return mapping, nil
+}
+
+func parseSocksURI(uri string) (map[string]any, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := uriPort(u)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := map[string]any{
+		"name":   uriName(u),
+		"type":   "socks5",
+		"server": u.Hostname(),
+		"port":   port,
+	}
+
+	if u.User != nil {
+		username := u.User.Username()
+		password, ok := u.User.Password()
+		// the userinfo of socks:// is base64 encoded by v2rayN
+		if !ok {
+			if decoded, err := decodeBase64(username); err == nil {
+				username, password, _ = strings.Cut(decoded, ":")
+			}
+		}
+		mapping["username"] = username
+		mapping["password"] = password
+	}
+
+	return mapping, nil
+}
+
+func uriName(u *url.URL) string {
+	if u.Fragment != "" {
+		return u.Fragment
+	}
+	return u.Host
+}
+
+func uriPort(u *url.URL) (int, error) {
+	port, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port: %s", u.Port())
+	}
+	return int(port), nil
+}
+
+func jsonNumber(raw json.RawMessage) (int, error) {
+	str := strings.Trim(string(raw), `"`)
+	if str == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(str)
+}
+
+func decodeBase64(s string) (string, error) {
+	s = strings.Join(strings.Fields(s), "")
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	} {
+		if decoded, err := encoding.DecodeString(s); err == nil {
+			return string(decoded), nil
+		}
+	}
+	return "", errors.New("invalid base64 content")
+}
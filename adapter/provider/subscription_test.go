@@ -0,0 +1,149 @@
+package provider
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter"
+	"github.com/Dreamacro/clash/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscription_YAML(t *testing.T) {
+	buf := []byte(`
+proxies:
+  - name: ss1
+    type: ss
+    server: 127.0.0.1
+    port: 443
+    cipher: aes-128-gcm
+    password: password
+`)
+
+	proxies, err := parseProxySchema(buf, FormatAuto)
+	require.NoError(t, err)
+	assert.Len(t, proxies, 1)
+	assert.Equal(t, "ss1", proxies[0]["name"])
+
+	_, err = parseProxySchema([]byte("foo: bar"), FormatYAML)
+	assert.ErrorIs(t, err, errNoProxies)
+}
+
+func TestSubscription_Base64URIList(t *testing.T) {
+	links := "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-128-gcm:password")) + "@127.0.0.1:8388/?plugin=obfs-local%3Bobfs%3Dhttp%3Bobfs-host%3Dexample.com#ss%20sip002\n" +
+		"ss://" + base64.StdEncoding.EncodeToString([]byte("aes-256-gcm:pass@127.0.0.2:8389")) + "#ss-legacy\n" +
+		"trojan://password@example.com:443?sni=sni.example.com&allowInsecure=1&type=ws&path=%2Fws&host=cdn.example.com#trojan\n" +
+		"socks://" + base64.StdEncoding.EncodeToString([]byte("user:pass")) + "@127.0.0.3:1080#socks\n" +
+		"vmess://" + base64.StdEncoding.EncodeToString([]byte(`{"v":"2","ps":"vmess","add":"example.com","port":"443","id":"b831381d-6324-4d53-ad4f-8cda48b30811","aid":"0","net":"ws","host":"cdn.example.com","path":"/path","tls":"tls"}`)) + "\n" +
+		"vless://unsupported@example.com:443#vless\n" +
+		"ss://aes-128-gcm:password@127.0.0.1:8388/?plugin=kcptun%3Bmode%3Dfast#unknown%20plugin\n"
+
+	buf := []byte(base64.StdEncoding.EncodeToString([]byte(links)))
+	proxies, err := parseProxySchema(buf, FormatAuto)
+	require.NoError(t, err)
+	require.Len(t, proxies, 5)
+
+	assert.Equal(t, "ss sip002", proxies[0]["name"])
+	assert.Equal(t, "aes-128-gcm", proxies[0]["cipher"])
+	assert.Equal(t, "password", proxies[0]["password"])
+	assert.Equal(t, "obfs", proxies[0]["plugin"])
+	assert.Equal(t, map[string]any{"mode": "http", "host": "example.com"}, proxies[0]["plugin-opts"])
+
+	assert.Equal(t, "ss-legacy", proxies[1]["name"])
+	assert.Equal(t, "127.0.0.2", proxies[1]["server"])
+	assert.Equal(t, 8389, proxies[1]["port"])
+
+	assert.Equal(t, "trojan", proxies[2]["type"])
+	assert.Equal(t, "sni.example.com", proxies[2]["sni"])
+	assert.Equal(t, true, proxies[2]["skip-cert-verify"])
+	assert.Equal(t, "ws", proxies[2]["network"])
+
+	assert.Equal(t, "socks5", proxies[3]["type"])
+	assert.Equal(t, "user", proxies[3]["username"])
+	assert.Equal(t, "pass", proxies[3]["password"])
+
+	assert.Equal(t, "vmess", proxies[4]["name"])
+	assert.Equal(t, 443, proxies[4]["port"])
+	assert.Equal(t, true, proxies[4]["tls"])
+
+	for _, mapping := range proxies {
+		_, err := adapter.ParseProxy(mapping)
+		assert.NoError(t, err, mapping["name"])
+	}
+}
+
+func TestSubscription_SIP008(t *testing.T) {
+	buf := []byte(`{
+  "version": 1,
+  "servers": [
+    {
+      "id": "27b8a625-4f4b-4428-9f0f-8a2317db7c79",
+      "remarks": "Name of the server",
+      "server": "example.com",
+      "server_port": 8388,
+      "password": "example",
+      "method": "chacha20-ietf-poly1305",
+      "plugin": "v2ray-plugin",
+      "plugin_opts": "host=example.com;path=/ws"
+    },
+    {
+      "remarks": "Unknown plugin",
+      "server": "example.com",
+      "server_port": 8389,
+      "password": "example",
+      "method": "chacha20-ietf-poly1305",
+      "plugin": "kcptun"
+    }
+  ]
+}`)
+
+	proxies, err := parseProxySchema(buf, FormatAuto)
+	require.NoError(t, err)
+	require.Len(t, proxies, 1)
+	assert.Equal(t, "Name of the server", proxies[0]["name"])
+	assert.Equal(t, "v2ray-plugin", proxies[0]["plugin"])
+
+	_, err = adapter.ParseProxy(proxies[0])
+	assert.NoError(t, err)
+}
+
+func TestSubscription_Format(t *testing.T) {
+	assert.NoError(t, checkFormat(""))
+	assert.NoError(t, checkFormat(FormatURI))
+	assert.ErrorIs(t, checkFormat("clash"), errFormat)
+
+	_, err := parseProxySchema([]byte("proxies: []"), FormatSIP008)
+	assert.Error(t, err)
+}
+
+func TestSubscription_SkippedLinkLog(t *testing.T) {
+	sub := log.Subscribe()
+	defer log.UnSubscribe(sub)
+
+	links := "trojan://secret-password@example.com:443#trojan\n" +
+		"trojan://secret-password@[::1#broken\n" +
+		"ss://aes-128-gcm:secret-password@127.0.0.1:8388/?plugin=kcptun#unknown%20plugin\n"
+	_, err := parseProxySchema([]byte(links), FormatURI)
+	require.NoError(t, err)
+
+	// the skipped links are logged without their credentials, the logs are delivered
+	// asynchronously so the ones of the other tests may arrive in between
+	expected := []string{"skip share link 2 (trojan)", "skip share link 3 (ss)"}
+	timeout := time.After(time.Second)
+	for len(expected) > 0 {
+		select {
+		case elm := <-sub:
+			event := elm.(log.Event)
+			assert.NotContains(t, event.Payload, "secret-password")
+			if strings.Contains(event.Payload, expected[0]) {
+				expected = expected[1:]
+			}
+		case <-timeout:
+			t.Fatalf("log not received: %v", expected)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// SubscriptionInfo is the quota of a subscription, parsed from the
+// `Subscription-Userinfo` response header, e.g.
+// `upload=455727941; download=6174315083; total=1073741824000; expire=1671815872`
+type SubscriptionInfo struct {
+	Upload   int64 `json:"upload"`
+	Download int64 `json:"download"`
+	Total    int64 `json:"total"`
+	// Expire is a unix timestamp in seconds, 0 means never expire
+	Expire int64 `json:"expire"`
+}
+
+func parseSubscriptionInfo(header string) (*SubscriptionInfo, error) {
+	info := &SubscriptionInfo{}
+	found := false
+	for _, field := range strings.Split(header, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			continue
+		}
+
+		// some providers send floating point numbers
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "upload":
+			info.Upload = int64(number)
+		case "download":
+			info.Download = int64(number)
+		case "total":
+			info.Total = int64(number)
+		case "expire":
+			info.Expire = int64(number)
+		default:
+			continue
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, errors.New("invalid subscription userinfo")
+	}
+
+	return info, nil
+}
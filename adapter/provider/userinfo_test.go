@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestSubscriptionInfo_Parse(t *testing.T) {
+	info, err := parseSubscriptionInfo("upload=455727941; download=6174315083; total=1073741824000; expire=1671815872")
+	require.NoError(t, err)
+	assert.Equal(t, &SubscriptionInfo{
+		Upload:   455727941,
+		Download: 6174315083,
+		Total:    1073741824000,
+		Expire:   1671815872,
+	}, info)
+
+	info, err = parseSubscriptionInfo("upload=1.5e3;download=0;total=10;expire=")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1500), info.Upload)
+	assert.Equal(t, int64(0), info.Expire)
+
+	_, err = parseSubscriptionInfo("foo=bar")
+	assert.Error(t, err)
+}
+
+func TestSubscriptionInfo_Provider(t *testing.T) {
+	C.SetHomeDir(t.TempDir())
+
+	userinfo := atomic.NewString("upload=1024; download=2048; total=1073741824; expire=1671815872")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Subscription-Userinfo", userinfo.Load())
+		w.Write([]byte("proxies:\n  - {name: direct, type: socks5, server: 127.0.0.1, port: 1080}\n"))
+	}))
+	defer ts.Close()
+
+	newProvider := func() *ProxySetProvider {
+		vehicle := NewHTTPVehicle(ts.URL, filepath.Join(t.TempDir(), "provider"), nil, "", nil)
+		hc := NewHealthCheck([]C.Proxy{}, "", 0, true)
+		pd, err := NewProxySetProvider("userinfo", 0, "", "", "", FormatAuto, Override{}, vehicle, hc)
+		require.NoError(t, err)
+		return pd
+	}
+
+	pd := newProvider()
+	assert.Nil(t, pd.SubscriptionInfo())
+	require.NoError(t, pd.Initial())
+	expected := &SubscriptionInfo{Upload: 1024, Download: 2048, Total: 1073741824, Expire: 1671815872}
+	assert.Equal(t, expected, pd.SubscriptionInfo())
+
+	buf, err := json.Marshal(pd)
+	require.NoError(t, err)
+	marshalled := struct {
+		Name             string            `json:"name"`
+		SubscriptionInfo *SubscriptionInfo `json:"subscriptionInfo"`
+	}{}
+	require.NoError(t, json.Unmarshal(buf, &marshalled))
+	assert.Equal(t, "userinfo", marshalled.Name)
+	assert.Equal(t, expected, marshalled.SubscriptionInfo)
+	assert.Contains(t, string(buf), `"subscriptionInfo":{"upload":1024,"download":2048,"total":1073741824,"expire":1671815872}`)
+
+	// the info is restored from the cache file before the first fetch
+	assert.Equal(t, expected, newProvider().SubscriptionInfo())
+
+	// the invalid header doesn't override the last info
+	userinfo.Store("foo=bar")
+	_, _, err = pd.Fetcher.Update()
+	require.NoError(t, err)
+	assert.Equal(t, expected, pd.SubscriptionInfo())
+}
@@ -2,14 +2,18 @@ package provider
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Dreamacro/clash/component/dialer"
+	C "github.com/Dreamacro/clash/constant"
 	types "github.com/Dreamacro/clash/constant/provider"
 )
 
@@ -34,8 +38,22 @@ func NewFileVehicle(path string) *FileVehicle {
 }
 
 type HTTPVehicle struct {
-	url  string
-	path string
+	url     string
+	path    string
+	header  http.Header
+	proxy   string
+	proxies map[string]C.Proxy
+
+	// validators of the last accepted response for conditional requests, the ones of
+	// the last response are pending until the fetcher accepts its content
+	mux                 sync.Mutex
+	etag                string
+	lastModified        string
+	pendingETag         string
+	pendingLastModified string
+
+	// onHeader is called with the header of every successful response
+	onHeader func(header http.Header)
 }
 
 func (h *HTTPVehicle) Type() types.VehicleType {
@@ -60,11 +78,26 @@ func (h *HTTPVehicle) Read() ([]byte, error) {
 		return nil, err
 	}
 
+	for key, values := range h.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
 	if user := uri.User; user != nil {
 		password, _ := user.Password()
 		req.SetBasicAuth(user.Username(), password)
 	}
 
+	h.mux.Lock()
+	if h.etag != "" {
+		req.Header.Set("If-None-Match", h.etag)
+	}
+	if h.lastModified != "" {
+		req.Header.Set("If-Modified-Since", h.lastModified)
+	}
+	h.mux.Unlock()
+
 	req = req.WithContext(ctx)
 
 	transport := &http.Transport{
@@ -73,26 +106,103 @@ func (h *HTTPVehicle) Read() ([]byte, error) {
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
-		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
-			return dialer.DialContext(ctx, network, address)
-		},
+		DialContext:           h.dialContext,
 	}
 
 	client := http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusNotModified && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if h.onHeader != nil {
+		h.onHeader(resp.Header)
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, types.ErrNotModified
+	}
+
 	buf, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
+	h.mux.Lock()
+	h.pendingETag = resp.Header.Get("ETag")
+	h.pendingLastModified = resp.Header.Get("Last-Modified")
+	h.mux.Unlock()
+
 	return buf, nil
 }
 
-func NewHTTPVehicle(url string, path string) *HTTPVehicle {
-	return &HTTPVehicle{url, path}
+// accept implements conditionalVehicle, the content failed to be parsed is requested
+// again without the validators of its response
+func (h *HTTPVehicle) accept() {
+	h.mux.Lock()
+	h.etag = h.pendingETag
+	h.lastModified = h.pendingLastModified
+	h.mux.Unlock()
+}
+
+// dialContext dials directly, or through the proxy when it is set
+func (h *HTTPVehicle) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if h.proxy == "" {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	proxy, exist := h.proxies[h.proxy]
+	if !exist {
+		return nil, fmt.Errorf("proxy %s not found", h.proxy)
+	}
+
+	metadata, err := addrToMetadata(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return proxy.DialContext(ctx, metadata)
+}
+
+// NewHTTPVehicle returns a HTTPVehicle, the content is fetched through
+// proxies[proxy] if proxy is not empty
+func NewHTTPVehicle(url string, path string, header http.Header, proxy string, proxies map[string]C.Proxy) *HTTPVehicle {
+	return &HTTPVehicle{
+		url:     url,
+		path:    path,
+		header:  header,
+		proxy:   proxy,
+		proxies: proxies,
+	}
+}
+
+func addrToMetadata(address string) (*C.Metadata, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %s", port)
+	}
+
+	metadata := &C.Metadata{
+		NetWork: C.TCP,
+		DstPort: C.Port(p),
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		metadata.DstIP = ip
+	} else {
+		metadata.Host = host
+	}
+
+	return metadata, nil
 }
@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapter"
+	"github.com/Dreamacro/clash/adapter/outbound"
+	"github.com/Dreamacro/clash/component/dialer"
+	C "github.com/Dreamacro/clash/constant"
+	types "github.com/Dreamacro/clash/constant/provider"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// conditionalServer serves the content with its ETag and Last-Modified, and answers
+// 304 to the conditional requests of the same content
+type conditionalServer struct {
+	mux          sync.Mutex
+	content      string
+	etag         string
+	lastModified string
+	conditions   []string
+}
+
+func (s *conditionalServer) set(content, etag, lastModified string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.content, s.etag, s.lastModified = content, etag, lastModified
+}
+
+// lastCondition returns the If-None-Match and If-Modified-Since of the last request
+func (s *conditionalServer) lastCondition() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.conditions[len(s.conditions)-1]
+}
+
+func (s *conditionalServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	condition := r.Header.Get("If-None-Match") + "|" + r.Header.Get("If-Modified-Since")
+	s.conditions = append(s.conditions, condition)
+	if condition == s.etag+"|"+s.lastModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Header().Set("Last-Modified", s.lastModified)
+	w.Write([]byte(s.content))
+}
+
+func TestHTTPVehicle_ConditionalRequest(t *testing.T) {
+	server := &conditionalServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	vehicle := NewHTTPVehicle(ts.URL, filepath.Join(t.TempDir(), "provider"), nil, "", nil)
+	parser := func(buf []byte) (any, error) {
+		if string(buf) == "broken" {
+			return nil, errors.New("broken content")
+		}
+		return string(buf), nil
+	}
+	fetcher := NewFetcher("conditional", 0, vehicle, parser, nil)
+
+	server.set("v1", `"v1"`, "Mon, 02 Jan 2006 15:04:05 GMT")
+	elm, err := fetcher.Initial()
+	require.NoError(t, err)
+	assert.Equal(t, "v1", elm)
+	assert.Equal(t, "|", server.lastCondition())
+
+	// the unmodified content isn't transferred again
+	_, same, err := fetcher.Update()
+	require.NoError(t, err)
+	assert.True(t, same)
+	assert.Equal(t, `"v1"|Mon, 02 Jan 2006 15:04:05 GMT`, server.lastCondition())
+
+	// the validators of the broken content aren't sent, so it's fetched again
+	server.set("broken", `"v2"`, "Tue, 03 Jan 2006 15:04:05 GMT")
+	_, _, err = fetcher.Update()
+	require.Error(t, err)
+	_, _, err = fetcher.Update()
+	require.Error(t, err)
+	assert.Equal(t, `"v1"|Mon, 02 Jan 2006 15:04:05 GMT`, server.lastCondition())
+
+	server.set("v3", `"v3"`, "Wed, 04 Jan 2006 15:04:05 GMT")
+	elm, same, err = fetcher.Update()
+	require.NoError(t, err)
+	assert.False(t, same)
+	assert.Equal(t, "v3", elm)
+
+	_, same, err = fetcher.Update()
+	require.NoError(t, err)
+	assert.True(t, same)
+	assert.Equal(t, `"v3"|Wed, 04 Jan 2006 15:04:05 GMT`, server.lastCondition())
+}
+
+func TestHTTPVehicle_Header(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		w.Write([]byte("content"))
+	}))
+	defer ts.Close()
+
+	header := http.Header{
+		"User-Agent": {"clash-test"},
+		"X-Token":    {"a", "b"},
+	}
+	url := "http://alice:password@" + ts.Listener.Addr().String() + "/sub"
+	vehicle := NewHTTPVehicle(url, filepath.Join(t.TempDir(), "provider"), header, "", nil)
+
+	buf, err := vehicle.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(buf))
+
+	r := <-received
+	assert.Equal(t, "clash-test", r.Header.Get("User-Agent"))
+	assert.Equal(t, []string{"a", "b"}, r.Header.Values("X-Token"))
+	user, pass, ok := r.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "alice", user)
+	assert.Equal(t, "password", pass)
+}
+
+// countingProxy counts the connections dialed through it
+type countingProxy struct {
+	C.Proxy
+	dials *atomic.Int32
+}
+
+func (p *countingProxy) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (C.Conn, error) {
+	p.dials.Inc()
+	return p.Proxy.DialContext(ctx, metadata, opts...)
+}
+
+func TestHTTPVehicle_Proxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer ts.Close()
+
+	proxy := &countingProxy{Proxy: adapter.NewProxy(outbound.NewDirect()), dials: atomic.NewInt32(0)}
+	proxies := map[string]C.Proxy{"relay": proxy}
+
+	vehicle := NewHTTPVehicle(ts.URL, filepath.Join(t.TempDir(), "provider"), nil, "relay", proxies)
+	assert.Equal(t, types.HTTP, vehicle.Type())
+	buf, err := vehicle.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(buf))
+	assert.Equal(t, int32(1), proxy.dials.Load())
+
+	vehicle = NewHTTPVehicle(ts.URL, filepath.Join(t.TempDir(), "provider"), nil, "missing", proxies)
+	_, err = vehicle.Read()
+	assert.ErrorContains(t, err, "proxy missing not found")
+}
@@ -198,6 +198,29 @@ func (c *LruCache) Delete(key any) {
 	c.mu.Unlock()
 }
 
+// Range calls f sequentially for each element from the least recently used with its expires,
+// iteration stops if f returns false. f must not call the methods of the cache.
+func (c *LruCache) Range(f func(key any, value any, expires time.Time) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for le := c.lru.Front(); le != nil; le = le.Next() {
+		e := le.Value.(*entry)
+		if !f(e.key, e.value, time.Unix(e.expires, 0)) {
+			return
+		}
+	}
+}
+
+// Clear removes all elements, the evict callback is not called
+func (c *LruCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru = list.New()
+	c.cache = make(map[any]*list.Element)
+}
+
 func (c *LruCache) maybeDeleteOldest() {
 	if !c.staleReturn && c.maxAge > 0 {
 		now := time.Now().Unix()
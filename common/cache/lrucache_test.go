@@ -181,3 +181,33 @@ func TestCloneTo(t *testing.T) {
 	n.Set("5", 5)
 	assert.False(t, n.Exist("1"))
 }
+
+func TestRange(t *testing.T) {
+	c := New(WithSize(10))
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Set("3", 3)
+	c.Get("1")
+
+	keys := []any{}
+	c.Range(func(key any, value any, expires time.Time) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	assert.Equal(t, []any{"2", "3"}, keys)
+}
+
+func TestClear(t *testing.T) {
+	evicted := 0
+	c := New(WithEvict(func(key any, value any) { evicted++ }))
+	c.Set("1", 1)
+	c.Set("2", 2)
+
+	c.Clear()
+	assert.False(t, c.Exist("1"))
+	assert.False(t, c.Exist("2"))
+	assert.Equal(t, 0, evicted)
+
+	c.Set("3", 3)
+	assert.True(t, c.Exist("3"))
+}
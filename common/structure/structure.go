@@ -80,6 +80,8 @@ func (d *Decoder) decode(name string, data any, val reflect.Value) error {
 		return d.setInterface(name, data, val)
 	case reflect.Struct:
 		return d.decodeStruct(name, data, val)
+	case reflect.Ptr:
+		return d.decodePtr(name, data, val)
 	default:
 		return fmt.Errorf("type %s not support", val.Kind().String())
 	}
@@ -144,6 +146,16 @@ func (d *Decoder) decodeBool(name string, data any, val reflect.Value) (err erro
 	return err
 }
 
+func (d *Decoder) decodePtr(name string, data any, val reflect.Value) error {
+	elem := reflect.New(val.Type().Elem())
+	if err := d.decode(name, data, elem.Elem()); err != nil {
+		return err
+	}
+
+	val.Set(elem)
+	return nil
+}
+
 func (d *Decoder) decodeSlice(name string, data any, val reflect.Value) error {
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	valType := val.Type()
@@ -179,3 +179,23 @@ func TestStructure_SliceNilValueComplex(t *testing.T) {
 	err = decoder.Decode(rawMap, ss)
 	assert.NotNil(t, err)
 }
+
+func TestStructure_Pointer(t *testing.T) {
+	type Pointer struct {
+		Foo *int    `test:"foo,omitempty"`
+		Bar *string `test:"bar,omitempty"`
+		Baz *bool   `test:"baz,omitempty"`
+	}
+
+	rawMap := map[string]any{
+		"foo": 1,
+		"baz": false,
+	}
+
+	s := &Pointer{}
+	err := decoder.Decode(rawMap, s)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, *s.Foo)
+	assert.Nil(t, s.Bar)
+	assert.False(t, *s.Baz)
+}
@@ -1,14 +1,54 @@
 package auth
 
 import (
+	"errors"
 	"sync"
 )
 
+// ErrDenied is returned by the authenticators denying the user
+var ErrDenied = errors.New("user denied")
+
 type Authenticator interface {
 	Verify(user string, pass string) bool
 	Users() []string
 }
 
+// ProxyAuthenticator is an Authenticator deciding the proxy of the authenticated users
+type ProxyAuthenticator interface {
+	Authenticator
+	// VerifyProxy verifies the user, the connections of the user are sent to
+	// the returned proxy if it's not empty. It returns ErrDenied if the user is
+	// denied, or the other errors if the user can't be verified for now
+	VerifyProxy(user string, pass string) (proxy string, err error)
+}
+
+// Session is a user authenticated by an inbound
+type Session struct {
+	User  string
+	Proxy string
+}
+
+// Authenticate verifies the user with the authenticator, it returns a nil session if the
+// authenticator is nil, and ErrDenied if the user is denied
+func Authenticate(au Authenticator, user string, pass string) (*Session, error) {
+	if au == nil {
+		return nil, nil
+	}
+
+	if pa, ok := au.(ProxyAuthenticator); ok {
+		proxy, err := pa.VerifyProxy(user, pass)
+		if err != nil {
+			return nil, err
+		}
+		return &Session{User: user, Proxy: proxy}, nil
+	}
+
+	if !au.Verify(user, pass) {
+		return nil, ErrDenied
+	}
+	return &Session{User: user}, nil
+}
+
 type AuthUser struct {
 	User string
 	Pass string
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeHtpasswd(t *testing.T, path string, users map[string]string, modTime time.Time) {
+	buf := []byte("# comment\n")
+	for user, pass := range users {
+		hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
+		require.NoError(t, err)
+		buf = append(buf, user+":"+string(hash)+"\n"...)
+	}
+	require.NoError(t, os.WriteFile(path, buf, 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestAuthenticate_InMemory(t *testing.T) {
+	au := NewAuthenticator([]AuthUser{{User: "alice", Pass: "alice-password"}})
+
+	session, err := Authenticate(au, "alice", "alice-password")
+	assert.NoError(t, err)
+	assert.Equal(t, &Session{User: "alice"}, session)
+
+	_, err = Authenticate(au, "alice", "bob-password")
+	assert.ErrorIs(t, err, ErrDenied)
+
+	session, err = Authenticate(nil, "alice", "")
+	assert.NoError(t, err)
+	assert.Nil(t, session)
+}
+
+func TestHtpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.htpasswd")
+	writeHtpasswd(t, path, map[string]string{"alice": "alice-password"}, time.Now().Add(-time.Minute))
+
+	au, err := NewHtpasswdAuthenticator(path)
+	require.NoError(t, err)
+	defer au.(*htpasswdAuthenticator).Close()
+
+	assert.True(t, au.Verify("alice", "alice-password"))
+	// verified by the digest cache
+	assert.True(t, au.Verify("alice", "alice-password"))
+	assert.False(t, au.Verify("alice", "bob-password"))
+	assert.False(t, au.Verify("bob", "bob-password"))
+	assert.Equal(t, []string{"alice"}, au.Users())
+
+	writeHtpasswd(t, path, map[string]string{"bob": "bob-password"}, time.Now())
+	reloaded, err := au.(*htpasswdAuthenticator).load()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	assert.False(t, au.Verify("alice", "alice-password"))
+	assert.True(t, au.Verify("bob", "bob-password"))
+	assert.Equal(t, []string{"bob"}, au.Users())
+}
+
+func TestHtpasswd_UnsupportedHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.htpasswd")
+	require.NoError(t, os.WriteFile(path, []byte("alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0o600))
+
+	_, err := NewHtpasswdAuthenticator(path)
+	assert.Error(t, err)
+}
+
+func TestHTTPAuthenticator(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		req := httpRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		switch {
+		case req.User == "alice" && req.Password == "alice-password":
+			json.NewEncoder(w).Encode(httpDecision{Allow: true, Proxy: "office"})
+		case req.User == "bob":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(httpDecision{Allow: false})
+		}
+	}))
+	defer server.Close()
+
+	au := NewHTTPAuthenticator(server.URL, time.Second)
+
+	session, err := Authenticate(au, "alice", "alice-password")
+	assert.NoError(t, err)
+	assert.Equal(t, &Session{User: "alice", Proxy: "office"}, session)
+
+	// the decision is cached
+	_, err = Authenticate(au, "alice", "alice-password")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	_, err = Authenticate(au, "alice", "bob-password")
+	assert.ErrorIs(t, err, ErrDenied)
+
+	// the failed callouts deny the user with their errors
+	_, err = Authenticate(au, "bob", "bob-password")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrDenied)
+	assert.False(t, au.Verify("bob", "bob-password"))
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/log"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// htpasswdReloadInterval is the interval of checking the modification of the htpasswd file
+const htpasswdReloadInterval = 5 * time.Second
+
+type htpasswdAuthenticator struct {
+	path string
+
+	mux     sync.RWMutex
+	modTime time.Time
+	hashes  map[string][]byte
+	// the digests of the verified passwords, bcrypt is too slow to compare on every connection
+	verified  map[string][sha256.Size]byte
+	usernames []string
+
+	done chan struct{}
+}
+
+func (ha *htpasswdAuthenticator) Verify(user string, pass string) bool {
+	digest := sha256.Sum256([]byte(pass))
+
+	ha.mux.RLock()
+	hash, ok := ha.hashes[user]
+	verified, cached := ha.verified[user]
+	ha.mux.RUnlock()
+	if !ok {
+		return false
+	}
+	if cached && verified == digest {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(pass)) != nil {
+		return false
+	}
+
+	ha.mux.Lock()
+	// the file may be reloaded during the comparison
+	if bytes.Equal(ha.hashes[user], hash) {
+		ha.verified[user] = digest
+	}
+	ha.mux.Unlock()
+	return true
+}
+
+func (ha *htpasswdAuthenticator) Users() []string {
+	ha.mux.RLock()
+	defer ha.mux.RUnlock()
+	return ha.usernames
+}
+
+// Close stops watching the htpasswd file
+func (ha *htpasswdAuthenticator) Close() error {
+	close(ha.done)
+	return nil
+}
+
+// load reads the htpasswd file if it's modified, it reports whether the file is reloaded
+func (ha *htpasswdAuthenticator) load() (bool, error) {
+	stat, err := os.Stat(ha.path)
+	if err != nil {
+		return false, err
+	}
+
+	ha.mux.RLock()
+	modified := !stat.ModTime().Equal(ha.modTime)
+	ha.mux.RUnlock()
+	if !modified {
+		return false, nil
+	}
+
+	buf, err := os.ReadFile(ha.path)
+	if err != nil {
+		return false, err
+	}
+	hashes, usernames, err := parseHtpasswd(buf)
+	if err != nil {
+		return false, err
+	}
+
+	ha.mux.Lock()
+	ha.modTime = stat.ModTime()
+	ha.hashes = hashes
+	ha.verified = map[string][sha256.Size]byte{}
+	ha.usernames = usernames
+	ha.mux.Unlock()
+	return true, nil
+}
+
+func (ha *htpasswdAuthenticator) watch() {
+	ticker := time.NewTicker(htpasswdReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if reloaded, err := ha.load(); err != nil {
+				log.Warnln("[Auth] reload htpasswd file %s failed: %s", ha.path, err)
+			} else if reloaded {
+				log.Infoln("[Auth] htpasswd file %s reloaded", ha.path)
+			}
+		case <-ha.done:
+			return
+		}
+	}
+}
+
+// parseHtpasswd parses the lines of "user:hash", only the bcrypt hashes are supported
+func parseHtpasswd(buf []byte) (map[string][]byte, []string, error) {
+	hashes := map[string][]byte{}
+	usernames := []string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for idx := 1; scanner.Scan(); idx++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" {
+			return nil, nil, fmt.Errorf("line %d: format invalid", idx)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, nil, fmt.Errorf("line %d: user %s: unsupported hash, only bcrypt is supported", idx, user)
+		}
+
+		if _, exist := hashes[user]; !exist {
+			usernames = append(usernames, user)
+		}
+		hashes[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return hashes, usernames, nil
+}
+
+// NewHtpasswdAuthenticator returns an Authenticator of the users in the htpasswd file,
+// the file is reloaded once it's modified, call Close to stop watching it
+func NewHtpasswdAuthenticator(path string) (Authenticator, error) {
+	ha := &htpasswdAuthenticator{
+		path: path,
+		done: make(chan struct{}),
+	}
+	if _, err := ha.load(); err != nil {
+		return nil, err
+	}
+
+	go ha.watch()
+	return ha, nil
+}
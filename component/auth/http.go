@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Dreamacro/clash/common/cache"
+	"github.com/Dreamacro/clash/log"
+)
+
+// httpDecisionAge is the age of the cached decisions in seconds
+const httpDecisionAge = 30
+
+type httpRequest struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type httpDecision struct {
+	Allow bool   `json:"allow"`
+	Proxy string `json:"proxy,omitempty"`
+}
+
+type httpAuthenticator struct {
+	url       string
+	client    *http.Client
+	decisions *cache.LruCache
+}
+
+func (ha *httpAuthenticator) Verify(user string, pass string) bool {
+	_, err := ha.VerifyProxy(user, pass)
+	return err == nil
+}
+
+func (ha *httpAuthenticator) VerifyProxy(user string, pass string) (string, error) {
+	key := httpRequest{User: user, Password: pass}
+	decision, ok := ha.decisions.Get(key)
+	if !ok {
+		d, err := ha.call(key)
+		if err != nil {
+			// the failed callouts deny the user without caching the decision
+			log.Warnln("[Auth] callout %s failed: %s", ha.url, err)
+			return "", err
+		}
+		ha.decisions.Set(key, d)
+		decision = d
+	}
+
+	d := decision.(httpDecision)
+	if !d.Allow {
+		return "", ErrDenied
+	}
+	return d.Proxy, nil
+}
+
+// the users are unknown until they are verified
+func (ha *httpAuthenticator) Users() []string { return []string{} }
+
+// call posts the user to the callout, the callout responds the decision with status 200
+func (ha *httpAuthenticator) call(req httpRequest) (httpDecision, error) {
+	body, _ := json.Marshal(req)
+	resp, err := ha.client.Post(ha.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return httpDecision{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return httpDecision{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	d := httpDecision{}
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return httpDecision{}, err
+	}
+	return d, nil
+}
+
+// NewHTTPAuthenticator returns an Authenticator asking the callout at the url,
+// the callout decides whether the user is allowed and the proxy of its connections
+func NewHTTPAuthenticator(url string, timeout time.Duration) Authenticator {
+	return &httpAuthenticator{
+		url:       url,
+		client:    &http.Client{Timeout: timeout},
+		decisions: cache.New(cache.WithAge(httpDecisionAge), cache.WithSize(1024)),
+	}
+}
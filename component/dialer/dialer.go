@@ -19,9 +19,9 @@ func DialContext(ctx context.Context, network, address string, options ...Option
 		var ip net.IP
 		switch network {
 		case "tcp4", "udp4":
-			ip, err = resolver.ResolveIPv4(host)
+			ip, err = resolver.ResolveIPv4WithResolver(host, resolverOf(options))
 		default:
-			ip, err = resolver.ResolveIPv6(host)
+			ip, err = resolver.ResolveIPv6WithResolver(host, resolverOf(options))
 		}
 		if err != nil {
 			return nil, err
@@ -35,6 +35,22 @@ func DialContext(ctx context.Context, network, address string, options ...Option
 	}
 }
 
+// ResolveIP resolves host with the resolver of the options, or the default resolver if none is set
+func ResolveIP(host string, options ...Option) (net.IP, error) {
+	return resolver.ResolveIPWithResolver(host, resolverOf(options))
+}
+
+func resolverOf(options []Option) resolver.Resolver {
+	opt := &option{resolver: resolver.DefaultResolver}
+	for _, o := range DefaultOptions {
+		o(opt)
+	}
+	for _, o := range options {
+		o(opt)
+	}
+	return opt.resolver
+}
+
 func ListenPacket(ctx context.Context, network, address string, options ...Option) (net.PacketConn, error) {
 	cfg := &option{
 		interfaceName: DefaultInterface.Load(),
@@ -141,9 +157,9 @@ func dualStackDialContext(ctx context.Context, network, address string, options
 
 		var ip net.IP
 		if ipv6 {
-			ip, result.error = resolver.ResolveIPv6(host)
+			ip, result.error = resolver.ResolveIPv6WithResolver(host, resolverOf(options))
 		} else {
-			ip, result.error = resolver.ResolveIPv4(host)
+			ip, result.error = resolver.ResolveIPv4WithResolver(host, resolverOf(options))
 		}
 		if result.error != nil {
 			return
@@ -180,3 +196,29 @@ func dualStackDialContext(ctx context.Context, network, address string, options
 
 	return nil, errors.New("never touched")
 }
+
+// Dialer binds a set of Option to DialContext and ListenPacket, so it can be
+// handed to proxy adapters as the way to reach their server.
+type Dialer struct {
+	options []Option
+}
+
+func NewDialer(options ...Option) *Dialer {
+	return &Dialer{options: options}
+}
+
+// DialContext dials address with the bound options
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return DialContext(ctx, network, address, d.options...)
+}
+
+// ResolveIP resolves host with the bound options
+func (d *Dialer) ResolveIP(host string) (net.IP, error) {
+	return ResolveIP(host, d.options...)
+}
+
+// ListenPacket listens on an unspecified local address with the bound options,
+// the remote address is not needed for a direct UDP socket and is ignored.
+func (d *Dialer) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	return ListenPacket(ctx, network, "", d.options...)
+}
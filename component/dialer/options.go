@@ -1,6 +1,10 @@
 package dialer
 
-import "go.uber.org/atomic"
+import (
+	"github.com/Dreamacro/clash/component/resolver"
+
+	"go.uber.org/atomic"
+)
 
 var (
 	DefaultOptions     []Option
@@ -13,6 +17,7 @@ type option struct {
 	fallbackBind  bool
 	addrReuse     bool
 	routingMark   int
+	resolver      resolver.Resolver
 }
 
 type Option func(opt *option)
@@ -40,3 +45,10 @@ func WithRoutingMark(mark int) Option {
 		opt.routingMark = mark
 	}
 }
+
+// WithResolver resolves the hostname of the destination with r instead of the default resolver
+func WithResolver(r resolver.Resolver) Option {
+	return func(opt *option) {
+		opt.resolver = r
+	}
+}
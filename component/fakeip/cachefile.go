@@ -8,11 +8,20 @@ import (
 
 type cachefileStore struct {
 	cache *cachefile.CacheFile
+	ipv6  bool
+}
+
+// hostKey returns the key of host, the pools of both families share the bucket
+func (c *cachefileStore) hostKey(host string) []byte {
+	if c.ipv6 {
+		return []byte("ipv6:" + host)
+	}
+	return []byte(host)
 }
 
 // GetByHost implements store.GetByHost
 func (c *cachefileStore) GetByHost(host string) (net.IP, bool) {
-	elm := c.cache.GetFakeip([]byte(host))
+	elm := c.cache.GetFakeip(c.hostKey(host))
 	if elm == nil {
 		return nil, false
 	}
@@ -21,12 +30,12 @@ func (c *cachefileStore) GetByHost(host string) (net.IP, bool) {
 
 // PutByHost implements store.PutByHost
 func (c *cachefileStore) PutByHost(host string, ip net.IP) {
-	c.cache.PutFakeip([]byte(host), ip)
+	c.cache.PutFakeip(c.hostKey(host), ip)
 }
 
 // GetByIP implements store.GetByIP
 func (c *cachefileStore) GetByIP(ip net.IP) (string, bool) {
-	elm := c.cache.GetFakeip(ip.To4())
+	elm := c.cache.GetFakeip(ip)
 	if elm == nil {
 		return "", false
 	}
@@ -35,13 +44,16 @@ func (c *cachefileStore) GetByIP(ip net.IP) (string, bool) {
 
 // PutByIP implements store.PutByIP
 func (c *cachefileStore) PutByIP(ip net.IP, host string) {
-	c.cache.PutFakeip(ip.To4(), []byte(host))
+	c.cache.PutFakeip(ip, []byte(host))
 }
 
 // DelByIP implements store.DelByIP
 func (c *cachefileStore) DelByIP(ip net.IP) {
-	ip = ip.To4()
-	c.cache.DelFakeipPair(ip, c.cache.GetFakeip(ip.To4()))
+	host := c.cache.GetFakeip(ip)
+	if host != nil {
+		host = c.hostKey(string(host))
+	}
+	c.cache.DelFakeipPair(ip, host)
 }
 
 // Exist implements store.Exist
@@ -2,6 +2,7 @@ package fakeip
 
 import (
 	"net"
+	"net/netip"
 
 	"github.com/Dreamacro/clash/common/cache"
 )
@@ -16,7 +17,7 @@ func (m *memoryStore) GetByHost(host string) (net.IP, bool) {
 		ip := elm.(net.IP)
 
 		// ensure ip --> host on head of linked list
-		m.cache.Get(ipToUint(ip.To4()))
+		m.cache.Get(ipKey(ip))
 		return ip, true
 	}
 
@@ -30,7 +31,7 @@ func (m *memoryStore) PutByHost(host string, ip net.IP) {
 
 // GetByIP implements store.GetByIP
 func (m *memoryStore) GetByIP(ip net.IP) (string, bool) {
-	if elm, exist := m.cache.Get(ipToUint(ip.To4())); exist {
+	if elm, exist := m.cache.Get(ipKey(ip)); exist {
 		host := elm.(string)
 
 		// ensure host --> ip on head of linked list
@@ -43,21 +44,21 @@ func (m *memoryStore) GetByIP(ip net.IP) (string, bool) {
 
 // PutByIP implements store.PutByIP
 func (m *memoryStore) PutByIP(ip net.IP, host string) {
-	m.cache.Set(ipToUint(ip.To4()), host)
+	m.cache.Set(ipKey(ip), host)
 }
 
 // DelByIP implements store.DelByIP
 func (m *memoryStore) DelByIP(ip net.IP) {
-	ipNum := ipToUint(ip.To4())
-	if elm, exist := m.cache.Get(ipNum); exist {
+	key := ipKey(ip)
+	if elm, exist := m.cache.Get(key); exist {
 		m.cache.Delete(elm.(string))
 	}
-	m.cache.Delete(ipNum)
+	m.cache.Delete(key)
 }
 
 // Exist implements store.Exist
 func (m *memoryStore) Exist(ip net.IP) bool {
-	return m.cache.Exist(ipToUint(ip.To4()))
+	return m.cache.Exist(ipKey(ip))
 }
 
 // CloneTo implements store.CloneTo
@@ -67,3 +68,9 @@ func (m *memoryStore) CloneTo(store store) {
 		m.cache.CloneTo(ms.cache)
 	}
 }
+
+// ipKey returns the cache key of ip, which never collides with the hosts
+func ipKey(ip net.IP) netip.Addr {
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr.Unmap()
+}
@@ -1,8 +1,12 @@
 package fakeip
 
 import (
+	"encoding/binary"
 	"errors"
+	"math"
+	"math/bits"
 	"net"
+	"net/netip"
 	"strings"
 	"sync"
 
@@ -23,10 +27,12 @@ type store interface {
 
 // Pool is an implementation about fake ip generator without storage
 type Pool struct {
-	max     uint32
-	min     uint32
-	gateway uint32
-	offset  uint32
+	min     netip.Addr
+	gateway netip.Addr
+	size    uint64
+	offset  uint64
+	ttl     uint32
+	inUse   func(ip netip.Addr) bool
 	mux     sync.Mutex
 	host    *trie.DomainTrie
 	ipnet   *net.IPNet
@@ -54,7 +60,7 @@ func (p *Pool) LookBack(ip net.IP) (string, bool) {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 
-	if ip = ip.To4(); ip == nil {
+	if ip = p.normalize(ip); ip == nil {
 		return "", false
 	}
 
@@ -74,7 +80,7 @@ func (p *Pool) Exist(ip net.IP) bool {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 
-	if ip = ip.To4(); ip == nil {
+	if ip = p.normalize(ip); ip == nil {
 		return false
 	}
 
@@ -83,7 +89,7 @@ func (p *Pool) Exist(ip net.IP) bool {
 
 // Gateway return gateway ip
 func (p *Pool) Gateway() net.IP {
-	return uintToIP(p.gateway)
+	return p.gateway.AsSlice()
 }
 
 // IPNet return raw ipnet
@@ -91,43 +97,89 @@ func (p *Pool) IPNet() *net.IPNet {
 	return p.ipnet
 }
 
+// IPv6 returns if the pool allocates IPv6 addresses
+func (p *Pool) IPv6() bool {
+	return p.min.Is6()
+}
+
+// TTL returns the TTL of the DNS answers with the fake ips
+func (p *Pool) TTL() uint32 {
+	return p.ttl
+}
+
 // CloneFrom clone cache from old pool
 func (p *Pool) CloneFrom(o *Pool) {
+	if p.IPv6() != o.IPv6() {
+		return
+	}
 	o.store.CloneTo(p.store)
 }
 
+// normalize returns ip in the form of the pool, or nil if it has a different family
+func (p *Pool) normalize(ip net.IP) net.IP {
+	if p.IPv6() {
+		if ip.To4() != nil {
+			return nil
+		}
+		return ip.To16()
+	}
+	return ip.To4()
+}
+
 func (p *Pool) get(host string) net.IP {
 	current := p.offset
 	for {
-		ip := uintToIP(p.min + p.offset)
-		if !p.store.Exist(ip) {
+		if !p.store.Exist(p.at(p.offset)) && !p.isInUse(p.offset) {
 			break
 		}
 
-		p.offset = (p.offset + 1) % (p.max - p.min)
+		p.offset = (p.offset + 1) % p.size
 		// Avoid infinite loops
 		if p.offset == current {
-			p.offset = (p.offset + 1) % (p.max - p.min)
-			ip := uintToIP(p.min + p.offset)
-			p.store.DelByIP(ip)
+			p.offset = p.evict()
 			break
 		}
 	}
-	ip := uintToIP(p.min + p.offset)
+	ip := p.at(p.offset)
 	p.store.PutByIP(ip, host)
 	return ip
 }
 
-func ipToUint(ip net.IP) uint32 {
-	v := uint32(ip[0]) << 24
-	v += uint32(ip[1]) << 16
-	v += uint32(ip[2]) << 8
-	v += uint32(ip[3])
-	return v
+// evict releases the ip after the current offset and returns its offset,
+// the ips referenced by active connections are passed over unless all of them are
+func (p *Pool) evict() uint64 {
+	next := (p.offset + 1) % p.size
+	offset := next
+	for p.isInUse(offset) {
+		offset = (offset + 1) % p.size
+		if offset == next {
+			break
+		}
+	}
+	p.store.DelByIP(p.at(offset))
+	return offset
+}
+
+func (p *Pool) isInUse(offset uint64) bool {
+	return p.inUse != nil && p.inUse(addOffset(p.min, offset))
 }
 
-func uintToIP(v uint32) net.IP {
-	return net.IP{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+func (p *Pool) at(offset uint64) net.IP {
+	return addOffset(p.min, offset).AsSlice()
+}
+
+// addOffset returns the 128-bit sum of addr and offset
+func addOffset(addr netip.Addr, offset uint64) netip.Addr {
+	b := addr.As16()
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo, carry := bits.Add64(binary.BigEndian.Uint64(b[8:]), offset, 0)
+	binary.BigEndian.PutUint64(b[:8], hi+carry)
+	binary.BigEndian.PutUint64(b[8:], lo)
+
+	if addr.Is4() {
+		return netip.AddrFrom16(b).Unmap()
+	}
+	return netip.AddrFrom16(b)
 }
 
 type Options struct {
@@ -141,30 +193,58 @@ type Options struct {
 	// Persistence will save the data to disk.
 	// Size will not work and record will be fully stored.
 	Persistence bool
+
+	// TTL is the TTL of the DNS answers, 1 by default
+	TTL uint32
+
+	// InUse reports whether the ip is still referenced by active connections,
+	// such ips are not reused when the pool runs out of ips
+	InUse func(ip netip.Addr) bool
 }
 
 // New return Pool instance
 func New(options Options) (*Pool, error) {
-	min := ipToUint(options.IPNet.IP) + 2
+	prefix, ok := netip.AddrFromSlice(options.IPNet.IP)
+	if !ok {
+		return nil, errors.New("invalid ipnet")
+	}
+	prefix = prefix.Unmap()
 
 	ones, bits := options.IPNet.Mask.Size()
-	total := 1<<uint(bits-ones) - 2
+	if prefix.Is6() && bits != 128 {
+		return nil, errors.New("invalid ipnet")
+	}
 
-	if total <= 0 {
+	hostBits := bits - ones
+	if hostBits < 2 {
 		return nil, errors.New("ipnet don't have valid ip")
 	}
 
-	max := min + uint32(total) - 1
+	// the first ip is the network address and the second one is the gateway
+	total := uint64(math.MaxUint64)
+	if hostBits < 64 {
+		total = 1<<uint(hostBits) - 2
+	}
+
+	ttl := options.TTL
+	if ttl == 0 {
+		ttl = 1
+	}
+
 	pool := &Pool{
-		min:     min,
-		max:     max,
-		gateway: min - 1,
-		host:    options.Host,
-		ipnet:   options.IPNet,
+		min:     addOffset(prefix, 2),
+		gateway: addOffset(prefix, 1),
+		// the last ip of the range is never allocated
+		size:  total - 1,
+		ttl:   ttl,
+		inUse: options.InUse,
+		host:  options.Host,
+		ipnet: options.IPNet,
 	}
 	if options.Persistence {
 		pool.store = &cachefileStore{
 			cache: cachefile.Cache(),
+			ipv6:  pool.IPv6(),
 		}
 	} else {
 		pool.store = &memoryStore{
@@ -2,6 +2,7 @@ package fakeip
 
 import (
 	"net"
+	"net/netip"
 	"os"
 	"testing"
 	"time"
@@ -115,6 +116,79 @@ func TestPool_CycleUsed(t *testing.T) {
 	}
 }
 
+func TestPool_CycleInUse(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/29")
+	var inUse netip.Addr
+	pools, tempfile, err := createPools(Options{
+		IPNet: ipnet,
+		Size:  10,
+		InUse: func(ip netip.Addr) bool { return ip == inUse },
+	})
+	assert.Nil(t, err)
+	defer os.Remove(tempfile)
+
+	for _, pool := range pools {
+		inUse = netip.Addr{}
+		for _, host := range []string{"2.com", "3.com", "4.com", "5.com", "6.com"} {
+			pool.Lookup(host)
+		}
+
+		inUse = netip.MustParseAddr("192.168.0.2")
+
+		// 192.168.0.2 is still referenced by connections
+		assert.Equal(t, net.IP{192, 168, 0, 3}, pool.Lookup("13.com"))
+		host, exist := pool.LookBack(net.IP{192, 168, 0, 2})
+		assert.True(t, exist)
+		assert.Equal(t, "2.com", host)
+		_, exist = pool.LookBack(net.IP{192, 168, 0, 3})
+		assert.True(t, exist)
+	}
+}
+
+func TestPool_IPv6(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("fc00::/64")
+	pools, tempfile, err := createPools(Options{
+		IPNet: ipnet,
+		Size:  10,
+		TTL:   60,
+	})
+	assert.Nil(t, err)
+	defer os.Remove(tempfile)
+
+	for _, pool := range pools {
+		first := pool.Lookup("foo.com")
+		last := pool.Lookup("bar.com")
+		bar, exist := pool.LookBack(last)
+
+		assert.True(t, pool.IPv6())
+		assert.Equal(t, uint32(60), pool.TTL())
+		assert.Equal(t, net.ParseIP("fc00::2"), first)
+		assert.Equal(t, net.ParseIP("fc00::3"), last)
+		assert.True(t, exist)
+		assert.Equal(t, "bar.com", bar)
+		assert.Equal(t, net.ParseIP("fc00::1"), pool.Gateway())
+		assert.True(t, pool.Exist(net.ParseIP("fc00::3")))
+		assert.False(t, pool.Exist(net.IP{0, 0, 0, 3}))
+	}
+}
+
+func TestPool_SharedCachefile(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.1/24")
+	_, ipnet6, _ := net.ParseCIDR("fc00::/64")
+	pool, tempfile, err := createCachefileStore(Options{IPNet: ipnet})
+	assert.Nil(t, err)
+	defer os.Remove(tempfile)
+
+	pool6, err := New(Options{IPNet: ipnet6})
+	assert.Nil(t, err)
+	pool6.store = &cachefileStore{cache: pool.store.(*cachefileStore).cache, ipv6: true}
+
+	assert.Equal(t, net.IP{192, 168, 0, 2}, pool.Lookup("foo.com"))
+	assert.Equal(t, net.ParseIP("fc00::2"), pool6.Lookup("foo.com"))
+	assert.Equal(t, net.IP{192, 168, 0, 2}, pool.Lookup("foo.com"))
+	assert.Equal(t, uint32(1), pool.TTL())
+}
+
 func TestPool_Skip(t *testing.T) {
 	_, ipnet, _ := net.ParseCIDR("192.168.0.1/30")
 	tree := trie.New()
@@ -209,4 +283,12 @@ func TestPool_Error(t *testing.T) {
 	})
 
 	assert.Error(t, err)
+
+	_, ipnet, _ = net.ParseCIDR("fc00::/127")
+	_, err = New(Options{
+		IPNet: ipnet,
+		Size:  10,
+	})
+
+	assert.Error(t, err)
 }
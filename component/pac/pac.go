@@ -0,0 +1,130 @@
+package pac
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	C "github.com/Dreamacro/clash/constant"
+
+	"go.uber.org/atomic"
+)
+
+// ContentType is the MIME type of the PAC script
+const ContentType = "application/x-ns-proxy-autoconfig"
+
+const (
+	header = `function isIPv4Literal(host) {
+	return /^\d{1,3}(\.\d{1,3}){3}$/.test(host);
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	var ip;
+	function resolved() {
+		if (ip === undefined) {
+			ip = isIPv4Literal(host) ? host : dnsResolve(host);
+		}
+		return ip;
+	}
+`
+
+	footer = "}\n"
+)
+
+var rulesScript = atomic.NewString(Generate(nil))
+
+// Update regenerates the PAC script of the rules
+func Update(rules []C.Rule) {
+	rulesScript.Store(Generate(rules))
+}
+
+// Script returns the PAC script of the rules, the proxied connections are sent to the proxy
+func Script(proxy string) []byte {
+	return withProxy(proxy, rulesScript.Load())
+}
+
+// Fixed returns the PAC script sending all the connections to the proxy,
+// or directly if the proxy is empty
+func Fixed(proxy string) []byte {
+	target := "proxy"
+	if proxy == "" {
+		target = strconv.Quote("DIRECT")
+	}
+	return withProxy(proxy, "function FindProxyForURL(url, host) {\n\treturn "+target+";\n}\n")
+}
+
+// ProxyAddr returns the address of the proxy in the PAC script
+func ProxyAddr(ip netip.Addr, port int) string {
+	return net.JoinHostPort(ip.Unmap().String(), strconv.Itoa(port))
+}
+
+func withProxy(proxy string, script string) []byte {
+	return []byte("var proxy = " + strconv.Quote("PROXY "+proxy) + ";\n\n" + script)
+}
+
+// Generate returns the FindProxyForURL function of the rules. Only the DOMAIN, DOMAIN-SUFFIX,
+// DOMAIN-KEYWORD and the IPv4 IP-CIDR rules are translated, the other rules sending to DIRECT
+// are skipped as the proxy sends them directly anyway, while the generation stops at the first
+// other rule sending to a proxy as it may shadow the following rules, the rest of the connections
+// are sent to the proxy and routed by the rules there. The connections matching no rule are sent
+// directly like the rules.
+func Generate(rules []C.Rule) string {
+	sb := strings.Builder{}
+	sb.WriteString(header)
+
+	final := strconv.Quote("DIRECT")
+	for _, rule := range rules {
+		target := "proxy"
+		if rule.Adapter() == "DIRECT" {
+			target = strconv.Quote("DIRECT")
+		}
+
+		if rule.RuleType() == C.MATCH {
+			final = target
+			break
+		}
+
+		cond, ok := condition(rule)
+		if !ok {
+			if target == "proxy" {
+				final = target
+				break
+			}
+			continue
+		}
+		sb.WriteString("\tif (" + cond + ") return " + target + ";\n")
+	}
+
+	sb.WriteString("\treturn " + final + ";\n")
+	sb.WriteString(footer)
+	return sb.String()
+}
+
+// condition returns the JavaScript condition of the rule
+func condition(rule C.Rule) (string, bool) {
+	payload := rule.Payload()
+	switch rule.RuleType() {
+	case C.Domain:
+		return "host === " + strconv.Quote(payload), true
+	case C.DomainSuffix:
+		return "host === " + strconv.Quote(payload) + " || dnsDomainIs(host, " + strconv.Quote("."+payload) + ")", true
+	case C.DomainKeyword:
+		return "host.indexOf(" + strconv.Quote(payload) + ") !== -1", true
+	case C.IPCIDR:
+		prefix, err := netip.ParsePrefix(payload)
+		if err != nil || !prefix.Addr().Is4() {
+			// isInNet doesn't support IPv6 in all the browsers
+			return "", false
+		}
+		addr := strconv.Quote(prefix.Masked().Addr().String())
+		mask := strconv.Quote(net.IP(net.CIDRMask(prefix.Bits(), 32)).String())
+		if !rule.ShouldResolveIP() {
+			return "isIPv4Literal(host) && isInNet(host, " + addr + ", " + mask + ")", true
+		}
+		return "resolved() && isInNet(ip, " + addr + ", " + mask + ")", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,59 @@
+package pac
+
+import (
+	"net/netip"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+	rules "github.com/Dreamacro/clash/rule"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	cidr, _ := rules.NewIPCIDR("10.1.2.3/8", "DIRECT")
+	literal, _ := rules.NewIPCIDR("172.16.0.0/12", "DIRECT", rules.WithIPCIDRNoResolve(true))
+	cidr6, _ := rules.NewIPCIDR("fd00::/8", "DIRECT")
+
+	script := Generate([]C.Rule{
+		rules.NewDomain("example.com", "DIRECT"),
+		rules.NewDomainSuffix("google.com", "auto"),
+		rules.NewDomainKeyword("ads", "REJECT"),
+		cidr,
+		literal,
+		// the unsupported rules sending to DIRECT are skipped
+		cidr6,
+		rules.NewGEOIP("CN", "DIRECT", false),
+		rules.NewDomain("after.example.com", "DIRECT"),
+		// the unsupported rules sending to a proxy stop the generation
+		rules.NewGEOIP("US", "auto", false),
+		rules.NewDomain("shadowed.example.com", "DIRECT"),
+		rules.NewMatch("DIRECT"),
+	})
+
+	assert.Contains(t, script, `if (host === "example.com") return "DIRECT";`)
+	assert.Contains(t, script, `if (host === "google.com" || dnsDomainIs(host, ".google.com")) return proxy;`)
+	assert.Contains(t, script, `if (host.indexOf("ads") !== -1) return proxy;`)
+	assert.Contains(t, script, `if (resolved() && isInNet(ip, "10.0.0.0", "255.0.0.0")) return "DIRECT";`)
+	assert.Contains(t, script, `if (isIPv4Literal(host) && isInNet(host, "172.16.0.0", "255.240.0.0")) return "DIRECT";`)
+	assert.NotContains(t, script, "fd00")
+	assert.Contains(t, script, `"after.example.com"`)
+	assert.NotContains(t, script, `"shadowed.example.com"`)
+	assert.Contains(t, script, "\treturn proxy;\n}\n")
+
+	// the connections matching no rule are sent directly
+	assert.Contains(t, Generate(nil), "\treturn \"DIRECT\";\n}\n")
+	assert.Contains(t, Generate([]C.Rule{rules.NewMatch("auto")}), "\treturn proxy;\n}\n")
+}
+
+func TestScript(t *testing.T) {
+	Update([]C.Rule{rules.NewMatch("auto")})
+	defer Update(nil)
+
+	proxy := ProxyAddr(netip.MustParseAddr("::ffff:192.168.1.1"), 7890)
+	assert.Equal(t, "192.168.1.1:7890", proxy)
+	assert.Contains(t, string(Script(proxy)), "var proxy = \"PROXY 192.168.1.1:7890\";\n")
+	assert.Contains(t, string(Script(proxy)), "\treturn proxy;\n}\n")
+	assert.Contains(t, string(Fixed("")), "\treturn \"DIRECT\";\n}\n")
+	assert.Equal(t, "[fd00::1]:7890", ProxyAddr(netip.MustParseAddr("fd00::1"), 7890))
+}
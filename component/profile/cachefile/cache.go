@@ -15,8 +15,11 @@ import (
 var (
 	fileMode os.FileMode = 0o666
 
-	bucketSelected = []byte("selected")
-	bucketFakeip   = []byte("fakeip")
+	bucketSelected     = []byte("selected")
+	bucketFakeip       = []byte("fakeip")
+	bucketSubscription = []byte("subscription")
+	bucketDNSCache     = []byte("dns")
+	bucketUsers        = []byte("users")
 )
 
 // CacheFile store and update the cache file
@@ -130,6 +133,142 @@ func (c *CacheFile) GetFakeip(key []byte) []byte {
 	return bucket.Get(key)
 }
 
+func (c *CacheFile) SetSubscriptionInfo(provider string, info []byte) {
+	if c.DB == nil {
+		return
+	}
+
+	err := c.DB.Batch(func(t *bbolt.Tx) error {
+		bucket, err := t.CreateBucketIfNotExists(bucketSubscription)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(provider), info)
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] write cache to %s failed: %s", c.DB.Path(), err.Error())
+	}
+}
+
+func (c *CacheFile) GetSubscriptionInfo(provider string) []byte {
+	if c.DB == nil {
+		return nil
+	}
+
+	var info []byte
+	c.DB.View(func(t *bbolt.Tx) error {
+		bucket := t.Bucket(bucketSubscription)
+		if bucket == nil {
+			return nil
+		}
+
+		// the value is only valid in the transaction
+		info = append([]byte(nil), bucket.Get([]byte(provider))...)
+		return nil
+	})
+	return info
+}
+
+// SetDNSCache replaces the persisted DNS cache with cache
+func (c *CacheFile) SetDNSCache(cache map[string][]byte) {
+	if c.DB == nil {
+		return
+	}
+
+	err := c.DB.Update(func(t *bbolt.Tx) error {
+		if err := t.DeleteBucket(bucketDNSCache); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+
+		bucket, err := t.CreateBucket(bucketDNSCache)
+		if err != nil {
+			return err
+		}
+
+		for key, value := range cache {
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] write cache to %s failed: %s", c.DB.Path(), err.Error())
+	}
+}
+
+// DNSCache returns the persisted DNS cache
+func (c *CacheFile) DNSCache() map[string][]byte {
+	if c.DB == nil {
+		return nil
+	}
+
+	cache := map[string][]byte{}
+	c.DB.View(func(t *bbolt.Tx) error {
+		bucket := t.Bucket(bucketDNSCache)
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			cache[string(k)] = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return cache
+}
+
+// SetUsersUsage replaces the persisted usage of the authenticated users with usage
+func (c *CacheFile) SetUsersUsage(usage map[string][]byte) {
+	if c.DB == nil {
+		return
+	}
+
+	err := c.DB.Update(func(t *bbolt.Tx) error {
+		if err := t.DeleteBucket(bucketUsers); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+
+		bucket, err := t.CreateBucket(bucketUsers)
+		if err != nil {
+			return err
+		}
+
+		for name, value := range usage {
+			if err := bucket.Put([]byte(name), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnln("[CacheFile] write cache to %s failed: %s", c.DB.Path(), err.Error())
+	}
+}
+
+// UsersUsage returns the persisted usage of the authenticated users
+func (c *CacheFile) UsersUsage() map[string][]byte {
+	if c.DB == nil {
+		return nil
+	}
+
+	usage := map[string][]byte{}
+	c.DB.View(func(t *bbolt.Tx) error {
+		bucket := t.Bucket(bucketUsers)
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			usage[string(k)] = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return usage
+}
+
 func (c *CacheFile) Close() error {
 	return c.DB.Close()
 }
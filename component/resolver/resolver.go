@@ -47,6 +47,11 @@ type Resolver interface {
 
 // LookupIPv4 with a host, return ipv4 list
 func LookupIPv4(ctx context.Context, host string) ([]net.IP, error) {
+	return LookupIPv4WithResolver(ctx, host, DefaultResolver)
+}
+
+// LookupIPv4WithResolver same as LookupIPv4, but with a resolver
+func LookupIPv4WithResolver(ctx context.Context, host string, r Resolver) ([]net.IP, error) {
 	if node := DefaultHosts.Search(host); node != nil {
 		if ip := node.Data.(net.IP).To4(); ip != nil {
 			return []net.IP{ip}, nil
@@ -61,8 +66,8 @@ func LookupIPv4(ctx context.Context, host string) ([]net.IP, error) {
 		return nil, ErrIPVersion
 	}
 
-	if DefaultResolver != nil {
-		return DefaultResolver.LookupIPv4(ctx, host)
+	if r != nil {
+		return r.LookupIPv4(ctx, host)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultDNSTimeout)
@@ -79,7 +84,12 @@ func LookupIPv4(ctx context.Context, host string) ([]net.IP, error) {
 
 // ResolveIPv4 with a host, return ipv4
 func ResolveIPv4(host string) (net.IP, error) {
-	ips, err := LookupIPv4(context.Background(), host)
+	return ResolveIPv4WithResolver(host, DefaultResolver)
+}
+
+// ResolveIPv4WithResolver same as ResolveIPv4, but with a resolver
+func ResolveIPv4WithResolver(host string, r Resolver) (net.IP, error) {
+	ips, err := LookupIPv4WithResolver(context.Background(), host, r)
 	if err != nil {
 		return nil, err
 	} else if len(ips) == 0 {
@@ -90,6 +100,11 @@ func ResolveIPv4(host string) (net.IP, error) {
 
 // LookupIPv6 with a host, return ipv6 list
 func LookupIPv6(ctx context.Context, host string) ([]net.IP, error) {
+	return LookupIPv6WithResolver(ctx, host, DefaultResolver)
+}
+
+// LookupIPv6WithResolver same as LookupIPv6, but with a resolver
+func LookupIPv6WithResolver(ctx context.Context, host string, r Resolver) ([]net.IP, error) {
 	if DisableIPv6 {
 		return nil, ErrIPv6Disabled
 	}
@@ -108,8 +123,8 @@ func LookupIPv6(ctx context.Context, host string) ([]net.IP, error) {
 		return nil, ErrIPVersion
 	}
 
-	if DefaultResolver != nil {
-		return DefaultResolver.LookupIPv6(ctx, host)
+	if r != nil {
+		return r.LookupIPv6(ctx, host)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultDNSTimeout)
@@ -126,7 +141,12 @@ func LookupIPv6(ctx context.Context, host string) ([]net.IP, error) {
 
 // ResolveIPv6 with a host, return ipv6
 func ResolveIPv6(host string) (net.IP, error) {
-	ips, err := LookupIPv6(context.Background(), host)
+	return ResolveIPv6WithResolver(host, DefaultResolver)
+}
+
+// ResolveIPv6WithResolver same as ResolveIPv6, but with a resolver
+func ResolveIPv6WithResolver(host string, r Resolver) (net.IP, error) {
+	ips, err := LookupIPv6WithResolver(context.Background(), host, r)
 	if err != nil {
 		return nil, err
 	} else if len(ips) == 0 {
@@ -172,7 +192,12 @@ func LookupIP(ctx context.Context, host string) ([]net.IP, error) {
 
 // ResolveIP with a host, return ip
 func ResolveIP(host string) (net.IP, error) {
-	ips, err := LookupIP(context.Background(), host)
+	return ResolveIPWithResolver(host, DefaultResolver)
+}
+
+// ResolveIPWithResolver same as ResolveIP, but with a resolver
+func ResolveIPWithResolver(host string, r Resolver) (net.IP, error) {
+	ips, err := LookupIPWithResolver(context.Background(), host, r)
 	if err != nil {
 		return nil, err
 	} else if len(ips) == 0 {
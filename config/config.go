@@ -4,9 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Dreamacro/clash/adapter"
 	"github.com/Dreamacro/clash/adapter/outbound"
@@ -21,7 +24,9 @@ import (
 	"github.com/Dreamacro/clash/log"
 	R "github.com/Dreamacro/clash/rule"
 	T "github.com/Dreamacro/clash/tunnel"
+	"github.com/Dreamacro/clash/tunnel/statistic"
 
+	D "github.com/miekg/dns"
 	"github.com/samber/lo"
 	"gopkg.in/yaml.v3"
 )
@@ -54,6 +59,11 @@ type LegacyInbound struct {
 	MixedPort   int    `json:"mixed-port"`
 	AllowLan    bool   `json:"allow-lan"`
 	BindAddress string `json:"bind-address"`
+
+	AutoRedirect bool `json:"auto-redirect"`
+
+	LanAllowedIPs    []netip.Prefix `json:"lan-allowed-ips"`
+	LanDisallowedIPs []netip.Prefix `json:"lan-disallowed-ips"`
 }
 
 // DNS config
@@ -64,11 +74,27 @@ type DNS struct {
 	Fallback          []dns.NameServer `yaml:"fallback"`
 	FallbackFilter    FallbackFilter   `yaml:"fallback-filter"`
 	Listen            string           `yaml:"listen"`
+	ListenTCP         string           `yaml:"listen-tcp"`
+	ListenTLS         string           `yaml:"listen-tls"`
+	ListenHTTPS       string           `yaml:"listen-https"`
+	HTTPSPath         string           `yaml:"https-path"`
+	Certificate       string           `yaml:"certificate"`
+	PrivateKey        string           `yaml:"private-key"`
 	EnhancedMode      C.DNSMode        `yaml:"enhanced-mode"`
 	DefaultNameserver []dns.NameServer `yaml:"default-nameserver"`
 	FakeIPRange       *fakeip.Pool
+	FakeIPRange6      *fakeip.Pool
 	Hosts             *trie.DomainTrie
-	NameServerPolicy  map[string]dns.NameServer
+	NameServerPolicy  []dns.Policy
+	Filter            dns.FilterConfig
+	CacheMinTTL       uint32
+	CacheMaxTTL       uint32
+	CachePrefetch     bool
+	CacheServeStale   bool
+	CacheStaleMaxAge  uint32
+	CacheStaleTTL     uint32
+	PersistCache      bool
+	DNSSEC            bool
 	SearchDomains     []string
 }
 
@@ -84,6 +110,7 @@ type FallbackFilter struct {
 type Profile struct {
 	StoreSelected bool `yaml:"store-selected"`
 	StoreFakeIP   bool `yaml:"store-fake-ip"`
+	StoreDNSCache bool `yaml:"store-dns-cache"`
 }
 
 // Experimental config
@@ -93,33 +120,142 @@ type Experimental struct {
 
 // Config is clash config manager
 type Config struct {
-	General      *General
-	DNS          *DNS
-	Experimental *Experimental
-	Hosts        *trie.DomainTrie
-	Profile      *Profile
-	Inbounds     []C.Inbound
-	Rules        []C.Rule
-	Users        []auth.AuthUser
-	Proxies      map[string]C.Proxy
-	Providers    map[string]providerTypes.ProxyProvider
-	Tunnels      []Tunnel
+	General       *General
+	DNS           *DNS
+	Experimental  *Experimental
+	Hosts         *trie.DomainTrie
+	Profile       *Profile
+	Inbounds      []C.Inbound
+	Rules         []C.Rule
+	SubRules      map[string][]C.Rule
+	Users         []auth.AuthUser
+	AuthBackend   auth.Authenticator
+	UserQuotas    map[string]statistic.UserQuota
+	Proxies       map[string]C.Proxy
+	Providers     map[string]providerTypes.ProxyProvider
+	RuleProviders map[string]providerTypes.RuleProvider
+	Tunnels       []Tunnel
 }
 
 type RawDNS struct {
-	Enable            bool              `yaml:"enable"`
-	IPv6              *bool             `yaml:"ipv6"`
-	UseHosts          bool              `yaml:"use-hosts"`
-	NameServer        []string          `yaml:"nameserver"`
-	Fallback          []string          `yaml:"fallback"`
-	FallbackFilter    RawFallbackFilter `yaml:"fallback-filter"`
-	Listen            string            `yaml:"listen"`
-	EnhancedMode      C.DNSMode         `yaml:"enhanced-mode"`
-	FakeIPRange       string            `yaml:"fake-ip-range"`
-	FakeIPFilter      []string          `yaml:"fake-ip-filter"`
-	DefaultNameserver []string          `yaml:"default-nameserver"`
-	NameServerPolicy  map[string]string `yaml:"nameserver-policy"`
-	SearchDomains     []string          `yaml:"search-domains"`
+	Enable            bool                    `yaml:"enable"`
+	IPv6              *bool                   `yaml:"ipv6"`
+	UseHosts          bool                    `yaml:"use-hosts"`
+	NameServer        []string                `yaml:"nameserver"`
+	Fallback          []string                `yaml:"fallback"`
+	FallbackFilter    RawFallbackFilter       `yaml:"fallback-filter"`
+	Listen            string                  `yaml:"listen"`
+	ListenTCP         string                  `yaml:"listen-tcp"`
+	ListenTLS         string                  `yaml:"listen-tls"`
+	ListenHTTPS       string                  `yaml:"listen-https"`
+	HTTPSPath         string                  `yaml:"https-path"`
+	Certificate       string                  `yaml:"certificate"`
+	PrivateKey        string                  `yaml:"private-key"`
+	EnhancedMode      C.DNSMode               `yaml:"enhanced-mode"`
+	FakeIPRange       string                  `yaml:"fake-ip-range"`
+	FakeIPRange6      string                  `yaml:"fake-ip-range6"`
+	FakeIPTTL         uint32                  `yaml:"fake-ip-ttl"`
+	FakeIPTTL6        uint32                  `yaml:"fake-ip-ttl6"`
+	FakeIPFilter      []string                `yaml:"fake-ip-filter"`
+	DefaultNameserver []string                `yaml:"default-nameserver"`
+	NameServerPolicy  RawNameServerPolicies   `yaml:"nameserver-policy"`
+	BlockMode         string                  `yaml:"block-mode"`
+	Block             []string                `yaml:"block"`
+	BlockLists        map[string]RawBlockList `yaml:"block-lists"`
+	Records           []string                `yaml:"records"`
+	Rewrites          map[string]string       `yaml:"rewrites"`
+	CacheMinTTL       uint32                  `yaml:"cache-min-ttl"`
+	CacheMaxTTL       uint32                  `yaml:"cache-max-ttl"`
+	CachePrefetch     bool                    `yaml:"cache-prefetch"`
+	CacheServeStale   *bool                   `yaml:"cache-serve-stale"`
+	CacheStaleMaxAge  uint32                  `yaml:"cache-stale-max-age"`
+	CacheStaleTTL     uint32                  `yaml:"cache-stale-ttl"`
+	DNSSEC            bool                    `yaml:"dnssec"`
+	SearchDomains     []string                `yaml:"search-domains"`
+}
+
+// RawAuthBackend is the backend authenticating the users of the local servers instead of authentication
+type RawAuthBackend struct {
+	Type    string `yaml:"type"`
+	Path    string `yaml:"path"`
+	URL     string `yaml:"url"`
+	Timeout int    `yaml:"timeout"`
+}
+
+// RawUserQuota is the limits of an authenticated user, the rates are in bytes per second
+// and the monthly quota is in bytes, the zero values are unlimited
+type RawUserQuota struct {
+	MaxConnections int   `yaml:"max-connections"`
+	UploadRate     int64 `yaml:"upload-rate"`
+	DownloadRate   int64 `yaml:"download-rate"`
+	MonthlyQuota   int64 `yaml:"monthly-quota"`
+}
+
+// RawBlockList is a list of blocked domains pulled from a file or an URL
+type RawBlockList struct {
+	Type     string `yaml:"type"`
+	Path     string `yaml:"path"`
+	URL      string `yaml:"url"`
+	Interval int    `yaml:"interval"`
+}
+
+// RawNameServerPolicies is the entries of nameserver-policy in the order of the config
+type RawNameServerPolicies []RawNameServerPolicyEntry
+
+// RawNameServerPolicyEntry is the nameservers of the domain patterns of Key, e.g. '+.corp.example,rule-set:private'
+type RawNameServerPolicyEntry struct {
+	Key    string
+	Policy RawNameServerPolicy
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, the entries are kept in the order of the mapping
+func (p *RawNameServerPolicies) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: nameserver-policy should be a mapping", node.Line)
+	}
+
+	policies := RawNameServerPolicies{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		entry := RawNameServerPolicyEntry{Key: node.Content[i].Value}
+		if err := node.Content[i+1].Decode(&entry.Policy); err != nil {
+			return err
+		}
+		policies = append(policies, entry)
+	}
+
+	*p = policies
+	return nil
+}
+
+// RawNameServerPolicy is the nameservers of a nameserver-policy entry,
+// it's a nameserver, a list of nameservers or nameservers with fallback
+type RawNameServerPolicy struct {
+	NameServer []string `yaml:"nameserver"`
+	Fallback   []string `yaml:"fallback"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (p *RawNameServerPolicy) UnmarshalYAML(unmarshal func(any) error) error {
+	var server string
+	if err := unmarshal(&server); err == nil {
+		p.NameServer = []string{server}
+		return nil
+	}
+
+	var servers []string
+	if err := unmarshal(&servers); err == nil {
+		p.NameServer = servers
+		return nil
+	}
+
+	type inner RawNameServerPolicy
+	var policy inner
+	if err := unmarshal(&policy); err != nil {
+		return err
+	}
+
+	*p = RawNameServerPolicy(policy)
+	return nil
 }
 
 type RawFallbackFilter struct {
@@ -188,25 +324,31 @@ func (t *Tunnel) UnmarshalYAML(unmarshal func(any) error) error {
 }
 
 type RawConfig struct {
-	Port               int          `yaml:"port"`
-	SocksPort          int          `yaml:"socks-port"`
-	RedirPort          int          `yaml:"redir-port"`
-	TProxyPort         int          `yaml:"tproxy-port"`
-	MixedPort          int          `yaml:"mixed-port"`
-	Authentication     []string     `yaml:"authentication"`
-	AllowLan           bool         `yaml:"allow-lan"`
-	BindAddress        string       `yaml:"bind-address"`
-	Mode               T.TunnelMode `yaml:"mode"`
-	LogLevel           log.LogLevel `yaml:"log-level"`
-	IPv6               bool         `yaml:"ipv6"`
-	ExternalController string       `yaml:"external-controller"`
-	ExternalUI         string       `yaml:"external-ui"`
-	Secret             string       `yaml:"secret"`
-	Interface          string       `yaml:"interface-name"`
-	RoutingMark        int          `yaml:"routing-mark"`
-	Tunnels            []Tunnel     `yaml:"tunnels"`
+	Port               int                     `yaml:"port"`
+	SocksPort          int                     `yaml:"socks-port"`
+	RedirPort          int                     `yaml:"redir-port"`
+	TProxyPort         int                     `yaml:"tproxy-port"`
+	AutoRedirect       bool                    `yaml:"auto-redirect"`
+	MixedPort          int                     `yaml:"mixed-port"`
+	Authentication     []string                `yaml:"authentication"`
+	AuthBackend        *RawAuthBackend         `yaml:"authentication-backend"`
+	UserQuotas         map[string]RawUserQuota `yaml:"user-quotas"`
+	AllowLan           bool                    `yaml:"allow-lan"`
+	BindAddress        string                  `yaml:"bind-address"`
+	LanAllowedIPs      []netip.Prefix          `yaml:"lan-allowed-ips"`
+	LanDisallowedIPs   []netip.Prefix          `yaml:"lan-disallowed-ips"`
+	Mode               T.TunnelMode            `yaml:"mode"`
+	LogLevel           log.LogLevel            `yaml:"log-level"`
+	IPv6               bool                    `yaml:"ipv6"`
+	ExternalController string                  `yaml:"external-controller"`
+	ExternalUI         string                  `yaml:"external-ui"`
+	Secret             string                  `yaml:"secret"`
+	Interface          string                  `yaml:"interface-name"`
+	RoutingMark        int                     `yaml:"routing-mark"`
+	Tunnels            []Tunnel                `yaml:"tunnels"`
 
 	ProxyProvider map[string]map[string]any `yaml:"proxy-providers"`
+	RuleProvider  map[string]map[string]any `yaml:"rule-providers"`
 	Hosts         map[string]string         `yaml:"hosts"`
 	Inbounds      []C.Inbound               `yaml:"inbounds"`
 	DNS           RawDNS                    `yaml:"dns"`
@@ -216,6 +358,7 @@ type RawConfig struct {
 	Proxy         []map[string]any          `yaml:"proxies"`
 	ProxyGroup    []map[string]any          `yaml:"proxy-groups"`
 	Rule          []string                  `yaml:"rules"`
+	SubRules      map[string][]string       `yaml:"sub-rules"`
 }
 
 // Parse config
@@ -245,6 +388,7 @@ func UnmarshalRawConfig(buf []byte) (*RawConfig, error) {
 			Enable:      false,
 			UseHosts:    true,
 			FakeIPRange: "198.18.0.1/16",
+			HTTPSPath:   "/dns-query",
 			FallbackFilter: RawFallbackFilter{
 				GeoIP:     true,
 				GeoIPCode: "CN",
@@ -289,19 +433,41 @@ func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
 	config.Proxies = proxies
 	config.Providers = providers
 
-	rules, err := parseRules(rawCfg, proxies)
+	ruleProviders, err := parseRuleProviders(rawCfg, proxies)
+	if err != nil {
+		return nil, err
+	}
+	config.RuleProviders = ruleProviders
+
+	rules, err := parseRules(rawCfg, proxies, ruleProviders)
 	if err != nil {
 		return nil, err
 	}
 	config.Rules = rules
 
+	subRules, err := parseSubRules(rawCfg, proxies, ruleProviders)
+	if err != nil {
+		return nil, err
+	}
+	config.SubRules = subRules
+
+	// verify the routing of inbounds
+	for _, inbound := range config.Inbounds {
+		if _, ok := config.Proxies[inbound.Proxy]; inbound.Proxy != "" && !ok {
+			return nil, fmt.Errorf("inbound %s proxy %s not found", inbound.ToAlias(), inbound.Proxy)
+		}
+		if _, ok := config.SubRules[inbound.Rules]; inbound.Rules != "" && !ok {
+			return nil, fmt.Errorf("inbound %s sub-rules %s not found", inbound.ToAlias(), inbound.Rules)
+		}
+	}
+
 	hosts, err := parseHosts(rawCfg)
 	if err != nil {
 		return nil, err
 	}
 	config.Hosts = hosts
 
-	dnsCfg, err := parseDNS(rawCfg, hosts)
+	dnsCfg, err := parseDNS(rawCfg, hosts, ruleProviders)
 	if err != nil {
 		return nil, err
 	}
@@ -314,6 +480,26 @@ func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
 
 	config.Users = parseAuthentication(rawCfg.Authentication)
 
+	userQuotas, err := parseUserQuotas(rawCfg.UserQuotas)
+	if err != nil {
+		return nil, err
+	}
+	config.UserQuotas = userQuotas
+
+	// verify nameserver proxies
+	nameservers := append(append([]dns.NameServer{}, dnsCfg.NameServer...), dnsCfg.Fallback...)
+	for _, policy := range dnsCfg.NameServerPolicy {
+		nameservers = append(append(nameservers, policy.Main...), policy.Fallback...)
+	}
+	for _, ns := range nameservers {
+		if ns.ProxyAdapter == "" {
+			continue
+		}
+		if _, ok := config.Proxies[ns.ProxyAdapter]; !ok {
+			return nil, fmt.Errorf("DNS nameserver %s proxy %s not found", ns.Addr, ns.ProxyAdapter)
+		}
+	}
+
 	config.Tunnels = rawCfg.Tunnels
 	// verify tunnels
 	for _, t := range config.Tunnels {
@@ -322,6 +508,13 @@ func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
 		}
 	}
 
+	// the backend may watch its file, parse it after all the verifications
+	authBackend, err := parseAuthBackend(rawCfg)
+	if err != nil {
+		return nil, err
+	}
+	config.AuthBackend = authBackend
+
 	return config, nil
 }
 
@@ -346,6 +539,11 @@ func parseGeneral(cfg *RawConfig) (*General, error) {
 			MixedPort:   cfg.MixedPort,
 			AllowLan:    cfg.AllowLan,
 			BindAddress: cfg.BindAddress,
+
+			AutoRedirect: cfg.AutoRedirect,
+
+			LanAllowedIPs:    cfg.LanAllowedIPs,
+			LanDisallowedIPs: cfg.LanDisallowedIPs,
 		},
 		Controller: Controller{
 			ExternalController: cfg.ExternalController,
@@ -406,20 +604,14 @@ func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[
 			return nil, nil, fmt.Errorf("can not defined a provider called `%s`", provider.ReservedName)
 		}
 
-		pd, err := provider.ParseProxyProvider(name, mapping)
+		pd, err := provider.ParseProxyProvider(name, mapping, proxies)
 		if err != nil {
 			return nil, nil, fmt.Errorf("parse proxy provider %s error: %w", name, err)
 		}
 
 		providersMap[name] = pd
 	}
-
-	for _, provider := range providersMap {
-		log.Infoln("Start initial provider %s", provider.Name())
-		if err := provider.Initial(); err != nil {
-			return nil, nil, fmt.Errorf("initial proxy provider %s error: %w", provider.Name(), err)
-		}
-	}
+	proxySetProviders := lo.Values(providersMap)
 
 	// parse proxy group
 	for idx, mapping := range groupsConfig {
@@ -463,12 +655,55 @@ func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[
 		[]providerTypes.ProxyProvider{pd},
 	)
 	proxies["GLOBAL"] = adapter.NewProxy(global)
+
+	// initial providers after all proxies and groups are parsed,
+	// so a provider can be fetched through any of them
+	for _, provider := range proxySetProviders {
+		log.Infoln("Start initial provider %s", provider.Name())
+		if err := provider.Initial(); err != nil {
+			return nil, nil, fmt.Errorf("initial proxy provider %s error: %w", provider.Name(), err)
+		}
+	}
+
 	return proxies, providersMap, nil
 }
 
-func parseRules(cfg *RawConfig, proxies map[string]C.Proxy) ([]C.Rule, error) {
+func parseRuleProviders(cfg *RawConfig, proxies map[string]C.Proxy) (map[string]providerTypes.RuleProvider, error) {
+	ruleProviders := map[string]providerTypes.RuleProvider{}
+	for name, mapping := range cfg.RuleProvider {
+		pd, err := provider.ParseRuleProvider(name, mapping, proxies)
+		if err != nil {
+			return nil, fmt.Errorf("parse rule provider %s error: %w", name, err)
+		}
+
+		log.Infoln("Start initial rule provider %s", name)
+		if err := pd.Initial(); err != nil {
+			return nil, fmt.Errorf("initial rule provider %s error: %w", name, err)
+		}
+		ruleProviders[name] = pd
+	}
+	return ruleProviders, nil
+}
+
+func parseRules(cfg *RawConfig, proxies map[string]C.Proxy, ruleProviders map[string]providerTypes.RuleProvider) ([]C.Rule, error) {
+	return parseRuleLines("rules", cfg.Rule, proxies, ruleProviders)
+}
+
+func parseSubRules(cfg *RawConfig, proxies map[string]C.Proxy, ruleProviders map[string]providerTypes.RuleProvider) (map[string][]C.Rule, error) {
+	subRules := map[string][]C.Rule{}
+	for name, lines := range cfg.SubRules {
+		rules, err := parseRuleLines(fmt.Sprintf("sub-rules[%s]", name), lines, proxies, ruleProviders)
+		if err != nil {
+			return nil, err
+		}
+		subRules[name] = rules
+	}
+	return subRules, nil
+}
+
+// parseRuleLines parses the rule lines, prefix is the name of the lines in the errors
+func parseRuleLines(prefix string, rulesConfig []string, proxies map[string]C.Proxy, ruleProviders map[string]providerTypes.RuleProvider) ([]C.Rule, error) {
 	rules := []C.Rule{}
-	rulesConfig := cfg.Rule
 
 	// parse rules
 	for idx, line := range rulesConfig {
@@ -490,19 +725,29 @@ func parseRules(cfg *RawConfig, proxies map[string]C.Proxy) ([]C.Rule, error) {
 			target = rule[2]
 			params = rule[3:]
 		default:
-			return nil, fmt.Errorf("rules[%d] [%s] error: format invalid", idx, line)
+			return nil, fmt.Errorf("%s[%d] [%s] error: format invalid", prefix, idx, line)
 		}
 
 		if _, ok := proxies[target]; !ok {
-			return nil, fmt.Errorf("rules[%d] [%s] error: proxy [%s] not found", idx, line, target)
+			return nil, fmt.Errorf("%s[%d] [%s] error: proxy [%s] not found", prefix, idx, line, target)
 		}
 
 		rule = trimArr(rule)
 		params = trimArr(params)
 
+		// the rule provider is matched with its own rules, e.g. 'RULE-SET,private,DIRECT'
+		if C.RuleConfig(rule[0]) == C.RuleConfigRuleSet {
+			ruleProvider, exist := ruleProviders[payload]
+			if !exist {
+				return nil, fmt.Errorf("%s[%d] [%s] error: rule provider [%s] not found", prefix, idx, line, payload)
+			}
+			rules = append(rules, ruleProvider.AsRule(target))
+			continue
+		}
+
 		parsed, parseErr := R.ParseRule(rule[0], payload, target, params)
 		if parseErr != nil {
-			return nil, fmt.Errorf("rules[%d] [%s] error: %s", idx, line, parseErr.Error())
+			return nil, fmt.Errorf("%s[%d] [%s] error: %s", prefix, idx, line, parseErr.Error())
 		}
 
 		rules = append(rules, parsed)
@@ -562,9 +807,39 @@ func parseNameServer(servers []string) ([]dns.NameServer, error) {
 			return nil, fmt.Errorf("DNS NameServer[%d] format error: %s", idx, err.Error())
 		}
 
-		// parse with specific interface
-		// .e.g 10.0.0.1#en0
-		interfaceName := u.Fragment
+		// parse with specific interface and options
+		// .e.g 10.0.0.1#en0, https://1.1.1.1/dns-query#h3&proxy=Proxy&ecs=1.2.3.0/24
+		var (
+			interfaceName string
+			proxyAdapter  string
+			h3            bool
+			ecsMode       dns.ECSMode
+			ecsSubnet     *net.IPNet
+		)
+		for _, opt := range strings.Split(u.Fragment, "&") {
+			key, value, _ := strings.Cut(opt, "=")
+			switch {
+			case opt == "":
+			case opt == "h3" && u.Scheme == "https":
+				h3 = true
+			case key == "proxy":
+				proxyAdapter = value
+			case key == "ecs":
+				if ecsMode, ecsSubnet, err = dns.ParseECS(value); err != nil {
+					return nil, fmt.Errorf("DNS NameServer[%d] format error: %s", idx, err.Error())
+				}
+			default:
+				interfaceName = opt
+			}
+		}
+
+		if proxyAdapter != "" && u.Scheme == "dhcp" {
+			return nil, fmt.Errorf("DNS NameServer[%d] dhcp doesn't support proxy", idx)
+		}
+		if proxyAdapter != "" && interfaceName != "" {
+			// the nameserver is reached through the proxy, which dials with its own interface
+			return nil, fmt.Errorf("DNS NameServer[%d] interface %s can't be used with proxy", idx, interfaceName)
+		}
 
 		var addr, dnsNetType string
 		switch u.Scheme {
@@ -581,6 +856,16 @@ func parseNameServer(servers []string) ([]dns.NameServer, error) {
 			clearURL := url.URL{Scheme: "https", Host: u.Host, Path: u.Path, User: u.User}
 			addr = clearURL.String()
 			dnsNetType = "https" // DNS over HTTPS
+			if h3 {
+				dnsNetType = "h3" // DNS over HTTP/3
+			}
+		case "h3":
+			clearURL := url.URL{Scheme: "https", Host: u.Host, Path: u.Path, User: u.User}
+			addr = clearURL.String()
+			dnsNetType = "h3" // DNS over HTTP/3
+		case "quic":
+			addr, err = hostWithDefaultPort(u.Host, "853")
+			dnsNetType = "quic" // DNS over QUIC
 		case "dhcp":
 			addr = u.Host
 			dnsNetType = "dhcp" // UDP from DHCP
@@ -595,32 +880,134 @@ func parseNameServer(servers []string) ([]dns.NameServer, error) {
 		nameservers = append(
 			nameservers,
 			dns.NameServer{
-				Net:       dnsNetType,
-				Addr:      addr,
-				Interface: interfaceName,
+				Net:          dnsNetType,
+				Addr:         addr,
+				Interface:    interfaceName,
+				ProxyAdapter: proxyAdapter,
+				ECSMode:      ecsMode,
+				ECSSubnet:    ecsSubnet,
 			},
 		)
 	}
 	return nameservers, nil
 }
 
-func parseNameServerPolicy(nsPolicy map[string]string) (map[string]dns.NameServer, error) {
-	policy := map[string]dns.NameServer{}
+func parseNameServerPolicy(nsPolicy RawNameServerPolicies, ruleProviders map[string]providerTypes.RuleProvider) ([]dns.Policy, error) {
+	policy := []dns.Policy{}
+	domains := map[string]struct{}{}
+
+	for _, entry := range nsPolicy {
+		key, servers := entry.Key, entry.Policy
+		if len(servers.NameServer) == 0 {
+			return nil, fmt.Errorf("DNS ResolverRule %s nameserver cannot be empty", key)
+		}
 
-	for domain, server := range nsPolicy {
-		nameservers, err := parseNameServer([]string{server})
+		nameservers, err := parseNameServer(servers.NameServer)
 		if err != nil {
 			return nil, err
 		}
-		if _, valid := trie.ValidAndSplitDomain(domain); !valid {
-			return nil, fmt.Errorf("DNS ResoverRule invalid domain: %s", domain)
+		fallback, err := parseNameServer(servers.Fallback)
+		if err != nil {
+			return nil, err
+		}
+
+		// multiple patterns share the same nameservers, e.g. '+.corp.example,+.corp.internal'
+		for _, domain := range trimArr(strings.Split(key, ",")) {
+			if _, exist := domains[domain]; exist {
+				return nil, fmt.Errorf("DNS ResolverRule duplicate domain: %s", domain)
+			}
+			domains[domain] = struct{}{}
+
+			// e.g. 'rule-set:private', the queried domains matching the rule provider
+			if prefix, name, ok := strings.Cut(domain, ":"); ok && strings.EqualFold(prefix, "rule-set") {
+				ruleProvider, exist := ruleProviders[name]
+				if !exist {
+					return nil, fmt.Errorf("DNS ResolverRule %s: rule provider %s not found", domain, name)
+				}
+				policy = append(policy, dns.Policy{Domain: domain, Main: nameservers, Fallback: fallback, RuleSet: ruleProvider})
+				continue
+			}
+
+			if _, valid := trie.ValidAndSplitDomain(domain); !valid {
+				return nil, fmt.Errorf("DNS ResolverRule invalid domain: %s", domain)
+			}
+			policy = append(policy, dns.Policy{Domain: domain, Main: nameservers, Fallback: fallback})
 		}
-		policy[domain] = nameservers[0]
 	}
 
 	return policy, nil
 }
 
+func parseDNSFilter(cfg RawDNS) (dns.FilterConfig, error) {
+	filter := dns.FilterConfig{
+		BlockMode: dns.BlockMode(cfg.BlockMode),
+		Rewrites:  map[string]string{},
+	}
+
+	switch filter.BlockMode {
+	case "", dns.BlockNXDomain, dns.BlockNullIP, dns.BlockRefused:
+	default:
+		return filter, fmt.Errorf("DNS block-mode %s is invalid", cfg.BlockMode)
+	}
+
+	for _, domain := range cfg.Block {
+		if _, valid := trie.ValidAndSplitDomain(domain); !valid {
+			return filter, fmt.Errorf("DNS block invalid domain: %s", domain)
+		}
+	}
+	filter.Block = cfg.Block
+
+	for name, list := range cfg.BlockLists {
+		path := C.Path.Resolve(list.Path)
+
+		var vehicle providerTypes.Vehicle
+		switch list.Type {
+		case "file":
+			vehicle = provider.NewFileVehicle(path)
+		case "http":
+			if list.Path == "" {
+				path = C.Path.Resolve(filepath.Join("blocklists", name))
+			}
+			if !C.Path.IsSubPath(path) {
+				return filter, fmt.Errorf("DNS block list %s path is not subpath of home directory: %s", name, path)
+			}
+			vehicle = provider.NewHTTPVehicle(list.URL, path, nil, "", nil)
+		default:
+			return filter, fmt.Errorf("DNS block list %s unsupported vehicle type: %s", name, list.Type)
+		}
+
+		filter.BlockLists = append(filter.BlockLists, dns.BlockList{
+			Name:     name,
+			Vehicle:  vehicle,
+			Interval: time.Duration(list.Interval) * time.Second,
+		})
+	}
+
+	for idx, record := range cfg.Records {
+		rr, err := D.NewRR(record)
+		if err != nil {
+			return filter, fmt.Errorf("DNS records[%d] format error: %w", idx, err)
+		} else if rr == nil {
+			return filter, fmt.Errorf("DNS records[%d] is empty", idx)
+		}
+		filter.Records = append(filter.Records, rr)
+	}
+
+	for domain, target := range cfg.Rewrites {
+		if _, valid := trie.ValidAndSplitDomain(domain); !valid {
+			return filter, fmt.Errorf("DNS rewrites invalid domain: %s", domain)
+		}
+		if net.ParseIP(target) == nil {
+			if _, valid := trie.ValidAndSplitDomain(target); !valid {
+				return filter, fmt.Errorf("DNS rewrites invalid target: %s", target)
+			}
+		}
+		filter.Rewrites[domain] = target
+	}
+
+	return filter, nil
+}
+
 func parseFallbackIPCIDR(ips []string) ([]*net.IPNet, error) {
 	ipNets := []*net.IPNet{}
 
@@ -635,7 +1022,7 @@ func parseFallbackIPCIDR(ips []string) ([]*net.IPNet, error) {
 	return ipNets, nil
 }
 
-func parseDNS(rawCfg *RawConfig, hosts *trie.DomainTrie) (*DNS, error) {
+func parseDNS(rawCfg *RawConfig, hosts *trie.DomainTrie, ruleProviders map[string]providerTypes.RuleProvider) (*DNS, error) {
 	cfg := rawCfg.DNS
 	if cfg.Enable && len(cfg.NameServer) == 0 {
 		return nil, fmt.Errorf("if DNS configuration is turned on, NameServer cannot be empty")
@@ -644,12 +1031,31 @@ func parseDNS(rawCfg *RawConfig, hosts *trie.DomainTrie) (*DNS, error) {
 	dnsCfg := &DNS{
 		Enable:       cfg.Enable,
 		Listen:       cfg.Listen,
+		ListenTCP:    cfg.ListenTCP,
+		ListenTLS:    cfg.ListenTLS,
+		ListenHTTPS:  cfg.ListenHTTPS,
+		HTTPSPath:    cfg.HTTPSPath,
+		CacheMinTTL:  cfg.CacheMinTTL,
+		CacheMaxTTL:  cfg.CacheMaxTTL,
+		PersistCache: rawCfg.Profile.StoreDNSCache,
 		IPv6:         lo.FromPtrOr(cfg.IPv6, rawCfg.IPv6),
 		EnhancedMode: cfg.EnhancedMode,
 		FallbackFilter: FallbackFilter{
 			IPCIDR: []*net.IPNet{},
 		},
 	}
+	if cfg.ListenTLS != "" || cfg.ListenHTTPS != "" {
+		if cfg.Certificate == "" || cfg.PrivateKey == "" {
+			return nil, errors.New("DNS listen-tls and listen-https require certificate and private-key")
+		}
+		dnsCfg.Certificate = C.Path.Resolve(cfg.Certificate)
+		dnsCfg.PrivateKey = C.Path.Resolve(cfg.PrivateKey)
+	}
+
+	if cfg.HTTPSPath != "" && !strings.HasPrefix(cfg.HTTPSPath, "/") {
+		return nil, fmt.Errorf("DNS https-path should start with '/': %s", cfg.HTTPSPath)
+	}
+
 	var err error
 	if dnsCfg.NameServer, err = parseNameServer(cfg.NameServer); err != nil {
 		return nil, err
@@ -659,7 +1065,23 @@ func parseDNS(rawCfg *RawConfig, hosts *trie.DomainTrie) (*DNS, error) {
 		return nil, err
 	}
 
-	if dnsCfg.NameServerPolicy, err = parseNameServerPolicy(cfg.NameServerPolicy); err != nil {
+	if dnsCfg.NameServerPolicy, err = parseNameServerPolicy(cfg.NameServerPolicy, ruleProviders); err != nil {
+		return nil, err
+	}
+
+	if cfg.CacheMaxTTL != 0 && cfg.CacheMinTTL > cfg.CacheMaxTTL {
+		return nil, errors.New("DNS cache-min-ttl should not be greater than cache-max-ttl")
+	}
+	dnsCfg.CachePrefetch = cfg.CachePrefetch
+	dnsCfg.CacheServeStale = lo.FromPtrOr(cfg.CacheServeStale, true)
+	dnsCfg.CacheStaleMaxAge = cfg.CacheStaleMaxAge
+	dnsCfg.CacheStaleTTL = cfg.CacheStaleTTL
+	if dnsCfg.CacheStaleTTL == 0 {
+		dnsCfg.CacheStaleTTL = 1
+	}
+	dnsCfg.DNSSEC = cfg.DNSSEC
+
+	if dnsCfg.Filter, err = parseDNSFilter(cfg); err != nil {
 		return nil, err
 	}
 
@@ -675,14 +1097,13 @@ func parseDNS(rawCfg *RawConfig, hosts *trie.DomainTrie) (*DNS, error) {
 		if err != nil || net.ParseIP(host) == nil {
 			return nil, errors.New("default nameserver should be pure IP")
 		}
+		// the hostnames of the proxy servers are resolved by the default nameservers
+		if ns.ProxyAdapter != "" {
+			return nil, errors.New("default nameserver doesn't support proxy")
+		}
 	}
 
 	if cfg.EnhancedMode == C.DNSFakeIP {
-		_, ipnet, err := net.ParseCIDR(cfg.FakeIPRange)
-		if err != nil {
-			return nil, err
-		}
-
 		var host *trie.DomainTrie
 		// fake ip skip host filter
 		if len(cfg.FakeIPFilter) != 0 {
@@ -692,17 +1113,46 @@ func parseDNS(rawCfg *RawConfig, hosts *trie.DomainTrie) (*DNS, error) {
 			}
 		}
 
-		pool, err := fakeip.New(fakeip.Options{
-			IPNet:       ipnet,
-			Size:        1000,
-			Host:        host,
-			Persistence: rawCfg.Profile.StoreFakeIP,
-		})
+		newPool := func(cidr string, ttl uint32) (*fakeip.Pool, error) {
+			_, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+
+			return fakeip.New(fakeip.Options{
+				IPNet:       ipnet,
+				Size:        1000,
+				Host:        host,
+				Persistence: rawCfg.Profile.StoreFakeIP,
+				TTL:         ttl,
+				InUse:       statistic.DefaultManager.FakeIPInUse,
+			})
+		}
+
+		pool, err := newPool(cfg.FakeIPRange, cfg.FakeIPTTL)
 		if err != nil {
 			return nil, err
 		}
-
+		if pool.IPv6() {
+			return nil, errors.New("fake-ip-range should be an IPv4 range, use fake-ip-range6 for IPv6")
+		}
 		dnsCfg.FakeIPRange = pool
+
+		if cfg.FakeIPRange6 != "" {
+			// the IPv6 pool has the TTL of the IPv4 one unless it's set
+			ttl6 := cfg.FakeIPTTL6
+			if ttl6 == 0 {
+				ttl6 = cfg.FakeIPTTL
+			}
+			pool6, err := newPool(cfg.FakeIPRange6, ttl6)
+			if err != nil {
+				return nil, err
+			}
+			if !pool6.IPv6() {
+				return nil, errors.New("fake-ip-range6 should be an IPv6 range")
+			}
+			dnsCfg.FakeIPRange6 = pool6
+		}
 	}
 
 	dnsCfg.FallbackFilter.GeoIP = cfg.FallbackFilter.GeoIP
@@ -731,6 +1181,48 @@ func parseDNS(rawCfg *RawConfig, hosts *trie.DomainTrie) (*DNS, error) {
 	return dnsCfg, nil
 }
 
+func parseAuthBackend(cfg *RawConfig) (auth.Authenticator, error) {
+	backend := cfg.AuthBackend
+	if backend == nil {
+		return nil, nil
+	}
+	if len(cfg.Authentication) != 0 {
+		return nil, errors.New("authentication and authentication-backend are exclusive")
+	}
+
+	switch backend.Type {
+	case "htpasswd":
+		au, err := auth.NewHtpasswdAuthenticator(C.Path.Resolve(backend.Path))
+		if err != nil {
+			return nil, fmt.Errorf("authentication-backend htpasswd error: %w", err)
+		}
+		return au, nil
+	case "http":
+		u, err := url.Parse(backend.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("authentication-backend invalid url: %s", backend.URL)
+		}
+		timeout := 5 * time.Second
+		if backend.Timeout > 0 {
+			timeout = time.Duration(backend.Timeout) * time.Millisecond
+		}
+		return auth.NewHTTPAuthenticator(backend.URL, timeout), nil
+	default:
+		return nil, fmt.Errorf("authentication-backend unsupported type: %s", backend.Type)
+	}
+}
+
+func parseUserQuotas(rawQuotas map[string]RawUserQuota) (map[string]statistic.UserQuota, error) {
+	quotas := map[string]statistic.UserQuota{}
+	for name, raw := range rawQuotas {
+		if raw.MaxConnections < 0 || raw.UploadRate < 0 || raw.DownloadRate < 0 || raw.MonthlyQuota < 0 {
+			return nil, fmt.Errorf("user-quotas %s: negative limit", name)
+		}
+		quotas[name] = statistic.UserQuota(raw)
+	}
+	return quotas, nil
+}
+
 func parseAuthentication(rawRecords []string) []auth.AuthUser {
 	users := []auth.AuthUser{}
 	for _, line := range rawRecords {
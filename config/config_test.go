@@ -0,0 +1,274 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapter"
+	"github.com/Dreamacro/clash/adapter/outbound"
+	"github.com/Dreamacro/clash/adapter/provider"
+	C "github.com/Dreamacro/clash/constant"
+	providerTypes "github.com/Dreamacro/clash/constant/provider"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNameServerPolicy_RuleSet(t *testing.T) {
+	ruleSet, err := provider.NewRuleSetProvider("private", providerTypes.Domain, 0, "", provider.NewFileVehicle("private.yaml"))
+	require.NoError(t, err)
+	ruleProviders := map[string]providerTypes.RuleProvider{"private": ruleSet}
+
+	policy, err := parseNameServerPolicy(RawNameServerPolicies{
+		{Key: "rule-set:private,+.corp.example", Policy: RawNameServerPolicy{NameServer: []string{"10.0.0.1"}}},
+		{Key: "RULE-SET:private2", Policy: RawNameServerPolicy{NameServer: []string{"10.0.0.2"}}},
+	}, map[string]providerTypes.RuleProvider{"private": ruleSet, "private2": ruleSet})
+	require.NoError(t, err)
+	require.Len(t, policy, 3)
+	assert.Equal(t, "rule-set:private", policy[0].Domain)
+	assert.Equal(t, ruleSet, policy[0].RuleSet)
+	assert.Equal(t, "10.0.0.1:53", policy[0].Main[0].Addr)
+	assert.Equal(t, "+.corp.example", policy[1].Domain)
+	assert.Nil(t, policy[1].RuleSet)
+	assert.Equal(t, "RULE-SET:private2", policy[2].Domain)
+	assert.Equal(t, ruleSet, policy[2].RuleSet)
+
+	_, err = parseNameServerPolicy(RawNameServerPolicies{
+		{Key: "rule-set:missing", Policy: RawNameServerPolicy{NameServer: []string{"10.0.0.1"}}},
+	}, ruleProviders)
+	assert.EqualError(t, err, "DNS ResolverRule rule-set:missing: rule provider missing not found")
+
+	_, err = parseNameServerPolicy(RawNameServerPolicies{
+		{Key: "rule-set:private,rule-set:private", Policy: RawNameServerPolicy{NameServer: []string{"10.0.0.1"}}},
+	}, ruleProviders)
+	assert.EqualError(t, err, "DNS ResolverRule duplicate domain: rule-set:private")
+}
+
+func TestParseRawConfig_RuleProviders(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "private.yaml"), []byte("payload:\n  - '+.lan'\n"), 0o600))
+
+	rawCfg, err := UnmarshalRawConfig([]byte(`
+rule-providers:
+  private:
+    type: file
+    behavior: domain
+    path: ` + filepath.Join(dir, "private.yaml") + `
+rules:
+  - RULE-SET,private,DIRECT
+`))
+	require.NoError(t, err)
+
+	cfg, err := ParseRawConfig(rawCfg)
+	require.NoError(t, err)
+
+	ruleSet := cfg.RuleProviders["private"]
+	require.NotNil(t, ruleSet)
+	assert.True(t, ruleSet.Match(&C.Metadata{Host: "nas.lan"}))
+	assert.False(t, ruleSet.Match(&C.Metadata{Host: "example.com"}))
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "private.yaml")))
+	_, err = ParseRawConfig(rawCfg)
+	assert.ErrorContains(t, err, "initial rule provider private error")
+}
+
+func TestParseRawConfig_NameServerPolicy(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "private.yaml"), []byte("payload:\n  - '+.lan'\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nas.yaml"), []byte("payload:\n  - 'nas.lan'\n"), 0o600))
+
+	rawCfg, err := UnmarshalRawConfig([]byte(`
+rule-providers:
+  private:
+    type: file
+    behavior: domain
+    path: ` + filepath.Join(dir, "private.yaml") + `
+  nas:
+    type: file
+    behavior: domain
+    path: ` + filepath.Join(dir, "nas.yaml") + `
+dns:
+  enable: true
+  nameserver: [1.1.1.1]
+  nameserver-policy:
+    'rule-set:private': 10.0.0.1
+    '+.example.com': [10.0.0.3, 10.0.0.4]
+    'rule-set:nas': 10.0.0.2
+`))
+	require.NoError(t, err)
+
+	cfg, err := ParseRawConfig(rawCfg)
+	require.NoError(t, err)
+
+	// the policies are in the order of the config rather than the order of the keys
+	policy := cfg.DNS.NameServerPolicy
+	require.Len(t, policy, 3)
+	assert.Equal(t, []string{"rule-set:private", "+.example.com", "rule-set:nas"}, []string{policy[0].Domain, policy[1].Domain, policy[2].Domain})
+	assert.Len(t, policy[1].Main, 2)
+
+	ruleSet := policy[0].RuleSet
+	require.NotNil(t, ruleSet)
+	assert.Equal(t, cfg.RuleProviders["private"], ruleSet)
+	assert.True(t, ruleSet.Match(&C.Metadata{Host: "nas.lan"}))
+	assert.False(t, ruleSet.Match(&C.Metadata{Host: "example.com"}))
+}
+
+func TestParseSubRules(t *testing.T) {
+	proxies := map[string]C.Proxy{
+		"DIRECT": adapter.NewProxy(outbound.NewDirect()),
+		"REJECT": adapter.NewProxy(outbound.NewReject()),
+	}
+
+	subRules, err := parseSubRules(&RawConfig{SubRules: map[string][]string{
+		"office": {"DOMAIN-SUFFIX,corp.example.com,DIRECT", "MATCH,REJECT"},
+	}}, proxies, nil)
+	require.NoError(t, err)
+	require.Len(t, subRules["office"], 2)
+	assert.Equal(t, C.DomainSuffix, subRules["office"][0].RuleType())
+	assert.Equal(t, "REJECT", subRules["office"][1].Adapter())
+
+	_, err = parseSubRules(&RawConfig{SubRules: map[string][]string{
+		"office": {"DOMAIN-SUFFIX,corp.example.com,missing"},
+	}}, proxies, nil)
+	assert.EqualError(t, err, "sub-rules[office][0] [DOMAIN-SUFFIX,corp.example.com,missing] error: proxy [missing] not found")
+
+	_, err = parseSubRules(&RawConfig{SubRules: map[string][]string{
+		"office": {"DIRECT"},
+	}}, proxies, nil)
+	assert.EqualError(t, err, "sub-rules[office][0] [DIRECT] error: format invalid")
+}
+
+func TestParseRules_RuleSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "private.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("payload:\n  - '+.lan'\n"), 0o600))
+	ruleSet, err := provider.NewRuleSetProvider("private", providerTypes.Domain, 0, "", provider.NewFileVehicle(path))
+	require.NoError(t, err)
+	require.NoError(t, ruleSet.Initial())
+	ruleProviders := map[string]providerTypes.RuleProvider{"private": ruleSet}
+	proxies := map[string]C.Proxy{"DIRECT": adapter.NewProxy(outbound.NewDirect())}
+
+	rules, err := parseRules(&RawConfig{Rule: []string{"RULE-SET,private,DIRECT", "MATCH,DIRECT"}}, proxies, ruleProviders)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, C.RuleSet, rules[0].RuleType())
+	assert.Equal(t, "private", rules[0].Payload())
+	assert.Equal(t, "DIRECT", rules[0].Adapter())
+	assert.True(t, rules[0].Match(&C.Metadata{Host: "nas.lan"}))
+	assert.False(t, rules[0].Match(&C.Metadata{Host: "example.com"}))
+
+	subRules, err := parseSubRules(&RawConfig{SubRules: map[string][]string{
+		"office": {"RULE-SET,private,DIRECT"},
+	}}, proxies, ruleProviders)
+	require.NoError(t, err)
+	assert.Equal(t, C.RuleSet, subRules["office"][0].RuleType())
+
+	_, err = parseRules(&RawConfig{Rule: []string{"RULE-SET,missing,DIRECT"}}, proxies, ruleProviders)
+	assert.EqualError(t, err, "rules[0] [RULE-SET,missing,DIRECT] error: rule provider [missing] not found")
+}
+
+func TestParseRawConfig_InboundRouting(t *testing.T) {
+	parse := func(inbound string) error {
+		rawCfg, err := UnmarshalRawConfig([]byte(`
+inbounds:
+  - ` + inbound + `
+sub-rules:
+  office:
+    - MATCH,DIRECT
+`))
+		require.NoError(t, err)
+		_, err = ParseRawConfig(rawCfg)
+		return err
+	}
+
+	assert.NoError(t, parse("{type: socks, bind-address: 127.0.0.1:7895, rules: office}"))
+	assert.NoError(t, parse("{type: socks, bind-address: 127.0.0.1:7895, proxy: REJECT}"))
+	assert.ErrorContains(t, parse("{type: socks, bind-address: 127.0.0.1:7895, rules: missing}"), "sub-rules missing not found")
+	assert.ErrorContains(t, parse("{type: socks, bind-address: 127.0.0.1:7895, proxy: missing}"), "proxy missing not found")
+}
+
+func TestParseNameServer(t *testing.T) {
+	tests := []struct {
+		server string
+		net    string
+		addr   string
+		iface  string
+		proxy  string
+		err    string
+	}{
+		{server: "1.1.1.1", addr: "1.1.1.1:53"},
+		{server: "1.1.1.1#en0", addr: "1.1.1.1:53", iface: "en0"},
+		{server: "tcp://1.1.1.1", net: "tcp", addr: "1.1.1.1:53"},
+		{server: "tls://1.1.1.1", net: "tcp-tls", addr: "1.1.1.1:853"},
+		{server: "quic://dns.adguard.com", net: "quic", addr: "dns.adguard.com:853"},
+		{server: "quic://dns.adguard.com:784#proxy=Proxy", net: "quic", addr: "dns.adguard.com:784", proxy: "Proxy"},
+		{server: "https://1.1.1.1/dns-query", net: "https", addr: "https://1.1.1.1/dns-query"},
+		{server: "https://1.1.1.1/dns-query#h3", net: "h3", addr: "https://1.1.1.1/dns-query"},
+		{server: "https://1.1.1.1/dns-query#h3&proxy=Proxy", net: "h3", addr: "https://1.1.1.1/dns-query", proxy: "Proxy"},
+		{server: "h3://dns.google/dns-query", net: "h3", addr: "https://dns.google/dns-query"},
+		{server: "tls://1.1.1.1#en0&proxy=Proxy", err: "DNS NameServer[0] interface en0 can't be used with proxy"},
+		{server: "ftp://1.1.1.1", err: "DNS NameServer[0] unsupport scheme: ftp"},
+		{server: "dhcp://en0#proxy=Proxy", err: "DNS NameServer[0] dhcp doesn't support proxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			nameservers, err := parseNameServer([]string{tt.server})
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, nameservers, 1)
+			assert.Equal(t, tt.net, nameservers[0].Net)
+			assert.Equal(t, tt.addr, nameservers[0].Addr)
+			assert.Equal(t, tt.iface, nameservers[0].Interface)
+			assert.Equal(t, tt.proxy, nameservers[0].ProxyAdapter)
+		})
+	}
+}
+
+func TestParseNameServerPolicy_Transport(t *testing.T) {
+	policy, err := parseNameServerPolicy(RawNameServerPolicies{
+		{Key: "+.google.com", Policy: RawNameServerPolicy{NameServer: []string{"quic://dns.adguard.com", "h3://dns.google/dns-query"}}},
+	}, nil)
+	require.NoError(t, err)
+	main := policy[0].Main
+	require.Len(t, main, 2)
+	assert.Equal(t, "quic", main[0].Net)
+	assert.Equal(t, "h3", main[1].Net)
+}
+
+func TestParseRawConfig_FakeIPRange6(t *testing.T) {
+	parse := func(dns string) (*Config, error) {
+		rawCfg, err := UnmarshalRawConfig([]byte("dns:\n  enable: true\n  nameserver: [1.1.1.1]\n  enhanced-mode: fake-ip\n" + dns))
+		require.NoError(t, err)
+		return ParseRawConfig(rawCfg)
+	}
+
+	cfg, err := parse("  fake-ip-range: 198.18.0.1/16\n  fake-ip-range6: fdfe:dcba:9877::/64\n  fake-ip-ttl: 5\n")
+	require.NoError(t, err)
+	require.NotNil(t, cfg.DNS.FakeIPRange6)
+	assert.True(t, cfg.DNS.FakeIPRange6.IPv6())
+	assert.Equal(t, "fdfe:dcba:9877::/64", cfg.DNS.FakeIPRange6.IPNet().String())
+	assert.Equal(t, uint32(5), cfg.DNS.FakeIPRange.TTL())
+	// the IPv6 pool has the TTL of the IPv4 one unless it's set
+	assert.Equal(t, uint32(5), cfg.DNS.FakeIPRange6.TTL())
+
+	cfg, err = parse("  fake-ip-range6: fdfe:dcba:9877::/64\n  fake-ip-ttl: 5\n  fake-ip-ttl6: 60\n")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), cfg.DNS.FakeIPRange.TTL())
+	assert.Equal(t, uint32(60), cfg.DNS.FakeIPRange6.TTL())
+
+	cfg, err = parse("")
+	require.NoError(t, err)
+	assert.Nil(t, cfg.DNS.FakeIPRange6)
+
+	_, err = parse("  fake-ip-range6: 198.18.0.1/16\n")
+	assert.EqualError(t, err, "fake-ip-range6 should be an IPv6 range")
+
+	_, err = parse("  fake-ip-range: fdfe:dcba:9877::/64\n")
+	assert.EqualError(t, err, "fake-ip-range should be an IPv4 range, use fake-ip-range6 for IPv6")
+
+	_, err = parse("  fake-ip-range6: invalid\n")
+	assert.Error(t, err)
+}
@@ -74,6 +74,24 @@ type PacketConn interface {
 	// WriteWithMetadata(p []byte, metadata *Metadata) (n int, err error)
 }
 
+// Dialer is used by a ProxyAdapter to reach its server. It is either a direct
+// dialer or another proxy, which allows adapters to be chained (see Relay).
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	// ListenPacket returns a PacketConn which is able to send packets to address
+	ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error)
+}
+
+// BindListener waits for the connection of the remote to the address bound by a ProxyAdapter
+type BindListener interface {
+	// Addr returns the address the remote connects to
+	Addr() net.Addr
+	// Accept waits for the connection of the remote, it only returns once
+	Accept() (Conn, error)
+	// Close stops waiting, the accepted connection is not closed
+	Close() error
+}
+
 type ProxyAdapter interface {
 	Name() string
 	Type() AdapterType
@@ -96,6 +114,14 @@ type ProxyAdapter interface {
 	DialContext(ctx context.Context, metadata *Metadata, opts ...dialer.Option) (Conn, error)
 	ListenPacketContext(ctx context.Context, metadata *Metadata, opts ...dialer.Option) (PacketConn, error)
 
+	// ListenPacketWithDialer is like ListenPacketContext, but reaches the
+	// proxy server through the given Dialer
+	ListenPacketWithDialer(ctx context.Context, d Dialer, metadata *Metadata) (PacketConn, error)
+
+	// BindContext listens for the connection of the remote in metadata like the SOCKS BIND command,
+	// it returns errors.ErrUnsupported if the proxy doesn't support it
+	BindContext(ctx context.Context, metadata *Metadata, opts ...dialer.Option) (BindListener, error)
+
 	// Unwrap extracts the proxy from a proxy-group. It returns nil when nothing to extract.
 	Unwrap(metadata *Metadata) Proxy
 }
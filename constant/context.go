@@ -16,6 +16,14 @@ type ConnContext interface {
 	Conn() net.Conn
 }
 
+// BindContext is the ConnContext of a BIND request, the remote connects to the address bound by the proxy
+type BindContext interface {
+	ConnContext
+	// Reply is called with the address bound by the proxy and then with the address of the
+	// connected remote, or with the error failing the request
+	Reply(addr net.Addr, err error) error
+}
+
 type PacketConnContext interface {
 	PlainContext
 	Metadata() *Metadata
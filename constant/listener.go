@@ -1,10 +1,14 @@
 package constant
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
+	"net/netip"
 	"net/url"
 	"strconv"
+
+	"github.com/samber/lo"
 )
 
 type Listener interface {
@@ -21,6 +25,10 @@ const (
 	InboundTypeTproxy InboundType = "tproxy"
 	InboundTypeHTTP   InboundType = "http"
 	InboundTypeMixed  InboundType = "mixed"
+
+	InboundTypeShadowsocks InboundType = "shadowsocks"
+	InboundTypeTrojan      InboundType = "trojan"
+	InboundTypeVmess       InboundType = "vmess"
 )
 
 var supportInboundTypes = map[InboundType]bool{
@@ -29,12 +37,60 @@ var supportInboundTypes = map[InboundType]bool{
 	InboundTypeTproxy: true,
 	InboundTypeHTTP:   true,
 	InboundTypeMixed:  true,
+
+	InboundTypeShadowsocks: true,
+	InboundTypeTrojan:      true,
+	InboundTypeVmess:       true,
+}
+
+// InboundUser is a user authenticated by an inbound
+type InboundUser struct {
+	Name     string `json:"name" yaml:"name"`
+	Password string `json:"password,omitempty" yaml:"password"`
+	UUID     string `json:"uuid,omitempty" yaml:"uuid"`
+}
+
+// InboundWSOptions is the WebSocket transport of an inbound
+type InboundWSOptions struct {
+	Path                string `json:"path,omitempty" yaml:"path"`
+	EarlyDataHeaderName string `json:"early-data-header-name,omitempty" yaml:"early-data-header-name"`
+}
+
+// InboundGrpcOptions is the gRPC transport of an inbound
+type InboundGrpcOptions struct {
+	GrpcServiceName string `json:"grpc-service-name,omitempty" yaml:"grpc-service-name"`
 }
 
 type inbound struct {
 	Type          InboundType `json:"type" yaml:"type"`
 	BindAddress   string      `json:"bind-address" yaml:"bind-address"`
 	IsFromPortCfg bool        `json:"-" yaml:"-"`
+
+	// options of the inbounds with encryption
+	Cipher   string        `json:"cipher,omitempty" yaml:"cipher"`
+	Password string        `json:"password,omitempty" yaml:"password"`
+	Users    []InboundUser `json:"users,omitempty" yaml:"users"`
+
+	// options of the TLS and the transport of the stream inbounds
+	Certificate string             `json:"certificate,omitempty" yaml:"certificate"`
+	PrivateKey  string             `json:"private-key,omitempty" yaml:"private-key"`
+	Network     string             `json:"network,omitempty" yaml:"network"`
+	WSOpts      InboundWSOptions   `json:"ws-opts,omitempty" yaml:"ws-opts"`
+	GrpcOpts    InboundGrpcOptions `json:"grpc-opts,omitempty" yaml:"grpc-opts"`
+
+	// the source IPs allowed to connect to the inbound besides the global lists
+	LanAllowedIPs    []netip.Prefix `json:"lan-allowed-ips,omitempty" yaml:"lan-allowed-ips"`
+	LanDisallowedIPs []netip.Prefix `json:"lan-disallowed-ips,omitempty" yaml:"lan-disallowed-ips"`
+
+	// the PROXY protocol headers sent by the trusted proxies in front of the inbound,
+	// "accept" parses them if any and "require" rejects the connections without them
+	ProxyProtocol        string         `json:"proxy-protocol,omitempty" yaml:"proxy-protocol"`
+	ProxyProtocolTrusted []netip.Prefix `json:"proxy-protocol-trusted-ips,omitempty" yaml:"proxy-protocol-trusted-ips"`
+
+	// the routing entry point, the connections are routed by the sub rule set
+	// or sent to the proxy instead of the global rules
+	Rules string `json:"rules,omitempty" yaml:"rules"`
+	Proxy string `json:"proxy,omitempty" yaml:"proxy"`
 }
 
 // Inbound
@@ -70,6 +126,30 @@ func (i *Inbound) UnmarshalYAML(unmarshal func(any) error) error {
 	if err != nil || port == 0 {
 		return fmt.Errorf("invalid bind port. addr: %s", i.BindAddress)
 	}
+	if i.Type == InboundTypeShadowsocks && i.Cipher == "" {
+		return fmt.Errorf("missing cipher of shadowsocks inbound. addr: %s", i.BindAddress)
+	}
+	if i.Rules != "" && i.Proxy != "" {
+		return fmt.Errorf("rules and proxy of inbound are exclusive. addr: %s", i.BindAddress)
+	}
+	switch i.ProxyProtocol {
+	case "":
+	case "accept", "require":
+		if i.Type != InboundTypeHTTP && i.Type != InboundTypeSocks && i.Type != InboundTypeMixed {
+			return fmt.Errorf("proxy-protocol is not supported by %s inbound. addr: %s", i.Type, i.BindAddress)
+		}
+	default:
+		return fmt.Errorf("not support proxy-protocol: %s", i.ProxyProtocol)
+	}
+	switch i.Network {
+	case "", "tcp", "ws":
+	case "grpc":
+		if i.Certificate == "" {
+			return fmt.Errorf("TLS certificate is required by grpc network. addr: %s", i.BindAddress)
+		}
+	default:
+		return fmt.Errorf("not support inbound network: %s", i.Network)
+	}
 	return nil
 }
 
@@ -85,6 +165,21 @@ func parseInbound(alias string) (*inbound, error) {
 	}, nil
 }
 
+// Key identifies the inbound with its options, the inbounds with the same key share the listeners
+func (i *Inbound) Key() string {
+	options, _ := json.Marshal(i)
+	return fmt.Sprintf("%t/%s", i.IsFromPortCfg, options)
+}
+
+// Redacted returns a copy of the inbound without the password and the credentials of the users
+func (i Inbound) Redacted() Inbound {
+	i.Password = ""
+	i.Users = lo.Map(i.Users, func(user InboundUser, _ int) InboundUser {
+		return InboundUser{Name: user.Name}
+	})
+	return i
+}
+
 func (i *Inbound) ToAlias() string {
 	return string(i.Type) + "://" + i.BindAddress
 }
@@ -0,0 +1,32 @@
+package constant
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInbound_Redacted(t *testing.T) {
+	inbound := Inbound{
+		Type:        InboundTypeShadowsocks,
+		BindAddress: "127.0.0.1:8388",
+		Cipher:      "2022-blake3-aes-128-gcm",
+		Password:    "server-psk",
+		Users: []InboundUser{
+			{Name: "alice", Password: "alice-psk"},
+			{Name: "bob", UUID: "b831381d-6324-4d53-ad4f-8cda48b30811"},
+		},
+	}
+
+	buf, err := json.Marshal(inbound.Redacted())
+	require.NoError(t, err)
+	assert.NotContains(t, string(buf), "psk")
+	assert.NotContains(t, string(buf), "b831381d")
+	assert.Contains(t, string(buf), `"users":[{"name":"alice"},{"name":"bob"}]`)
+
+	// the inbound itself keeps the credentials
+	assert.Equal(t, "server-psk", inbound.Password)
+	assert.Equal(t, "alice-psk", inbound.Users[0].Password)
+}
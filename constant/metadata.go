@@ -22,6 +22,9 @@ const (
 	TPROXY
 	TUNNEL
 	TUN
+	SHADOWSOCKS
+	TROJAN
+	VMESS
 )
 
 type NetWork int
@@ -57,6 +60,12 @@ func (t Type) String() string {
 		return "Tunnel"
 	case TUN:
 		return "Tun"
+	case SHADOWSOCKS:
+		return "Shadowsocks"
+	case TROJAN:
+		return "Trojan"
+	case VMESS:
+		return "Vmess"
 	default:
 		return "Unknown"
 	}
@@ -78,8 +87,12 @@ type Metadata struct {
 	DNSMode      DNSMode `json:"dnsMode"`
 	ProcessPath  string  `json:"processPath"`
 	SpecialProxy string  `json:"specialProxy"`
+	SpecialRules string  `json:"specialRules"`
+	InboundUser  string  `json:"inboundUser"`
 
 	OriginDst netip.AddrPort `json:"-"`
+	// FakeIP is the fake ip the connection was made to, if any
+	FakeIP netip.Addr `json:"-"`
 }
 
 func (m *Metadata) RemoteAddress() string {
@@ -1,9 +1,15 @@
 package provider
 
 import (
+	"errors"
+
 	"github.com/Dreamacro/clash/constant"
 )
 
+// ErrNotModified is returned by Vehicle.Read when the content is the same as
+// the last successful read
+var ErrNotModified = errors.New("content not modified")
+
 // Vehicle Type
 const (
 	File VehicleType = iota
@@ -36,6 +36,7 @@ const (
 	Process
 	ProcessPath
 	IPSet
+	RuleSet
 	MATCH
 )
 
@@ -67,6 +68,8 @@ func (rt RuleType) String() string {
 		return "ProcessPath"
 	case IPSet:
 		return "IPSet"
+	case RuleSet:
+		return "RuleSet"
 	case MATCH:
 		return "Match"
 	default:
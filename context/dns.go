@@ -1,6 +1,8 @@
 package context
 
 import (
+	"net"
+
 	"github.com/gofrs/uuid/v5"
 	"github.com/miekg/dns"
 )
@@ -9,12 +11,16 @@ const (
 	DNSTypeHost   = "host"
 	DNSTypeFakeIP = "fakeip"
 	DNSTypeRaw    = "raw"
+	DNSTypeBlock  = "block"
 )
 
 type DNSContext struct {
-	id  uuid.UUID
-	msg *dns.Msg
-	tp  string
+	id       uuid.UUID
+	msg      *dns.Msg
+	tp       string
+	client   net.Addr
+	upstream string
+	cacheHit bool
 }
 
 func NewDNSContext(msg *dns.Msg) *DNSContext {
@@ -39,3 +45,33 @@ func (c *DNSContext) SetType(tp string) {
 func (c *DNSContext) Type() string {
 	return c.tp
 }
+
+// SetClient set the address of the querying client
+func (c *DNSContext) SetClient(client net.Addr) {
+	c.client = client
+}
+
+// Client return the address of the querying client, nil if unknown
+func (c *DNSContext) Client() net.Addr {
+	return c.client
+}
+
+// SetUpstream set the nameserver which answered the query
+func (c *DNSContext) SetUpstream(upstream string) {
+	c.upstream = upstream
+}
+
+// Upstream return the nameserver which answered the query
+func (c *DNSContext) Upstream() string {
+	return c.upstream
+}
+
+// SetCacheHit set whether the response is from cache
+func (c *DNSContext) SetCacheHit(hit bool) {
+	c.cacheHit = hit
+}
+
+// CacheHit return whether the response is from cache
+func (c *DNSContext) CacheHit() bool {
+	return c.cacheHit
+}
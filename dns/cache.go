@@ -0,0 +1,131 @@
+package dns
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/Dreamacro/clash/common/cache"
+	"github.com/Dreamacro/clash/component/profile/cachefile"
+	"github.com/Dreamacro/clash/log"
+
+	D "github.com/miekg/dns"
+	"github.com/samber/lo"
+	"go.uber.org/atomic"
+)
+
+const (
+	// an entry is prefetched when it's hit at least prefetchHits times
+	// and less than 1/prefetchRatio of its TTL is left
+	prefetchHits  = 2
+	prefetchRatio = 10
+
+	persistInterval = 5 * time.Minute
+)
+
+type cacheEntry struct {
+	msg  *D.Msg
+	ttl  uint32
+	hits *atomic.Uint32
+}
+
+// shouldPrefetch reports whether the entry is popular and about to expire
+func (e *cacheEntry) shouldPrefetch(remaining uint32) bool {
+	return e.hits.Inc() >= prefetchHits && remaining*prefetchRatio <= e.ttl
+}
+
+func putMsgToCache(c *cache.LruCache, key string, msg *D.Msg) {
+	ttl := minimalTTL(msg.Answer)
+	if ttl == 0 {
+		return
+	}
+	putEntry(c, key, msg.Copy(), time.Now().Add(time.Duration(ttl)*time.Second))
+}
+
+func putEntry(c *cache.LruCache, key string, msg *D.Msg, expires time.Time) {
+	c.SetWithExpire(key, &cacheEntry{
+		msg:  msg,
+		ttl:  minimalTTL(msg.Answer),
+		hits: atomic.NewUint32(0),
+	}, expires)
+}
+
+// clampMsgTTL limits the TTL of records to [min, max], zero means no limit
+func clampMsgTTL(msg *D.Msg, min, max uint32) {
+	if min == 0 && max == 0 {
+		return
+	}
+
+	if max == 0 {
+		max = ^uint32(0)
+	}
+
+	for _, records := range [][]D.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range records {
+			if rr.Header().Rrtype == D.TypeOPT {
+				continue
+			}
+			rr.Header().Ttl = lo.Clamp(rr.Header().Ttl, min, max)
+		}
+	}
+}
+
+// clearCache removes the entries of name from the cache, all entries are removed if name is empty
+func clearCache(c *cache.LruCache, name string) {
+	if name == "" {
+		c.Clear()
+		return
+	}
+
+	name = D.Fqdn(name)
+	keys := []any{}
+	c.Range(func(key any, value any, _ time.Time) bool {
+		if q := value.(*cacheEntry).msg.Question; len(q) != 0 && strings.EqualFold(q[0].Name, name) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	for _, key := range keys {
+		c.Delete(key)
+	}
+}
+
+// saveCache persists the cache to the cache file,
+// the value is the expire time in unix seconds followed by the packed message
+func saveCache(c *cache.LruCache) {
+	entries := map[string][]byte{}
+	c.Range(func(key any, value any, expires time.Time) bool {
+		buf, err := value.(*cacheEntry).msg.Pack()
+		if err != nil {
+			return true
+		}
+
+		entry := make([]byte, 8+len(buf))
+		binary.BigEndian.PutUint64(entry, uint64(expires.Unix()))
+		copy(entry[8:], buf)
+		entries[key.(string)] = entry
+		return true
+	})
+
+	cachefile.Cache().SetDNSCache(entries)
+}
+
+func loadCache(c *cache.LruCache) {
+	entries := cachefile.Cache().DNSCache()
+	for key, entry := range entries {
+		if len(entry) <= 8 {
+			continue
+		}
+
+		msg := &D.Msg{}
+		if err := msg.Unpack(entry[8:]); err != nil {
+			continue
+		}
+
+		expires := time.Unix(int64(binary.BigEndian.Uint64(entry)), 0)
+		putEntry(c, key, msg, expires)
+	}
+
+	log.Debugln("[DNS] %d cache entries loaded", len(entries))
+}
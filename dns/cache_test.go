@@ -0,0 +1,142 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/common/cache"
+	C "github.com/Dreamacro/clash/constant"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMsg(t *testing.T, name string, qtype uint16, records ...string) *D.Msg {
+	msg := &D.Msg{}
+	msg.SetQuestion(D.Fqdn(name), qtype)
+	for _, record := range records {
+		rr, err := D.NewRR(record)
+		require.NoError(t, err)
+		msg.Answer = append(msg.Answer, rr)
+	}
+	return msg
+}
+
+func TestCache_ClampTTL(t *testing.T) {
+	msg := newMsg(t, "example.com", D.TypeA, "example.com. 5 IN A 1.1.1.1", "example.com. 90000 IN A 1.1.1.2")
+
+	clampMsgTTL(msg, 60, 86400)
+	assert.Equal(t, uint32(60), msg.Answer[0].Header().Ttl)
+	assert.Equal(t, uint32(86400), msg.Answer[1].Header().Ttl)
+
+	clampMsgTTL(msg, 0, 0)
+	assert.Equal(t, uint32(60), msg.Answer[0].Header().Ttl)
+}
+
+func TestCache_Clear(t *testing.T) {
+	c := cache.New(cache.WithSize(10), cache.WithStale(true))
+	for _, msg := range []*D.Msg{
+		newMsg(t, "example.com", D.TypeA, "example.com. 60 IN A 1.1.1.1"),
+		newMsg(t, "example.com", D.TypeAAAA, "example.com. 60 IN AAAA ::1"),
+		newMsg(t, "example.org", D.TypeA, "example.org. 60 IN A 1.1.1.1"),
+	} {
+		putMsgToCache(c, msg.Question[0].String(), msg)
+	}
+
+	clearCache(c, "Example.com")
+	assert.False(t, c.Exist(newMsg(t, "example.com", D.TypeA).Question[0].String()))
+	assert.False(t, c.Exist(newMsg(t, "example.com", D.TypeAAAA).Question[0].String()))
+	assert.True(t, c.Exist(newMsg(t, "example.org", D.TypeA).Question[0].String()))
+
+	clearCache(c, "")
+	assert.False(t, c.Exist(newMsg(t, "example.org", D.TypeA).Question[0].String()))
+}
+
+func TestCache_Prefetch(t *testing.T) {
+	c := cache.New(cache.WithSize(10), cache.WithStale(true))
+	msg := newMsg(t, "example.com", D.TypeA, "example.com. 100 IN A 1.1.1.1")
+	key := msg.Question[0].String()
+	putMsgToCache(c, key, msg)
+
+	value, _, _ := c.GetWithExpire(key)
+	entry := value.(*cacheEntry)
+
+	// not popular yet
+	assert.False(t, entry.shouldPrefetch(5))
+	// popular but not about to expire
+	assert.False(t, entry.shouldPrefetch(50))
+	assert.True(t, entry.shouldPrefetch(10))
+}
+
+// answerClient answers the A questions with the IP
+type answerClient struct {
+	ip string
+}
+
+func (c *answerClient) Address() string { return "answer" }
+
+func (c *answerClient) Exchange(m *D.Msg) (*D.Msg, error) {
+	return c.ExchangeContext(context.Background(), m)
+}
+
+func (c *answerClient) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	msg := &D.Msg{}
+	msg.SetReply(m)
+	rr, err := D.NewRR(m.Question[0].Name + " 300 IN A " + c.ip)
+	if err != nil {
+		return nil, err
+	}
+	msg.Answer = append(msg.Answer, rr)
+	return msg, nil
+}
+
+func TestResolver_ServeStale(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		serveStale  bool
+		staleMaxAge time.Duration
+		expired     time.Duration
+		stale       bool
+	}{
+		{name: "disabled", expired: time.Minute},
+		{name: "no limit", serveStale: true, expired: 24 * time.Hour, stale: true},
+		{name: "within max age", serveStale: true, staleMaxAge: time.Hour, expired: time.Minute, stale: true},
+		{name: "beyond max age", serveStale: true, staleMaxAge: time.Hour, expired: 2 * time.Hour},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Resolver{
+				main:        []dnsClient{&answerClient{ip: "2.2.2.2"}},
+				lruCache:    cache.New(cache.WithSize(10), cache.WithStale(true)),
+				serveStale:  tt.serveStale,
+				staleMaxAge: tt.staleMaxAge,
+				staleTTL:    30,
+			}
+
+			cached := newMsg(t, "example.com", D.TypeA, "example.com. 100 IN A 1.1.1.1")
+			key := cached.Question[0].String()
+			putMsgToCache(r.lruCache, key, cached)
+			value, _, _ := r.lruCache.GetWithExpire(key)
+			r.lruCache.SetWithExpire(key, value, time.Now().Add(-tt.expired))
+
+			msg, err := r.ExchangeContext(context.Background(), newMsg(t, "example.com", D.TypeA))
+			require.NoError(t, err)
+			require.Len(t, msg.Answer, 1)
+			if tt.stale {
+				assert.Equal(t, "1.1.1.1", msg.Answer[0].(*D.A).A.String())
+				assert.Equal(t, uint32(30), msg.Answer[0].Header().Ttl)
+			} else {
+				assert.Equal(t, "2.2.2.2", msg.Answer[0].(*D.A).A.String())
+			}
+		})
+	}
+}
+
+func TestResolver_Close(t *testing.T) {
+	C.SetHomeDir(t.TempDir())
+
+	r := NewResolver(Config{PersistCache: true})
+	r.Close()
+	assert.NotPanics(t, r.Close)
+}
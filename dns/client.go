@@ -3,23 +3,30 @@ package dns
 import (
 	"context"
 	"crypto/tls"
-	"fmt"
-	"math/rand"
 	"net"
 	"strings"
 
-	"github.com/Dreamacro/clash/component/dialer"
-	"github.com/Dreamacro/clash/component/resolver"
-
 	D "github.com/miekg/dns"
 )
 
 type client struct {
 	*D.Client
-	r     *Resolver
-	port  string
-	host  string
-	iface string
+	r            *Resolver
+	port         string
+	host         string
+	iface        string
+	proxyAdapter string
+}
+
+func (c *client) Address() string {
+	scheme := "udp"
+	switch c.Client.Net {
+	case "tcp":
+		scheme = "tcp"
+	case "tcp-tls":
+		scheme = "tls"
+	}
+	return scheme + "://" + net.JoinHostPort(c.host, c.port)
 }
 
 func (c *client) Exchange(m *D.Msg) (*D.Msg, error) {
@@ -27,35 +34,12 @@ func (c *client) Exchange(m *D.Msg) (*D.Msg, error) {
 }
 
 func (c *client) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
-	var (
-		ip  net.IP
-		err error
-	)
-	if c.r == nil {
-		// a default ip dns
-		if ip = net.ParseIP(c.host); ip == nil {
-			return nil, fmt.Errorf("dns %s not a valid ip", c.host)
-		}
-	} else {
-		ips, err := resolver.LookupIPWithResolver(ctx, c.host, c.r)
-		if err != nil {
-			return nil, fmt.Errorf("use default dns resolve failed: %w", err)
-		} else if len(ips) == 0 {
-			return nil, fmt.Errorf("%w: %s", resolver.ErrIPNotFound, c.host)
-		}
-		ip = ips[rand.Intn(len(ips))]
-	}
-
 	network := "udp"
 	if strings.HasPrefix(c.Client.Net, "tcp") {
 		network = "tcp"
 	}
 
-	options := []dialer.Option{}
-	if c.iface != "" {
-		options = append(options, dialer.WithInterface(c.iface))
-	}
-	conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), c.port), options...)
+	conn, err := dialContext(ctx, network, net.JoinHostPort(c.host, c.port), c.iface, c.proxyAdapter, c.r)
 	if err != nil {
 		return nil, err
 	}
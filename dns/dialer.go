@@ -0,0 +1,194 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+
+	"github.com/Dreamacro/clash/component/dialer"
+	"github.com/Dreamacro/clash/component/resolver"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/tunnel"
+)
+
+// dialContext dials the nameserver directly, or through the proxy adapter when it is set.
+// A proxy adapter without UDP support falls back to TCP for the "udp" network,
+// DNS messages are framed by the connection type so the caller doesn't need to care.
+// The interface is only used by the direct dial, the proxy adapter dials its server with its own
+// options, and the hostname of its server is resolved by r instead of the default resolver,
+// which may query the nameserver itself.
+func dialContext(ctx context.Context, network, addr, iface, proxyAdapter string, r *Resolver) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyAdapter == "" {
+		ip, err := lookupServerIP(ctx, host, r)
+		if err != nil {
+			return nil, err
+		}
+
+		options := []dialer.Option{}
+		if iface != "" {
+			options = append(options, dialer.WithInterface(iface))
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port), options...)
+	}
+
+	proxy, err := lookupProxy(proxyAdapter)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "udp" && proxy.SupportUDP() {
+		pc, rAddr, err := listenPacketWithProxy(ctx, proxy, host, port, r)
+		if err != nil {
+			return nil, err
+		}
+		return &packetConn{PacketConn: pc, rAddr: rAddr}, nil
+	}
+
+	// the host is resolved by the proxy
+	metadata, err := hostToMetadata(host, port)
+	if err != nil {
+		return nil, err
+	}
+	return proxy.DialContext(ctx, metadata, proxyOptions(r)...)
+}
+
+// listenPacket returns a PacketConn to the nameserver and the resolved address of it
+func listenPacket(ctx context.Context, addr, iface, proxyAdapter string, r *Resolver) (net.PacketConn, net.Addr, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if proxyAdapter != "" {
+		proxy, err := lookupProxy(proxyAdapter)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !proxy.SupportUDP() {
+			return nil, nil, fmt.Errorf("proxy %s doesn't support UDP", proxyAdapter)
+		}
+		return listenPacketWithProxy(ctx, proxy, host, port, r)
+	}
+
+	ip, err := lookupServerIP(ctx, host, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(ip.String(), port))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := []dialer.Option{}
+	if iface != "" {
+		options = append(options, dialer.WithInterface(iface))
+	}
+
+	pc, err := dialer.ListenPacket(ctx, "udp", "", options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pc, udpAddr, nil
+}
+
+func listenPacketWithProxy(ctx context.Context, proxy C.Proxy, host, port string, r *Resolver) (net.PacketConn, net.Addr, error) {
+	// packets are written to an IP address, so the host has to be resolved locally
+	ip, err := lookupServerIP(ctx, host, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata, err := hostToMetadata(ip.String(), port)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata.NetWork = C.UDP
+
+	pc, err := proxy.ListenPacketContext(ctx, metadata, proxyOptions(r)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pc, metadata.UDPAddr(), nil
+}
+
+// lookupServerIP resolves the host of a nameserver, r is nil for default nameservers
+func lookupServerIP(ctx context.Context, host string, r *Resolver) (net.IP, error) {
+	if r == nil {
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return nil, fmt.Errorf("dns %s not a valid ip", host)
+		}
+		return ip, nil
+	}
+
+	ips, err := resolver.LookupIPWithResolver(ctx, host, r)
+	if err != nil {
+		return nil, fmt.Errorf("use default dns resolve failed: %w", err)
+	} else if len(ips) == 0 {
+		return nil, fmt.Errorf("%w: %s", resolver.ErrIPNotFound, host)
+	}
+	return ips[rand.Intn(len(ips))], nil
+}
+
+// proxyOptions resolves the server of the proxy adapter with the resolver of the nameserver
+func proxyOptions(r *Resolver) []dialer.Option {
+	if r == nil {
+		return nil
+	}
+	return []dialer.Option{dialer.WithResolver(r)}
+}
+
+func lookupProxy(name string) (C.Proxy, error) {
+	proxy, ok := tunnel.Proxies()[name]
+	if !ok {
+		return nil, fmt.Errorf("proxy %s not found", name)
+	}
+	return proxy, nil
+}
+
+func hostToMetadata(host, port string) (*C.Metadata, error) {
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %s", port)
+	}
+
+	metadata := &C.Metadata{
+		NetWork: C.TCP,
+		DstPort: C.Port(p),
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		metadata.DstIP = ip
+	} else {
+		metadata.Host = host
+	}
+
+	return metadata, nil
+}
+
+// packetConn is a connected net.Conn on top of a PacketConn,
+// it's still a net.PacketConn so miekg/dns treats it as UDP
+type packetConn struct {
+	net.PacketConn
+	rAddr net.Addr
+}
+
+func (pc *packetConn) Read(b []byte) (int, error) {
+	n, _, err := pc.ReadFrom(b)
+	return n, err
+}
+
+func (pc *packetConn) Write(b []byte) (int, error) {
+	return pc.WriteTo(b, pc.rAddr)
+}
+
+func (pc *packetConn) RemoteAddr() net.Addr {
+	return pc.rAddr
+}
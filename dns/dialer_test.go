@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapter"
+	"github.com/Dreamacro/clash/adapter/outbound"
+	"github.com/Dreamacro/clash/common/cache"
+	"github.com/Dreamacro/clash/component/dialer"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/tunnel"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serverProxy dials its server with the options, it records the destination of the dial
+type serverProxy struct {
+	*outbound.Base
+	metadata *C.Metadata
+}
+
+func (p *serverProxy) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (C.Conn, error) {
+	p.metadata = metadata
+	c, err := dialer.DialContext(ctx, "tcp", p.Addr(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return outbound.NewConn(c, p), nil
+}
+
+// hostsClient answers the A queries of the hosts
+type hostsClient map[string]string
+
+func (c hostsClient) Exchange(m *D.Msg) (*D.Msg, error) {
+	return c.ExchangeContext(context.Background(), m)
+}
+
+func (c hostsClient) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	msg := new(D.Msg).SetReply(m)
+	q := m.Question[0]
+	ip, ok := c[q.Name]
+	if !ok || q.Qtype != D.TypeA {
+		msg.Rcode = D.RcodeNameError
+		return msg, nil
+	}
+	msg.Answer = []D.RR{&D.A{
+		Hdr: D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: 300},
+		A:   net.ParseIP(ip),
+	}}
+	return msg, nil
+}
+
+func (c hostsClient) Address() string { return "hosts" }
+
+func withTestProxy(t *testing.T, name string, proxy C.ProxyAdapter) {
+	proxies, providers := tunnel.Proxies(), tunnel.Providers()
+	tunnel.UpdateProxies(map[string]C.Proxy{name: adapter.NewProxy(proxy)}, providers)
+	t.Cleanup(func() {
+		tunnel.UpdateProxies(proxies, providers)
+	})
+}
+
+func TestDialContext_ProxyServerResolver(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	proxy := &serverProxy{Base: outbound.NewBase(outbound.BaseOption{
+		Name: "proxy",
+		Addr: net.JoinHostPort("proxy.clash.test", port),
+		Type: C.Http,
+	})}
+	withTestProxy(t, "proxy", proxy)
+
+	// the server of the proxy is only known by the resolver of the nameserver
+	r := &Resolver{
+		main:     []dnsClient{hostsClient{"proxy.clash.test.": "127.0.0.1"}},
+		lruCache: cache.New(cache.WithSize(10), cache.WithStale(true)),
+	}
+
+	c, err := dialContext(context.Background(), "udp", "dns.clash.test:53", "", "proxy", r)
+	require.NoError(t, err)
+	c.Close()
+
+	// the nameserver is resolved by the proxy
+	assert.Equal(t, "dns.clash.test", proxy.metadata.Host)
+	assert.Equal(t, C.Port(53), proxy.metadata.DstPort)
+}
+
+func TestDialContext_ProxyNotFound(t *testing.T) {
+	withTestProxy(t, "proxy", outbound.NewDirect())
+
+	_, err := dialContext(context.Background(), "tcp", "1.1.1.1:53", "", "missing", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,619 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Dreamacro/clash/common/cache"
+
+	D "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+const (
+	// dnssecMaxDepth limits the queries made to build a chain of trust
+	dnssecMaxDepth = 32
+	// dnssecNegativeTTL is how long the proofs of non-existence are cached
+	dnssecNegativeTTL = 60
+)
+
+var (
+	errBogus = errors.New("DNSSEC bogus")
+
+	// rootAnchors is the DS of the root KSKs, see https://data.iana.org/root-anchors/root-anchors.xml
+	rootAnchors = []*D.DS{
+		{
+			Hdr:        D.RR_Header{Name: ".", Rrtype: D.TypeDS, Class: D.ClassINET},
+			KeyTag:     20326,
+			Algorithm:  D.RSASHA256,
+			DigestType: D.SHA256,
+			Digest:     "E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+		},
+		{
+			Hdr:        D.RR_Header{Name: ".", Rrtype: D.TypeDS, Class: D.ClassINET},
+			KeyTag:     38696,
+			Algorithm:  D.RSASHA256,
+			DigestType: D.SHA256,
+			Digest:     "683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+		},
+	}
+)
+
+type rrsetKey struct {
+	name   string
+	rrtype uint16
+}
+
+// splitRRsets groups records into RRsets and their signatures
+func splitRRsets(records []D.RR) (map[rrsetKey][]D.RR, map[rrsetKey][]*D.RRSIG) {
+	rrsets := map[rrsetKey][]D.RR{}
+	sigs := map[rrsetKey][]*D.RRSIG{}
+	for _, rr := range records {
+		name := D.CanonicalName(rr.Header().Name)
+		switch rr := rr.(type) {
+		case *D.OPT:
+		case *D.RRSIG:
+			key := rrsetKey{name: name, rrtype: rr.TypeCovered}
+			sigs[key] = append(sigs[key], rr)
+		default:
+			key := rrsetKey{name: name, rrtype: rr.Header().Rrtype}
+			rrsets[key] = append(rrsets[key], rr)
+		}
+	}
+	return rrsets, sigs
+}
+
+// setDNSSECOK requests the DNSSEC records without the validation of the upstream
+func setDNSSECOK(m *D.Msg) {
+	if opt := m.IsEdns0(); opt != nil {
+		opt.SetDo()
+	} else {
+		m.SetEdns0(D.DefaultMsgSize, true)
+	}
+	m.CheckingDisabled = true
+}
+
+// stripDNSSEC removes the DNSSEC records not requested by the query r from msg, see RFC 4035 section 3.2.1
+func stripDNSSEC(r *D.Msg, msg *D.Msg) {
+	opt := r.IsEdns0()
+	if opt != nil && opt.Do() {
+		return
+	}
+
+	// RFC 6840 section 5.7, AD is set only if the query asks for it
+	msg.AuthenticatedData = msg.AuthenticatedData && r.AuthenticatedData
+
+	qtype := r.Question[0].Qtype
+	isRequested := func(rr D.RR, _ int) bool {
+		switch rrtype := rr.Header().Rrtype; rrtype {
+		case D.TypeRRSIG, D.TypeNSEC, D.TypeNSEC3:
+			return rrtype == qtype
+		case D.TypeOPT:
+			return opt != nil
+		}
+		return true
+	}
+	msg.Answer = lo.Filter(msg.Answer, isRequested)
+	msg.Ns = lo.Filter(msg.Ns, isRequested)
+	msg.Extra = lo.Filter(msg.Extra, isRequested)
+
+	if respOpt := msg.IsEdns0(); respOpt != nil {
+		respOpt.SetDo(false)
+	}
+}
+
+// validator validates the responses with the chain of trust from the trust anchors
+type validator struct {
+	exchange func(ctx context.Context, m *D.Msg) (*D.Msg, error)
+	anchors  []*D.DS
+	cache    *cache.LruCache
+	now      func() time.Time
+}
+
+// dsResult is the DS records of a zone, both fields are empty if the name is not a zone cut
+type dsResult struct {
+	ds       []*D.DS
+	insecure bool
+}
+
+type dnssecDepthKey struct{}
+
+// enter guards against the loops of the chain of trust
+func (v *validator) enter(ctx context.Context) (context.Context, error) {
+	depth, _ := ctx.Value(dnssecDepthKey{}).(int)
+	if depth >= dnssecMaxDepth {
+		return nil, fmt.Errorf("%w: chain of trust is too long", errBogus)
+	}
+	return context.WithValue(ctx, dnssecDepthKey{}, depth+1), nil
+}
+
+func (v *validator) cached(key string) (any, bool) {
+	value, expires, hit := v.cache.GetWithExpire(key)
+	if !hit || expires.Before(v.now()) {
+		return nil, false
+	}
+	return value, true
+}
+
+func (v *validator) query(ctx context.Context, name string, qtype uint16) (*D.Msg, error) {
+	m := &D.Msg{}
+	m.SetQuestion(name, qtype)
+	setDNSSECOK(m)
+
+	msg, err := v.exchange(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Rcode != D.RcodeSuccess && msg.Rcode != D.RcodeNameError {
+		return nil, fmt.Errorf("query %s %s: %s", name, D.TypeToString[qtype], D.RcodeToString[msg.Rcode])
+	}
+	return msg, nil
+}
+
+// validate returns whether msg is secure, and an error if msg is bogus
+func (v *validator) validate(ctx context.Context, msg *D.Msg) (bool, error) {
+	q := msg.Question[0]
+	qname := D.CanonicalName(q.Name)
+
+	type expanded struct {
+		name   string
+		labels int
+	}
+	wildcards := []expanded{}
+
+	secure := true
+	answers, sigs := splitRRsets(msg.Answer)
+	for key, rrset := range answers {
+		sig, err := v.verifyRRset(ctx, key.name, rrset, sigs[key])
+		if err != nil {
+			return false, err
+		}
+		if sig == nil {
+			secure = false
+			continue
+		}
+
+		// the answer is expanded from a wildcard, RFC 4035 section 5.3.4
+		if labels := int(sig.Labels); labels < D.CountLabel(key.name) {
+			wildcards = append(wildcards, expanded{name: key.name, labels: labels})
+		}
+	}
+
+	nxdomain := msg.Rcode == D.RcodeNameError
+	negative := nxdomain || len(answers) == 0
+	if !negative && len(wildcards) == 0 {
+		return secure, nil
+	}
+
+	// the name denied is the target of the CNAME chain
+	for i := 0; i < len(answers); i++ {
+		rrset, ok := answers[rrsetKey{name: qname, rrtype: D.TypeCNAME}]
+		if !ok {
+			break
+		}
+		qname = D.CanonicalName(rrset[0].(*D.CNAME).Target)
+	}
+
+	proved, err := v.verifyAuthority(ctx, qname, msg.Ns)
+	if err != nil || !proved {
+		return false, err
+	}
+
+	if negative && !provesDenial(msg.Ns, qname, q.Qtype, nxdomain) {
+		return false, fmt.Errorf("%w: no proof of non-existence of %s %s", errBogus, qname, D.TypeToString[q.Qtype])
+	}
+	for _, w := range wildcards {
+		if !provesWildcard(msg.Ns, w.name, w.labels) {
+			return false, fmt.Errorf("%w: no proof of wildcard expansion of %s", errBogus, w.name)
+		}
+	}
+
+	return secure, nil
+}
+
+// verifyRRset returns the signature of rrset verified with the trusted keys of its signer,
+// the signature is nil if rrset is in an insecure zone, which is proven with name if rrset is unsigned
+func (v *validator) verifyRRset(ctx context.Context, name string, rrset []D.RR, sigs []*D.RRSIG) (*D.RRSIG, error) {
+	header := rrset[0].Header()
+	owner := D.CanonicalName(header.Name)
+
+	if len(sigs) == 0 {
+		insecure, err := v.isInsecure(ctx, name)
+		if err != nil {
+			return nil, err
+		} else if insecure {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: no signature of %s %s", errBogus, owner, D.TypeToString[header.Rrtype])
+	}
+
+	err := fmt.Errorf("%w: no valid signature of %s %s", errBogus, owner, D.TypeToString[header.Rrtype])
+	for _, sig := range sigs {
+		signer := D.CanonicalName(sig.SignerName)
+		if !D.IsSubDomain(signer, owner) {
+			continue
+		}
+		// the DS records are signed by the parent zone
+		if header.Rrtype == D.TypeDS && signer == owner {
+			continue
+		}
+
+		keys, kErr := v.zoneKeys(ctx, signer)
+		if kErr != nil {
+			err = kErr
+			continue
+		} else if keys == nil {
+			return nil, nil
+		}
+
+		if v.verifySig(sig, keys, rrset) {
+			return sig, nil
+		}
+	}
+	return nil, err
+}
+
+func (v *validator) verifySig(sig *D.RRSIG, keys []*D.DNSKEY, rrset []D.RR) bool {
+	if !sig.ValidityPeriod(v.now()) {
+		return false
+	}
+
+	for _, key := range keys {
+		if key.KeyTag() == sig.KeyTag && key.Algorithm == sig.Algorithm && sig.Verify(key, rrset) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyAuthority verifies the NSEC and NSEC3 records in the authority section,
+// it returns false if they are in an insecure zone, which is proven with name if there are no records
+func (v *validator) verifyAuthority(ctx context.Context, name string, ns []D.RR) (bool, error) {
+	rrsets, sigs := splitRRsets(ns)
+
+	found := false
+	for key, rrset := range rrsets {
+		if key.rrtype != D.TypeNSEC && key.rrtype != D.TypeNSEC3 {
+			continue
+		}
+
+		found = true
+		sig, err := v.verifyRRset(ctx, name, rrset, sigs[key])
+		if err != nil || sig == nil {
+			return false, err
+		}
+	}
+
+	if !found {
+		insecure, err := v.isInsecure(ctx, name)
+		if err != nil || insecure {
+			return false, err
+		}
+		return false, fmt.Errorf("%w: no NSEC or NSEC3 records for %s", errBogus, name)
+	}
+
+	return true, nil
+}
+
+// zoneKeys returns the trusted DNSKEYs of zone, nil if zone is insecure
+func (v *validator) zoneKeys(ctx context.Context, zone string) ([]*D.DNSKEY, error) {
+	cacheKey := "DNSKEY " + zone
+	if value, ok := v.cached(cacheKey); ok {
+		return value.([]*D.DNSKEY), nil
+	}
+
+	ctx, err := v.enter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := v.dsSet(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if ds.insecure {
+		v.cache.SetWithExpire(cacheKey, []*D.DNSKEY(nil), v.now().Add(dnssecNegativeTTL*time.Second))
+		return nil, nil
+	} else if len(ds.ds) == 0 {
+		return nil, fmt.Errorf("%w: %s is not a zone", errBogus, zone)
+	}
+
+	msg, err := v.query(ctx, zone, D.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+
+	rrsets, sigs := splitRRsets(msg.Answer)
+	key := rrsetKey{name: zone, rrtype: D.TypeDNSKEY}
+	keySet := rrsets[key]
+	keys := []*D.DNSKEY{}
+	for _, rr := range keySet {
+		if k, ok := rr.(*D.DNSKEY); ok {
+			keys = append(keys, k)
+		}
+	}
+
+	// the key set is trusted if it's signed by a key matching the DS records
+	for _, k := range keys {
+		if !matchDS(k, ds.ds) {
+			continue
+		}
+
+		for _, sig := range sigs[key] {
+			if v.verifySig(sig, []*D.DNSKEY{k}, keySet) {
+				v.cache.SetWithExpire(cacheKey, keys, v.now().Add(time.Duration(minimalTTL(keySet))*time.Second))
+				return keys, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no DNSKEY of %s matches its DS", errBogus, zone)
+}
+
+func matchDS(key *D.DNSKEY, dsSet []*D.DS) bool {
+	for _, ds := range dsSet {
+		if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+			continue
+		}
+
+		if keyDS := key.ToDS(ds.DigestType); keyDS != nil && strings.EqualFold(keyDS.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// dsSet returns the trusted DS records of zone, or whether zone is under an insecure delegation
+func (v *validator) dsSet(ctx context.Context, zone string) (*dsResult, error) {
+	if zone == "." {
+		return &dsResult{ds: v.anchors}, nil
+	}
+
+	cacheKey := "DS " + zone
+	if value, ok := v.cached(cacheKey); ok {
+		return value.(*dsResult), nil
+	}
+
+	ctx, err := v.enter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := v.query(ctx, zone, D.TypeDS)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ttl, err := v.verifyDS(ctx, zone, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	v.cache.SetWithExpire(cacheKey, result, v.now().Add(time.Duration(ttl)*time.Second))
+	return result, nil
+}
+
+func (v *validator) verifyDS(ctx context.Context, zone string, msg *D.Msg) (*dsResult, uint32, error) {
+	// the DS records and the proofs of their absence are in the parent zone
+	parent := parentName(zone)
+
+	rrsets, sigs := splitRRsets(msg.Answer)
+	key := rrsetKey{name: zone, rrtype: D.TypeDS}
+	if rrset := rrsets[key]; len(rrset) != 0 {
+		sig, err := v.verifyRRset(ctx, parent, rrset, sigs[key])
+		if err != nil {
+			return nil, 0, err
+		} else if sig == nil {
+			return &dsResult{insecure: true}, minimalTTL(rrset), nil
+		}
+
+		ds := []*D.DS{}
+		for _, rr := range rrset {
+			ds = append(ds, rr.(*D.DS))
+		}
+		return &dsResult{ds: ds}, minimalTTL(rrset), nil
+	}
+
+	proved, err := v.verifyAuthority(ctx, parent, msg.Ns)
+	if err != nil {
+		return nil, 0, err
+	} else if !proved {
+		return &dsResult{insecure: true}, dnssecNegativeTTL, nil
+	}
+
+	nxdomain := msg.Rcode == D.RcodeNameError
+	if !provesDenial(msg.Ns, zone, D.TypeDS, nxdomain) {
+		return nil, 0, fmt.Errorf("%w: no proof of non-existence of %s DS", errBogus, zone)
+	}
+
+	return &dsResult{insecure: !nxdomain && isDelegation(msg.Ns, zone)}, dnssecNegativeTTL, nil
+}
+
+// isInsecure reports whether name is proven to be under an insecure delegation
+func (v *validator) isInsecure(ctx context.Context, name string) (bool, error) {
+	labels := D.CountLabel(name)
+	for i := 1; i <= labels; i++ {
+		ds, err := v.dsSet(ctx, suffixName(name, i))
+		if err != nil {
+			return false, err
+		} else if ds.insecure {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// provesDenial reports whether the NSEC or NSEC3 records in ns prove that qname or its qtype doesn't exist
+func provesDenial(ns []D.RR, qname string, qtype uint16, nxdomain bool) bool {
+	nsecs, nsec3s := denialRecords(ns)
+
+	if len(nsecs) != 0 {
+		if !nxdomain {
+			return lo.ContainsBy(nsecs, func(nsec *D.NSEC) bool {
+				return D.CanonicalName(nsec.Hdr.Name) == qname && !hasType(nsec.TypeBitMap, qtype)
+			})
+		}
+
+		cover, ok := lo.Find(nsecs, func(nsec *D.NSEC) bool { return nsecCovers(nsec, qname) })
+		if !ok {
+			return false
+		}
+
+		// the wildcard at the closest encloser doesn't exist either
+		labels := lo.Max([]int{
+			D.CompareDomainName(qname, cover.Hdr.Name),
+			D.CompareDomainName(qname, cover.NextDomain),
+		})
+		wildcard := wildcardName(suffixName(qname, labels))
+		return lo.ContainsBy(nsecs, func(nsec *D.NSEC) bool { return nsecCovers(nsec, wildcard) })
+	}
+
+	if len(nsec3s) != 0 {
+		if !nxdomain {
+			if lo.ContainsBy(nsec3s, func(nsec3 *D.NSEC3) bool {
+				return nsec3.Match(qname) && !hasType(nsec3.TypeBitMap, qtype)
+			}) {
+				return true
+			}
+
+			// an opt-out NSEC3 covers the insecure delegations, RFC 5155 section 8.6
+			_, nextCloser := closestEncloser(nsec3s, qname)
+			return qtype == D.TypeDS && nextCloser != "" && lo.ContainsBy(nsec3s, func(nsec3 *D.NSEC3) bool {
+				return nsec3.Flags&0x1 != 0 && nsec3.Cover(nextCloser)
+			})
+		}
+
+		encloser, nextCloser := closestEncloser(nsec3s, qname)
+		if encloser == "" {
+			return false
+		}
+		wildcard := wildcardName(encloser)
+		return lo.ContainsBy(nsec3s, func(nsec3 *D.NSEC3) bool { return nsec3.Cover(nextCloser) }) &&
+			lo.ContainsBy(nsec3s, func(nsec3 *D.NSEC3) bool { return nsec3.Cover(wildcard) })
+	}
+
+	return false
+}
+
+// provesWildcard reports whether ns proves that name, which is expanded from a wildcard with labels, doesn't exist
+func provesWildcard(ns []D.RR, name string, labels int) bool {
+	nsecs, nsec3s := denialRecords(ns)
+	nextCloser := suffixName(name, labels+1)
+
+	return lo.ContainsBy(nsecs, func(nsec *D.NSEC) bool { return nsecCovers(nsec, name) }) ||
+		lo.ContainsBy(nsec3s, func(nsec3 *D.NSEC3) bool { return nsec3.Cover(nextCloser) })
+}
+
+// isDelegation reports whether the proof of the absence of the DS of name shows a delegation
+func isDelegation(ns []D.RR, name string) bool {
+	nsecs, nsec3s := denialRecords(ns)
+
+	for _, nsec := range nsecs {
+		if D.CanonicalName(nsec.Hdr.Name) == name {
+			return lo.Contains(nsec.TypeBitMap, D.TypeNS) && !lo.Contains(nsec.TypeBitMap, D.TypeSOA)
+		}
+	}
+
+	for _, nsec3 := range nsec3s {
+		if nsec3.Match(name) {
+			return lo.Contains(nsec3.TypeBitMap, D.TypeNS) && !lo.Contains(nsec3.TypeBitMap, D.TypeSOA) &&
+				!lo.Contains(nsec3.TypeBitMap, D.TypeDS)
+		}
+	}
+
+	// the next closer name is covered by an opt-out NSEC3, RFC 5155 section 8.6
+	_, nextCloser := closestEncloser(nsec3s, name)
+	return nextCloser != "" && lo.ContainsBy(nsec3s, func(nsec3 *D.NSEC3) bool {
+		return nsec3.Flags&0x1 != 0 && nsec3.Cover(nextCloser)
+	})
+}
+
+func denialRecords(ns []D.RR) ([]*D.NSEC, []*D.NSEC3) {
+	nsecs := []*D.NSEC{}
+	nsec3s := []*D.NSEC3{}
+	for _, rr := range ns {
+		switch rr := rr.(type) {
+		case *D.NSEC:
+			nsecs = append(nsecs, rr)
+		case *D.NSEC3:
+			nsec3s = append(nsec3s, rr)
+		}
+	}
+	return nsecs, nsec3s
+}
+
+// closestEncloser returns the closest encloser of name proven by nsec3s and the next closer name, RFC 5155 section 8.3
+func closestEncloser(nsec3s []*D.NSEC3, name string) (string, string) {
+	labels := D.CountLabel(name)
+	for i := labels - 1; i >= 0; i-- {
+		encloser := suffixName(name, i)
+		if lo.ContainsBy(nsec3s, func(nsec3 *D.NSEC3) bool { return nsec3.Match(encloser) }) {
+			return encloser, suffixName(name, i+1)
+		}
+	}
+	return "", ""
+}
+
+// hasType reports whether the type bitmap has t, or CNAME which means all types
+func hasType(bitmap []uint16, t uint16) bool {
+	return lo.Contains(bitmap, t) || lo.Contains(bitmap, D.TypeCNAME)
+}
+
+// nsecCovers reports whether name is between the owner and the next name of nsec in canonical order
+func nsecCovers(nsec *D.NSEC, name string) bool {
+	owner, next := nsec.Hdr.Name, nsec.NextDomain
+	if compareCanonical(owner, next) < 0 {
+		return compareCanonical(owner, name) < 0 && compareCanonical(name, next) < 0
+	}
+
+	// the last NSEC of the zone, next is the apex
+	return D.IsSubDomain(next, name) && compareCanonical(owner, name) < 0
+}
+
+// compareCanonical compares the names in the canonical order, RFC 4034 section 6.1
+func compareCanonical(a, b string) int {
+	la := D.SplitDomainName(strings.ToLower(a))
+	lb := D.SplitDomainName(strings.ToLower(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// suffixName returns the last labels of name
+func suffixName(name string, labels int) string {
+	if labels <= 0 {
+		return "."
+	}
+
+	idx := D.Split(name)
+	if labels >= len(idx) {
+		return name
+	}
+	return name[idx[len(idx)-labels]:]
+}
+
+func parentName(name string) string {
+	return suffixName(name, D.CountLabel(name)-1)
+}
+
+func wildcardName(name string) string {
+	if name == "." {
+		return "*."
+	}
+	return "*." + name
+}
+
+func newValidator(exchange func(ctx context.Context, m *D.Msg) (*D.Msg, error), anchors []*D.DS) *validator {
+	return &validator{
+		exchange: exchange,
+		anchors:  anchors,
+		cache:    cache.New(cache.WithSize(1024)),
+		now:      time.Now,
+	}
+}
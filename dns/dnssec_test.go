@@ -0,0 +1,286 @@
+package dns
+
+import (
+	"context"
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/common/cache"
+	"github.com/Dreamacro/clash/component/trie"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testZone struct {
+	name string
+	key  *D.DNSKEY
+	priv crypto.Signer
+}
+
+func newTestZone(t *testing.T, name string) *testZone {
+	key := &D.DNSKEY{
+		Hdr:       D.RR_Header{Name: name, Rrtype: D.TypeDNSKEY, Class: D.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: D.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	require.NoError(t, err)
+
+	return &testZone{name: name, key: key, priv: priv.(crypto.Signer)}
+}
+
+// sign returns the RRset with its signature
+func (z *testZone) sign(t *testing.T, rrset ...D.RR) []D.RR {
+	now := time.Now().Unix()
+	sig := &D.RRSIG{
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.name,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(now - 3600),
+		Expiration: uint32(now + 3600),
+	}
+	require.NoError(t, sig.Sign(z.priv, rrset))
+	return append(rrset, sig)
+}
+
+func newRR(t *testing.T, s string) D.RR {
+	rr, err := D.NewRR(s)
+	require.NoError(t, err)
+	return rr
+}
+
+// zoneClient answers the queries from the signed zones
+type zoneClient struct {
+	responses map[rrsetKey]*D.Msg
+	addr      string
+}
+
+func (c *zoneClient) Address() string {
+	if c.addr != "" {
+		return c.addr
+	}
+	return "zone"
+}
+
+func (c *zoneClient) Exchange(m *D.Msg) (*D.Msg, error) {
+	return c.ExchangeContext(context.Background(), m)
+}
+
+func (c *zoneClient) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	q := m.Question[0]
+	msg := &D.Msg{}
+	if resp, ok := c.responses[rrsetKey{name: D.CanonicalName(q.Name), rrtype: q.Qtype}]; ok {
+		msg = resp.Copy()
+	} else {
+		msg.Rcode = D.RcodeNameError
+	}
+	msg.Id = m.Id
+	msg.Response = true
+	msg.Question = m.Question
+	return msg, nil
+}
+
+func (c *zoneClient) add(name string, qtype uint16, rcode int, answer []D.RR, ns []D.RR) {
+	c.responses[rrsetKey{name: name, rrtype: qtype}] = &D.Msg{
+		MsgHdr: D.MsgHdr{Rcode: rcode},
+		Answer: answer,
+		Ns:     ns,
+	}
+}
+
+func newDNSSECResolver(t *testing.T) *Resolver {
+	c, anchor := newDNSSECZoneClient(t)
+	r := &Resolver{
+		main:     []dnsClient{c},
+		lruCache: cache.New(cache.WithSize(10), cache.WithStale(true)),
+	}
+	r.validator = newValidator(r.dnssecExchange, []*D.DS{anchor})
+	return r
+}
+
+// newDNSSECZoneClient returns the client of the signed test zones and the trust anchor of the root
+func newDNSSECZoneClient(t *testing.T) (*zoneClient, *D.DS) {
+	root := newTestZone(t, ".")
+	com := newTestZone(t, "com.")
+	example := newTestZone(t, "example.com.")
+	nsec3 := newTestZone(t, "nsec3.com.")
+
+	c := &zoneClient{responses: map[rrsetKey]*D.Msg{}}
+	c.add(".", D.TypeDNSKEY, D.RcodeSuccess, root.sign(t, root.key), nil)
+	c.add("com.", D.TypeDS, D.RcodeSuccess, root.sign(t, com.key.ToDS(D.SHA256)), nil)
+	c.add("com.", D.TypeDNSKEY, D.RcodeSuccess, com.sign(t, com.key), nil)
+
+	c.add("example.com.", D.TypeDS, D.RcodeSuccess, com.sign(t, example.key.ToDS(D.SHA256)), nil)
+	c.add("example.com.", D.TypeDNSKEY, D.RcodeSuccess, example.sign(t, example.key), nil)
+	c.add("www.example.com.", D.TypeA, D.RcodeSuccess, example.sign(t, newRR(t, "www.example.com. 300 IN A 1.2.3.4")), nil)
+	c.add("nx.example.com.", D.TypeA, D.RcodeNameError, nil,
+		example.sign(t, newRR(t, "example.com. 300 IN NSEC www.example.com. NS SOA RRSIG NSEC DNSKEY")))
+	// the NSEC doesn't cover the name
+	c.add("uncovered.example.com.", D.TypeA, D.RcodeNameError, nil,
+		example.sign(t, newRR(t, "www.example.com. 300 IN NSEC example.com. A RRSIG NSEC")))
+	c.add("unsigned.example.com.", D.TypeA, D.RcodeSuccess, []D.RR{newRR(t, "unsigned.example.com. 300 IN A 1.2.3.4")}, nil)
+
+	bogus := example.sign(t, newRR(t, "bogus.example.com. 300 IN A 1.2.3.4"))
+	bogus[0].(*D.A).A[3] = 5
+	c.add("bogus.example.com.", D.TypeA, D.RcodeSuccess, bogus, nil)
+
+	// insecure delegation
+	c.add("insecure.com.", D.TypeDS, D.RcodeSuccess, nil,
+		com.sign(t, newRR(t, "insecure.com. 300 IN NSEC zzz.com. NS RRSIG NSEC")))
+	c.add("www.insecure.com.", D.TypeA, D.RcodeSuccess, []D.RR{newRR(t, "www.insecure.com. 300 IN A 5.6.7.8")}, nil)
+
+	// the only NSEC3 of the zone matches the apex and covers all the other names
+	c.add("nsec3.com.", D.TypeDS, D.RcodeSuccess, com.sign(t, nsec3.key.ToDS(D.SHA256)), nil)
+	c.add("nsec3.com.", D.TypeDNSKEY, D.RcodeSuccess, nsec3.sign(t, nsec3.key), nil)
+	apexHash := D.HashName("nsec3.com.", D.SHA1, 0, "")
+	c.add("nx.nsec3.com.", D.TypeA, D.RcodeNameError, nil, nsec3.sign(t, &D.NSEC3{
+		Hdr:        D.RR_Header{Name: apexHash + ".nsec3.com.", Rrtype: D.TypeNSEC3, Class: D.ClassINET, Ttl: 300},
+		Hash:       D.SHA1,
+		HashLength: 20,
+		NextDomain: apexHash,
+		TypeBitMap: []uint16{D.TypeNS, D.TypeSOA, D.TypeRRSIG, D.TypeDNSKEY, D.TypeNSEC3PARAM},
+	}))
+
+	return c, root.key.ToDS(D.SHA256)
+}
+
+func exchangeValidated(t *testing.T, r *Resolver, name string, do bool) *D.Msg {
+	m := &D.Msg{}
+	m.SetQuestion(name, D.TypeA)
+	m.AuthenticatedData = true
+	if do {
+		m.SetEdns0(D.DefaultMsgSize, true)
+	}
+
+	msg, err := r.Exchange(m)
+	require.NoError(t, err)
+	return msg
+}
+
+func TestDNSSEC_Secure(t *testing.T) {
+	r := newDNSSECResolver(t)
+
+	msg := exchangeValidated(t, r, "www.example.com.", false)
+	assert.Equal(t, D.RcodeSuccess, msg.Rcode)
+	assert.True(t, msg.AuthenticatedData)
+	require.Len(t, msg.Answer, 1)
+	assert.IsType(t, &D.A{}, msg.Answer[0])
+
+	// the signatures are kept if DO is set
+	msg = exchangeValidated(t, r, "www.example.com.", true)
+	assert.True(t, msg.AuthenticatedData)
+	assert.Len(t, msg.Answer, 2)
+}
+
+func TestDNSSEC_Denial(t *testing.T) {
+	r := newDNSSECResolver(t)
+
+	msg := exchangeValidated(t, r, "nx.example.com.", false)
+	assert.Equal(t, D.RcodeNameError, msg.Rcode)
+	assert.True(t, msg.AuthenticatedData)
+	assert.Empty(t, msg.Ns)
+
+	msg = exchangeValidated(t, r, "nx.nsec3.com.", false)
+	assert.Equal(t, D.RcodeNameError, msg.Rcode)
+	assert.True(t, msg.AuthenticatedData)
+}
+
+func TestDNSSEC_Insecure(t *testing.T) {
+	r := newDNSSECResolver(t)
+
+	msg := exchangeValidated(t, r, "www.insecure.com.", false)
+	assert.Equal(t, D.RcodeSuccess, msg.Rcode)
+	assert.False(t, msg.AuthenticatedData)
+	assert.Len(t, msg.Answer, 1)
+}
+
+func TestDNSSEC_Bogus(t *testing.T) {
+	r := newDNSSECResolver(t)
+
+	for _, name := range []string{"bogus.example.com.", "uncovered.example.com.", "unsigned.example.com."} {
+		msg := exchangeValidated(t, r, name, false)
+		assert.Equal(t, D.RcodeServerFailure, msg.Rcode, name)
+		assert.Empty(t, msg.Answer, name)
+	}
+}
+
+func TestDNSSEC_CanonicalOrder(t *testing.T) {
+	names := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", "*.z.example."}
+	for i := 1; i < len(names); i++ {
+		assert.Negative(t, compareCanonical(names[i-1], names[i]), names[i])
+	}
+}
+
+func TestDNSSEC_QueryNameServers(t *testing.T) {
+	// the main nameserver doesn't know any of the records of the chain of trust
+	empty := &zoneClient{responses: map[rrsetKey]*D.Msg{}, addr: "empty"}
+
+	t.Run("policy", func(t *testing.T) {
+		c, anchor := newDNSSECZoneClient(t)
+		r := &Resolver{
+			main:     []dnsClient{empty},
+			policy:   trie.New(),
+			lruCache: cache.New(cache.WithSize(10), cache.WithStale(true)),
+		}
+		require.NoError(t, r.policy.Insert("+.example.com", &policy{main: []dnsClient{c}}))
+		r.validator = newValidator(r.dnssecExchange, []*D.DS{anchor})
+
+		msg := exchangeValidated(t, r, "www.example.com.", false)
+		assert.Equal(t, D.RcodeSuccess, msg.Rcode)
+		assert.True(t, msg.AuthenticatedData)
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		c, anchor := newDNSSECZoneClient(t)
+		c.addr = "fallback"
+		r := &Resolver{
+			main:                  []dnsClient{empty},
+			fallback:              []dnsClient{c},
+			fallbackDomainFilters: []fallbackDomainFilter{NewDomainFilter([]string{"+.example.com"})},
+			lruCache:              cache.New(cache.WithSize(10), cache.WithStale(true)),
+		}
+		r.validator = newValidator(r.dnssecExchange, []*D.DS{anchor})
+
+		msg := exchangeValidated(t, r, "www.example.com.", false)
+		assert.Equal(t, D.RcodeSuccess, msg.Rcode)
+		assert.True(t, msg.AuthenticatedData)
+	})
+}
+
+func TestDNSSEC_IsDelegation(t *testing.T) {
+	nsec3 := func(name string, flags uint8, next string, types ...uint16) D.RR {
+		return &D.NSEC3{
+			Hdr:        D.RR_Header{Name: D.HashName(name, D.SHA1, 0, "") + ".nsec3.com.", Rrtype: D.TypeNSEC3, Class: D.ClassINET, Ttl: 300},
+			Hash:       D.SHA1,
+			Flags:      flags,
+			HashLength: 20,
+			NextDomain: D.HashName(next, D.SHA1, 0, ""),
+			TypeBitMap: types,
+		}
+	}
+	// the NSEC3 of the apex matches it and covers all the other names
+	apex := func(flags uint8) D.RR {
+		return nsec3("nsec3.com.", flags, "nsec3.com.", D.TypeNS, D.TypeSOA, D.TypeRRSIG, D.TypeDNSKEY, D.TypeNSEC3PARAM)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		ns       []D.RR
+		expected bool
+	}{
+		{"NSEC delegation", []D.RR{newRR(t, "sub.nsec3.com. 300 IN NSEC zzz.nsec3.com. NS RRSIG NSEC")}, true},
+		{"NSEC apex", []D.RR{newRR(t, "sub.nsec3.com. 300 IN NSEC zzz.nsec3.com. NS SOA RRSIG NSEC")}, false},
+		{"NSEC3 delegation", []D.RR{nsec3("sub.nsec3.com.", 0, "nsec3.com.", D.TypeNS)}, true},
+		{"NSEC3 with DS", []D.RR{nsec3("sub.nsec3.com.", 0, "nsec3.com.", D.TypeNS, D.TypeDS, D.TypeRRSIG)}, false},
+		{"opt-out NSEC3", []D.RR{apex(1)}, true},
+		{"covering NSEC3 without opt-out", []D.RR{apex(0)}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isDelegation(tt.ns, "sub.nsec3.com."))
+		})
+	}
+}
@@ -4,16 +4,13 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
-	"fmt"
 	"io"
-	"math/rand"
 	"net"
 	"net/http"
 
-	"github.com/Dreamacro/clash/component/dialer"
-	"github.com/Dreamacro/clash/component/resolver"
-
 	D "github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 )
 
 const (
@@ -23,7 +20,11 @@ const (
 
 type dohClient struct {
 	url       string
-	transport *http.Transport
+	transport http.RoundTripper
+}
+
+func (dc *dohClient) Address() string {
+	return dc.url
 }
 
 func (dc *dohClient) Exchange(m *D.Msg) (msg *D.Msg, err error) {
@@ -82,31 +83,13 @@ func (dc *dohClient) doRequest(req *http.Request) (msg *D.Msg, err error) {
 	return msg, err
 }
 
-func newDoHClient(url, iface string, r *Resolver) *dohClient {
+func newDoHClient(url, iface, proxyAdapter string, r *Resolver) *dohClient {
 	return &dohClient{
 		url: url,
 		transport: &http.Transport{
 			ForceAttemptHTTP2: true,
 			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				host, port, err := net.SplitHostPort(addr)
-				if err != nil {
-					return nil, err
-				}
-
-				ips, err := resolver.LookupIPWithResolver(ctx, host, r)
-				if err != nil {
-					return nil, err
-				} else if len(ips) == 0 {
-					return nil, fmt.Errorf("%w: %s", resolver.ErrIPNotFound, host)
-				}
-				ip := ips[rand.Intn(len(ips))]
-
-				options := []dialer.Option{}
-				if iface != "" {
-					options = append(options, dialer.WithInterface(iface))
-				}
-
-				return dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port), options...)
+				return dialContext(ctx, "tcp", addr, iface, proxyAdapter, r)
 			},
 			TLSClientConfig: &tls.Config{
 				// alpn identifier, see https://tools.ietf.org/html/draft-hoffman-dprive-dns-tls-alpn-00#page-6
@@ -115,3 +98,18 @@ func newDoHClient(url, iface string, r *Resolver) *dohClient {
 		},
 	}
 }
+
+// newDoH3Client returns a DNS over HTTP/3 client, QUIC connections are reused by the round tripper
+func newDoH3Client(url, iface, proxyAdapter string, r *Resolver) *dohClient {
+	return &dohClient{
+		url: url,
+		transport: &http3.RoundTripper{
+			TLSClientConfig: &tls.Config{
+				ClientSessionCache: tls.NewLRUClientSessionCache(0),
+			},
+			Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+				return dialQUIC(ctx, addr, iface, proxyAdapter, r, tlsCfg, cfg)
+			},
+		},
+	}
+}
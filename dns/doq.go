@@ -0,0 +1,201 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/common/pool"
+
+	D "github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// DoQ error codes, see https://datatracker.ietf.org/doc/html/rfc9250#section-4.3
+	doqNoError          = 0x0
+	doqInternalError    = 0x1
+	doqRequestCancelled = 0x3
+)
+
+type doqClient struct {
+	addr         string
+	iface        string
+	proxyAdapter string
+	r            *Resolver
+	tlsConfig    *tls.Config
+
+	mux  sync.Mutex
+	conn quic.EarlyConnection
+}
+
+func (dc *doqClient) Address() string {
+	return "quic://" + dc.addr
+}
+
+func (dc *doqClient) Exchange(m *D.Msg) (msg *D.Msg, err error) {
+	return dc.ExchangeContext(context.Background(), m)
+}
+
+func (dc *doqClient) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	conn, err := dc.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := openStream(ctx, conn)
+	if err != nil {
+		// the cached connection may be closed by the server, retry with a new one
+		dc.resetConnection(conn)
+		if conn, err = dc.getConnection(ctx); err != nil {
+			return nil, err
+		}
+		if stream, err = openStream(ctx, conn); err != nil {
+			dc.resetConnection(conn)
+			return nil, err
+		}
+	}
+
+	msg, err := dc.exchange(ctx, stream, m)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		// the query sent as 0-RTT data is sent again once the handshake completes
+		if stream, err = openStream(ctx, conn); err != nil {
+			dc.resetConnection(conn)
+			return nil, err
+		}
+		return dc.exchange(ctx, stream, m)
+	}
+	return msg, err
+}
+
+// openStream opens the stream of a query, the streams of a 0-RTT connection rejected by
+// the server are opened after its handshake completes
+func openStream(ctx context.Context, conn quic.EarlyConnection) (quic.Stream, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		return conn.NextConnection().OpenStreamSync(ctx)
+	}
+	return stream, err
+}
+
+func (dc *doqClient) exchange(ctx context.Context, stream quic.Stream, m *D.Msg) (*D.Msg, error) {
+	stop := context.AfterFunc(ctx, func() {
+		stream.CancelRead(doqRequestCancelled)
+		stream.CancelWrite(doqRequestCancelled)
+	})
+	defer stop()
+
+	// https://datatracker.ietf.org/doc/html/rfc9250#section-4.2.1
+	// the DNS Message ID MUST be set to 0
+	newM := *m
+	newM.Id = 0
+	buf, err := newM.Pack()
+	if err != nil {
+		stream.CancelWrite(doqInternalError)
+		stream.CancelRead(doqInternalError)
+		return nil, err
+	}
+
+	packet := pool.Get(2 + len(buf))
+	defer pool.Put(packet)
+	binary.BigEndian.PutUint16(packet, uint16(len(buf)))
+	copy(packet[2:], buf)
+
+	if _, err := stream.Write(packet); err != nil {
+		stream.CancelRead(doqInternalError)
+		return nil, err
+	}
+	// the client MUST send the STREAM FIN after the query
+	stream.Close()
+
+	var length uint16
+	if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, length)
+	if _, err := io.ReadFull(stream, resp); err != nil {
+		return nil, err
+	}
+
+	msg := &D.Msg{}
+	if err := msg.Unpack(resp); err != nil {
+		return nil, err
+	}
+	msg.Id = m.Id
+	return msg, nil
+}
+
+func (dc *doqClient) getConnection(ctx context.Context) (quic.EarlyConnection, error) {
+	dc.mux.Lock()
+	defer dc.mux.Unlock()
+
+	if dc.conn != nil {
+		select {
+		case <-dc.conn.Context().Done():
+		default:
+			return dc.conn, nil
+		}
+	}
+
+	conn, err := dialQUIC(ctx, dc.addr, dc.iface, dc.proxyAdapter, dc.r, dc.tlsConfig, &quic.Config{
+		KeepAlivePeriod: 15 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dc.conn = conn
+	return conn, nil
+}
+
+func (dc *doqClient) resetConnection(conn quic.EarlyConnection) {
+	dc.mux.Lock()
+	defer dc.mux.Unlock()
+
+	if dc.conn == conn {
+		dc.conn = nil
+	}
+	conn.CloseWithError(doqNoError, "")
+}
+
+// dialQUIC dials a 0-RTT QUIC connection, the PacketConn is closed with the connection
+func dialQUIC(ctx context.Context, addr, iface, proxyAdapter string, r *Resolver, tlsConfig *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+	pc, rAddr, err := listenPacket(ctx, addr, iface, proxyAdapter, r)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := quic.DialEarly(ctx, pc, rAddr, tlsConfig, cfg)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	go func() {
+		<-conn.Context().Done()
+		pc.Close()
+	}()
+
+	return conn, nil
+}
+
+func newDoQClient(addr, iface, proxyAdapter string, r *Resolver) *doqClient {
+	host, _, _ := net.SplitHostPort(addr)
+	return &doqClient{
+		addr:         addr,
+		iface:        iface,
+		proxyAdapter: proxyAdapter,
+		r:            r,
+		tlsConfig: &tls.Config{
+			ServerName:         host,
+			NextProtos:         []string{"doq"},
+			ClientSessionCache: tls.NewLRUClientSessionCache(0),
+		},
+	}
+}
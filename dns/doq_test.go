@@ -0,0 +1,171 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	D "github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// doqServer answers every query with 1.1.1.1, each query is expected on its own stream
+// with the 2-byte length prefix, the message ID 0 and the STREAM FIN
+type doqServer struct {
+	listener    *quic.Listener
+	connections *atomic.Int32
+	streams     *atomic.Int32
+	errCh       chan error
+
+	conns chan quic.Connection
+}
+
+func startDoQServer(t *testing.T) *doqServer {
+	certFile, keyFile := writeCertificate(t, t.TempDir(), 1, time.Now())
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"doq"},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	s := &doqServer{
+		listener:    listener,
+		connections: atomic.NewInt32(0),
+		streams:     atomic.NewInt32(0),
+		errCh:       make(chan error, 16),
+		conns:       make(chan quic.Connection, 16),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *doqServer) serve() {
+	for {
+		conn, err := s.listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		s.connections.Inc()
+		s.conns <- conn
+
+		go func() {
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				s.streams.Inc()
+				go func() {
+					if err := s.handle(stream); err != nil {
+						s.errCh <- err
+					}
+				}()
+			}
+		}()
+	}
+}
+
+func (s *doqServer) handle(stream quic.Stream) error {
+	defer stream.Close()
+
+	// the query is the whole stream, which ends with the FIN of the client
+	buf, err := io.ReadAll(stream)
+	if err != nil {
+		return err
+	}
+	if len(buf) < 2 || int(binary.BigEndian.Uint16(buf)) != len(buf)-2 {
+		return io.ErrUnexpectedEOF
+	}
+
+	req := &D.Msg{}
+	if err := req.Unpack(buf[2:]); err != nil {
+		return err
+	}
+	if req.Id != 0 {
+		return D.ErrId
+	}
+
+	msg := new(D.Msg).SetReply(req)
+	msg.Answer = []D.RR{&D.A{
+		Hdr: D.RR_Header{Name: req.Question[0].Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: 60},
+		A:   net.IPv4(1, 1, 1, 1),
+	}}
+	resp, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	packet := make([]byte, 2+len(resp))
+	binary.BigEndian.PutUint16(packet, uint16(len(resp)))
+	copy(packet[2:], resp)
+	_, err = stream.Write(packet)
+	return err
+}
+
+func (s *doqServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *doqServer) assertNoError(t *testing.T) {
+	select {
+	case err := <-s.errCh:
+		t.Fatalf("doq server error: %s", err)
+	default:
+	}
+}
+
+func TestDoQClient_Exchange(t *testing.T) {
+	server := startDoQServer(t)
+
+	client := newDoQClient(server.addr(), "", "", nil)
+	client.tlsConfig.InsecureSkipVerify = true
+	assert.Equal(t, "quic://"+server.addr(), client.Address())
+
+	for i := 0; i < 3; i++ {
+		req := new(D.Msg).SetQuestion("example.com.", D.TypeA)
+		msg, err := client.Exchange(req)
+		require.NoError(t, err)
+		server.assertNoError(t)
+
+		// the ID is restored for the caller
+		assert.Equal(t, req.Id, msg.Id)
+		require.Len(t, msg.Answer, 1)
+		assert.Equal(t, "1.1.1.1", msg.Answer[0].(*D.A).A.String())
+	}
+
+	// every query has its own stream of the same connection
+	assert.Equal(t, int32(1), server.connections.Load())
+	assert.Equal(t, int32(3), server.streams.Load())
+}
+
+func TestDoQClient_Reconnect(t *testing.T) {
+	server := startDoQServer(t)
+
+	client := newDoQClient(server.addr(), "", "", nil)
+	client.tlsConfig.InsecureSkipVerify = true
+
+	_, err := client.Exchange(new(D.Msg).SetQuestion("example.com.", D.TypeA))
+	require.NoError(t, err)
+
+	// the connection closed by the server is replaced by a new one
+	conn := <-server.conns
+	require.NoError(t, conn.CloseWithError(doqNoError, ""))
+	<-client.conn.Context().Done()
+
+	msg, err := client.Exchange(new(D.Msg).SetQuestion("example.com.", D.TypeA))
+	require.NoError(t, err)
+	server.assertNoError(t)
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, int32(2), server.connections.Load())
+}
@@ -0,0 +1,189 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	D "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+// ECSMode is how the EDNS Client Subnet of queries is handled for a nameserver
+type ECSMode string
+
+const (
+	// ECSStrip removes the ECS of queries
+	ECSStrip ECSMode = "strip"
+	// ECSAuto replaces the ECS of queries with the subnet of the querying client
+	ECSAuto ECSMode = "auto"
+	// ECSSubnet replaces the ECS of queries with a fixed subnet
+	ECSSubnet ECSMode = "subnet"
+
+	ecsIPv4Mask = 24
+	ecsIPv6Mask = 56
+)
+
+// ParseECS parses the ecs option of a nameserver, it's strip, auto or a subnet
+func ParseECS(s string) (ECSMode, *net.IPNet, error) {
+	switch mode := ECSMode(s); mode {
+	case ECSStrip, ECSAuto:
+		return mode, nil, nil
+	}
+
+	_, subnet, err := net.ParseCIDR(s)
+	if err != nil {
+		if ip := net.ParseIP(s); ip != nil {
+			return ECSSubnet, defaultSubnet(ip), nil
+		}
+		return "", nil, fmt.Errorf("invalid ecs %s, should be strip, auto or a subnet", s)
+	}
+	return ECSSubnet, subnet, nil
+}
+
+// defaultSubnet returns the subnet of ip with the mask commonly used by public resolvers
+func defaultSubnet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		mask := net.CIDRMask(ecsIPv4Mask, 32)
+		return &net.IPNet{IP: ip4.Mask(mask), Mask: mask}
+	}
+	mask := net.CIDRMask(ecsIPv6Mask, 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+type clientSubnetKey struct{}
+
+// withClientSubnet attaches the subnet of the querying client to ctx,
+// private addresses are ignored since they are meaningless to the nameservers
+func withClientSubnet(ctx context.Context, client net.Addr) context.Context {
+	var ip net.IP
+	switch addr := client.(type) {
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.TCPAddr:
+		ip = addr.IP
+	default:
+		return ctx
+	}
+
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return ctx
+	}
+
+	return context.WithValue(ctx, clientSubnetKey{}, defaultSubnet(ip))
+}
+
+func clientSubnetFromContext(ctx context.Context) *net.IPNet {
+	subnet, _ := ctx.Value(clientSubnetKey{}).(*net.IPNet)
+	return subnet
+}
+
+// ecsClient rewrites the EDNS Client Subnet of the queries to the nameserver
+type ecsClient struct {
+	dnsClient
+	mode   ECSMode
+	subnet *net.IPNet
+}
+
+func (c *ecsClient) Exchange(m *D.Msg) (msg *D.Msg, err error) {
+	return c.ExchangeContext(context.Background(), m)
+}
+
+func (c *ecsClient) ExchangeContext(ctx context.Context, m *D.Msg) (msg *D.Msg, err error) {
+	var subnet *net.IPNet
+	switch c.mode {
+	case ECSSubnet:
+		subnet = c.subnet
+	case ECSAuto:
+		subnet = clientSubnetFromContext(ctx)
+		if subnet == nil {
+			// keep the query as is for the lookups of clash itself and the clients in LAN
+			return c.dnsClient.ExchangeContext(ctx, m)
+		}
+	}
+
+	requested := getECS(m) != nil
+
+	// the query is shared by the nameservers queried concurrently
+	m = m.Copy()
+	if subnet == nil {
+		stripECS(m)
+	} else {
+		setECS(m, subnet)
+	}
+
+	msg, err = c.dnsClient.ExchangeContext(ctx, m)
+	if err == nil && !requested {
+		// the client doesn't know the ECS of the response
+		stripECS(msg)
+	}
+	return
+}
+
+func getECS(m *D.Msg) *D.EDNS0_SUBNET {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*D.EDNS0_SUBNET); ok {
+			return subnet
+		}
+	}
+	return nil
+}
+
+// setECS replaces the ECS of m with subnet, the OPT record is added if m doesn't have one
+func setECS(m *D.Msg, subnet *net.IPNet) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		m.SetEdns0(D.DefaultMsgSize, false)
+		opt = m.IsEdns0()
+	}
+	stripECS(m)
+
+	ones, _ := subnet.Mask.Size()
+	ecs := &D.EDNS0_SUBNET{
+		Code:          D.EDNS0SUBNET,
+		SourceNetmask: uint8(ones),
+	}
+	if ip4 := subnet.IP.To4(); ip4 != nil {
+		ecs.Family = 1
+		ecs.Address = ip4
+	} else {
+		ecs.Family = 2
+		ecs.Address = subnet.IP
+	}
+	opt.Option = append(opt.Option, ecs)
+}
+
+func stripECS(m *D.Msg) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	options := opt.Option[:0]
+	for _, o := range opt.Option {
+		if _, ok := o.(*D.EDNS0_SUBNET); !ok {
+			options = append(options, o)
+		}
+	}
+	opt.Option = options
+}
+
+// hasECSAuto reports whether the ECS of any nameserver is the subnet of the querying client
+func hasECSAuto(config Config) bool {
+	isAuto := func(s NameServer) bool { return s.ECSMode == ECSAuto }
+
+	if lo.ContainsBy(config.Main, isAuto) || lo.ContainsBy(config.Fallback, isAuto) {
+		return true
+	}
+	for _, p := range config.Policy {
+		if lo.ContainsBy(p.Main, isAuto) || lo.ContainsBy(p.Fallback, isAuto) {
+			return true
+		}
+	}
+	return false
+}
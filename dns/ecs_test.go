@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoClient records the query and answers it with its OPT record
+type echoClient struct {
+	query *D.Msg
+}
+
+func (c *echoClient) Address() string { return "echo" }
+
+func (c *echoClient) Exchange(m *D.Msg) (*D.Msg, error) {
+	return c.ExchangeContext(context.Background(), m)
+}
+
+func (c *echoClient) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	c.query = m
+	msg := &D.Msg{}
+	msg.SetReply(m)
+	if opt := m.IsEdns0(); opt != nil {
+		msg.Extra = append(msg.Extra, D.Copy(opt))
+	}
+	return msg, nil
+}
+
+func newECSClient(t *testing.T, ecs string) (*ecsClient, *echoClient) {
+	mode, subnet, err := ParseECS(ecs)
+	require.NoError(t, err)
+
+	upstream := &echoClient{}
+	return &ecsClient{dnsClient: upstream, mode: mode, subnet: subnet}, upstream
+}
+
+func TestECS_Parse(t *testing.T) {
+	mode, subnet, err := ParseECS("1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, ECSSubnet, mode)
+	assert.Equal(t, "1.2.3.0/24", subnet.String())
+
+	_, subnet, err = ParseECS("2001:db8::1")
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::/56", subnet.String())
+
+	mode, _, err = ParseECS("auto")
+	require.NoError(t, err)
+	assert.Equal(t, ECSAuto, mode)
+
+	_, _, err = ParseECS("invalid")
+	assert.Error(t, err)
+}
+
+func TestECS_Subnet(t *testing.T) {
+	c, upstream := newECSClient(t, "1.2.3.0/24")
+
+	r := &D.Msg{}
+	r.SetQuestion("example.com.", D.TypeA)
+	msg, err := c.Exchange(r)
+	require.NoError(t, err)
+
+	ecs := getECS(upstream.query)
+	require.NotNil(t, ecs)
+	assert.Equal(t, uint16(1), ecs.Family)
+	assert.Equal(t, uint8(24), ecs.SourceNetmask)
+	assert.True(t, ecs.Address.Equal(net.IPv4(1, 2, 3, 0)))
+
+	// the query of the client is not modified and the ECS of the response is removed
+	assert.Nil(t, r.IsEdns0())
+	assert.Nil(t, getECS(msg))
+
+	// the ECS of the client is replaced
+	setECS(r, &net.IPNet{IP: net.IPv4(5, 6, 7, 0), Mask: net.CIDRMask(24, 32)})
+	msg, err = c.Exchange(r)
+	require.NoError(t, err)
+	assert.Len(t, upstream.query.IsEdns0().Option, 1)
+	assert.True(t, getECS(upstream.query).Address.Equal(net.IPv4(1, 2, 3, 0)))
+	assert.NotNil(t, getECS(msg))
+}
+
+func TestECS_Auto(t *testing.T) {
+	c, upstream := newECSClient(t, "auto")
+
+	r := &D.Msg{}
+	r.SetQuestion("example.com.", D.TypeA)
+
+	ctx := withClientSubnet(context.Background(), &net.UDPAddr{IP: net.ParseIP("2001:db8:1:2:3::1"), Port: 53})
+	_, err := c.ExchangeContext(ctx, r)
+	require.NoError(t, err)
+
+	ecs := getECS(upstream.query)
+	require.NotNil(t, ecs)
+	assert.Equal(t, uint16(2), ecs.Family)
+	assert.Equal(t, uint8(56), ecs.SourceNetmask)
+	assert.True(t, ecs.Address.Equal(net.ParseIP("2001:db8:1::")))
+
+	// private clients are ignored
+	ctx = withClientSubnet(context.Background(), &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 53})
+	_, err = c.ExchangeContext(ctx, r)
+	require.NoError(t, err)
+	assert.Nil(t, upstream.query.IsEdns0())
+}
+
+func TestECS_Strip(t *testing.T) {
+	c, upstream := newECSClient(t, "strip")
+
+	r := &D.Msg{}
+	r.SetQuestion("example.com.", D.TypeA)
+	setECS(r, &net.IPNet{IP: net.IPv4(5, 6, 7, 0), Mask: net.CIDRMask(24, 32)})
+	r.IsEdns0().Option = append(r.IsEdns0().Option, &D.EDNS0_COOKIE{Code: D.EDNS0COOKIE, Cookie: "0102030405060708"})
+
+	_, err := c.Exchange(r)
+	require.NoError(t, err)
+
+	opt := upstream.query.IsEdns0()
+	require.NotNil(t, opt)
+	require.Len(t, opt.Option, 1)
+	assert.IsType(t, &D.EDNS0_COOKIE{}, opt.Option[0])
+	assert.NotNil(t, getECS(r))
+}
@@ -0,0 +1,244 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter/provider"
+	"github.com/Dreamacro/clash/component/trie"
+	types "github.com/Dreamacro/clash/constant/provider"
+	"github.com/Dreamacro/clash/log"
+
+	D "github.com/miekg/dns"
+	"go.uber.org/atomic"
+)
+
+// BlockMode is the response of a blocked query
+type BlockMode string
+
+const (
+	BlockNXDomain BlockMode = "nxdomain"
+	BlockNullIP   BlockMode = "null-ip" // 0.0.0.0 for A and :: for AAAA
+	BlockRefused  BlockMode = "refused"
+)
+
+// BlockList is a list of blocked domains pulled from a file or an URL
+type BlockList struct {
+	Name     string
+	Vehicle  types.Vehicle
+	Interval time.Duration
+}
+
+type FilterConfig struct {
+	BlockMode  BlockMode
+	Block      []string
+	BlockLists []BlockList
+	// Records are the local records, CNAME records are followed
+	Records []D.RR
+	// Rewrites answers the domain with the records of the target domain or the target IP
+	Rewrites map[string]string
+}
+
+// FilterStatistics is the counters of blocked queries
+type FilterStatistics struct {
+	Blocked int64                 `json:"blocked"`
+	Lists   []BlockListStatistics `json:"lists"`
+}
+
+type BlockListStatistics struct {
+	Name        string `json:"name"`
+	VehicleType string `json:"vehicleType"`
+	Rules       int64  `json:"rules"`
+	Blocked     int64  `json:"blocked"`
+}
+
+type blockList struct {
+	name    string
+	fetcher *provider.Fetcher
+	domains *atomic.Pointer[trie.DomainTrie]
+	rules   *atomic.Int64
+	blocked *atomic.Int64
+}
+
+type filter struct {
+	mode     BlockMode
+	block    *trie.DomainTrie
+	blocked  *atomic.Int64
+	lists    []*blockList
+	records  map[string][]D.RR
+	rewrites *trie.DomainTrie
+}
+
+// match returns the block list which contains the domain, the inline list is nil
+func (f *filter) match(domain string) (*blockList, bool) {
+	if f.block != nil && f.block.Search(domain) != nil {
+		return nil, true
+	}
+
+	for _, list := range f.lists {
+		if domains := list.domains.Load(); domains != nil && domains.Search(domain) != nil {
+			return list, true
+		}
+	}
+
+	return nil, false
+}
+
+func (f *filter) blockedMsg(r *D.Msg) *D.Msg {
+	q := r.Question[0]
+	msg := &D.Msg{}
+
+	switch f.mode {
+	case BlockRefused:
+		msg.SetRcode(r, D.RcodeRefused)
+	case BlockNullIP:
+		msg.SetRcode(r, D.RcodeSuccess)
+		switch q.Qtype {
+		case D.TypeA:
+			msg.Answer = []D.RR{&D.A{
+				Hdr: D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: dnsDefaultTTL},
+				A:   net.IPv4zero,
+			}}
+		case D.TypeAAAA:
+			msg.Answer = []D.RR{&D.AAAA{
+				Hdr:  D.RR_Header{Name: q.Name, Rrtype: D.TypeAAAA, Class: D.ClassINET, Ttl: dnsDefaultTTL},
+				AAAA: net.IPv6zero,
+			}}
+		}
+	default:
+		msg.SetRcode(r, D.RcodeNameError)
+	}
+
+	msg.Authoritative = true
+	msg.RecursionAvailable = true
+	return msg
+}
+
+func (f *filter) statistics() *FilterStatistics {
+	stats := &FilterStatistics{
+		Blocked: f.blocked.Load(),
+		Lists:   []BlockListStatistics{},
+	}
+
+	for _, list := range f.lists {
+		stats.Blocked += list.blocked.Load()
+		stats.Lists = append(stats.Lists, BlockListStatistics{
+			Name:        list.name,
+			VehicleType: list.fetcher.VehicleType().String(),
+			Rules:       list.rules.Load(),
+			Blocked:     list.blocked.Load(),
+		})
+	}
+
+	return stats
+}
+
+func (f *filter) close() {
+	for _, list := range f.lists {
+		list.fetcher.Destroy()
+	}
+}
+
+// parseBlockList parses a list of domains, hosts file (0.0.0.0 example.com)
+// and adblock style (||example.com^) lines are supported
+func parseBlockList(buf []byte) (*trie.DomainTrie, int64) {
+	tree := trie.New()
+	rules := int64(0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		domain := fields[0]
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			domain = fields[1]
+		}
+
+		if strings.HasPrefix(domain, "||") {
+			domain = "+." + strings.TrimSuffix(strings.TrimPrefix(domain, "||"), "^")
+		}
+
+		if tree.Insert(strings.ToLower(domain), true) == nil {
+			rules++
+		}
+	}
+
+	return tree, rules
+}
+
+func newFilter(cfg FilterConfig) (*filter, error) {
+	f := &filter{
+		mode:    cfg.BlockMode,
+		blocked: atomic.NewInt64(0),
+		records: map[string][]D.RR{},
+	}
+
+	if len(cfg.Block) != 0 {
+		f.block = trie.New()
+		for _, domain := range cfg.Block {
+			if err := f.block.Insert(strings.ToLower(domain), true); err != nil {
+				return nil, fmt.Errorf("invalid block domain %s: %w", domain, err)
+			}
+		}
+	}
+
+	for _, rr := range cfg.Records {
+		name := strings.ToLower(rr.Header().Name)
+		f.records[name] = append(f.records[name], rr)
+	}
+
+	if len(cfg.Rewrites) != 0 {
+		f.rewrites = trie.New()
+		for domain, target := range cfg.Rewrites {
+			if err := f.rewrites.Insert(strings.ToLower(domain), target); err != nil {
+				return nil, fmt.Errorf("invalid rewrite domain %s: %w", domain, err)
+			}
+		}
+	}
+
+	for _, bl := range cfg.BlockLists {
+		list := &blockList{
+			name:    bl.Name,
+			domains: atomic.NewPointer[trie.DomainTrie](nil),
+			rules:   atomic.NewInt64(0),
+			blocked: atomic.NewInt64(0),
+		}
+
+		parser := func(buf []byte) (any, error) {
+			tree, rules := parseBlockList(buf)
+			if rules == 0 {
+				return nil, fmt.Errorf("block list %s is empty", list.name)
+			}
+			list.rules.Store(rules)
+			return tree, nil
+		}
+		onUpdate := func(elm any) {
+			list.domains.Store(elm.(*trie.DomainTrie))
+		}
+
+		list.fetcher = provider.NewFetcher(bl.Name, bl.Interval, bl.Vehicle, parser, onUpdate)
+		f.lists = append(f.lists, list)
+	}
+
+	return f, nil
+}
+
+// initial loads the block lists, it pulls from remote so it shouldn't block the caller
+func (f *filter) initial() {
+	for _, list := range f.lists {
+		elm, err := list.fetcher.Initial()
+		if err != nil {
+			log.Warnln("[DNS] block list %s initial error: %s", list.name, err.Error())
+			continue
+		}
+		list.domains.Store(elm.(*trie.DomainTrie))
+	}
+}
@@ -0,0 +1,117 @@
+package dns
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapter/provider"
+	"github.com/Dreamacro/clash/context"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFilterHandler(t *testing.T, cfg FilterConfig) (*filter, handler) {
+	f, err := newFilter(cfg)
+	require.NoError(t, err)
+
+	upstream := func(ctx *context.DNSContext, r *D.Msg) (*D.Msg, error) {
+		msg := &D.Msg{}
+		msg.SetReply(r)
+		msg.Answer = []D.RR{&D.A{
+			Hdr: D.RR_Header{Name: r.Question[0].Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: 60},
+			A:   net.IPv4(1, 1, 1, 1),
+		}}
+		return msg, nil
+	}
+
+	return f, withFilter(f)(upstream)
+}
+
+func query(t *testing.T, h handler, name string, qtype uint16) *D.Msg {
+	r := &D.Msg{}
+	r.SetQuestion(D.Fqdn(name), qtype)
+	msg, err := handlerWithContext(h, nil, r)
+	require.NoError(t, err)
+	return msg
+}
+
+func TestFilter_Block(t *testing.T) {
+	f, h := newFilterHandler(t, FilterConfig{Block: []string{"+.ads.example.com"}})
+
+	assert.Equal(t, D.RcodeNameError, query(t, h, "x.ads.example.com", D.TypeA).Rcode)
+	assert.Equal(t, D.RcodeSuccess, query(t, h, "example.com", D.TypeA).Rcode)
+
+	f.mode = BlockNullIP
+	msg := query(t, h, "ADS.example.com", D.TypeA)
+	require.Len(t, msg.Answer, 1)
+	assert.True(t, msg.Answer[0].(*D.A).A.Equal(net.IPv4zero))
+
+	f.mode = BlockRefused
+	assert.Equal(t, D.RcodeRefused, query(t, h, "ads.example.com", D.TypeAAAA).Rcode)
+
+	assert.Equal(t, int64(3), f.statistics().Blocked)
+}
+
+func TestFilter_BlockList(t *testing.T) {
+	tree, rules := parseBlockList([]byte("# comment\n! adblock comment\n0.0.0.0 tracker.example.com\n||ads.example.org^\nplain.example.net\n"))
+	assert.Equal(t, int64(3), rules)
+	assert.NotNil(t, tree.Search("tracker.example.com"))
+	assert.NotNil(t, tree.Search("x.ads.example.org"))
+	assert.NotNil(t, tree.Search("plain.example.net"))
+	assert.Nil(t, tree.Search("x.plain.example.net"))
+}
+
+func TestFilter_EmptyBlockList(t *testing.T) {
+	dir := t.TempDir()
+	lists := []BlockList{}
+	for _, name := range []string{"ads", "trackers"} {
+		path := filepath.Join(dir, name+".txt")
+		require.NoError(t, os.WriteFile(path, []byte(name+".example.com\n"), 0o600))
+		lists = append(lists, BlockList{Name: name, Vehicle: provider.NewFileVehicle(path)})
+	}
+
+	f, err := newFilter(FilterConfig{BlockLists: lists})
+	require.NoError(t, err)
+	f.initial()
+	defer f.close()
+
+	// the emptied list is named in the error of its refresh
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ads.txt"), []byte("# emptied\n"), 0o600))
+	_, _, err = f.lists[0].fetcher.Update()
+	assert.EqualError(t, err, "block list ads is empty")
+}
+
+func TestFilter_Records(t *testing.T) {
+	txt, _ := D.NewRR("local.lan. 60 IN TXT hello")
+	cname, _ := D.NewRR("alias.lan. 60 IN CNAME example.com.")
+	_, h := newFilterHandler(t, FilterConfig{
+		Records:  []D.RR{txt, cname},
+		Rewrites: map[string]string{"+.rewrite.lan": "example.org", "ip.lan": "10.0.0.1"},
+	})
+
+	msg := query(t, h, "local.lan", D.TypeTXT)
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, []string{"hello"}, msg.Answer[0].(*D.TXT).Txt)
+
+	// the name exists without the type
+	msg = query(t, h, "local.lan", D.TypeA)
+	assert.Equal(t, D.RcodeSuccess, msg.Rcode)
+	assert.Empty(t, msg.Answer)
+
+	msg = query(t, h, "alias.lan", D.TypeA)
+	require.Len(t, msg.Answer, 2)
+	assert.Equal(t, "example.com.", msg.Answer[0].(*D.CNAME).Target)
+	assert.Equal(t, "alias.lan.", msg.Question[0].Name)
+
+	msg = query(t, h, "a.rewrite.lan", D.TypeA)
+	require.Len(t, msg.Answer, 2)
+	assert.Equal(t, "example.org.", msg.Answer[0].(*D.CNAME).Target)
+
+	msg = query(t, h, "ip.lan", D.TypeA)
+	require.Len(t, msg.Answer, 1)
+	assert.True(t, msg.Answer[0].(*D.A).A.Equal(net.IPv4(10, 0, 0, 1)))
+}
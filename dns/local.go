@@ -10,7 +10,7 @@ type LocalServer struct {
 
 // ServeMsg implement resolver.LocalServer ResolveMsg
 func (s *LocalServer) ServeMsg(msg *D.Msg) (*D.Msg, error) {
-	return handlerWithContext(s.handler, msg)
+	return handlerWithContext(s.handler, nil, msg)
 }
 
 func NewLocalServer(resolver *Resolver, mapper *ResolverEnhancer) *LocalServer {
@@ -63,6 +63,98 @@ func withHosts(hosts *trie.DomainTrie) middleware {
 	}
 }
 
+func withFilter(f *filter) middleware {
+	return func(next handler) handler {
+		return func(ctx *context.DNSContext, r *D.Msg) (*D.Msg, error) {
+			q := r.Question[0]
+			name := strings.ToLower(q.Name)
+			host := strings.TrimRight(name, ".")
+
+			if list, blocked := f.match(host); blocked {
+				if list != nil {
+					list.blocked.Inc()
+				} else {
+					f.blocked.Inc()
+				}
+				log.Debugln("[DNS] %s is blocked", host)
+
+				ctx.SetType(context.DNSTypeBlock)
+				return f.blockedMsg(r), nil
+			}
+
+			var target string
+			if records := f.records[name]; len(records) != 0 {
+				answer := []D.RR{}
+				for _, rr := range records {
+					if rr.Header().Rrtype == q.Qtype || q.Qtype == D.TypeANY {
+						answer = append(answer, D.Copy(rr))
+					} else if cname, ok := rr.(*D.CNAME); ok {
+						target = cname.Target
+					}
+				}
+
+				if len(answer) != 0 || target == "" {
+					return localMsg(ctx, r, answer), nil
+				}
+			} else if f.rewrites != nil {
+				if node := f.rewrites.Search(host); node != nil {
+					target = node.Data.(string)
+				}
+			}
+
+			if target == "" {
+				return next(ctx, r)
+			}
+
+			if ip := net.ParseIP(target); ip != nil {
+				answer := []D.RR{}
+				if v4 := ip.To4(); v4 != nil && q.Qtype == D.TypeA {
+					answer = append(answer, &D.A{
+						Hdr: D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: dnsDefaultTTL},
+						A:   v4,
+					})
+				} else if v4 == nil && q.Qtype == D.TypeAAAA {
+					answer = append(answer, &D.AAAA{
+						Hdr:  D.RR_Header{Name: q.Name, Rrtype: D.TypeAAAA, Class: D.ClassINET, Ttl: dnsDefaultTTL},
+						AAAA: ip,
+					})
+				}
+				return localMsg(ctx, r, answer), nil
+			}
+
+			// answer with the records of the target domain
+			target = D.Fqdn(target)
+			req := r.Copy()
+			req.Question[0].Name = target
+			msg, err := next(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+
+			cname := &D.CNAME{
+				Hdr:    D.RR_Header{Name: q.Name, Rrtype: D.TypeCNAME, Class: D.ClassINET, Ttl: dnsDefaultTTL},
+				Target: target,
+			}
+			msg.Answer = append([]D.RR{cname}, msg.Answer...)
+			msg.SetRcode(r, msg.Rcode)
+
+			return msg, nil
+		}
+	}
+}
+
+func localMsg(ctx *context.DNSContext, r *D.Msg, answer []D.RR) *D.Msg {
+	msg := &D.Msg{}
+	msg.Answer = answer
+
+	ctx.SetType(context.DNSTypeHost)
+	msg.SetRcode(r, D.RcodeSuccess)
+	msg.Authoritative = true
+	msg.RecursionAvailable = true
+
+	return msg
+}
+
 func withMapping(mapping *cache.LruCache) middleware {
 	return func(next handler) handler {
 		return func(ctx *context.DNSContext, r *D.Msg) (*D.Msg, error) {
@@ -111,7 +203,7 @@ func withMapping(mapping *cache.LruCache) middleware {
 	}
 }
 
-func withFakeIP(fakePool *fakeip.Pool) middleware {
+func withFakeIP(fakePool *fakeip.Pool, fakePool6 *fakeip.Pool) middleware {
 	return func(next handler) handler {
 		return func(ctx *context.DNSContext, r *D.Msg) (*D.Msg, error) {
 			q := r.Question[0]
@@ -121,24 +213,31 @@ func withFakeIP(fakePool *fakeip.Pool) middleware {
 				return next(ctx, r)
 			}
 
+			var rr D.RR
 			switch q.Qtype {
-			case D.TypeAAAA, D.TypeSVCB, D.TypeHTTPS:
+			case D.TypeA:
+				rr = &D.A{
+					Hdr: D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: fakePool.TTL()},
+					A:   fakePool.Lookup(host),
+				}
+			case D.TypeAAAA:
+				if fakePool6 == nil {
+					return handleMsgWithEmptyAnswer(r), nil
+				}
+				rr = &D.AAAA{
+					Hdr:  D.RR_Header{Name: q.Name, Rrtype: D.TypeAAAA, Class: D.ClassINET, Ttl: fakePool6.TTL()},
+					AAAA: fakePool6.Lookup(host),
+				}
+			case D.TypeSVCB, D.TypeHTTPS:
 				return handleMsgWithEmptyAnswer(r), nil
-			}
-
-			if q.Qtype != D.TypeA {
+			default:
 				return next(ctx, r)
 			}
 
-			rr := &D.A{}
-			rr.Hdr = D.RR_Header{Name: q.Name, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: dnsDefaultTTL}
-			ip := fakePool.Lookup(host)
-			rr.A = ip
 			msg := r.Copy()
 			msg.Answer = []D.RR{rr}
 
 			ctx.SetType(context.DNSTypeFakeIP)
-			setMsgTTL(msg, 1)
 			msg.SetRcode(r, D.RcodeSuccess)
 			msg.Authoritative = true
 			msg.RecursionAvailable = true
@@ -158,7 +257,9 @@ func withResolver(resolver *Resolver) handler {
 			return handleMsgWithEmptyAnswer(r), nil
 		}
 
-		msg, err := resolver.Exchange(r)
+		msg, upstream, cacheHit, err := resolver.exchangeWithInfo(ctx.Client(), r)
+		ctx.SetUpstream(upstream)
+		ctx.SetCacheHit(cacheHit)
 		if err != nil {
 			log.Debugln("[DNS Server] Exchange %s failed: %v", q.String(), err)
 			return msg, err
@@ -184,12 +285,21 @@ func compose(middlewares []middleware, endpoint handler) handler {
 func newHandler(resolver *Resolver, mapper *ResolverEnhancer) handler {
 	middlewares := []middleware{}
 
+	if resolver.filter != nil {
+		middlewares = append(middlewares, withFilter(resolver.filter))
+	}
+
 	if resolver.hosts != nil {
 		middlewares = append(middlewares, withHosts(resolver.hosts))
 	}
 
 	if mapper.mode == C.DNSFakeIP {
-		middlewares = append(middlewares, withFakeIP(mapper.fakePool))
+		// AAAA questions get empty answers rather than fake IPv6 addresses without ipv6
+		fakePool6 := mapper.fakePool6
+		if !resolver.ipv6 {
+			fakePool6 = nil
+		}
+		middlewares = append(middlewares, withFakeIP(mapper.fakePool, fakePool6))
 		middlewares = append(middlewares, withMapping(mapper.mapping))
 	}
 
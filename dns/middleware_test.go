@@ -0,0 +1,54 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Dreamacro/clash/component/fakeip"
+	C "github.com/Dreamacro/clash/constant"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeIPPool(t *testing.T, cidr string, ttl uint32) *fakeip.Pool {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	pool, err := fakeip.New(fakeip.Options{IPNet: ipnet, Size: 10, TTL: ttl})
+	require.NoError(t, err)
+	return pool
+}
+
+func TestHandler_FakeIP(t *testing.T) {
+	for _, ipv6 := range []bool{true, false} {
+		cfg := Config{
+			IPv6:         ipv6,
+			EnhancedMode: C.DNSFakeIP,
+			Pool:         newFakeIPPool(t, "198.18.0.1/16", 1),
+			Pool6:        newFakeIPPool(t, "fdfe:dcba:9877::/64", 30),
+		}
+		h := newHandler(NewResolver(cfg), NewEnhancer(cfg))
+
+		msg := query(t, h, "example.com", D.TypeA)
+		require.Len(t, msg.Answer, 1)
+		assert.True(t, cfg.Pool.IPNet().Contains(msg.Answer[0].(*D.A).A))
+		assert.Equal(t, uint32(1), msg.Answer[0].Header().Ttl)
+
+		// the IPv6 pool answers with its own TTL, AAAA questions get empty answers without ipv6
+		msg = query(t, h, "example.com", D.TypeAAAA)
+		if !ipv6 {
+			assert.Equal(t, D.RcodeSuccess, msg.Rcode)
+			assert.Empty(t, msg.Answer)
+			continue
+		}
+		require.Len(t, msg.Answer, 1)
+		ip := msg.Answer[0].(*D.AAAA).AAAA
+		assert.True(t, cfg.Pool6.IPNet().Contains(ip))
+		assert.Equal(t, uint32(30), msg.Answer[0].Header().Ttl)
+
+		host, exist := cfg.Pool6.LookBack(ip)
+		assert.True(t, exist)
+		assert.Equal(t, "example.com", host)
+	}
+}
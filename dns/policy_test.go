@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	C "github.com/Dreamacro/clash/constant"
+	types "github.com/Dreamacro/clash/constant/provider"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// hostsRuleSet is a rule provider matching the hosts
+type hostsRuleSet struct {
+	types.RuleProvider
+	hosts []string
+}
+
+func (rs *hostsRuleSet) Match(metadata *C.Metadata) bool {
+	for _, host := range rs.hosts {
+		if metadata.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of a plain DNS client
+func clientAddr(c dnsClient) string {
+	cl := c.(*client)
+	return net.JoinHostPort(cl.host, cl.port)
+}
+
+func TestResolver_MatchPolicy(t *testing.T) {
+	nameserver := func(addr string) []NameServer {
+		return []NameServer{{Net: "udp", Addr: addr}}
+	}
+	a := &hostsRuleSet{hosts: []string{"a.example.com", "both.example.com"}}
+	b := &hostsRuleSet{hosts: []string{"b.example.com", "both.example.com", "www.corp.example"}}
+
+	r := NewResolver(Config{
+		Main: nameserver("127.0.0.1:53"),
+		Policy: []Policy{
+			{Domain: "rule-set:b", Main: nameserver("127.0.0.3:53"), RuleSet: b},
+			{Domain: "rule-set:a", Main: nameserver("127.0.0.2:53"), RuleSet: a},
+			{Domain: "+.corp.example", Main: nameserver("127.0.0.4:53")},
+		},
+	})
+
+	// the overlapping rule providers are matched in the order of the config
+	for domain, expected := range map[string]string{
+		"a.example.com":    "127.0.0.2:53",
+		"b.example.com":    "127.0.0.3:53",
+		"both.example.com": "127.0.0.3:53",
+		"www.corp.example": "127.0.0.4:53",
+		"c.example.com":    "",
+	} {
+		m := &D.Msg{}
+		m.SetQuestion(D.Fqdn(domain), D.TypeA)
+		matched := r.matchPolicy(m)
+		if expected == "" {
+			assert.Nil(t, matched, domain)
+			continue
+		}
+		if assert.NotNil(t, matched, domain) {
+			assert.Contains(t, clientAddr(matched.main[0]), expected, domain)
+		}
+	}
+}
+
+func TestResolver_MatchPolicyOrder(t *testing.T) {
+	nameserver := func(addr string) []NameServer {
+		return []NameServer{{Net: "udp", Addr: addr}}
+	}
+	a := &hostsRuleSet{hosts: []string{"both.example.com"}}
+	b := &hostsRuleSet{hosts: []string{"both.example.com"}}
+	m := &D.Msg{}
+	m.SetQuestion("both.example.com.", D.TypeA)
+
+	for _, policy := range [][]Policy{
+		{{Domain: "rule-set:a", Main: nameserver("127.0.0.2:53"), RuleSet: a}, {Domain: "rule-set:b", Main: nameserver("127.0.0.3:53"), RuleSet: b}},
+		{{Domain: "rule-set:b", Main: nameserver("127.0.0.3:53"), RuleSet: b}, {Domain: "rule-set:a", Main: nameserver("127.0.0.2:53"), RuleSet: a}},
+	} {
+		r := NewResolver(Config{Main: nameserver("127.0.0.1:53"), Policy: policy})
+		matched := r.matchPolicy(m)
+		if assert.NotNil(t, matched) {
+			assert.Contains(t, clientAddr(matched.main[0]), policy[0].Main[0].Addr)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/common/observable"
+
+	D "github.com/miekg/dns"
+	"go.uber.org/atomic"
+)
+
+// maxStatisticsEntries limits the number of domains and clients counted,
+// queries of new domains or clients are still counted in total when the limit is reached
+const maxStatisticsEntries = 10000
+
+// queryLogBufferSize is the number of query logs buffered for the subscribers,
+// the logs are dropped when it's full so a slow subscriber never blocks the queries
+const queryLogBufferSize = 1024
+
+var (
+	queryLogCh     = make(chan any, queryLogBufferSize)
+	queryLogSource = observable.NewObservable(queryLogCh)
+	statistics     = newQueryStatistics()
+)
+
+// QueryLog is a DNS query handled by the DNS server or looked up by clash itself
+type QueryLog struct {
+	Time time.Time `json:"time"`
+	// Client is empty for the lookups of clash itself
+	Client   string `json:"client"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Upstream string `json:"upstream"`
+	Rcode    string `json:"rcode"`
+	// Latency in milliseconds
+	Latency  int64  `json:"latency"`
+	CacheHit bool   `json:"cacheHit"`
+	FakeIP   string `json:"fakeIP,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// QueryCount is the number of queries of a domain or a client
+type QueryCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// QueryStatistics is the aggregate of the query logs
+type QueryStatistics struct {
+	Queries    int64        `json:"queries"`
+	CacheHits  int64        `json:"cacheHits"`
+	TopDomains []QueryCount `json:"topDomains"`
+	TopClients []QueryCount `json:"topClients"`
+}
+
+type queryStatistics struct {
+	mux       sync.Mutex
+	queries   int64
+	cacheHits int64
+	domains   map[string]int64
+	clients   map[string]int64
+}
+
+func (s *queryStatistics) add(l *QueryLog) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.queries++
+	if l.CacheHit {
+		s.cacheHits++
+	}
+
+	increase := func(counts map[string]int64, key string) {
+		if _, ok := counts[key]; ok || len(counts) < maxStatisticsEntries {
+			counts[key]++
+		}
+	}
+	increase(s.domains, l.Name)
+	if l.Client != "" {
+		increase(s.clients, l.Client)
+	}
+}
+
+func (s *queryStatistics) snapshot(top int) *QueryStatistics {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return &QueryStatistics{
+		Queries:    s.queries,
+		CacheHits:  s.cacheHits,
+		TopDomains: topCounts(s.domains, top),
+		TopClients: topCounts(s.clients, top),
+	}
+}
+
+func (s *queryStatistics) reset() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.queries = 0
+	s.cacheHits = 0
+	s.domains = map[string]int64{}
+	s.clients = map[string]int64{}
+}
+
+func newQueryStatistics() *queryStatistics {
+	s := &queryStatistics{}
+	s.reset()
+	return s
+}
+
+func topCounts(counts map[string]int64, top int) []QueryCount {
+	ret := make([]QueryCount, 0, len(counts))
+	for name, count := range counts {
+		ret = append(ret, QueryCount{Name: name, Count: count})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Name < ret[j].Name
+	})
+
+	if top > 0 && len(ret) > top {
+		ret = ret[:top]
+	}
+	return ret
+}
+
+// SubscribeQueryLog returns a subscription of QueryLog
+func SubscribeQueryLog() observable.Subscription {
+	sub, _ := queryLogSource.Subscribe()
+	return sub
+}
+
+func UnSubscribeQueryLog(sub observable.Subscription) {
+	queryLogSource.UnSubscribe(sub)
+}
+
+// Statistics returns the number of queries and the top domains and clients, all of them are returned if top <= 0
+func Statistics(top int) *QueryStatistics {
+	return statistics.snapshot(top)
+}
+
+// ResetStatistics clears the counters of queries
+func ResetStatistics() {
+	statistics.reset()
+}
+
+func emitQueryLog(l *QueryLog) {
+	statistics.add(l)
+	select {
+	case queryLogCh <- l:
+	default:
+	}
+}
+
+func newQueryLog(client net.Addr, r *D.Msg, msg *D.Msg, err error, start time.Time) *QueryLog {
+	q := r.Question[0]
+	l := &QueryLog{
+		Time:    start,
+		Name:    strings.ToLower(strings.TrimRight(q.Name, ".")),
+		Type:    D.Type(q.Qtype).String(),
+		Latency: time.Since(start).Milliseconds(),
+	}
+
+	if client != nil {
+		l.Client = client.String()
+		if host, _, err := net.SplitHostPort(l.Client); err == nil {
+			l.Client = host
+		}
+	}
+
+	if err != nil {
+		l.Rcode = D.RcodeToString[D.RcodeServerFailure]
+		l.Error = err.Error()
+	} else {
+		l.Rcode = D.RcodeToString[msg.Rcode]
+	}
+
+	return l
+}
+
+// queryInfo is filled by the resolver while exchanging a query
+type queryInfo struct {
+	upstream *atomic.String
+	cacheHit *atomic.Bool
+}
+
+type queryInfoKey struct{}
+
+func withQueryInfo(ctx context.Context) (context.Context, *queryInfo) {
+	info := &queryInfo{
+		upstream: atomic.NewString(""),
+		cacheHit: atomic.NewBool(false),
+	}
+	return context.WithValue(ctx, queryInfoKey{}, info), info
+}
+
+func setQueryUpstream(ctx context.Context, upstream string) {
+	if info, ok := ctx.Value(queryInfoKey{}).(*queryInfo); ok {
+		info.upstream.Store(upstream)
+	}
+}
+
+func setQueryCacheHit(ctx context.Context) {
+	if info, ok := ctx.Value(queryInfoKey{}).(*queryInfo); ok {
+		info.cacheHit.Store(true)
+	}
+}
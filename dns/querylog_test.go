@@ -0,0 +1,92 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/component/fakeip"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLog_Server(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("198.18.0.1/24")
+	pool, err := fakeip.New(fakeip.Options{IPNet: ipnet, Size: 10})
+	require.NoError(t, err)
+
+	sub := SubscribeQueryLog()
+	defer UnSubscribeQueryLog(sub)
+
+	h := withFakeIP(pool, nil)(nil)
+	r := &D.Msg{}
+	r.SetQuestion("Example.com.", D.TypeA)
+	_, err = handlerWithContext(h, &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 5353}, r)
+	require.NoError(t, err)
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case elm := <-sub:
+			l := elm.(*QueryLog)
+			// skip the queries of the other tests
+			if l.Client == "" {
+				continue
+			}
+			assert.Equal(t, "192.168.1.2", l.Client)
+			assert.Equal(t, "example.com", l.Name)
+			assert.Equal(t, "A", l.Type)
+			assert.Equal(t, "NOERROR", l.Rcode)
+			assert.Equal(t, "198.18.0.2", l.FakeIP)
+			return
+		case <-timeout:
+			assert.FailNow(t, "query log not emitted")
+		}
+	}
+}
+
+func TestQueryLog_Statistics(t *testing.T) {
+	s := newQueryStatistics()
+	for _, l := range []*QueryLog{
+		{Name: "a.com", Client: "10.0.0.1"},
+		{Name: "b.com", Client: "10.0.0.1", CacheHit: true},
+		{Name: "b.com", Client: "10.0.0.2"},
+		{Name: "b.com"},
+	} {
+		s.add(l)
+	}
+
+	stats := s.snapshot(1)
+	assert.Equal(t, int64(4), stats.Queries)
+	assert.Equal(t, int64(1), stats.CacheHits)
+	assert.Equal(t, []QueryCount{{Name: "b.com", Count: 3}}, stats.TopDomains)
+	assert.Equal(t, []QueryCount{{Name: "10.0.0.1", Count: 2}}, stats.TopClients)
+
+	assert.Len(t, s.snapshot(0).TopDomains, 2)
+
+	s.reset()
+	assert.Equal(t, int64(0), s.snapshot(0).Queries)
+	assert.Empty(t, s.snapshot(0).TopClients)
+}
+
+func TestQueryLog_SlowSubscriber(t *testing.T) {
+	sub := SubscribeQueryLog()
+	defer UnSubscribeQueryLog(sub)
+
+	// the subscriber never reads, the logs are dropped instead of blocking the queries
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < queryLogBufferSize*4; i++ {
+			emitQueryLog(&QueryLog{Name: "example.com"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.FailNow(t, "query log blocked by the subscriber")
+	}
+}
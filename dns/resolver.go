@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Dreamacro/clash/common/cache"
@@ -14,19 +15,24 @@ import (
 	"github.com/Dreamacro/clash/component/resolver"
 	"github.com/Dreamacro/clash/component/trie"
 	C "github.com/Dreamacro/clash/constant"
+	types "github.com/Dreamacro/clash/constant/provider"
+	"github.com/Dreamacro/clash/log"
 
 	D "github.com/miekg/dns"
+	"github.com/samber/lo"
 	"golang.org/x/sync/singleflight"
 )
 
 type dnsClient interface {
 	Exchange(m *D.Msg) (msg *D.Msg, err error)
 	ExchangeContext(ctx context.Context, m *D.Msg) (msg *D.Msg, err error)
+	Address() string
 }
 
 type result struct {
-	Msg   *D.Msg
-	Error error
+	Msg      *D.Msg
+	Error    error
+	Upstream string
 }
 
 type Resolver struct {
@@ -39,7 +45,20 @@ type Resolver struct {
 	group                 singleflight.Group
 	lruCache              *cache.LruCache
 	policy                *trie.DomainTrie
+	ruleSetPolicy         []*policy
 	searchDomains         []string
+	filter                *filter
+	minTTL                uint32
+	maxTTL                uint32
+	prefetch              bool
+	serveStale            bool
+	staleMaxAge           time.Duration
+	staleTTL              uint32
+	persistCache          bool
+	ecsAuto               bool
+	validator             *validator
+	done                  chan struct{}
+	closeOnce             sync.Once
 }
 
 // LookupIP request with TypeA and TypeAAAA, priority return TypeA
@@ -134,32 +153,96 @@ func (r *Resolver) ExchangeContext(ctx context.Context, m *D.Msg) (msg *D.Msg, e
 		return nil, errors.New("should have one question at least")
 	}
 
-	q := m.Question[0]
-	cache, expireTime, hit := r.lruCache.GetWithExpire(q.String())
-	if hit {
-		now := time.Now()
-		msg = cache.(*D.Msg).Copy()
+	if r.validator != nil {
+		defer func() {
+			if err == nil {
+				stripDNSSEC(m, msg)
+			}
+		}()
+	}
+
+	cache, expireTime, hit := r.lruCache.GetWithExpire(r.cacheKey(ctx, m.Question[0]))
+	now := time.Now()
+	if hit && (!expireTime.Before(now) || r.canServeStale(now.Sub(expireTime))) {
+		entry := cache.(*cacheEntry)
+		msg = entry.msg.Copy()
+		setQueryCacheHit(ctx)
 		if expireTime.Before(now) {
-			setMsgTTL(msg, uint32(1)) // Continue fetch
-			go func() {
-				ctx, cancel := context.WithTimeout(context.Background(), resolver.DefaultDNSTimeout)
-				r.exchangeWithoutCache(ctx, m)
-				cancel()
-			}()
+			setMsgTTL(msg, r.staleTTL) // Continue fetch
+			go r.refresh(ctx, m)
 		} else {
 			// updating TTL by subtracting common delta time from each DNS record
-			updateMsgTTL(msg, uint32(time.Until(expireTime).Seconds()))
+			remaining := uint32(time.Until(expireTime).Seconds())
+			updateMsgTTL(msg, remaining)
+
+			if r.prefetch && entry.shouldPrefetch(remaining) {
+				go r.refresh(ctx, m)
+			}
 		}
 		return
 	}
 	return r.exchangeWithoutCache(ctx, m)
 }
 
+// exchangeWithInfo exchanges the query from client,
+// it also returns the upstream used and whether the cache is hit
+func (r *Resolver) exchangeWithInfo(client net.Addr, m *D.Msg) (msg *D.Msg, upstream string, cacheHit bool, err error) {
+	ctx, info := withQueryInfo(withClientSubnet(context.Background(), client))
+	msg, err = r.ExchangeContext(ctx, m)
+	return msg, info.upstream.Load(), info.cacheHit.Load(), err
+}
+
+// exchangeWithLog exchanges the query of clash itself and emits its query log
+func (r *Resolver) exchangeWithLog(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	start := time.Now()
+	ctx, info := withQueryInfo(ctx)
+	msg, err := r.ExchangeContext(ctx, m)
+
+	l := newQueryLog(nil, m, msg, err, start)
+	l.Upstream = info.upstream.Load()
+	l.CacheHit = info.cacheHit.Load()
+	emitQueryLog(l)
+
+	return msg, err
+}
+
+// canServeStale reports whether the answer expired for the duration can be served while it's
+// refreshed in background, the expired answers not served are queried again
+func (r *Resolver) canServeStale(expired time.Duration) bool {
+	return r.serveStale && (r.staleMaxAge == 0 || expired <= r.staleMaxAge)
+}
+
+// refresh updates the cache in background, ctx is only used for its values
+func (r *Resolver) refresh(ctx context.Context, m *D.Msg) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resolver.DefaultDNSTimeout)
+	defer cancel()
+
+	r.exchangeWithoutCache(ctx, m)
+}
+
+// cacheKey returns the key of q in the cache,
+// the answers vary with the subnet of the querying client if the ECS of any nameserver is auto
+func (r *Resolver) cacheKey(ctx context.Context, q D.Question) string {
+	key := q.String()
+	if r.ecsAuto {
+		if subnet := clientSubnetFromContext(ctx); subnet != nil {
+			key += " " + subnet.String()
+		}
+	}
+	return key
+}
+
+// ClearCache removes the cached answers of name, all answers are removed if name is empty
+func (r *Resolver) ClearCache(name string) {
+	clearCache(r.lruCache, name)
+}
+
 // ExchangeWithoutCache a batch of dns request, and it do NOT GET from cache
 func (r *Resolver) exchangeWithoutCache(ctx context.Context, m *D.Msg) (msg *D.Msg, err error) {
 	q := m.Question[0]
+	key := r.cacheKey(ctx, q)
 
-	ret, err, shared := r.group.Do(q.String(), func() (result any, err error) {
+	ret, err, shared := r.group.Do(key, func() (result any, err error) {
 		defer func() {
 			if err != nil {
 				return
@@ -167,18 +250,14 @@ func (r *Resolver) exchangeWithoutCache(ctx context.Context, m *D.Msg) (msg *D.M
 
 			msg := result.(*D.Msg)
 
-			putMsgToCache(r.lruCache, q.String(), q, msg)
+			clampMsgTTL(msg, r.minTTL, r.maxTTL)
+			putMsgToCache(r.lruCache, key, msg)
 		}()
 
-		isIPReq := isIPRequest(q)
-		if isIPReq {
-			return r.ipExchange(ctx, m)
-		}
-
-		if matched := r.matchPolicy(m); len(matched) != 0 {
-			return r.batchExchange(ctx, matched, m)
+		if r.validator != nil {
+			return r.validatedExchange(ctx, m)
 		}
-		return r.batchExchange(ctx, r.main, m)
+		return r.upstreamExchange(ctx, m)
 	})
 
 	if err == nil {
@@ -191,6 +270,75 @@ func (r *Resolver) exchangeWithoutCache(ctx context.Context, m *D.Msg) (msg *D.M
 	return
 }
 
+func (r *Resolver) upstreamExchange(ctx context.Context, m *D.Msg) (msg *D.Msg, err error) {
+	if isIPRequest(m.Question[0]) {
+		return r.ipExchange(ctx, m)
+	}
+
+	if matched := r.matchPolicy(m); matched != nil {
+		return r.batchExchange(ctx, matched.main, m)
+	}
+	return r.batchExchange(ctx, r.main, m)
+}
+
+// validatedExchange requests the DNSSEC records and validates the response,
+// the response is SERVFAIL if it's bogus, and AD is set if it's secure
+func (r *Resolver) validatedExchange(ctx context.Context, m *D.Msg) (msg *D.Msg, err error) {
+	query := m.Copy()
+	setDNSSECOK(query)
+
+	upstreamCtx, info := withQueryInfo(ctx)
+	msg, err = r.upstreamExchange(upstreamCtx, query)
+	if err != nil {
+		return nil, err
+	}
+	upstream := info.upstream.Load()
+	setQueryUpstream(ctx, upstream)
+
+	// the queries of the chain of trust are not the upstream of m,
+	// they are sent to the nameservers which answered m
+	validateCtx, _ := withQueryInfo(ctx)
+	validateCtx = context.WithValue(validateCtx, dnssecClientsKey{}, r.dnssecClients(m, upstream))
+	secure, err := r.validator.validate(validateCtx, msg)
+	if err != nil {
+		log.Warnln("[DNS] DNSSEC validation of %s failed: %s", m.Question[0].Name, err.Error())
+		msg = &D.Msg{}
+		msg.SetRcode(m, D.RcodeServerFailure)
+		return msg, nil
+	}
+
+	msg.AuthenticatedData = secure
+	return msg, nil
+}
+
+type dnssecClientsKey struct{}
+
+// dnssecClients returns the nameservers of the route of m which the upstream belongs to,
+// they are the policy nameservers if m matches a policy, and the fallback if they answered m
+func (r *Resolver) dnssecClients(m *D.Msg, upstream string) []dnsClient {
+	main, fallback := r.main, r.fallback
+	if matched := r.matchPolicy(m); matched != nil {
+		main, fallback = matched.main, matched.fallback
+	}
+
+	if lo.ContainsBy(main, func(c dnsClient) bool { return c.Address() == upstream }) {
+		return main
+	}
+	if lo.ContainsBy(fallback, func(c dnsClient) bool { return c.Address() == upstream }) {
+		return fallback
+	}
+	return main
+}
+
+// dnssecExchange requests the records of the chain of trust from the nameservers of the validated query
+func (r *Resolver) dnssecExchange(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	clients, ok := ctx.Value(dnssecClientsKey{}).([]dnsClient)
+	if !ok || len(clients) == 0 {
+		clients = r.main
+	}
+	return r.batchExchange(ctx, clients, m)
+}
+
 func (r *Resolver) batchExchange(ctx context.Context, clients []dnsClient, m *D.Msg) (msg *D.Msg, err error) {
 	ctx, cancel := context.WithTimeout(ctx, resolver.DefaultDNSTimeout)
 	defer cancel()
@@ -198,8 +346,10 @@ func (r *Resolver) batchExchange(ctx context.Context, clients []dnsClient, m *D.
 	return batchExchange(ctx, clients, m)
 }
 
-func (r *Resolver) matchPolicy(m *D.Msg) []dnsClient {
-	if r.policy == nil {
+// matchPolicy returns the policy of the queried domain, the domain patterns are matched
+// before the rule providers, which are matched in the order of their keys
+func (r *Resolver) matchPolicy(m *D.Msg) *policy {
+	if r.policy == nil && len(r.ruleSetPolicy) == 0 {
 		return nil
 	}
 
@@ -208,12 +358,20 @@ func (r *Resolver) matchPolicy(m *D.Msg) []dnsClient {
 		return nil
 	}
 
-	record := r.policy.Search(domain)
-	if record == nil {
-		return nil
+	if r.policy != nil {
+		if record := r.policy.Search(domain); record != nil {
+			return record.Data.(*policy)
+		}
+	}
+
+	metadata := &C.Metadata{Host: domain}
+	for _, p := range r.ruleSetPolicy {
+		if p.ruleSet.Match(metadata) {
+			return p
+		}
 	}
 
-	return record.Data.([]dnsClient)
+	return nil
 }
 
 func (r *Resolver) shouldOnlyQueryFallback(m *D.Msg) bool {
@@ -237,31 +395,39 @@ func (r *Resolver) shouldOnlyQueryFallback(m *D.Msg) bool {
 }
 
 func (r *Resolver) ipExchange(ctx context.Context, m *D.Msg) (msg *D.Msg, err error) {
-	if matched := r.matchPolicy(m); len(matched) != 0 {
-		res := <-r.asyncExchange(ctx, matched, m)
-		return res.Msg, res.Error
+	if matched := r.matchPolicy(m); matched != nil {
+		return r.exchangeWithFallback(ctx, m, matched.main, matched.fallback)
 	}
 
 	onlyFallback := r.shouldOnlyQueryFallback(m)
 
 	if onlyFallback {
 		res := <-r.asyncExchange(ctx, r.fallback, m)
+		setQueryUpstream(ctx, res.Upstream)
 		return res.Msg, res.Error
 	}
 
-	msgCh := r.asyncExchange(ctx, r.main, m)
+	return r.exchangeWithFallback(ctx, m, r.main, r.fallback)
+}
 
-	if r.fallback == nil { // directly return if no fallback servers are available
+// exchangeWithFallback queries main and fallback concurrently,
+// the result of fallback is used when the IP of main matches the fallback filter
+func (r *Resolver) exchangeWithFallback(ctx context.Context, m *D.Msg, main, fallback []dnsClient) (msg *D.Msg, err error) {
+	msgCh := r.asyncExchange(ctx, main, m)
+
+	if fallback == nil { // directly return if no fallback servers are available
 		res := <-msgCh
+		setQueryUpstream(ctx, res.Upstream)
 		msg, err = res.Msg, res.Error
 		return
 	}
 
-	fallbackMsg := r.asyncExchange(ctx, r.fallback, m)
+	fallbackMsg := r.asyncExchange(ctx, fallback, m)
 	res := <-msgCh
 	if res.Error == nil {
 		if ips := msgToIP(res.Msg); len(ips) != 0 {
 			if !r.shouldIPFallback(ips[0]) {
+				setQueryUpstream(ctx, res.Upstream)
 				msg = res.Msg // no need to wait for fallback result
 				err = res.Error
 				return msg, err
@@ -270,6 +436,7 @@ func (r *Resolver) ipExchange(ctx context.Context, m *D.Msg) (msg *D.Msg, err er
 	}
 
 	res = <-fallbackMsg
+	setQueryUpstream(ctx, res.Upstream)
 	msg, err = res.Msg, res.Error
 	return
 }
@@ -291,7 +458,7 @@ func (r *Resolver) lookupIP(ctx context.Context, host string, dnsType uint16) ([
 	query := &D.Msg{}
 	query.SetQuestion(D.Fqdn(host), dnsType)
 
-	msg, err := r.ExchangeContext(ctx, query)
+	msg, err := r.exchangeWithLog(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -307,7 +474,7 @@ func (r *Resolver) lookupIP(ctx context.Context, host string, dnsType uint16) ([
 	for _, domain := range r.searchDomains {
 		q := &D.Msg{}
 		q.SetQuestion(D.Fqdn(fmt.Sprintf("%s.%s", host, domain)), dnsType)
-		msg, err := r.ExchangeContext(ctx, q)
+		msg, err := r.exchangeWithLog(ctx, q)
 		if err != nil {
 			return nil, err
 		}
@@ -331,16 +498,36 @@ func (r *Resolver) msgToDomain(msg *D.Msg) string {
 func (r *Resolver) asyncExchange(ctx context.Context, client []dnsClient, msg *D.Msg) <-chan *result {
 	ch := make(chan *result, 1)
 	go func() {
+		// main and fallback are exchanged concurrently, so the upstream is reported by the result
+		ctx, info := withQueryInfo(ctx)
 		res, err := r.batchExchange(ctx, client, msg)
-		ch <- &result{Msg: res, Error: err}
+		ch <- &result{Msg: res, Error: err, Upstream: info.upstream.Load()}
 	}()
 	return ch
 }
 
+// Policy is the nameservers of the domains in nameserver-policy, the domains are the ones
+// of the Domain pattern, or the ones matching RuleSet if it's set. The policies are in the
+// order of the config, which the rule providers are matched in.
+type Policy struct {
+	Domain         string
+	Main, Fallback []NameServer
+	RuleSet        types.RuleProvider
+}
+
+type policy struct {
+	main     []dnsClient
+	fallback []dnsClient
+	ruleSet  types.RuleProvider
+}
+
 type NameServer struct {
-	Net       string
-	Addr      string
-	Interface string
+	Net          string
+	Addr         string
+	Interface    string
+	ProxyAdapter string
+	ECSMode      ECSMode
+	ECSSubnet    *net.IPNet
 }
 
 type FallbackFilter struct {
@@ -357,9 +544,58 @@ type Config struct {
 	EnhancedMode   C.DNSMode
 	FallbackFilter FallbackFilter
 	Pool           *fakeip.Pool
+	Pool6          *fakeip.Pool
 	Hosts          *trie.DomainTrie
-	Policy         map[string]NameServer
+	Policy         []Policy
 	SearchDomains  []string
+	Filter         FilterConfig
+	MinTTL         uint32
+	MaxTTL         uint32
+	Prefetch       bool
+	// ServeStale answers the expired answers with StaleTTL while refreshing them, the answers
+	// expired longer than StaleMaxAge are queried again, 0 means no limit
+	ServeStale   bool
+	StaleMaxAge  time.Duration
+	StaleTTL     uint32
+	PersistCache bool
+	DNSSEC       bool
+}
+
+// FilterStatistics returns the counters of blocked queries, nil if filtering is disabled
+func (r *Resolver) FilterStatistics() *FilterStatistics {
+	if r.filter == nil {
+		return nil
+	}
+	return r.filter.statistics()
+}
+
+// Close stops refreshing the block lists of the resolver and persists the cache,
+// it's safe to call it more than once
+func (r *Resolver) Close() {
+	r.closeOnce.Do(func() {
+		if r.filter != nil {
+			r.filter.close()
+		}
+
+		if r.persistCache {
+			close(r.done)
+			saveCache(r.lruCache)
+		}
+	})
+}
+
+func (r *Resolver) persistLoop() {
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			saveCache(r.lruCache)
+		case <-r.done:
+			return
+		}
+	}
 }
 
 func NewResolver(config Config) *Resolver {
@@ -374,6 +610,24 @@ func NewResolver(config Config) *Resolver {
 		lruCache:      cache.New(cache.WithSize(4096), cache.WithStale(true)),
 		hosts:         config.Hosts,
 		searchDomains: config.SearchDomains,
+		minTTL:        config.MinTTL,
+		maxTTL:        config.MaxTTL,
+		prefetch:      config.Prefetch,
+		serveStale:    config.ServeStale,
+		staleMaxAge:   config.StaleMaxAge,
+		staleTTL:      config.StaleTTL,
+		persistCache:  config.PersistCache,
+		ecsAuto:       hasECSAuto(config),
+	}
+
+	if config.DNSSEC {
+		r.validator = newValidator(r.dnssecExchange, rootAnchors)
+	}
+
+	if r.persistCache {
+		loadCache(r.lruCache)
+		r.done = make(chan struct{})
+		go r.persistLoop()
 	}
 
 	if len(config.Fallback) != 0 {
@@ -381,9 +635,20 @@ func NewResolver(config Config) *Resolver {
 	}
 
 	if len(config.Policy) != 0 {
-		r.policy = trie.New()
-		for domain, nameserver := range config.Policy {
-			r.policy.Insert(domain, transform([]NameServer{nameserver}, defaultResolver))
+		for _, p := range config.Policy {
+			matched := &policy{main: transform(p.Main, defaultResolver), ruleSet: p.RuleSet}
+			if len(p.Fallback) != 0 {
+				matched.fallback = transform(p.Fallback, defaultResolver)
+			}
+
+			if p.RuleSet != nil {
+				r.ruleSetPolicy = append(r.ruleSetPolicy, matched)
+				continue
+			}
+			if r.policy == nil {
+				r.policy = trie.New()
+			}
+			r.policy.Insert(p.Domain, matched)
 		}
 	}
 
@@ -403,5 +668,15 @@ func NewResolver(config Config) *Resolver {
 		r.fallbackDomainFilters = fallbackDomainFilters
 	}
 
+	if filter := config.Filter; filter.BlockMode != "" || len(filter.Block) != 0 || len(filter.BlockLists) != 0 ||
+		len(filter.Records) != 0 || len(filter.Rewrites) != 0 {
+		if f, err := newFilter(filter); err != nil {
+			log.Errorln("[DNS] filter error: %s", err.Error())
+		} else {
+			r.filter = f
+			go f.initial()
+		}
+	}
+
 	return r
 }
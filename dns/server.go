@@ -1,8 +1,17 @@
 package dns
 
 import (
+	"crypto/tls"
+	"encoding/base64"
 	"errors"
+	"io"
 	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/Dreamacro/clash/common/sockopt"
 	"github.com/Dreamacro/clash/context"
@@ -12,20 +21,38 @@ import (
 )
 
 var (
-	address string
-	server  = &Server{}
+	serverConfig ServerConfig
+	server       = &Server{}
 
 	dnsDefaultTTL uint32 = 600
+
+	certCheckInterval = 10 * time.Second
 )
 
+// ServerConfig is the listen addresses of the DNS server,
+// a transport is disabled when its address is empty
+type ServerConfig struct {
+	Listen      string
+	ListenTCP   string
+	ListenTLS   string
+	ListenHTTPS string
+	HTTPSPath   string
+	Certificate string
+	PrivateKey  string
+}
+
 type Server struct {
-	*D.Server
 	handler handler
+	udp     *D.Server
+	tcp     *D.Server
+	tls     *D.Server
+	https   *http.Server
+	cert    *certLoader
 }
 
 // ServeDNS implement D.Handler ServeDNS
 func (s *Server) ServeDNS(w D.ResponseWriter, r *D.Msg) {
-	msg, err := handlerWithContext(s.handler, r)
+	msg, err := handlerWithContext(s.handler, w.RemoteAddr(), r)
 	if err != nil {
 		D.HandleFailed(w, r)
 		return
@@ -34,34 +61,274 @@ func (s *Server) ServeDNS(w D.ResponseWriter, r *D.Msg) {
 	w.WriteMsg(msg)
 }
 
-func handlerWithContext(handler handler, msg *D.Msg) (*D.Msg, error) {
+// ServeHTTP implement http.Handler for DNS over HTTPS, see RFC 8484
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		buf []byte
+		err error
+	)
+
+	switch r.Method {
+	case http.MethodGet:
+		buf, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dotMimeType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		buf, err = io.ReadAll(io.LimitReader(r.Body, D.MaxMsgSize))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil || len(buf) == 0 {
+		http.Error(w, "invalid dns message", http.StatusBadRequest)
+		return
+	}
+
+	req := &D.Msg{}
+	if err := req.Unpack(buf); err != nil {
+		http.Error(w, "invalid dns message", http.StatusBadRequest)
+		return
+	}
+
+	var client net.Addr
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		client = net.TCPAddrFromAddrPort(addrPort)
+	}
+
+	msg, err := handlerWithContext(s.handler, client, req)
+	if err != nil {
+		msg = &D.Msg{}
+		msg.SetRcode(req, D.RcodeServerFailure)
+	}
+	msg.Compress = true
+
+	packed, err := msg.Pack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", dotMimeType)
+	w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(minimalTTL(msg.Answer)), 10))
+	w.Write(packed)
+}
+
+// handlerWithContext handles the query from client and emits its query log
+func handlerWithContext(handler handler, client net.Addr, msg *D.Msg) (*D.Msg, error) {
 	if len(msg.Question) == 0 {
 		return nil, errors.New("at least one question is required")
 	}
 
+	start := time.Now()
 	ctx := context.NewDNSContext(msg)
-	return handler(ctx, msg)
+	ctx.SetClient(client)
+	ret, err := handler(ctx, msg)
+
+	l := newQueryLog(client, msg, ret, err, start)
+	l.Upstream = ctx.Upstream()
+	l.CacheHit = ctx.CacheHit()
+	if err == nil && ctx.Type() == context.DNSTypeFakeIP {
+		if ips := msgToIP(ret); len(ips) != 0 {
+			l.FakeIP = ips[0].String()
+		}
+	}
+	emitQueryLog(l)
+
+	return ret, err
 }
 
 func (s *Server) setHandler(handler handler) {
 	s.handler = handler
 }
 
-func ReCreateServer(addr string, resolver *Resolver, mapper *ResolverEnhancer) {
-	if addr == address && resolver != nil {
-		handler := newHandler(resolver, mapper)
-		server.setHandler(handler)
-		return
+func (s *Server) shutdown() {
+	for _, srv := range []*D.Server{s.udp, s.tcp, s.tls} {
+		if srv != nil {
+			srv.Shutdown()
+		}
+	}
+	if s.https != nil {
+		s.https.Close()
 	}
+}
 
-	if server.Server != nil {
-		server.Shutdown()
+func ReCreateServer(cfg ServerConfig, resolver *Resolver, mapper *ResolverEnhancer) {
+	if resolver == nil {
+		server.shutdown()
 		server = &Server{}
-		address = ""
+		serverConfig = ServerConfig{}
+		return
 	}
 
-	if addr == "" {
-		return
+	server.setHandler(newHandler(resolver, mapper))
+
+	certChanged := cfg.Certificate != serverConfig.Certificate || cfg.PrivateKey != serverConfig.PrivateKey
+	if certChanged {
+		server.cert = nil
+	} else if server.cert != nil {
+		server.cert.reload()
+	}
+
+	if cfg.Listen != serverConfig.Listen {
+		if server.udp != nil {
+			server.udp.Shutdown()
+			server.udp = nil
+		}
+		server.udp = startUDPServer(cfg.Listen)
+	}
+
+	if cfg.ListenTCP != serverConfig.ListenTCP {
+		if server.tcp != nil {
+			server.tcp.Shutdown()
+			server.tcp = nil
+		}
+		server.tcp = startStreamServer("TCP", cfg.ListenTCP, nil)
+	}
+
+	if cfg.ListenTLS != serverConfig.ListenTLS || certChanged {
+		if server.tls != nil {
+			server.tls.Shutdown()
+			server.tls = nil
+		}
+		if cfg.ListenTLS != "" {
+			if tlsConfig, err := server.tlsConfig(cfg); err != nil {
+				log.Errorln("Start DNS over TLS server error: %s", err.Error())
+			} else {
+				server.tls = startStreamServer("TLS", cfg.ListenTLS, tlsConfig)
+			}
+		}
+	}
+
+	if cfg.ListenHTTPS != serverConfig.ListenHTTPS || cfg.HTTPSPath != serverConfig.HTTPSPath || certChanged {
+		if server.https != nil {
+			server.https.Close()
+			server.https = nil
+		}
+		if cfg.ListenHTTPS != "" {
+			if tlsConfig, err := server.tlsConfig(cfg); err != nil {
+				log.Errorln("Start DNS over HTTPS server error: %s", err.Error())
+			} else {
+				server.https = startHTTPSServer(cfg.ListenHTTPS, cfg.HTTPSPath, tlsConfig)
+			}
+		}
+	}
+
+	serverConfig = cfg
+}
+
+// tlsConfig returns the TLS config of the DNS over TLS and HTTPS servers, they share the
+// certificate loaded from the files of cfg
+func (s *Server) tlsConfig(cfg ServerConfig) (*tls.Config, error) {
+	if s.cert == nil {
+		loader, err := newCertLoader(cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.cert = loader
+	}
+
+	return &tls.Config{GetCertificate: s.cert.GetCertificate}, nil
+}
+
+// certLoader caches the certificate of the files and reloads it once the files are modified,
+// so a renewed certificate is picked up without restarting the servers. The files are checked
+// at most once every interval rather than on every handshake.
+type certLoader struct {
+	certificate string
+	privateKey  string
+	interval    time.Duration
+
+	mux       sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertLoader(cfg ServerConfig) (*certLoader, error) {
+	if cfg.Certificate == "" || cfg.PrivateKey == "" {
+		return nil, errors.New("certificate and private-key are required")
+	}
+
+	loader := &certLoader{certificate: cfg.Certificate, privateKey: cfg.PrivateKey, interval: certCheckInterval}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+// GetCertificate implements tls.Config GetCertificate, the last loaded certificate is kept if
+// the modified files are invalid, e.g. they are being written
+func (l *certLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if time.Since(l.checkedAt) < l.interval {
+		return l.cert, nil
+	}
+	l.checkedAt = time.Now()
+
+	if modTime, err := l.lastModified(); err == nil && !modTime.Equal(l.modTime) {
+		if err := l.load(); err != nil {
+			// retried once the files are modified again
+			l.modTime = modTime
+			log.Warnln("Reload DNS server certificate error: %s", err.Error())
+		}
+	}
+	return l.cert, nil
+}
+
+// reload loads the files regardless of their modification time, it's called on config reload
+func (l *certLoader) reload() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if err := l.load(); err != nil {
+		log.Warnln("Reload DNS server certificate error: %s", err.Error())
+	}
+}
+
+func (l *certLoader) load() error {
+	modTime, err := l.lastModified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.certificate, l.privateKey)
+	if err != nil {
+		return err
+	}
+
+	l.cert = &cert
+	l.modTime = modTime
+	l.checkedAt = time.Now()
+	return nil
+}
+
+// lastModified returns the latest modification time of the certificate and the private key
+func (l *certLoader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, path := range []string{l.certificate, l.privateKey} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func validListenAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port != "" && port != "0"
+}
+
+func startUDPServer(addr string) *D.Server {
+	if !validListenAddr(addr) {
+		return nil
 	}
 
 	var err error
@@ -71,36 +338,72 @@ func ReCreateServer(addr string, resolver *Resolver, mapper *ResolverEnhancer) {
 		}
 	}()
 
-	_, port, err := net.SplitHostPort(addr)
-	if port == "0" || port == "" || err != nil {
-		return
-	}
-
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
-		return
+		return nil
 	}
 
 	p, err := net.ListenUDP("udp", udpAddr)
 	if err != nil {
-		return
+		return nil
 	}
 
-	err = sockopt.UDPReuseaddr(p)
-	if err != nil {
+	if err := sockopt.UDPReuseaddr(p); err != nil {
 		log.Warnln("Failed to Reuse UDP Address: %s", err)
+	}
+
+	srv := &D.Server{Addr: addr, PacketConn: p, Handler: server}
+	go srv.ActivateAndServe()
+
+	log.Infoln("DNS server listening at: %s", p.LocalAddr().String())
+	return srv
+}
 
-		err = nil
+func startStreamServer(name, addr string, tlsConfig *tls.Config) *D.Server {
+	if !validListenAddr(addr) {
+		return nil
 	}
 
-	address = addr
-	handler := newHandler(resolver, mapper)
-	server = &Server{handler: handler}
-	server.Server = &D.Server{Addr: addr, PacketConn: p, Handler: server}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Errorln("Start DNS %s server error: %s", name, err.Error())
+		return nil
+	}
 
-	go func() {
-		server.ActivateAndServe()
-	}()
+	network := "tcp"
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+		network = "tcp-tls"
+	}
 
-	log.Infoln("DNS server listening at: %s", p.LocalAddr().String())
+	srv := &D.Server{Addr: addr, Net: network, Listener: l, Handler: server}
+	go srv.ActivateAndServe()
+
+	log.Infoln("DNS %s server listening at: %s", name, l.Addr().String())
+	return srv
+}
+
+func startHTTPSServer(addr, path string, tlsConfig *tls.Config) *http.Server {
+	if !validListenAddr(addr) {
+		return nil
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Errorln("Start DNS over HTTPS server error: %s", err.Error())
+		return nil
+	}
+
+	if path == "" {
+		path = "/dns-query"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, server)
+
+	srv := &http.Server{Handler: mux, TLSConfig: tlsConfig}
+	go srv.ServeTLS(l, "", "")
+
+	log.Infoln("DNS over HTTPS server listening at: %s%s", l.Addr().String(), path)
+	return srv
 }
@@ -0,0 +1,270 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/component/trie"
+
+	D "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertificate writes a self-signed certificate of the serial number and its key to dir,
+// the files are modified at modTime
+func writeCertificate(t *testing.T, dir string, serial int64, modTime time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	return certFile, keyFile
+}
+
+func serialOf(t *testing.T, config *tls.Config) int64 {
+	cert, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertLoader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certFile, keyFile := writeCertificate(t, dir, 1, now.Add(-time.Minute))
+
+	loader, err := newCertLoader(ServerConfig{Certificate: certFile, PrivateKey: keyFile})
+	require.NoError(t, err)
+	loader.interval = 0
+	config := &tls.Config{GetCertificate: loader.GetCertificate}
+	assert.Equal(t, int64(1), serialOf(t, config))
+
+	writeCertificate(t, dir, 2, now)
+	assert.Equal(t, int64(2), serialOf(t, config))
+
+	// the last certificate is kept if the modified files are invalid
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	require.NoError(t, os.Chtimes(certFile, now.Add(time.Minute), now.Add(time.Minute)))
+	assert.Equal(t, int64(2), serialOf(t, config))
+
+	writeCertificate(t, dir, 3, now.Add(2*time.Minute))
+	assert.Equal(t, int64(3), serialOf(t, config))
+}
+
+func TestCertLoader_Cache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certFile, keyFile := writeCertificate(t, dir, 1, now.Add(-time.Minute))
+
+	loader, err := newCertLoader(ServerConfig{Certificate: certFile, PrivateKey: keyFile})
+	require.NoError(t, err)
+	config := &tls.Config{GetCertificate: loader.GetCertificate}
+
+	// the files aren't checked again within the interval
+	writeCertificate(t, dir, 2, now)
+	assert.Equal(t, int64(1), serialOf(t, config))
+
+	// but they are loaded on config reload
+	loader.reload()
+	assert.Equal(t, int64(2), serialOf(t, config))
+
+	// and the last certificate is kept if they are invalid
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	loader.reload()
+	assert.Equal(t, int64(2), serialOf(t, config))
+}
+
+func TestCertLoader_Invalid(t *testing.T) {
+	_, err := newCertLoader(ServerConfig{})
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	_, err = newCertLoader(ServerConfig{Certificate: filepath.Join(dir, "cert.pem"), PrivateKey: filepath.Join(dir, "key.pem")})
+	assert.Error(t, err)
+}
+
+// freeAddr returns a loopback address of a port that is free at the moment
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// startTestServer starts the DNS servers of cfg with a resolver answering example.com
+// with 1.1.1.1 from its hosts
+func startTestServer(t *testing.T, cfg ServerConfig) {
+	hosts := trie.New()
+	require.NoError(t, hosts.Insert("example.com", net.ParseIP("1.1.1.1")))
+	resolverCfg := Config{Hosts: hosts}
+
+	ReCreateServer(cfg, NewResolver(resolverCfg), NewEnhancer(resolverCfg))
+	t.Cleanup(func() {
+		ReCreateServer(ServerConfig{}, nil, nil)
+	})
+}
+
+func assertAnswer(t *testing.T, msg *D.Msg) {
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, "1.1.1.1", msg.Answer[0].(*D.A).A.String())
+}
+
+func exchangeEventually(t *testing.T, client *D.Client, addr string) *D.Msg {
+	var (
+		msg *D.Msg
+		err error
+	)
+	// the servers are served in the background
+	for i := 0; i < 50; i++ {
+		if msg, _, err = client.Exchange(new(D.Msg).SetQuestion("example.com.", D.TypeA), addr); err == nil {
+			return msg
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	return msg
+}
+
+func TestServer_TCP(t *testing.T) {
+	addr := freeAddr(t)
+	startTestServer(t, ServerConfig{ListenTCP: addr})
+
+	assertAnswer(t, exchangeEventually(t, &D.Client{Net: "tcp"}, addr))
+}
+
+func TestServer_TLS(t *testing.T) {
+	addr := freeAddr(t)
+	certFile, keyFile := writeCertificate(t, t.TempDir(), 1, time.Now())
+	startTestServer(t, ServerConfig{ListenTLS: addr, Certificate: certFile, PrivateKey: keyFile})
+
+	client := &D.Client{Net: "tcp-tls", TLSConfig: &tls.Config{ServerName: "example.com", InsecureSkipVerify: true}}
+	assertAnswer(t, exchangeEventually(t, client, addr))
+}
+
+func TestServer_HTTPS(t *testing.T) {
+	addr := freeAddr(t)
+	certFile, keyFile := writeCertificate(t, t.TempDir(), 1, time.Now())
+	startTestServer(t, ServerConfig{ListenHTTPS: addr, HTTPSPath: "/query", Certificate: certFile, PrivateKey: keyFile})
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	defer client.CloseIdleConnections()
+
+	req := new(D.Msg).SetQuestion("example.com.", D.TypeA)
+	buf, err := req.Pack()
+	require.NoError(t, err)
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Post("https://"+addr+"/query", dotMimeType, bytes.NewReader(buf)); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	assertHTTPAnswer(t, resp)
+
+	resp, err = client.Get("https://" + addr + "/query?dns=" + base64.RawURLEncoding.EncodeToString(buf))
+	require.NoError(t, err)
+	assertHTTPAnswer(t, resp)
+
+	resp, err = client.Post("https://"+addr+"/query", "text/plain", bytes.NewReader(buf))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	resp, err = client.Get("https://" + addr + "/query?dns=invalid")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = client.Get("https://" + addr + "/dns-query?dns=" + base64.RawURLEncoding.EncodeToString(buf))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func assertHTTPAnswer(t *testing.T, resp *http.Response) {
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, dotMimeType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "max-age=600", resp.Header.Get("Cache-Control"))
+
+	buf, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	msg := &D.Msg{}
+	require.NoError(t, msg.Unpack(buf))
+	assertAnswer(t, msg)
+}
+
+// servedSerial returns the serial number of the certificate served at addr
+func servedSerial(t *testing.T, addr string) int64 {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestServer_Reload(t *testing.T) {
+	tcpAddr, tlsAddr := freeAddr(t), freeAddr(t)
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, 1, time.Now())
+	cfg := ServerConfig{ListenTCP: tcpAddr, ListenTLS: tlsAddr, Certificate: certFile, PrivateKey: keyFile}
+	startTestServer(t, cfg)
+
+	tlsClient := &D.Client{Net: "tcp-tls", TLSConfig: &tls.Config{ServerName: "example.com", InsecureSkipVerify: true}}
+	assertAnswer(t, exchangeEventually(t, &D.Client{Net: "tcp"}, tcpAddr))
+	assertAnswer(t, exchangeEventually(t, tlsClient, tlsAddr))
+	assert.Equal(t, int64(1), servedSerial(t, tlsAddr))
+
+	// the unchanged servers keep running and the certificate is reloaded
+	tcpServer, tlsServer := server.tcp, server.tls
+	writeCertificate(t, dir, 2, time.Now())
+	startTestServer(t, cfg)
+	assert.Same(t, tcpServer, server.tcp)
+	assert.Same(t, tlsServer, server.tls)
+	assert.Equal(t, int64(2), servedSerial(t, tlsAddr))
+
+	// the moved server is restarted at the new address
+	newAddr := freeAddr(t)
+	cfg.ListenTCP = newAddr
+	startTestServer(t, cfg)
+	assertAnswer(t, exchangeEventually(t, &D.Client{Net: "tcp"}, newAddr))
+	_, _, err := (&D.Client{Net: "tcp"}).Exchange(new(D.Msg).SetQuestion("example.com.", D.TypeA), tcpAddr)
+	assert.Error(t, err)
+
+	// the servers are stopped without a resolver
+	ReCreateServer(ServerConfig{}, nil, nil)
+	_, _, err = tlsClient.Exchange(new(D.Msg).SetQuestion("example.com.", D.TypeA), tlsAddr)
+	assert.Error(t, err)
+}
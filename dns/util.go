@@ -8,7 +8,6 @@ import (
 	"net"
 	"time"
 
-	"github.com/Dreamacro/clash/common/cache"
 	"github.com/Dreamacro/clash/common/picker"
 
 	D "github.com/miekg/dns"
@@ -34,14 +33,6 @@ func updateTTL(records []D.RR, ttl uint32) {
 	}
 }
 
-func putMsgToCache(c *cache.LruCache, key string, q D.Question, msg *D.Msg) {
-	ttl := minimalTTL(msg.Answer)
-	if ttl == 0 {
-		return
-	}
-	c.SetWithExpire(key, msg.Copy(), time.Now().Add(time.Duration(ttl)*time.Second))
-}
-
 func setMsgTTL(msg *D.Msg, ttl uint32) {
 	for _, answer := range msg.Answer {
 		answer.Header().Ttl = ttl
@@ -69,30 +60,39 @@ func isIPRequest(q D.Question) bool {
 func transform(servers []NameServer, resolver *Resolver) []dnsClient {
 	ret := []dnsClient{}
 	for _, s := range servers {
+		var c dnsClient
 		switch s.Net {
 		case "https":
-			ret = append(ret, newDoHClient(s.Addr, s.Interface, resolver))
-			continue
+			c = newDoHClient(s.Addr, s.Interface, s.ProxyAdapter, resolver)
+		case "h3":
+			c = newDoH3Client(s.Addr, s.Interface, s.ProxyAdapter, resolver)
+		case "quic":
+			c = newDoQClient(s.Addr, s.Interface, s.ProxyAdapter, resolver)
 		case "dhcp":
-			ret = append(ret, newDHCPClient(s.Addr))
-			continue
+			c = newDHCPClient(s.Addr)
+		default:
+			host, port, _ := net.SplitHostPort(s.Addr)
+			c = &client{
+				Client: &D.Client{
+					Net: s.Net,
+					TLSConfig: &tls.Config{
+						ServerName: host,
+					},
+					UDPSize: 4096,
+					Timeout: 5 * time.Second,
+				},
+				port:         port,
+				host:         host,
+				iface:        s.Interface,
+				proxyAdapter: s.ProxyAdapter,
+				r:            resolver,
+			}
 		}
 
-		host, port, _ := net.SplitHostPort(s.Addr)
-		ret = append(ret, &client{
-			Client: &D.Client{
-				Net: s.Net,
-				TLSConfig: &tls.Config{
-					ServerName: host,
-				},
-				UDPSize: 4096,
-				Timeout: 5 * time.Second,
-			},
-			port:  port,
-			host:  host,
-			iface: s.Interface,
-			r:     resolver,
-		})
+		if s.ECSMode != "" {
+			c = &ecsClient{dnsClient: c, mode: s.ECSMode, subnet: s.ECSSubnet}
+		}
+		ret = append(ret, c)
 	}
 	return ret
 }
@@ -134,7 +134,7 @@ func batchExchange(ctx context.Context, clients []dnsClient, m *D.Msg) (msg *D.M
 			} else if m.Rcode == D.RcodeServerFailure || m.Rcode == D.RcodeRefused {
 				return nil, errors.New("server failure")
 			}
-			return m, nil
+			return &result{Msg: m, Upstream: r.Address()}, nil
 		})
 	}
 
@@ -147,6 +147,7 @@ func batchExchange(ctx context.Context, clients []dnsClient, m *D.Msg) (msg *D.M
 		return nil, err
 	}
 
-	msg = elm.(*D.Msg)
-	return
+	res := elm.(*result)
+	setQueryUpstream(ctx, res.Upstream)
+	return res.Msg, nil
 }
@@ -2,10 +2,13 @@ package executor
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/Dreamacro/clash/adapter"
+	"github.com/Dreamacro/clash/adapter/inbound"
 	"github.com/Dreamacro/clash/adapter/outboundgroup"
 	"github.com/Dreamacro/clash/component/auth"
 	"github.com/Dreamacro/clash/component/dialer"
@@ -22,6 +25,7 @@ import (
 	authStore "github.com/Dreamacro/clash/listener/auth"
 	"github.com/Dreamacro/clash/log"
 	"github.com/Dreamacro/clash/tunnel"
+	"github.com/Dreamacro/clash/tunnel/statistic"
 )
 
 var mux sync.Mutex
@@ -67,9 +71,11 @@ func ApplyConfig(cfg *config.Config, force bool) {
 	mux.Lock()
 	defer mux.Unlock()
 
-	updateUsers(cfg.Users)
+	updateUsers(cfg.Users, cfg.AuthBackend)
+	updateUserQuotas(cfg.UserQuotas)
 	updateProxies(cfg.Proxies, cfg.Providers)
-	updateRules(cfg.Rules)
+	updateRuleProviders(cfg.RuleProviders)
+	updateRules(cfg.Rules, cfg.SubRules)
 	updateHosts(cfg.Hosts)
 	updateProfile(cfg)
 	updateGeneral(cfg.General, force)
@@ -80,6 +86,19 @@ func ApplyConfig(cfg *config.Config, force bool) {
 	updateTunnels(cfg.Tunnels)
 }
 
+// Shutdown releases the resources which should be cleaned up before exit
+func Shutdown() {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if r, ok := resolver.DefaultResolver.(*dns.Resolver); ok {
+		r.Close()
+	}
+
+	statistic.DefaultUserManager.Save()
+	listener.CloseAutoRedirect()
+}
+
 func GetGeneral() *config.General {
 	ports := listener.GetPorts()
 	authenticator := []string{}
@@ -87,6 +106,7 @@ func GetGeneral() *config.General {
 		authenticator = auth.Users()
 	}
 
+	filter := inbound.GlobalIPFilter()
 	general := &config.General{
 		LegacyInbound: config.LegacyInbound{
 			Port:        ports.Port,
@@ -96,6 +116,11 @@ func GetGeneral() *config.General {
 			MixedPort:   ports.MixedPort,
 			AllowLan:    listener.AllowLan(),
 			BindAddress: listener.BindAddress(),
+
+			AutoRedirect: listener.AutoRedirect(),
+
+			LanAllowedIPs:    filter.Allowed,
+			LanDisallowedIPs: filter.Disallowed,
 		},
 		Authentication: authenticator,
 		Mode:           tunnel.Mode(),
@@ -113,10 +138,15 @@ func updateExperimental(c *config.Config) {
 }
 
 func updateDNS(c *config.DNS) {
+	// stop refreshing the block lists of the old resolver
+	if old, ok := resolver.DefaultResolver.(*dns.Resolver); ok {
+		old.Close()
+	}
+
 	if !c.Enable {
 		resolver.DefaultResolver = nil
 		resolver.DefaultHostMapper = nil
-		dns.ReCreateServer("", nil, nil)
+		dns.ReCreateServer(dns.ServerConfig{}, nil, nil)
 		return
 	}
 
@@ -126,6 +156,7 @@ func updateDNS(c *config.DNS) {
 		IPv6:         c.IPv6,
 		EnhancedMode: c.EnhancedMode,
 		Pool:         c.FakeIPRange,
+		Pool6:        c.FakeIPRange6,
 		Hosts:        c.Hosts,
 		FallbackFilter: dns.FallbackFilter{
 			GeoIP:     c.FallbackFilter.GeoIP,
@@ -136,6 +167,15 @@ func updateDNS(c *config.DNS) {
 		Default:       c.DefaultNameserver,
 		Policy:        c.NameServerPolicy,
 		SearchDomains: c.SearchDomains,
+		Filter:        c.Filter,
+		MinTTL:        c.CacheMinTTL,
+		MaxTTL:        c.CacheMaxTTL,
+		Prefetch:      c.CachePrefetch,
+		ServeStale:    c.CacheServeStale,
+		StaleMaxAge:   time.Duration(c.CacheStaleMaxAge) * time.Second,
+		StaleTTL:      c.CacheStaleTTL,
+		PersistCache:  c.PersistCache,
+		DNSSEC:        c.DNSSEC,
 	}
 
 	r := dns.NewResolver(cfg)
@@ -150,7 +190,15 @@ func updateDNS(c *config.DNS) {
 	resolver.DefaultHostMapper = m
 	resolver.DefaultLocalServer = dns.NewLocalServer(r, m)
 
-	dns.ReCreateServer(c.Listen, r, m)
+	dns.ReCreateServer(dns.ServerConfig{
+		Listen:      c.Listen,
+		ListenTCP:   c.ListenTCP,
+		ListenTLS:   c.ListenTLS,
+		ListenHTTPS: c.ListenHTTPS,
+		HTTPSPath:   c.HTTPSPath,
+		Certificate: c.Certificate,
+		PrivateKey:  c.PrivateKey,
+	}, r, m)
 }
 
 func updateHosts(tree *trie.DomainTrie) {
@@ -161,8 +209,18 @@ func updateProxies(proxies map[string]C.Proxy, providers map[string]provider.Pro
 	tunnel.UpdateProxies(proxies, providers)
 }
 
-func updateRules(rules []C.Rule) {
-	tunnel.UpdateRules(rules)
+// updateRuleProviders stops pulling the replaced rule providers rather than leaving them to the GC,
+// the rules and the resolver still holding them keep matching their last content
+func updateRuleProviders(ruleProviders map[string]provider.RuleProvider) {
+	for _, pd := range tunnel.UpdateRuleProviders(ruleProviders) {
+		if destroyer, ok := pd.(interface{ Destroy() error }); ok {
+			destroyer.Destroy()
+		}
+	}
+}
+
+func updateRules(rules []C.Rule, subRules map[string][]C.Rule) {
+	tunnel.UpdateRules(rules, subRules)
 }
 
 func updateTunnels(tunnels []config.Tunnel) {
@@ -189,6 +247,9 @@ func updateGeneral(general *config.General, force bool) {
 
 	iface.FlushCache()
 
+	// the filter is checked on each connection, the listeners are kept
+	inbound.SetIPFilter(general.LanAllowedIPs, general.LanDisallowedIPs)
+
 	if !force {
 		return
 	}
@@ -199,6 +260,8 @@ func updateGeneral(general *config.General, force bool) {
 	bindAddress := general.BindAddress
 	listener.SetBindAddress(bindAddress)
 
+	listener.SetAutoRedirect(general.AutoRedirect)
+
 	ports := listener.Ports{
 		Port:       general.Port,
 		SocksPort:  general.SocksPort,
@@ -216,14 +279,27 @@ func updateTun(general *config.General, force bool) {
 	listener.ReCreateTun(general.Tun, tunnel.TCPIn(), tunnel.UDPIn())
 }
 
-func updateUsers(users []auth.AuthUser) {
-	authenticator := auth.NewAuthenticator(users)
+func updateUsers(users []auth.AuthUser, backend auth.Authenticator) {
+	authenticator := backend
+	if authenticator == nil {
+		authenticator = auth.NewAuthenticator(users)
+	}
+
+	// stop watching the file of the replaced backend
+	if closer, ok := authStore.Authenticator().(io.Closer); ok {
+		closer.Close()
+	}
 	authStore.SetAuthenticator(authenticator)
 	if authenticator != nil {
 		log.Infoln("Authentication of local server updated")
 	}
 }
 
+func updateUserQuotas(quotas map[string]statistic.UserQuota) {
+	statistic.DefaultUserManager.SetQuotas(quotas)
+	statistic.DefaultUserManager.Persist()
+}
+
 func updateProfile(cfg *config.Config) {
 	profileCfg := cfg.Profile
 
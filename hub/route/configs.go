@@ -5,6 +5,7 @@ import (
 	"net/netip"
 	"path/filepath"
 
+	"github.com/Dreamacro/clash/adapter/inbound"
 	"github.com/Dreamacro/clash/component/resolver"
 	"github.com/Dreamacro/clash/config"
 	C "github.com/Dreamacro/clash/constant"
@@ -40,6 +41,9 @@ func patchConfigs(w http.ResponseWriter, r *http.Request) {
 		MixedPort   *int               `json:"mixed-port"`
 		AllowLan    *bool              `json:"allow-lan"`
 		BindAddress *string            `json:"bind-address"`
+		AutoRedir   *bool              `json:"auto-redirect"`
+		LanAllowed  *[]netip.Prefix    `json:"lan-allowed-ips"`
+		LanDisallow *[]netip.Prefix    `json:"lan-disallowed-ips"`
 		Mode        *tunnel.TunnelMode `json:"mode"`
 		LogLevel    *log.LogLevel      `json:"log-level"`
 		IPv6        *bool              `json:"ipv6"`
@@ -71,6 +75,18 @@ func patchConfigs(w http.ResponseWriter, r *http.Request) {
 		listener.SetBindAddress(*general.BindAddress)
 	}
 
+	if general.AutoRedir != nil {
+		listener.SetAutoRedirect(*general.AutoRedir)
+	}
+
+	if general.LanAllowed != nil || general.LanDisallow != nil {
+		filter := inbound.GlobalIPFilter()
+		inbound.SetIPFilter(
+			lo.FromPtrOr(general.LanAllowed, filter.Allowed),
+			lo.FromPtrOr(general.LanDisallow, filter.Disallowed),
+		)
+	}
+
 	ports := listener.GetPorts()
 	ports.Port = lo.FromPtrOr(general.Port, ports.Port)
 	ports.SocksPort = lo.FromPtrOr(general.SocksPort, ports.SocksPort)
@@ -1,24 +1,131 @@
 package route
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/Dreamacro/clash/component/resolver"
+	"github.com/Dreamacro/clash/dns"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
-	"github.com/miekg/dns"
+	"github.com/gorilla/websocket"
+	D "github.com/miekg/dns"
 	"github.com/samber/lo"
 )
 
 func dnsRouter() http.Handler {
 	r := chi.NewRouter()
 	r.Get("/query", queryDNS)
+	r.Get("/filter", getDNSFilter)
+	r.Delete("/cache", clearDNSCache)
+	r.Get("/logs", getDNSLogs)
+	r.Get("/stats", getDNSStatistics)
+	r.Delete("/stats", resetDNSStatistics)
 	return r
 }
 
+func getDNSLogs(w http.ResponseWriter, r *http.Request) {
+	var wsConn *websocket.Conn
+	if websocket.IsWebSocketUpgrade(r) {
+		var err error
+		wsConn, err = upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+	}
+
+	if wsConn == nil {
+		w.Header().Set("Content-Type", "application/json")
+		render.Status(r, http.StatusOK)
+	}
+
+	ch := make(chan *dns.QueryLog, 1024)
+	sub := dns.SubscribeQueryLog()
+	defer dns.UnSubscribeQueryLog(sub)
+	buf := &bytes.Buffer{}
+
+	go func() {
+		for elm := range sub {
+			select {
+			case ch <- elm.(*dns.QueryLog):
+			default:
+			}
+		}
+		close(ch)
+	}()
+
+	for l := range ch {
+		buf.Reset()
+
+		if err := json.NewEncoder(buf).Encode(l); err != nil {
+			break
+		}
+
+		var err error
+		if wsConn == nil {
+			_, err = w.Write(buf.Bytes())
+			w.(http.Flusher).Flush()
+		} else {
+			err = wsConn.WriteMessage(websocket.TextMessage, buf.Bytes())
+		}
+
+		if err != nil {
+			break
+		}
+	}
+}
+
+func getDNSStatistics(w http.ResponseWriter, r *http.Request) {
+	top := 10
+	if topStr := r.URL.Query().Get("top"); topStr != "" {
+		var err error
+		if top, err = strconv.Atoi(topStr); err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, ErrBadRequest)
+			return
+		}
+	}
+
+	render.JSON(w, r, dns.Statistics(top))
+}
+
+func resetDNSStatistics(w http.ResponseWriter, r *http.Request) {
+	dns.ResetStatistics()
+	render.NoContent(w, r)
+}
+
+func clearDNSCache(w http.ResponseWriter, r *http.Request) {
+	dnsResolver, ok := resolver.DefaultResolver.(*dns.Resolver)
+	if !ok {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, newError("DNS section is disabled"))
+		return
+	}
+
+	dnsResolver.ClearCache(r.URL.Query().Get("name"))
+	render.NoContent(w, r)
+}
+
+func getDNSFilter(w http.ResponseWriter, r *http.Request) {
+	dnsResolver, ok := resolver.DefaultResolver.(*dns.Resolver)
+	if !ok {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, newError("DNS section is disabled"))
+		return
+	}
+
+	stats := dnsResolver.FilterStatistics()
+	if stats == nil {
+		stats = &dns.FilterStatistics{Lists: []dns.BlockListStatistics{}}
+	}
+	render.JSON(w, r, stats)
+}
+
 func queryDNS(w http.ResponseWriter, r *http.Request) {
 	if resolver.DefaultResolver == nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -29,7 +136,7 @@ func queryDNS(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Query().Get("name")
 	qTypeStr, _ := lo.Coalesce(r.URL.Query().Get("type"), "A")
 
-	qType, exist := dns.StringToType[qTypeStr]
+	qType, exist := D.StringToType[qTypeStr]
 	if !exist {
 		render.Status(r, http.StatusBadRequest)
 		render.JSON(w, r, newError("invalid query type"))
@@ -39,8 +146,8 @@ func queryDNS(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), resolver.DefaultDNSTimeout)
 	defer cancel()
 
-	msg := dns.Msg{}
-	msg.SetQuestion(dns.Fqdn(name), qType)
+	msg := D.Msg{}
+	msg.SetQuestion(D.Fqdn(name), qType)
 	resp, err := resolver.DefaultResolver.ExchangeContext(ctx, &msg)
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -58,7 +165,7 @@ func queryDNS(w http.ResponseWriter, r *http.Request) {
 		"CD":       resp.CheckingDisabled,
 	}
 
-	rr2Json := func(rr dns.RR, _ int) render.M {
+	rr2Json := func(rr D.RR, _ int) render.M {
 		header := rr.Header()
 		return render.M{
 			"name": header.Name,
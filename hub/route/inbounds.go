@@ -3,12 +3,14 @@ package route
 import (
 	"net/http"
 
+	"github.com/Dreamacro/clash/adapter/inbound"
 	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/listener"
 	"github.com/Dreamacro/clash/tunnel"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/samber/lo"
 )
 
 func inboundRouter() http.Handler {
@@ -19,9 +21,12 @@ func inboundRouter() http.Handler {
 }
 
 func getInbounds(w http.ResponseWriter, r *http.Request) {
-	inbounds := listener.GetInbounds()
+	inbounds := lo.Map(listener.GetInbounds(), func(inbound C.Inbound, _ int) C.Inbound {
+		return inbound.Redacted()
+	})
 	render.JSON(w, r, render.M{
 		"inbounds": inbounds,
+		"rejected": inbound.Rejected(),
 	})
 }
 
@@ -0,0 +1,40 @@
+package route
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/Dreamacro/clash/component/pac"
+	"github.com/Dreamacro/clash/listener"
+	"github.com/Dreamacro/clash/tunnel"
+
+	"github.com/go-chi/render"
+)
+
+// getPAC serves the PAC script sending the proxied connections to the mixed port or the HTTP port,
+// the host of them is the local address the client connected to
+func getPAC(w http.ResponseWriter, r *http.Request) {
+	ports := listener.GetPorts()
+	port := ports.MixedPort
+	if port == 0 {
+		port = ports.Port
+	}
+
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if port == 0 || local == nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, newError("mixed-port or port is required"))
+		return
+	}
+
+	addr, err := netip.ParseAddrPort(local.String())
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", pac.ContentType)
+	w.Write(tunnel.PAC(pac.ProxyAddr(addr.Addr(), port)))
+}
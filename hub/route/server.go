@@ -74,7 +74,17 @@ func Start(addr string, secret string) {
 		r.Mount("/rules", ruleRouter())
 		r.Mount("/connections", connectionRouter())
 		r.Mount("/providers/proxies", proxyProviderRouter())
+		r.Mount("/providers/rules", ruleProviderRouter())
 		r.Mount("/dns", dnsRouter())
+		r.Mount("/users", userRouter())
+	})
+
+	// the browsers fetch the PAC script with the secret in the URL
+	r.Group(func(r chi.Router) {
+		r.Use(tokenAuthentication)
+
+		r.Get("/proxy.pac", getPAC)
+		r.Get("/wpad.dat", getPAC)
 	})
 
 	if uiPath != "" {
@@ -139,6 +149,27 @@ func authentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// tokenAuthentication accepts the secret in the token query as well as the header,
+// as the browsers can't set the header of the PAC script request
+func tokenAuthentication(next http.Handler) http.Handler {
+	header := authentication(next)
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if serverSecret == "" || token == "" {
+			header.ServeHTTP(w, r)
+			return
+		}
+
+		if !safeEuqal(token, serverSecret) {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, ErrUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
 func hello(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, render.M{"hello": "clash"})
 }
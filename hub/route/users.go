@@ -0,0 +1,62 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/Dreamacro/clash/tunnel/statistic"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func userRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", getUsers)
+	r.Get("/{name}", getUser)
+	r.Put("/{name}", updateUserQuota)
+	r.Delete("/{name}/usage", resetUserUsage)
+	return r
+}
+
+func getUsers(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, render.M{
+		"users": statistic.DefaultUserManager.Users(),
+	})
+}
+
+func getUser(w http.ResponseWriter, r *http.Request) {
+	user, exist := statistic.DefaultUserManager.User(getEscapeParam(r, "name"))
+	if !exist {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, ErrNotFound)
+		return
+	}
+	render.JSON(w, r, user)
+}
+
+// updateUserQuota replaces the quota of the user until the config is reloaded
+func updateUserQuota(w http.ResponseWriter, r *http.Request) {
+	quota := statistic.UserQuota{}
+	if err := render.DecodeJSON(r.Body, &quota); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrBadRequest)
+		return
+	}
+	if quota.MaxConnections < 0 || quota.UploadRate < 0 || quota.DownloadRate < 0 || quota.MonthlyQuota < 0 {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError("Negative limit"))
+		return
+	}
+
+	statistic.DefaultUserManager.SetQuota(getEscapeParam(r, "name"), quota)
+	render.NoContent(w, r)
+}
+
+func resetUserUsage(w http.ResponseWriter, r *http.Request) {
+	if !statistic.DefaultUserManager.ResetUsage(getEscapeParam(r, "name")) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, ErrNotFound)
+		return
+	}
+	render.NoContent(w, r)
+}
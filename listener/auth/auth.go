@@ -2,6 +2,7 @@ package auth
 
 import (
 	"github.com/Dreamacro/clash/component/auth"
+	C "github.com/Dreamacro/clash/constant"
 )
 
 var authenticator auth.Authenticator
@@ -13,3 +14,15 @@ func Authenticator() auth.Authenticator {
 func SetAuthenticator(au auth.Authenticator) {
 	authenticator = au
 }
+
+// ApplySession records the authenticated user in the metadata of its connection
+func ApplySession(metadata *C.Metadata, session *auth.Session) {
+	if session == nil {
+		return
+	}
+
+	metadata.InboundUser = session.User
+	if session.Proxy != "" {
+		metadata.SpecialProxy = session.Proxy
+	}
+}
@@ -0,0 +1,55 @@
+// Package autoredir installs the nftables rules redirecting the traffic to the redir and tproxy
+// listeners, so that they work without the hand-written iptables rules.
+package autoredir
+
+import "net/netip"
+
+const (
+	// TableName is the name of the nftables table of the rules in the inet family
+	TableName = "clash"
+
+	// TProxyMark is the mark routing the packets to the local tproxy listener by TProxyTable
+	TProxyMark = 0x162
+
+	// TProxyTable is the routing table delivering all the packets locally
+	TProxyTable = 354
+
+	// rulePriority is the priority of the policy routing rules
+	rulePriority = 9010
+)
+
+// Options are the listeners the traffic is redirected to
+type Options struct {
+	// RedirPort is the port of the redir listener receiving the TCP traffic,
+	// it is used only if there is no tproxy listener
+	RedirPort int
+
+	// TProxyPort is the port of the tproxy listener receiving the TCP and UDP traffic
+	TProxyPort int
+
+	// RoutingMark is the mark of the outgoing connections, the traffic of the host itself is
+	// redirected only if it is set as the connections would be redirected in a loop otherwise
+	RoutingMark int
+}
+
+// Enabled reports whether any traffic is redirected
+func (o Options) Enabled() bool {
+	return o.RedirPort != 0 || o.TProxyPort != 0
+}
+
+// reserved is the destinations never redirected, they are usually in the local networks
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
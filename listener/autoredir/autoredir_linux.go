@@ -0,0 +1,187 @@
+package autoredir
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/sagernet/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Setup installs the rules of the options, the rules left by a previous run are removed first
+func Setup(opts Options) error {
+	if err := Cleanup(); err != nil {
+		return err
+	}
+	if !opts.Enabled() {
+		return nil
+	}
+	if opts.TProxyPort != 0 && opts.RoutingMark == TProxyMark {
+		return fmt.Errorf("routing-mark %#x is reserved by auto-redirect", TProxyMark)
+	}
+
+	b := newBatch(unix.NFPROTO_INET)
+	b.addTable(TableName)
+	for _, c := range chains(opts) {
+		b.addChain(TableName, c)
+	}
+	if err := b.commit(); err != nil {
+		return err
+	}
+
+	if opts.TProxyPort != 0 {
+		if err := addRoutes(); err != nil {
+			Cleanup()
+			return err
+		}
+	}
+	return nil
+}
+
+// Cleanup removes the rules installed by Setup, it succeeds if there are no rules
+func Cleanup() error {
+	if _, err := deleteTable(); err != nil {
+		return err
+	}
+	deleteRoutes()
+	return nil
+}
+
+// CleanupStale removes the rules left by a crashed run, the routing rules are only removed
+// along with the table as they may be owned by something else otherwise. It reports whether
+// the table existed
+func CleanupStale() (bool, error) {
+	existed, err := deleteTable()
+	if err != nil || !existed {
+		return false, err
+	}
+	deleteRoutes()
+	return true, nil
+}
+
+// deleteTable removes the table, it reports whether the table existed
+func deleteTable() (bool, error) {
+	b := newBatch(unix.NFPROTO_INET)
+	b.deleteTable(TableName)
+	if err := b.commit(); err != nil {
+		if isNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func deleteRoutes() {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		for netlink.RuleDel(routingRule(family)) == nil {
+		}
+		netlink.RouteDel(localRoute(family))
+	}
+}
+
+func chains(opts Options) []chain {
+	skip := [][]expr{
+		append(matchLocal(), verdict(unix.NFT_RETURN)),
+		append(matchReply(), verdict(unix.NFT_RETURN)),
+	}
+	for _, prefix := range reserved {
+		skip = append(skip, append(matchDst(prefix), verdict(unix.NFT_RETURN)))
+	}
+
+	// the connections of clash itself are marked by routing-mark
+	var skipOutput [][]expr
+	if opts.RoutingMark != 0 {
+		skipOutput = append([][]expr{append(matchMark(opts.RoutingMark), verdict(unix.NFT_RETURN))}, skip...)
+	}
+
+	if opts.TProxyPort != 0 {
+		prerouting := chain{name: "prerouting", kind: "filter", hook: unix.NF_INET_PRE_ROUTING, priority: -150, rules: skip}
+		output := chain{name: "output", kind: "route", hook: unix.NF_INET_LOCAL_OUT, priority: -150, rules: skipOutput}
+		for _, proto := range []byte{unix.IPPROTO_TCP, unix.IPPROTO_UDP} {
+			prerouting.rules = append(prerouting.rules, concat(
+				matchL4Proto(proto),
+				[]expr{
+					immediate(port(opts.TProxyPort)), tproxy(),
+					immediate(nativeUint32(TProxyMark)), metaSet(unix.NFT_META_MARK),
+					verdict(nfAccept),
+				},
+			))
+			// the marked packets are routed to lo and received by the prerouting chain
+			output.rules = append(output.rules, concat(
+				matchL4Proto(proto),
+				[]expr{immediate(nativeUint32(TProxyMark)), metaSet(unix.NFT_META_MARK)},
+			))
+		}
+		if opts.RoutingMark == 0 {
+			return []chain{prerouting}
+		}
+		return []chain{prerouting, output}
+	}
+
+	redir := concat(matchL4Proto(unix.IPPROTO_TCP), []expr{immediate(port(opts.RedirPort)), redirect()})
+	prerouting := chain{name: "prerouting", kind: "nat", hook: unix.NF_INET_PRE_ROUTING, priority: -100, rules: append(skip, redir)}
+	if opts.RoutingMark == 0 {
+		return []chain{prerouting}
+	}
+	output := chain{name: "output", kind: "nat", hook: unix.NF_INET_LOCAL_OUT, priority: -100, rules: append(skipOutput, redir)}
+	return []chain{prerouting, output}
+}
+
+// addRoutes delivers the packets marked by TProxyMark locally
+func addRoutes() error {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		return err
+	}
+
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		route := localRoute(family)
+		route.LinkIndex = lo.Index
+		err := netlink.RouteReplace(route)
+		if err == nil {
+			err = netlink.RuleAdd(routingRule(family))
+		}
+		if err != nil {
+			// IPv6 may be disabled on the host
+			if family == netlink.FAMILY_V6 && errors.Is(err, unix.EAFNOSUPPORT) {
+				continue
+			}
+			return fmt.Errorf("add the routing rule of tproxy: %w", err)
+		}
+	}
+	return nil
+}
+
+func routingRule(family int) *netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Family = family
+	rule.Priority = rulePriority
+	rule.Mark = TProxyMark
+	rule.Table = TProxyTable
+	return rule
+}
+
+// localRoute is the route delivering all the packets locally in TProxyTable
+func localRoute(family int) *netlink.Route {
+	dst := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	if family == netlink.FAMILY_V6 {
+		dst = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	}
+	return &netlink.Route{
+		Scope:  netlink.SCOPE_HOST,
+		Family: family,
+		Table:  TProxyTable,
+		Type:   unix.RTN_LOCAL,
+		Dst:    dst,
+	}
+}
+
+func concat(exprs ...[]expr) []expr {
+	var result []expr
+	for _, e := range exprs {
+		result = append(result, e...)
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package autoredir
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/sagernet/netlink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// isolate moves the test into a new network namespace, the thread is never unlocked
+// so it's discarded with the namespace when the test ends
+func isolate(t *testing.T) {
+	runtime.LockOSThread()
+	if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		t.Skipf("new network namespace: %s", err)
+	}
+	lo, err := netlink.LinkByName("lo")
+	require.NoError(t, err)
+	require.NoError(t, netlink.LinkSetUp(lo))
+}
+
+func countRoutingRules(t *testing.T) int {
+	rules, err := netlink.RuleList(netlink.FAMILY_V4)
+	require.NoError(t, err)
+	count := 0
+	for _, rule := range rules {
+		if rule.Mark == TProxyMark && rule.Table == TProxyTable {
+			count++
+		}
+	}
+	return count
+}
+
+func TestCleanupStale(t *testing.T) {
+	isolate(t)
+
+	removed, err := CleanupStale()
+	if err != nil {
+		t.Skipf("nftables: %s", err)
+	}
+	assert.False(t, removed)
+
+	// the rules of a crashed run
+	if err := Setup(Options{TProxyPort: 7893}); err != nil {
+		t.Skipf("setup: %s", err)
+	}
+	require.Equal(t, 1, countRoutingRules(t))
+
+	removed, err = CleanupStale()
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.Equal(t, 0, countRoutingRules(t))
+
+	removed, err = CleanupStale()
+	require.NoError(t, err)
+	assert.False(t, removed)
+}
+
+func TestCleanupStale_ForeignRoutingRule(t *testing.T) {
+	isolate(t)
+
+	if _, err := CleanupStale(); err != nil {
+		t.Skipf("nftables: %s", err)
+	}
+
+	// the routing rule without the table isn't ours
+	require.NoError(t, netlink.RuleAdd(routingRule(netlink.FAMILY_V4)))
+	removed, err := CleanupStale()
+	require.NoError(t, err)
+	assert.False(t, removed)
+	assert.Equal(t, 1, countRoutingRules(t))
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package autoredir
+
+import "errors"
+
+// Setup installs the rules of the options
+func Setup(opts Options) error {
+	return errors.New("auto-redirect is only supported on Linux")
+}
+
+// Cleanup removes the rules installed by Setup
+func Cleanup() error {
+	return nil
+}
+
+// CleanupStale removes the rules left by a crashed run
+func CleanupStale() (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,311 @@
+package autoredir
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// the constants missing in x/sys/unix
+const (
+	nfAccept = 1
+
+	nftaTProxyFamily  = 1
+	nftaTProxyRegPort = 3
+
+	ipCTDirReply = 1
+)
+
+const (
+	// nftRegister is the register the expressions load to and store from
+	nftRegister = unix.NFT_REG_1
+
+	nftTimeout = 5 * time.Second
+)
+
+// expr is an nftables expression
+type expr struct {
+	name string
+	data func(ae *netlink.AttributeEncoder)
+}
+
+func metaLoad(key uint32) expr {
+	return expr{"meta", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_META_KEY, key)
+		ae.Uint32(unix.NFTA_META_DREG, nftRegister)
+	}}
+}
+
+func metaSet(key uint32) expr {
+	return expr{"meta", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_META_KEY, key)
+		ae.Uint32(unix.NFTA_META_SREG, nftRegister)
+	}}
+}
+
+func ctLoad(key uint32) expr {
+	return expr{"ct", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_CT_KEY, key)
+		ae.Uint32(unix.NFTA_CT_DREG, nftRegister)
+	}}
+}
+
+func fibLoad(result uint32, flags uint32) expr {
+	return expr{"fib", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_FIB_RESULT, result)
+		ae.Uint32(unix.NFTA_FIB_FLAGS, flags)
+		ae.Uint32(unix.NFTA_FIB_DREG, nftRegister)
+	}}
+}
+
+func payloadLoad(offset uint32, length uint32) expr {
+	return expr{"payload", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_PAYLOAD_DREG, nftRegister)
+		ae.Uint32(unix.NFTA_PAYLOAD_BASE, unix.NFT_PAYLOAD_NETWORK_HEADER)
+		ae.Uint32(unix.NFTA_PAYLOAD_OFFSET, offset)
+		ae.Uint32(unix.NFTA_PAYLOAD_LEN, length)
+	}}
+}
+
+func bitwise(mask []byte) expr {
+	return expr{"bitwise", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_BITWISE_SREG, nftRegister)
+		ae.Uint32(unix.NFTA_BITWISE_DREG, nftRegister)
+		ae.Uint32(unix.NFTA_BITWISE_LEN, uint32(len(mask)))
+		ae.Nested(unix.NFTA_BITWISE_MASK, dataValue(mask))
+		ae.Nested(unix.NFTA_BITWISE_XOR, dataValue(make([]byte, len(mask))))
+	}}
+}
+
+func cmpEq(data []byte) expr {
+	return expr{"cmp", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_CMP_SREG, nftRegister)
+		ae.Uint32(unix.NFTA_CMP_OP, unix.NFT_CMP_EQ)
+		ae.Nested(unix.NFTA_CMP_DATA, dataValue(data))
+	}}
+}
+
+func immediate(data []byte) expr {
+	return expr{"immediate", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_IMMEDIATE_DREG, nftRegister)
+		ae.Nested(unix.NFTA_IMMEDIATE_DATA, dataValue(data))
+	}}
+}
+
+func verdict(code int32) expr {
+	return expr{"immediate", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_IMMEDIATE_DREG, unix.NFT_REG_VERDICT)
+		ae.Nested(unix.NFTA_IMMEDIATE_DATA, func(ae *netlink.AttributeEncoder) error {
+			ae.Nested(unix.NFTA_DATA_VERDICT, func(ae *netlink.AttributeEncoder) error {
+				ae.Uint32(unix.NFTA_VERDICT_CODE, uint32(code))
+				return nil
+			})
+			return nil
+		})
+	}}
+}
+
+func redirect() expr {
+	return expr{"redir", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NFTA_REDIR_REG_PROTO_MIN, nftRegister)
+	}}
+}
+
+// tproxy sends the packets to the port of the local address, it works in both IPv4 and IPv6
+func tproxy() expr {
+	return expr{"tproxy", func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(nftaTProxyFamily, unix.NFPROTO_UNSPEC)
+		ae.Uint32(nftaTProxyRegPort, nftRegister)
+	}}
+}
+
+func dataValue(data []byte) func(ae *netlink.AttributeEncoder) error {
+	return func(ae *netlink.AttributeEncoder) error {
+		ae.Bytes(unix.NFTA_DATA_VALUE, data)
+		return nil
+	}
+}
+
+// the values of meta mark and fib type are in the host byte order
+func nativeUint32(v uint32) []byte {
+	return binary.NativeEndian.AppendUint32(nil, v)
+}
+
+func port(p int) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(p))
+}
+
+// matchMark matches the packets with the mark
+func matchMark(mark int) []expr {
+	return []expr{metaLoad(unix.NFT_META_MARK), cmpEq(nativeUint32(uint32(mark)))}
+}
+
+// matchL4Proto matches the packets of the transport protocol
+func matchL4Proto(proto byte) []expr {
+	return []expr{metaLoad(unix.NFT_META_L4PROTO), cmpEq([]byte{proto})}
+}
+
+// matchLocal matches the packets to the local addresses
+func matchLocal() []expr {
+	return []expr{fibLoad(unix.NFT_FIB_RESULT_ADDRTYPE, unix.NFTA_FIB_F_DADDR), cmpEq(nativeUint32(unix.RTN_LOCAL))}
+}
+
+// matchReply matches the packets of the reply direction
+func matchReply() []expr {
+	return []expr{ctLoad(unix.NFT_CT_DIRECTION), cmpEq([]byte{ipCTDirReply})}
+}
+
+// matchDst matches the packets to the prefix
+func matchDst(prefix netip.Prefix) []expr {
+	proto, offset := byte(unix.NFPROTO_IPV4), uint32(16)
+	if prefix.Addr().Is6() {
+		proto, offset = unix.NFPROTO_IPV6, 24
+	}
+
+	addr := prefix.Masked().Addr().AsSlice()
+	exprs := []expr{
+		metaLoad(unix.NFT_META_NFPROTO), cmpEq([]byte{proto}),
+		payloadLoad(offset, uint32(len(addr))),
+	}
+	if prefix.Bits() < prefix.Addr().BitLen() {
+		mask := make([]byte, len(addr))
+		for i := 0; i < prefix.Bits(); i++ {
+			mask[i/8] |= 0x80 >> (i % 8)
+		}
+		exprs = append(exprs, bitwise(mask))
+	}
+	return append(exprs, cmpEq(addr))
+}
+
+// chain is a base chain with its rules
+type chain struct {
+	name     string
+	kind     string
+	hook     uint32
+	priority int32
+	rules    [][]expr
+}
+
+// batch is the messages committed in a transaction
+type batch struct {
+	family   uint8
+	messages []netlink.Message
+}
+
+func newBatch(family uint8) *batch {
+	return &batch{family: family}
+}
+
+func (b *batch) add(msgType uint16, flags netlink.HeaderFlags, fn func(ae *netlink.AttributeEncoder)) {
+	ae := netlink.NewAttributeEncoder()
+	ae.ByteOrder = binary.BigEndian
+	fn(ae)
+	attrs, err := ae.Encode()
+	if err != nil {
+		// the attributes are built from the constants, it should never fail
+		panic(err)
+	}
+
+	b.messages = append(b.messages, netlink.Message{
+		Header: netlink.Header{
+			Type:  netlink.HeaderType(unix.NFNL_SUBSYS_NFTABLES<<8 | msgType),
+			Flags: netlink.Request | netlink.Acknowledge | flags,
+		},
+		Data: append([]byte{b.family, unix.NFNETLINK_V0, 0, 0}, attrs...),
+	})
+}
+
+func (b *batch) addTable(name string) {
+	b.add(unix.NFT_MSG_NEWTABLE, netlink.Create, func(ae *netlink.AttributeEncoder) {
+		ae.String(unix.NFTA_TABLE_NAME, name)
+		ae.Uint32(unix.NFTA_TABLE_FLAGS, 0)
+	})
+}
+
+func (b *batch) deleteTable(name string) {
+	b.add(unix.NFT_MSG_DELTABLE, 0, func(ae *netlink.AttributeEncoder) {
+		ae.String(unix.NFTA_TABLE_NAME, name)
+	})
+}
+
+func (b *batch) addChain(table string, c chain) {
+	b.add(unix.NFT_MSG_NEWCHAIN, netlink.Create, func(ae *netlink.AttributeEncoder) {
+		ae.String(unix.NFTA_CHAIN_TABLE, table)
+		ae.String(unix.NFTA_CHAIN_NAME, c.name)
+		ae.Nested(unix.NFTA_CHAIN_HOOK, func(ae *netlink.AttributeEncoder) error {
+			ae.Uint32(unix.NFTA_HOOK_HOOKNUM, c.hook)
+			ae.Uint32(unix.NFTA_HOOK_PRIORITY, uint32(c.priority))
+			return nil
+		})
+		ae.String(unix.NFTA_CHAIN_TYPE, c.kind)
+		ae.Uint32(unix.NFTA_CHAIN_POLICY, nfAccept)
+	})
+
+	for _, rule := range c.rules {
+		b.add(unix.NFT_MSG_NEWRULE, netlink.Create|netlink.Append, func(ae *netlink.AttributeEncoder) {
+			ae.String(unix.NFTA_RULE_TABLE, table)
+			ae.String(unix.NFTA_RULE_CHAIN, c.name)
+			ae.Nested(unix.NFTA_RULE_EXPRESSIONS, func(ae *netlink.AttributeEncoder) error {
+				for _, e := range rule {
+					ae.Nested(unix.NFTA_LIST_ELEM, func(ae *netlink.AttributeEncoder) error {
+						ae.String(unix.NFTA_EXPR_NAME, e.name)
+						ae.Nested(unix.NFTA_EXPR_DATA, func(ae *netlink.AttributeEncoder) error {
+							e.data(ae)
+							return nil
+						})
+						return nil
+					})
+				}
+				return nil
+			})
+		})
+	}
+}
+
+// commit sends the messages in a transaction, it fails if any of them fails
+func (b *batch) commit() error {
+	conn, err := netlink.Dial(unix.NETLINK_NETFILTER, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(nftTimeout))
+
+	// the res_id of the batch messages is the subsystem
+	subsys := []byte{unix.AF_UNSPEC, unix.NFNETLINK_V0}
+	subsys = binary.BigEndian.AppendUint16(subsys, unix.NFNL_SUBSYS_NFTABLES)
+
+	messages := make([]netlink.Message, 0, len(b.messages)+2)
+	messages = append(messages, netlink.Message{
+		Header: netlink.Header{Type: unix.NFNL_MSG_BATCH_BEGIN, Flags: netlink.Request},
+		Data:   subsys,
+	})
+	messages = append(messages, b.messages...)
+	messages = append(messages, netlink.Message{
+		Header: netlink.Header{Type: unix.NFNL_MSG_BATCH_END, Flags: netlink.Request},
+		Data:   subsys,
+	})
+	if _, err := conn.SendMessages(messages); err != nil {
+		return err
+	}
+
+	// each message is acknowledged, the first error aborts the transaction
+	for acked := 0; acked < len(b.messages); {
+		replies, err := conn.Receive()
+		if err != nil {
+			return fmt.Errorf("nftables: %w", err)
+		}
+		acked += len(replies)
+	}
+	return nil
+}
+
+// isNotExist reports whether the error is caused by a missing object
+func isNotExist(err error) bool {
+	return errors.Is(err, unix.ENOENT)
+}
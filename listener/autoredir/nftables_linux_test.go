@@ -0,0 +1,371 @@
+package autoredir
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// attr is the netlink attribute of the data, its header is in the host byte order
+func attr(typ uint16, data ...[]byte) []byte {
+	payload := bytes.Join(data, nil)
+	b := binary.NativeEndian.AppendUint16(nil, uint16(4+len(payload)))
+	b = binary.NativeEndian.AppendUint16(b, typ)
+	b = append(b, payload...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func nested(typ uint16, attrs ...[]byte) []byte {
+	return attr(unix.NLA_F_NESTED|typ, attrs...)
+}
+
+func be32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func cstring(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func value(data ...byte) []byte {
+	return attr(unix.NFTA_DATA_VALUE, data)
+}
+
+// element is the expression in the NFTA_RULE_EXPRESSIONS list
+func element(name string, data ...[]byte) []byte {
+	return nested(unix.NFTA_LIST_ELEM, attr(unix.NFTA_EXPR_NAME, cstring(name)), nested(unix.NFTA_EXPR_DATA, data...))
+}
+
+func encodeExpr(t *testing.T, e expr) []byte {
+	ae := netlink.NewAttributeEncoder()
+	ae.ByteOrder = binary.BigEndian
+	e.data(ae)
+	b, err := ae.Encode()
+	require.NoError(t, err)
+	return b
+}
+
+func TestExpr(t *testing.T) {
+	reg := be32(unix.NFT_REG_1)
+
+	for _, tt := range []struct {
+		name string
+		expr expr
+		kind string
+		data [][]byte
+	}{
+		{
+			name: "meta load",
+			expr: metaLoad(unix.NFT_META_MARK),
+			kind: "meta",
+			data: [][]byte{attr(unix.NFTA_META_KEY, be32(unix.NFT_META_MARK)), attr(unix.NFTA_META_DREG, reg)},
+		},
+		{
+			name: "meta set",
+			expr: metaSet(unix.NFT_META_MARK),
+			kind: "meta",
+			data: [][]byte{attr(unix.NFTA_META_KEY, be32(unix.NFT_META_MARK)), attr(unix.NFTA_META_SREG, reg)},
+		},
+		{
+			name: "ct load",
+			expr: ctLoad(unix.NFT_CT_DIRECTION),
+			kind: "ct",
+			data: [][]byte{attr(unix.NFTA_CT_KEY, be32(unix.NFT_CT_DIRECTION)), attr(unix.NFTA_CT_DREG, reg)},
+		},
+		{
+			name: "fib load",
+			expr: fibLoad(unix.NFT_FIB_RESULT_ADDRTYPE, unix.NFTA_FIB_F_DADDR),
+			kind: "fib",
+			data: [][]byte{
+				attr(unix.NFTA_FIB_RESULT, be32(unix.NFT_FIB_RESULT_ADDRTYPE)),
+				attr(unix.NFTA_FIB_FLAGS, be32(unix.NFTA_FIB_F_DADDR)),
+				attr(unix.NFTA_FIB_DREG, reg),
+			},
+		},
+		{
+			name: "payload load",
+			expr: payloadLoad(16, 4),
+			kind: "payload",
+			data: [][]byte{
+				attr(unix.NFTA_PAYLOAD_DREG, reg),
+				attr(unix.NFTA_PAYLOAD_BASE, be32(unix.NFT_PAYLOAD_NETWORK_HEADER)),
+				attr(unix.NFTA_PAYLOAD_OFFSET, be32(16)),
+				attr(unix.NFTA_PAYLOAD_LEN, be32(4)),
+			},
+		},
+		{
+			name: "bitwise",
+			expr: bitwise([]byte{0xff, 0xf0, 0, 0}),
+			kind: "bitwise",
+			data: [][]byte{
+				attr(unix.NFTA_BITWISE_SREG, reg),
+				attr(unix.NFTA_BITWISE_DREG, reg),
+				attr(unix.NFTA_BITWISE_LEN, be32(4)),
+				nested(unix.NFTA_BITWISE_MASK, value(0xff, 0xf0, 0, 0)),
+				nested(unix.NFTA_BITWISE_XOR, value(0, 0, 0, 0)),
+			},
+		},
+		{
+			name: "cmp",
+			expr: cmpEq([]byte{unix.IPPROTO_TCP}),
+			kind: "cmp",
+			data: [][]byte{
+				attr(unix.NFTA_CMP_SREG, reg),
+				attr(unix.NFTA_CMP_OP, be32(unix.NFT_CMP_EQ)),
+				nested(unix.NFTA_CMP_DATA, value(unix.IPPROTO_TCP)),
+			},
+		},
+		{
+			name: "immediate port",
+			expr: immediate(port(7893)),
+			kind: "immediate",
+			data: [][]byte{attr(unix.NFTA_IMMEDIATE_DREG, reg), nested(unix.NFTA_IMMEDIATE_DATA, value(0x1e, 0xd5))},
+		},
+		{
+			name: "verdict",
+			expr: verdict(unix.NFT_RETURN),
+			kind: "immediate",
+			data: [][]byte{
+				attr(unix.NFTA_IMMEDIATE_DREG, be32(unix.NFT_REG_VERDICT)),
+				nested(unix.NFTA_IMMEDIATE_DATA, nested(unix.NFTA_DATA_VERDICT, attr(unix.NFTA_VERDICT_CODE, be32(0xfffffffb)))),
+			},
+		},
+		{
+			name: "redirect",
+			expr: redirect(),
+			kind: "redir",
+			data: [][]byte{attr(unix.NFTA_REDIR_REG_PROTO_MIN, reg)},
+		},
+		{
+			name: "tproxy",
+			expr: tproxy(),
+			kind: "tproxy",
+			data: [][]byte{attr(nftaTProxyFamily, be32(unix.NFPROTO_UNSPEC)), attr(nftaTProxyRegPort, reg)},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.kind, tt.expr.name)
+			assert.Equal(t, bytes.Join(tt.data, nil), encodeExpr(t, tt.expr))
+		})
+	}
+}
+
+func TestMatchDst(t *testing.T) {
+	for _, tt := range []struct {
+		prefix string
+		proto  byte
+		offset uint32
+		mask   []byte
+		addr   []byte
+	}{
+		{"10.0.0.0/8", unix.NFPROTO_IPV4, 16, []byte{0xff, 0, 0, 0}, []byte{10, 0, 0, 0}},
+		{"100.64.0.0/10", unix.NFPROTO_IPV4, 16, []byte{0xff, 0xc0, 0, 0}, []byte{100, 64, 0, 0}},
+		{"::1/128", unix.NFPROTO_IPV6, 24, nil, netip.MustParseAddr("::1").AsSlice()},
+		{"fe80::/10", unix.NFPROTO_IPV6, 24, append([]byte{0xff, 0xc0}, make([]byte, 14)...), netip.MustParseAddr("fe80::").AsSlice()},
+	} {
+		t.Run(tt.prefix, func(t *testing.T) {
+			expected := []expr{
+				metaLoad(unix.NFT_META_NFPROTO), cmpEq([]byte{tt.proto}),
+				payloadLoad(tt.offset, uint32(len(tt.addr))),
+			}
+			// the host prefixes are compared without the mask
+			if tt.mask != nil {
+				expected = append(expected, bitwise(tt.mask))
+			}
+			expected = append(expected, cmpEq(tt.addr))
+
+			exprs := matchDst(netip.MustParsePrefix(tt.prefix))
+			require.Len(t, exprs, len(expected))
+			for i := range exprs {
+				assert.Equal(t, expected[i].name, exprs[i].name)
+				assert.Equal(t, encodeExpr(t, expected[i]), encodeExpr(t, exprs[i]))
+			}
+		})
+	}
+}
+
+func TestChains(t *testing.T) {
+	// the local, the reply and the reserved destinations are skipped
+	skip := 2 + len(reserved)
+
+	type chainSpec struct {
+		name     string
+		kind     string
+		hook     uint32
+		priority int32
+		rules    int
+	}
+	for _, tt := range []struct {
+		name   string
+		opts   Options
+		chains []chainSpec
+	}{
+		{
+			name:   "redir",
+			opts:   Options{RedirPort: 7892},
+			chains: []chainSpec{{"prerouting", "nat", unix.NF_INET_PRE_ROUTING, -100, skip + 1}},
+		},
+		{
+			name: "redir with routing mark",
+			opts: Options{RedirPort: 7892, RoutingMark: 6666},
+			chains: []chainSpec{
+				{"prerouting", "nat", unix.NF_INET_PRE_ROUTING, -100, skip + 1},
+				{"output", "nat", unix.NF_INET_LOCAL_OUT, -100, 1 + skip + 1},
+			},
+		},
+		{
+			name:   "tproxy",
+			opts:   Options{RedirPort: 7892, TProxyPort: 7893},
+			chains: []chainSpec{{"prerouting", "filter", unix.NF_INET_PRE_ROUTING, -150, skip + 2}},
+		},
+		{
+			name: "tproxy with routing mark",
+			opts: Options{TProxyPort: 7893, RoutingMark: 6666},
+			chains: []chainSpec{
+				{"prerouting", "filter", unix.NF_INET_PRE_ROUTING, -150, skip + 2},
+				{"output", "route", unix.NF_INET_LOCAL_OUT, -150, 1 + skip + 2},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			chains := chains(tt.opts)
+			require.Len(t, chains, len(tt.chains))
+			for i, c := range chains {
+				assert.Equal(t, tt.chains[i], chainSpec{c.name, c.kind, c.hook, c.priority, len(c.rules)})
+			}
+
+			// the connections of clash itself are skipped first
+			if tt.opts.RoutingMark != 0 {
+				mark := chains[1].rules[0]
+				require.Len(t, mark, 3)
+				assert.Equal(t, encodeExpr(t, metaLoad(unix.NFT_META_MARK)), encodeExpr(t, mark[0]))
+				assert.Equal(t, encodeExpr(t, cmpEq(nativeUint32(6666))), encodeExpr(t, mark[1]))
+				assert.Equal(t, encodeExpr(t, verdict(unix.NFT_RETURN)), encodeExpr(t, mark[2]))
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	header := func(family uint8) []byte {
+		return []byte{family, unix.NFNETLINK_V0, 0, 0}
+	}
+	msgType := func(msg uint16) netlink.HeaderType {
+		return netlink.HeaderType(unix.NFNL_SUBSYS_NFTABLES<<8 | msg)
+	}
+
+	b := newBatch(unix.NFPROTO_INET)
+	b.addTable(TableName)
+	b.addChain(TableName, chain{
+		name:     "prerouting",
+		kind:     "nat",
+		hook:     unix.NF_INET_PRE_ROUTING,
+		priority: -100,
+		rules: [][]expr{
+			append(matchLocal(), verdict(unix.NFT_RETURN)),
+			concat(matchL4Proto(unix.IPPROTO_TCP), []expr{immediate(port(7892)), redirect()}),
+		},
+	})
+	b.deleteTable(TableName)
+	require.Len(t, b.messages, 5)
+
+	for i, tt := range []struct {
+		name  string
+		msg   uint16
+		flags netlink.HeaderFlags
+		attrs [][]byte
+	}{
+		{
+			name:  "table",
+			msg:   unix.NFT_MSG_NEWTABLE,
+			flags: netlink.Create,
+			attrs: [][]byte{attr(unix.NFTA_TABLE_NAME, cstring("clash")), attr(unix.NFTA_TABLE_FLAGS, be32(0))},
+		},
+		{
+			name:  "chain",
+			msg:   unix.NFT_MSG_NEWCHAIN,
+			flags: netlink.Create,
+			attrs: [][]byte{
+				attr(unix.NFTA_CHAIN_TABLE, cstring("clash")),
+				attr(unix.NFTA_CHAIN_NAME, cstring("prerouting")),
+				nested(unix.NFTA_CHAIN_HOOK,
+					attr(unix.NFTA_HOOK_HOOKNUM, be32(unix.NF_INET_PRE_ROUTING)),
+					attr(unix.NFTA_HOOK_PRIORITY, be32(0xffffff9c)), // -100
+				),
+				attr(unix.NFTA_CHAIN_TYPE, cstring("nat")),
+				attr(unix.NFTA_CHAIN_POLICY, be32(nfAccept)),
+			},
+		},
+		{
+			name:  "local rule",
+			msg:   unix.NFT_MSG_NEWRULE,
+			flags: netlink.Create | netlink.Append,
+			attrs: [][]byte{
+				attr(unix.NFTA_RULE_TABLE, cstring("clash")),
+				attr(unix.NFTA_RULE_CHAIN, cstring("prerouting")),
+				nested(unix.NFTA_RULE_EXPRESSIONS,
+					element("fib",
+						attr(unix.NFTA_FIB_RESULT, be32(unix.NFT_FIB_RESULT_ADDRTYPE)),
+						attr(unix.NFTA_FIB_FLAGS, be32(unix.NFTA_FIB_F_DADDR)),
+						attr(unix.NFTA_FIB_DREG, be32(unix.NFT_REG_1)),
+					),
+					element("cmp",
+						attr(unix.NFTA_CMP_SREG, be32(unix.NFT_REG_1)),
+						attr(unix.NFTA_CMP_OP, be32(unix.NFT_CMP_EQ)),
+						nested(unix.NFTA_CMP_DATA, attr(unix.NFTA_DATA_VALUE, binary.NativeEndian.AppendUint32(nil, unix.RTN_LOCAL))),
+					),
+					element("immediate",
+						attr(unix.NFTA_IMMEDIATE_DREG, be32(unix.NFT_REG_VERDICT)),
+						nested(unix.NFTA_IMMEDIATE_DATA, nested(unix.NFTA_DATA_VERDICT, attr(unix.NFTA_VERDICT_CODE, be32(0xfffffffb)))),
+					),
+				),
+			},
+		},
+		{
+			name:  "redirect rule",
+			msg:   unix.NFT_MSG_NEWRULE,
+			flags: netlink.Create | netlink.Append,
+			attrs: [][]byte{
+				attr(unix.NFTA_RULE_TABLE, cstring("clash")),
+				attr(unix.NFTA_RULE_CHAIN, cstring("prerouting")),
+				nested(unix.NFTA_RULE_EXPRESSIONS,
+					element("meta",
+						attr(unix.NFTA_META_KEY, be32(unix.NFT_META_L4PROTO)),
+						attr(unix.NFTA_META_DREG, be32(unix.NFT_REG_1)),
+					),
+					element("cmp",
+						attr(unix.NFTA_CMP_SREG, be32(unix.NFT_REG_1)),
+						attr(unix.NFTA_CMP_OP, be32(unix.NFT_CMP_EQ)),
+						nested(unix.NFTA_CMP_DATA, value(unix.IPPROTO_TCP)),
+					),
+					element("immediate",
+						attr(unix.NFTA_IMMEDIATE_DREG, be32(unix.NFT_REG_1)),
+						nested(unix.NFTA_IMMEDIATE_DATA, value(0x1e, 0xd4)),
+					),
+					element("redir", attr(unix.NFTA_REDIR_REG_PROTO_MIN, be32(unix.NFT_REG_1))),
+				),
+			},
+		},
+		{
+			name:  "delete table",
+			msg:   unix.NFT_MSG_DELTABLE,
+			attrs: [][]byte{attr(unix.NFTA_TABLE_NAME, cstring("clash"))},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := b.messages[i]
+			assert.Equal(t, msgType(tt.msg), m.Header.Type)
+			assert.Equal(t, netlink.Request|netlink.Acknowledge|tt.flags, m.Header.Flags)
+			assert.Equal(t, append(header(unix.NFPROTO_INET), bytes.Join(tt.attrs, nil)...), m.Data)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/Dreamacro/clash/component/pac"
+	"github.com/Dreamacro/clash/tunnel"
+)
+
+// isPACRequest reports whether the request fetches the PAC script from the inbound itself
+func isPACRequest(request *http.Request) bool {
+	if request.Method != http.MethodGet || request.URL.Host != "" {
+		return false
+	}
+	return request.URL.Path == "/proxy.pac" || request.URL.Path == "/wpad.dat"
+}
+
+// responsePAC responds the PAC script sending the proxied connections to the inbound,
+// the inbound address is the local address the client connected to
+func responsePAC(request *http.Request, local net.Addr) *http.Response {
+	addr, err := netip.ParseAddrPort(local.String())
+	if err != nil {
+		return responseWith(request, http.StatusInternalServerError)
+	}
+
+	script := tunnel.PAC(pac.ProxyAddr(addr.Addr(), int(addr.Port())))
+	resp := responseWith(request, http.StatusOK)
+	resp.Header.Set("Content-Type", pac.ContentType)
+	resp.Body = io.NopCloser(bytes.NewReader(script))
+	resp.ContentLength = int64(len(script))
+	resp.Close = true
+	return resp
+}
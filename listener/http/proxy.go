@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -9,13 +10,21 @@ import (
 	"github.com/Dreamacro/clash/adapter/inbound"
 	"github.com/Dreamacro/clash/common/cache"
 	N "github.com/Dreamacro/clash/common/net"
+	"github.com/Dreamacro/clash/component/auth"
 	C "github.com/Dreamacro/clash/constant"
 	authStore "github.com/Dreamacro/clash/listener/auth"
 	"github.com/Dreamacro/clash/log"
 )
 
-func HandleConn(c net.Conn, in chan<- C.ConnContext, cache *cache.LruCache) {
-	client := newClient(c.RemoteAddr(), c.LocalAddr(), in)
+func HandleConn(c net.Conn, in chan<- C.ConnContext, cache *cache.LruCache, additions ...inbound.Addition) {
+	// the user authenticated by the first request of the connection
+	var session *auth.Session
+	send := func(ctx C.ConnContext) {
+		authStore.ApplySession(ctx.Metadata(), session)
+		in <- ctx
+	}
+
+	client := newClient(c.RemoteAddr(), c.LocalAddr(), send, additions)
 	defer client.CloseIdleConnections()
 
 	conn := N.NewBufferedConn(c)
@@ -31,12 +40,18 @@ func HandleConn(c net.Conn, in chan<- C.ConnContext, cache *cache.LruCache) {
 
 		request.RemoteAddr = conn.RemoteAddr().String()
 
+		// the PAC script is fetched by the browsers without the proxy authentication
+		if isPACRequest(request) {
+			responsePAC(request, conn.LocalAddr()).Write(conn)
+			break
+		}
+
 		keepAlive = strings.TrimSpace(strings.ToLower(request.Header.Get("Proxy-Connection"))) == "keep-alive"
 
 		var resp *http.Response
 
 		if !trusted {
-			resp = authenticate(request, cache)
+			resp, session = authenticate(request, cache)
 
 			trusted = resp == nil
 		}
@@ -48,7 +63,7 @@ func HandleConn(c net.Conn, in chan<- C.ConnContext, cache *cache.LruCache) {
 					break // close connection
 				}
 
-				in <- inbound.NewHTTPS(request, conn)
+				send(inbound.NewHTTPS(request, conn, additions...))
 
 				return // hijack connection
 			}
@@ -61,7 +76,7 @@ func HandleConn(c net.Conn, in chan<- C.ConnContext, cache *cache.LruCache) {
 			request.RequestURI = ""
 
 			if isUpgradeRequest(request) {
-				handleUpgrade(conn, request, in)
+				handleUpgrade(conn, request, send, additions)
 
 				return // hijack connection
 			}
@@ -98,30 +113,43 @@ func HandleConn(c net.Conn, in chan<- C.ConnContext, cache *cache.LruCache) {
 	conn.Close()
 }
 
-func authenticate(request *http.Request, cache *cache.LruCache) *http.Response {
+// authenticate returns the response of the failed authentication, or the authenticated user
+func authenticate(request *http.Request, cache *cache.LruCache) (*http.Response, *auth.Session) {
 	authenticator := authStore.Authenticator()
 	if authenticator != nil {
 		credential := parseBasicProxyAuthorization(request)
 		if credential == "" {
 			resp := responseWith(request, http.StatusProxyAuthRequired)
 			resp.Header.Set("Proxy-Authenticate", "Basic")
-			return resp
+			return resp, nil
 		}
 
-		authed, exist := cache.Get(credential)
+		// the denied credentials are cached as nil sessions, the ones failed to be
+		// verified are not cached to be verified again by the next request
+		cached, exist := cache.Get(credential)
 		if !exist {
-			user, pass, err := decodeBasicProxyAuthorization(credential)
-			authed = err == nil && authenticator.Verify(user, pass)
-			cache.Set(credential, authed)
+			var (
+				session *auth.Session
+				err     error
+			)
+			if user, pass, decodeErr := decodeBasicProxyAuthorization(credential); decodeErr == nil {
+				session, err = auth.Authenticate(authenticator, user, pass)
+			}
+			if err == nil || errors.Is(err, auth.ErrDenied) {
+				cache.Set(credential, session)
+			}
+			cached = session
 		}
-		if !authed.(bool) {
+		session := cached.(*auth.Session)
+		if session == nil {
 			log.Infoln("Auth failed from %s", request.RemoteAddr)
 
-			return responseWith(request, http.StatusForbidden)
+			return responseWith(request, http.StatusForbidden), nil
 		}
+		return nil, session
 	}
 
-	return nil
+	return nil, nil
 }
 
 func responseWith(request *http.Request, statusCode int) *http.Response {
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/common/cache"
+	C "github.com/Dreamacro/clash/constant"
+	authStore "github.com/Dreamacro/clash/listener/auth"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyAuthenticator fails to verify the users until it's called for the failures times
+type flakyAuthenticator struct {
+	calls    int
+	failures int
+}
+
+func (au *flakyAuthenticator) Verify(user string, pass string) bool {
+	_, err := au.VerifyProxy(user, pass)
+	return err == nil
+}
+
+func (au *flakyAuthenticator) Users() []string { return []string{} }
+
+func (au *flakyAuthenticator) VerifyProxy(user string, pass string) (string, error) {
+	au.calls++
+	if au.calls <= au.failures {
+		return "", errors.New("callout unavailable")
+	}
+	return "office", nil
+}
+
+func TestHandleConn_RetryFailedAuthentication(t *testing.T) {
+	au := &flakyAuthenticator{failures: 1}
+	authStore.SetAuthenticator(au)
+	defer authStore.SetAuthenticator(nil)
+
+	in := make(chan C.ConnContext, 1)
+	client, server := net.Pipe()
+	defer client.Close()
+	go HandleConn(server, in, cache.New(cache.WithAge(30)))
+
+	credential := base64.StdEncoding.EncodeToString([]byte("alice:password"))
+	reader := bufio.NewReader(client)
+	connect := func() *http.Response {
+		fmt.Fprintf(client, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\nProxy-Authorization: Basic %s\r\nProxy-Connection: keep-alive\r\n\r\n", credential)
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// the failed verification is not cached as a denial
+	assert.Equal(t, http.StatusForbidden, connect().StatusCode)
+	assert.Equal(t, http.StatusOK, connect().StatusCode)
+	assert.Equal(t, 2, au.calls)
+
+	select {
+	case ctx := <-in:
+		assert.Equal(t, "alice", ctx.Metadata().InboundUser)
+		assert.Equal(t, "office", ctx.Metadata().SpecialProxy)
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not received")
+	}
+}
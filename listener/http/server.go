@@ -3,8 +3,10 @@ package http
 import (
 	"net"
 
+	"github.com/Dreamacro/clash/adapter/inbound"
 	"github.com/Dreamacro/clash/common/cache"
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/transport/proxyprotocol"
 )
 
 type Listener struct {
@@ -29,11 +31,11 @@ func (l *Listener) Close() error {
 	return l.listener.Close()
 }
 
-func New(addr string, in chan<- C.ConnContext) (C.Listener, error) {
-	return NewWithAuthenticate(addr, in, true)
+func New(addr string, in chan<- C.ConnContext, filter *inbound.IPFilter, pp *proxyprotocol.Server, additions ...inbound.Addition) (C.Listener, error) {
+	return NewWithAuthenticate(addr, in, true, filter, pp, additions...)
 }
 
-func NewWithAuthenticate(addr string, in chan<- C.ConnContext, authenticate bool) (C.Listener, error) {
+func NewWithAuthenticate(addr string, in chan<- C.ConnContext, authenticate bool, filter *inbound.IPFilter, pp *proxyprotocol.Server, additions ...inbound.Addition) (C.Listener, error) {
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -57,9 +59,17 @@ func NewWithAuthenticate(addr string, in chan<- C.ConnContext, authenticate bool
 				}
 				continue
 			}
-			go HandleConn(conn, in, c)
+			go handleConn(conn, in, c, filter, pp, additions)
 		}
 	}()
 
 	return hl, nil
 }
+
+func handleConn(conn net.Conn, in chan<- C.ConnContext, cache *cache.LruCache, filter *inbound.IPFilter, pp *proxyprotocol.Server, additions []inbound.Addition) {
+	c, ok := inbound.AcceptProxied(conn, filter, pp)
+	if !ok {
+		return
+	}
+	HandleConn(c, in, cache, additions...)
+}
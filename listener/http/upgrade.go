@@ -23,7 +23,7 @@ func isUpgradeRequest(req *http.Request) bool {
 	return false
 }
 
-func handleUpgrade(conn net.Conn, request *http.Request, in chan<- C.ConnContext) {
+func handleUpgrade(conn net.Conn, request *http.Request, send func(C.ConnContext), additions []inbound.Addition) {
 	defer conn.Close()
 
 	removeProxyHeaders(request.Header)
@@ -41,7 +41,7 @@ func handleUpgrade(conn net.Conn, request *http.Request, in chan<- C.ConnContext
 
 	left, right := net.Pipe()
 
-	in <- inbound.NewHTTP(dstAddr, conn.RemoteAddr(), conn.LocalAddr(), right)
+	send(inbound.NewHTTP(dstAddr, conn.RemoteAddr(), conn.LocalAddr(), right, additions...))
 
 	bufferedLeft := N.NewBufferedConn(left)
 	defer bufferedLeft.Close()
@@ -8,25 +8,37 @@ import (
 	"sync"
 
 	"github.com/Dreamacro/clash/adapter/inbound"
+	"github.com/Dreamacro/clash/component/dialer"
 	"github.com/Dreamacro/clash/config"
 	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/listener/autoredir"
 	"github.com/Dreamacro/clash/listener/http"
 	"github.com/Dreamacro/clash/listener/mixed"
 	"github.com/Dreamacro/clash/listener/redir"
+	"github.com/Dreamacro/clash/listener/shadowsocks"
 	"github.com/Dreamacro/clash/listener/socks"
 	"github.com/Dreamacro/clash/listener/tproxy"
+	"github.com/Dreamacro/clash/listener/trojan"
 	"github.com/Dreamacro/clash/listener/tunnel"
+	"github.com/Dreamacro/clash/listener/vmess"
 	"github.com/Dreamacro/clash/log"
+	"github.com/Dreamacro/clash/transport/proxyprotocol"
 
 	"github.com/samber/lo"
 )
 
 var (
-	allowLan    = false
-	bindAddress = "*"
+	allowLan     = false
+	bindAddress  = "*"
+	autoRedirect = false
 
-	tcpListeners = map[C.Inbound]C.Listener{}
-	udpListeners = map[C.Inbound]C.Listener{}
+	// the options of the installed auto-redirect rules, nil before the first recreation
+	autoRedirectOptions *autoredir.Options
+
+	// the listeners and the inbounds are keyed by C.Inbound.Key
+	tcpListeners     = map[string]C.Listener{}
+	udpListeners     = map[string]C.Listener{}
+	listenerInbounds = map[string]C.Inbound{}
 
 	tunnelTCPListeners = map[string]*tunnel.Listener{}
 	tunnelUDPListeners = map[string]*tunnel.PacketConn{}
@@ -45,25 +57,51 @@ type Ports struct {
 }
 
 var tcpListenerCreators = map[C.InboundType]tcpListenerCreator{
-	C.InboundTypeHTTP:   http.New,
-	C.InboundTypeSocks:  socks.New,
-	C.InboundTypeRedir:  redir.New,
-	C.InboundTypeTproxy: tproxy.New,
-	C.InboundTypeMixed:  mixed.New,
+	C.InboundTypeHTTP:        withProxyProtocol(http.New),
+	C.InboundTypeSocks:       withProxyProtocol(socks.New),
+	C.InboundTypeRedir:       withAddr(redir.New),
+	C.InboundTypeTproxy:      withAddr(tproxy.New),
+	C.InboundTypeMixed:       withProxyProtocol(mixed.New),
+	C.InboundTypeShadowsocks: shadowsocks.New,
 }
 
 var udpListenerCreators = map[C.InboundType]udpListenerCreator{
-	C.InboundTypeSocks:  socks.NewUDP,
-	C.InboundTypeRedir:  tproxy.NewUDP,
-	C.InboundTypeTproxy: tproxy.NewUDP,
-	C.InboundTypeMixed:  socks.NewUDP,
+	C.InboundTypeSocks:       withAddr(socks.NewUDP),
+	C.InboundTypeRedir:       withAddr(tproxy.NewUDP),
+	C.InboundTypeTproxy:      withAddr(tproxy.NewUDP),
+	C.InboundTypeMixed:       withAddr(socks.NewUDP),
+	C.InboundTypeShadowsocks: shadowsocks.NewUDP,
+}
+
+// the stream inbounds relay both TCP and UDP over the accepted streams
+var streamListenerCreators = map[C.InboundType]streamListenerCreator{
+	C.InboundTypeTrojan: trojan.New,
+	C.InboundTypeVmess:  vmess.New,
 }
 
 type (
-	tcpListenerCreator func(addr string, tcpIn chan<- C.ConnContext) (C.Listener, error)
-	udpListenerCreator func(addr string, udpIn chan<- *inbound.PacketAdapter) (C.Listener, error)
+	tcpListenerCreator    func(inbound C.Inbound, tcpIn chan<- C.ConnContext) (C.Listener, error)
+	udpListenerCreator    func(inbound C.Inbound, udpIn chan<- *inbound.PacketAdapter) (C.Listener, error)
+	streamListenerCreator func(inbound C.Inbound, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter) (C.Listener, error)
 )
 
+// withAddr adapts the creators of the inbounds without options
+func withAddr[T any](create func(addr string, in chan<- T, filter *inbound.IPFilter, additions ...inbound.Addition) (C.Listener, error)) func(C.Inbound, chan<- T) (C.Listener, error) {
+	return func(config C.Inbound, in chan<- T) (C.Listener, error) {
+		filter := inbound.NewIPFilter(config.LanAllowedIPs, config.LanDisallowedIPs)
+		return create(config.BindAddress, in, filter, inbound.RoutingAdditions(config)...)
+	}
+}
+
+// withProxyProtocol adapts the creators of the inbounds accepting the PROXY protocol
+func withProxyProtocol(create func(addr string, in chan<- C.ConnContext, filter *inbound.IPFilter, pp *proxyprotocol.Server, additions ...inbound.Addition) (C.Listener, error)) tcpListenerCreator {
+	return func(config C.Inbound, in chan<- C.ConnContext) (C.Listener, error) {
+		filter := inbound.NewIPFilter(config.LanAllowedIPs, config.LanDisallowedIPs)
+		pp := proxyprotocol.NewServer(config.ProxyProtocol, config.ProxyProtocolTrusted)
+		return create(config.BindAddress, in, filter, pp, inbound.RoutingAdditions(config)...)
+	}
+}
+
 func AllowLan() bool {
 	return allowLan
 }
@@ -80,11 +118,47 @@ func SetBindAddress(host string) {
 	bindAddress = host
 }
 
+func AutoRedirect() bool {
+	return autoRedirect
+}
+
+// SetAutoRedirect enables the auto-redirect rules, they are installed with the ports config listeners
+func SetAutoRedirect(enable bool) {
+	autoRedirect = enable
+}
+
+// CloseAutoRedirect removes the installed auto-redirect rules
+func CloseAutoRedirect() {
+	recreateMux.Lock()
+	defer recreateMux.Unlock()
+
+	if autoRedirectOptions == nil || !autoRedirectOptions.Enabled() {
+		return
+	}
+	if err := autoredir.Cleanup(); err != nil {
+		log.Errorln("auto-redirect cleanup error: %s", err.Error())
+	}
+	autoRedirectOptions = &autoredir.Options{}
+}
+
 func createListener(inbound C.Inbound, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter) {
 	addr := inbound.BindAddress
 	if portIsZero(addr) {
 		return
 	}
+	key := inbound.Key()
+	if streamCreator := streamListenerCreators[inbound.Type]; streamCreator != nil {
+		streamListener, err := streamCreator(inbound, tcpIn, udpIn)
+		if err != nil {
+			log.Errorln("create addr %s stream listener error. err:%v", addr, err)
+			return
+		}
+		tcpListeners[key] = streamListener
+		listenerInbounds[key] = inbound
+		log.Infoln("inbound %s create success.", inbound.ToAlias())
+		return
+	}
+
 	tcpCreator := tcpListenerCreators[inbound.Type]
 	udpCreator := udpListenerCreators[inbound.Type]
 	if tcpCreator == nil && udpCreator == nil {
@@ -92,57 +166,61 @@ func createListener(inbound C.Inbound, tcpIn chan<- C.ConnContext, udpIn chan<-
 		return
 	}
 	if tcpCreator != nil {
-		tcpListener, err := tcpCreator(addr, tcpIn)
+		tcpListener, err := tcpCreator(inbound, tcpIn)
 		if err != nil {
 			log.Errorln("create addr %s tcp listener error. err:%v", addr, err)
 			return
 		}
-		tcpListeners[inbound] = tcpListener
+		tcpListeners[key] = tcpListener
+		listenerInbounds[key] = inbound
 	}
 	if udpCreator != nil {
-		udpListener, err := udpCreator(addr, udpIn)
+		udpListener, err := udpCreator(inbound, udpIn)
 		if err != nil {
 			log.Errorln("create addr %s udp listener error. err:%v", addr, err)
 			return
 		}
-		udpListeners[inbound] = udpListener
+		udpListeners[key] = udpListener
+		listenerInbounds[key] = inbound
 	}
 	log.Infoln("inbound %s create success.", inbound.ToAlias())
 }
 
 func closeListener(inbound C.Inbound) {
-	listener := tcpListeners[inbound]
+	key := inbound.Key()
+	listener := tcpListeners[key]
 	if listener != nil {
 		if err := listener.Close(); err != nil {
 			log.Errorln("close tcp address `%s` error. err:%s", inbound.ToAlias(), err.Error())
 		}
-		delete(tcpListeners, inbound)
+		delete(tcpListeners, key)
 	}
-	listener = udpListeners[inbound]
+	listener = udpListeners[key]
 	if listener != nil {
 		if err := listener.Close(); err != nil {
 			log.Errorln("close udp address `%s` error. err:%s", inbound.ToAlias(), err.Error())
 		}
-		delete(udpListeners, inbound)
+		delete(udpListeners, key)
 	}
+	delete(listenerInbounds, key)
 }
 
 func getNeedCloseAndCreateInbound(originInbounds []C.Inbound, newInbounds []C.Inbound) ([]C.Inbound, []C.Inbound) {
-	needCloseMap := map[C.Inbound]bool{}
+	needCloseMap := map[string]C.Inbound{}
 	needClose := []C.Inbound{}
 	needCreate := []C.Inbound{}
 
 	for _, inbound := range originInbounds {
-		needCloseMap[inbound] = true
+		needCloseMap[inbound.Key()] = inbound
 	}
 	for _, inbound := range newInbounds {
-		if needCloseMap[inbound] {
-			delete(needCloseMap, inbound)
+		if _, ok := needCloseMap[inbound.Key()]; ok {
+			delete(needCloseMap, inbound.Key())
 		} else {
 			needCreate = append(needCreate, inbound)
 		}
 	}
-	for inbound := range needCloseMap {
+	for _, inbound := range needCloseMap {
 		needClose = append(needClose, inbound)
 	}
 	return needClose, needCreate
@@ -170,6 +248,61 @@ func ReCreatePortsListeners(ports Ports, tcpIn chan<- C.ConnContext, udpIn chan<
 	newInbounds = addPortInbound(newInbounds, C.InboundTypeTproxy, ports.TProxyPort)
 	newInbounds = addPortInbound(newInbounds, C.InboundTypeMixed, ports.MixedPort)
 	reCreateListeners(newInbounds, tcpIn, udpIn)
+	reCreateAutoRedirect()
+}
+
+// reCreateAutoRedirect installs the auto-redirect rules of the listening redir and tproxy ports
+func reCreateAutoRedirect() {
+	recreateMux.Lock()
+	defer recreateMux.Unlock()
+
+	opts := autoredir.Options{}
+	if autoRedirect {
+		ports := GetPorts()
+		opts = autoredir.Options{
+			RedirPort:   ports.RedirPort,
+			TProxyPort:  ports.TProxyPort,
+			RoutingMark: int(dialer.DefaultRoutingMark.Load()),
+		}
+	}
+	if autoRedirectOptions != nil && *autoRedirectOptions == opts {
+		return
+	}
+	startup := autoRedirectOptions == nil
+	installed := !startup && autoRedirectOptions.Enabled()
+	autoRedirectOptions = &opts
+
+	if !opts.Enabled() {
+		switch {
+		case installed:
+			if err := autoredir.Cleanup(); err != nil {
+				log.Errorln("auto-redirect cleanup error: %s", err.Error())
+			}
+		case startup:
+			// the table is ours, if it exists on startup it's left by a crashed run and still
+			// redirects the traffic to the dead ports. The error is expected without the privileges
+			if removed, err := autoredir.CleanupStale(); err != nil {
+				log.Debugln("auto-redirect stale rules cleanup error: %s", err.Error())
+			} else if removed {
+				log.Warnln("auto-redirect: removed the rules left by a previous run in nftables table inet %s", autoredir.TableName)
+			}
+		}
+		return
+	}
+
+	if err := autoredir.Setup(opts); err != nil {
+		log.Errorln("auto-redirect setup error: %s", err.Error())
+		// nothing is installed on failure, it's retried on the next recreation
+		autoRedirectOptions = &autoredir.Options{}
+		return
+	}
+	if opts.RoutingMark == 0 {
+		log.Warnln("auto-redirect: routing-mark is not set, the traffic of this host is not redirected")
+	}
+	if !allowLan {
+		log.Warnln("auto-redirect: allow-lan is disabled, only the IPv4 traffic of this host reaches the listeners")
+	}
+	log.Infoln("auto-redirect rules installed in nftables table inet %s", autoredir.TableName)
 }
 
 func addPortInbound(inbounds []C.Inbound, inboundType C.InboundType, port int) []C.Inbound {
@@ -292,16 +425,7 @@ func GetInbounds() []C.Inbound {
 
 // GetInbounds return the inbounds of proxy servers
 func getInbounds() []C.Inbound {
-	var inbounds []C.Inbound
-	for inbound := range tcpListeners {
-		inbounds = append(inbounds, inbound)
-	}
-	for inbound := range udpListeners {
-		if _, ok := tcpListeners[inbound]; !ok {
-			inbounds = append(inbounds, inbound)
-		}
-	}
-	return inbounds
+	return lo.Values(listenerInbounds)
 }
 
 // GetPorts return the ports of proxy servers
@@ -3,11 +3,13 @@ package mixed
 import (
 	"net"
 
+	"github.com/Dreamacro/clash/adapter/inbound"
 	"github.com/Dreamacro/clash/common/cache"
 	N "github.com/Dreamacro/clash/common/net"
 	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/listener/http"
 	"github.com/Dreamacro/clash/listener/socks"
+	"github.com/Dreamacro/clash/transport/proxyprotocol"
 	"github.com/Dreamacro/clash/transport/socks4"
 	"github.com/Dreamacro/clash/transport/socks5"
 )
@@ -35,7 +37,7 @@ func (l *Listener) Close() error {
 	return l.listener.Close()
 }
 
-func New(addr string, in chan<- C.ConnContext) (C.Listener, error) {
+func New(addr string, in chan<- C.ConnContext, filter *inbound.IPFilter, pp *proxyprotocol.Server, additions ...inbound.Addition) (C.Listener, error) {
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -55,17 +57,22 @@ func New(addr string, in chan<- C.ConnContext) (C.Listener, error) {
 				}
 				continue
 			}
-			go handleConn(c, in, ml.cache)
+			go handleConn(c, in, ml.cache, filter, pp, additions)
 		}
 	}()
 
 	return ml, nil
 }
 
-func handleConn(conn net.Conn, in chan<- C.ConnContext, cache *cache.LruCache) {
+func handleConn(conn net.Conn, in chan<- C.ConnContext, cache *cache.LruCache, filter *inbound.IPFilter, pp *proxyprotocol.Server, additions []inbound.Addition) {
 	conn.(*net.TCPConn).SetKeepAlive(true)
 
-	bufConn := N.NewBufferedConn(conn)
+	c, ok := inbound.AcceptProxied(conn, filter, pp)
+	if !ok {
+		return
+	}
+
+	bufConn := N.NewBufferedConn(c)
 	head, err := bufConn.Peek(1)
 	if err != nil {
 		return
@@ -73,10 +80,10 @@ func handleConn(conn net.Conn, in chan<- C.ConnContext, cache *cache.LruCache) {
 
 	switch head[0] {
 	case socks4.Version:
-		socks.HandleSocks4(bufConn, in)
+		socks.HandleSocks4(bufConn, in, additions...)
 	case socks5.Version:
-		socks.HandleSocks5(bufConn, in)
+		socks.HandleSocks5(bufConn, in, additions...)
 	default:
-		http.HandleConn(bufConn, in, cache)
+		http.HandleConn(bufConn, in, cache, additions...)
 	}
 }
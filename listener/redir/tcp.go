@@ -29,7 +29,7 @@ func (l *Listener) Close() error {
 	return l.listener.Close()
 }
 
-func New(addr string, in chan<- C.ConnContext) (C.Listener, error) {
+func New(addr string, in chan<- C.ConnContext, filter *inbound.IPFilter, additions ...inbound.Addition) (C.Listener, error) {
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -48,19 +48,23 @@ func New(addr string, in chan<- C.ConnContext) (C.Listener, error) {
 				}
 				continue
 			}
-			go handleRedir(c, in)
+			if !inbound.Allowed(c.RemoteAddr(), filter) {
+				c.Close()
+				continue
+			}
+			go handleRedir(c, in, additions)
 		}
 	}()
 
 	return rl, nil
 }
 
-func handleRedir(conn net.Conn, in chan<- C.ConnContext) {
+func handleRedir(conn net.Conn, in chan<- C.ConnContext, additions []inbound.Addition) {
 	target, err := parserPacket(conn)
 	if err != nil {
 		conn.Close()
 		return
 	}
 	conn.(*net.TCPConn).SetKeepAlive(true)
-	in <- inbound.NewSocket(target, conn, C.REDIR)
+	in <- inbound.NewSocket(target, conn, C.REDIR, additions...)
 }
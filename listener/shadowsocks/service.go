@@ -0,0 +1,179 @@
+package shadowsocks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/transport/shadowsocks/core"
+	"github.com/Dreamacro/clash/transport/shadowsocks/shadowaead"
+	"github.com/Dreamacro/clash/transport/shadowsocks/shadowaead2022"
+	"github.com/Dreamacro/clash/transport/socks5"
+
+	"github.com/samber/lo"
+)
+
+var errUserNotFound = errors.New("user not found")
+
+// service authenticates the streams and the packets of the clients
+type service interface {
+	// NewConn returns the decrypted stream with the target address and the name of the user
+	NewConn(conn net.Conn) (net.Conn, socks5.Addr, string, error)
+	// UnpackPacket decrypts a packet in place and returns its session with the target address and the payload
+	UnpackPacket(pkt []byte) (packetSession, socks5.Addr, []byte, error)
+}
+
+type packetSession interface {
+	User() string
+	// Pack encrypts a packet to the client with the source address
+	Pack(source socks5.Addr, payload []byte) ([]byte, error)
+}
+
+func newService(config C.Inbound) (service, error) {
+	if shadowaead2022.IsMethod(config.Cipher) {
+		users := lo.Map(config.Users, func(u C.InboundUser, _ int) shadowaead2022.User {
+			return shadowaead2022.User{Name: u.Name, Key: u.Password}
+		})
+		s, err := shadowaead2022.NewService(config.Cipher, config.Password, users)
+		if err != nil {
+			return nil, err
+		}
+		return &service2022{Service: s}, nil
+	}
+
+	return newAEADService(config)
+}
+
+type service2022 struct {
+	*shadowaead2022.Service
+}
+
+func (s *service2022) UnpackPacket(pkt []byte) (packetSession, socks5.Addr, []byte, error) {
+	session, target, payload, err := s.Service.UnpackPacket(pkt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return session, target, payload, nil
+}
+
+type aeadUser struct {
+	name   string
+	cipher *core.AeadCipher
+}
+
+// aeadService is the server of the AEAD ciphers, the users are identified by trial decryption
+type aeadService struct {
+	users []*aeadUser
+}
+
+func newAEADService(config C.Inbound) (*aeadService, error) {
+	users := config.Users
+	if config.Password != "" {
+		users = append([]C.InboundUser{{Password: config.Password}}, users...)
+	}
+	if len(users) == 0 {
+		return nil, errors.New("password or users is required")
+	}
+
+	s := &aeadService{}
+	for _, u := range users {
+		ciph, err := core.PickCipher(config.Cipher, nil, u.Password)
+		if err != nil {
+			return nil, err
+		}
+		aead, ok := ciph.(*core.AeadCipher)
+		if !ok {
+			return nil, fmt.Errorf("cipher %s is not supported by inbounds", config.Cipher)
+		}
+		s.users = append(s.users, &aeadUser{name: u.Name, cipher: aead})
+	}
+	return s, nil
+}
+
+// NewConn implements service.NewConn
+func (s *aeadService) NewConn(conn net.Conn) (net.Conn, socks5.Addr, string, error) {
+	// the salt and the encrypted length of the first chunk
+	saltSize := s.users[0].cipher.SaltSize()
+	buf := make([]byte, saltSize+2+16)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, nil, "", err
+	}
+
+	u := s.findUser(func(u *aeadUser) bool {
+		aead, err := u.cipher.Decrypter(buf[:saltSize])
+		if err != nil {
+			return false
+		}
+		_, err = aead.Open(nil, make([]byte, aead.NonceSize()), buf[saltSize:], nil)
+		return err == nil
+	})
+	if u == nil {
+		return nil, nil, "", errUserNotFound
+	}
+
+	c := u.cipher.StreamConn(&replayConn{Conn: conn, Reader: io.MultiReader(bytes.NewReader(buf), conn)})
+	target, err := socks5.ReadAddr(c, make([]byte, socks5.MaxAddrLen))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return c, target, u.name, nil
+}
+
+// UnpackPacket implements service.UnpackPacket
+func (s *aeadService) UnpackPacket(pkt []byte) (packetSession, socks5.Addr, []byte, error) {
+	// the decryption of a failed trial overwrites the buffer
+	buf := make([]byte, len(pkt))
+	var plaintext []byte
+	u := s.findUser(func(u *aeadUser) bool {
+		var err error
+		plaintext, err = shadowaead.Unpack(buf, pkt, u.cipher)
+		return err == nil
+	})
+	if u == nil {
+		return nil, nil, nil, errUserNotFound
+	}
+
+	plaintext = pkt[:copy(pkt, plaintext)]
+	target := socks5.SplitAddr(plaintext)
+	if target == nil {
+		return nil, nil, nil, errors.New("parse addr error")
+	}
+	return u, target, plaintext[len(target):], nil
+}
+
+func (s *aeadService) findUser(match func(u *aeadUser) bool) *aeadUser {
+	for _, u := range s.users {
+		if match(u) {
+			return u
+		}
+	}
+	return nil
+}
+
+// User implements packetSession.User
+func (u *aeadUser) User() string {
+	return u.name
+}
+
+// Pack implements packetSession.Pack
+func (u *aeadUser) Pack(source socks5.Addr, payload []byte) ([]byte, error) {
+	plaintext := make([]byte, 0, len(source)+len(payload))
+	plaintext = append(plaintext, source...)
+	plaintext = append(plaintext, payload...)
+
+	buf := make([]byte, u.cipher.SaltSize()+len(plaintext)+16)
+	return shadowaead.Pack(buf, plaintext, u.cipher)
+}
+
+// replayConn reads the bytes consumed by the identification of the user again
+type replayConn struct {
+	net.Conn
+	io.Reader
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	return c.Reader.Read(b)
+}
@@ -0,0 +1,92 @@
+package shadowsocks
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter/outbound"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRoundTrip(t *testing.T, config C.Inbound, option outbound.ShadowSocksOption, user string) {
+	in := make(chan C.ConnContext, 1)
+	l, err := New(config, in)
+	require.NoError(t, err)
+	defer l.Close()
+
+	host, port, _ := net.SplitHostPort(l.Address())
+	option.Name = "ss"
+	option.Server = host
+	option.Port, _ = strconv.Atoi(port)
+	ss, err := outbound.NewShadowSocks(option)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := ss.DialContext(ctx, &C.Metadata{NetWork: C.TCP, Host: "example.com", DstPort: 443})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	var cc C.ConnContext
+	select {
+	case cc = <-in:
+	case <-ctx.Done():
+		t.Fatal("no connection accepted")
+	}
+	defer cc.Conn().Close()
+	assert.Equal(t, "example.com", cc.Metadata().Host)
+	assert.Equal(t, C.Port(443), cc.Metadata().DstPort)
+	assert.Equal(t, C.SHADOWSOCKS, cc.Metadata().Type)
+	assert.Equal(t, user, cc.Metadata().InboundUser)
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(cc.Conn(), buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = cc.Conn().Write([]byte("pong"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+}
+
+func TestShadowsocks_AEAD(t *testing.T) {
+	config := C.Inbound{
+		Type:        C.InboundTypeShadowsocks,
+		BindAddress: "127.0.0.1:0",
+		Cipher:      "aes-128-gcm",
+		Users: []C.InboundUser{
+			{Name: "alice", Password: "alice-password"},
+			{Name: "bob", Password: "bob-password"},
+		},
+	}
+	option := outbound.ShadowSocksOption{Cipher: "aes-128-gcm", Password: "bob-password"}
+	testRoundTrip(t, config, option, "bob")
+}
+
+func TestShadowsocks_2022(t *testing.T) {
+	const (
+		serverKey = "AAECAwQFBgcICQoLDA0ODw=="
+		userKey   = "EBESExQVFhcYGRobHB0eHw=="
+	)
+	config := C.Inbound{
+		Type:        C.InboundTypeShadowsocks,
+		BindAddress: "127.0.0.1:0",
+		Cipher:      "2022-blake3-aes-128-gcm",
+		Password:    serverKey,
+		Users:       []C.InboundUser{{Name: "alice", Password: userKey}},
+	}
+	option := outbound.ShadowSocksOption{Cipher: "2022-blake3-aes-128-gcm", Password: serverKey + ":" + userKey}
+	testRoundTrip(t, config, option, "alice")
+}
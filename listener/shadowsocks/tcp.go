@@ -0,0 +1,82 @@
+package shadowsocks
+
+import (
+	"net"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+)
+
+type Listener struct {
+	listener net.Listener
+	addr     string
+	closed   bool
+}
+
+// RawAddress implements C.Listener
+func (l *Listener) RawAddress() string {
+	return l.addr
+}
+
+// Address implements C.Listener
+func (l *Listener) Address() string {
+	return l.listener.Addr().String()
+}
+
+// Close implements C.Listener
+func (l *Listener) Close() error {
+	l.closed = true
+	return l.listener.Close()
+}
+
+func New(config C.Inbound, in chan<- C.ConnContext) (C.Listener, error) {
+	s, err := newService(config)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", config.BindAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := inbound.NewIPFilter(config.LanAllowedIPs, config.LanDisallowedIPs)
+	additions := inbound.RoutingAdditions(config)
+	sl := &Listener{
+		listener: l,
+		addr:     config.BindAddress,
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				if sl.closed {
+					break
+				}
+				continue
+			}
+			if !inbound.Allowed(c.RemoteAddr(), filter) {
+				c.Close()
+				continue
+			}
+			go handleShadowsocks(s, c, in, additions)
+		}
+	}()
+
+	return sl, nil
+}
+
+func handleShadowsocks(s service, conn net.Conn, in chan<- C.ConnContext, additions []inbound.Addition) {
+	conn.(*net.TCPConn).SetKeepAlive(true)
+	c, target, user, err := s.NewConn(conn)
+	if err != nil {
+		log.Debugln("[Shadowsocks] handshake from %s failed: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	ctx := inbound.NewSocket(target, c, C.SHADOWSOCKS, additions...)
+	ctx.Metadata().InboundUser = user
+	in <- ctx
+}
@@ -0,0 +1,130 @@
+package shadowsocks
+
+import (
+	"net"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	"github.com/Dreamacro/clash/common/pool"
+	"github.com/Dreamacro/clash/common/sockopt"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+	"github.com/Dreamacro/clash/transport/socks5"
+)
+
+type UDPListener struct {
+	packetConn net.PacketConn
+	addr       string
+	closed     bool
+}
+
+// RawAddress implements C.Listener
+func (l *UDPListener) RawAddress() string {
+	return l.addr
+}
+
+// Address implements C.Listener
+func (l *UDPListener) Address() string {
+	return l.packetConn.LocalAddr().String()
+}
+
+// Close implements C.Listener
+func (l *UDPListener) Close() error {
+	l.closed = true
+	return l.packetConn.Close()
+}
+
+func NewUDP(config C.Inbound, in chan<- *inbound.PacketAdapter) (C.Listener, error) {
+	s, err := newService(config)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.ListenPacket("udp", config.BindAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sockopt.UDPReuseaddr(l.(*net.UDPConn)); err != nil {
+		log.Warnln("Failed to Reuse UDP Address: %s", err)
+	}
+
+	filter := inbound.NewIPFilter(config.LanAllowedIPs, config.LanDisallowedIPs)
+	additions := inbound.RoutingAdditions(config)
+	sl := &UDPListener{
+		packetConn: l,
+		addr:       config.BindAddress,
+	}
+	go func() {
+		for {
+			buf := pool.Get(pool.UDPBufferSize)
+			n, remoteAddr, err := l.ReadFrom(buf)
+			if err != nil {
+				pool.Put(buf)
+				if sl.closed {
+					break
+				}
+				continue
+			}
+			if !inbound.AllowedPacket(remoteAddr, filter) {
+				pool.Put(buf)
+				continue
+			}
+			handleShadowsocksUDP(s, l, in, buf, n, remoteAddr, additions)
+		}
+	}()
+
+	return sl, nil
+}
+
+func handleShadowsocksUDP(s service, pc net.PacketConn, in chan<- *inbound.PacketAdapter, buf []byte, n int, addr net.Addr, additions []inbound.Addition) {
+	session, target, payload, err := s.UnpackPacket(buf[:n])
+	if err != nil {
+		// Unresolved UDP packet, return buffer to the pool
+		pool.Put(buf)
+		return
+	}
+
+	pkt := &packet{
+		pc:      pc,
+		rAddr:   addr,
+		payload: payload,
+		bufRef:  buf,
+		session: session,
+	}
+	adapter := inbound.NewPacket(target, pc.LocalAddr(), pkt, C.SHADOWSOCKS, additions...)
+	adapter.Metadata().InboundUser = session.User()
+	select {
+	case in <- adapter:
+	default:
+	}
+}
+
+type packet struct {
+	pc      net.PacketConn
+	rAddr   net.Addr
+	payload []byte
+	bufRef  []byte
+	session packetSession
+}
+
+func (c *packet) Data() []byte {
+	return c.payload
+}
+
+// WriteBack write UDP packet with source(ip, port) = `addr`
+func (c *packet) WriteBack(b []byte, addr net.Addr) (n int, err error) {
+	pkt, err := c.session.Pack(socks5.ParseAddrToSocksAddr(addr), b)
+	if err != nil {
+		return
+	}
+	return c.pc.WriteTo(pkt, c.rAddr)
+}
+
+// LocalAddr returns the source IP/Port of UDP Packet
+func (c *packet) LocalAddr() net.Addr {
+	return c.rAddr
+}
+
+func (c *packet) Drop() {
+	pool.Put(c.bufRef)
+}
@@ -28,6 +28,11 @@ type ListenerHandler struct {
 }
 
 func (h *ListenerHandler) NewConnection(ctx context.Context, conn net.Conn, metadata M.Metadata) error {
+	// the TUN device is only checked with the global lists
+	if !inbound.Allowed(metadata.Source.TCPAddr(), nil) {
+		return conn.Close()
+	}
+
 	if deadline.NeedAdditionalReadDeadline(conn) {
 		conn = deadline.NewFallbackConn(conn) // conn from sing should check NeedAdditionalReadDeadline
 	}
@@ -37,6 +42,11 @@ func (h *ListenerHandler) NewConnection(ctx context.Context, conn net.Conn, meta
 }
 
 func (h *ListenerHandler) NewPacketConnection(ctx context.Context, conn network.PacketConn, metadata M.Metadata) error {
+	// the packets of a UDP session share the source, check it once
+	if !inbound.Allowed(metadata.Source.UDPAddr(), nil) {
+		return conn.Close()
+	}
+
 	if deadline.NeedAdditionalReadDeadline(conn) {
 		conn = deadline.NewFallbackPacketConn(bufio.NewNetPacketConn(conn)) // conn from sing should check NeedAdditionalReadDeadline
 	}
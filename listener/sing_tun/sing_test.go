@@ -0,0 +1,45 @@
+package sing_tun
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	C "github.com/Dreamacro/clash/constant"
+
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerHandler_IPFilter(t *testing.T) {
+	inbound.SetIPFilter(nil, []netip.Prefix{netip.MustParsePrefix("198.18.0.2/32")})
+	defer inbound.SetIPFilter(nil, nil)
+
+	tcpIn := make(chan C.ConnContext, 2)
+	handler := &ListenerHandler{TcpIn: tcpIn}
+	destination := M.ParseSocksaddr("1.1.1.1:443")
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	metadata := M.Metadata{Source: M.ParseSocksaddr("198.18.0.2:40000"), Destination: destination}
+	require.NoError(t, handler.NewConnection(context.Background(), local, metadata))
+	assert.Empty(t, tcpIn)
+	// the rejected connection is closed
+	remote.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := remote.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	local, remote = net.Pipe()
+	defer remote.Close()
+	metadata = M.Metadata{Source: M.ParseSocksaddr("198.18.0.1:40000"), Destination: destination}
+	require.NoError(t, handler.NewConnection(context.Background(), local, metadata))
+	require.Len(t, tcpIn, 1)
+	conn := <-tcpIn
+	assert.Equal(t, "198.18.0.1", conn.Metadata().SrcIP.String())
+	conn.Conn().Close()
+}
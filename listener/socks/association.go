@@ -0,0 +1,105 @@
+package socks
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/Dreamacro/clash/component/auth"
+	"github.com/Dreamacro/clash/transport/socks5"
+	"github.com/Dreamacro/clash/tunnel"
+)
+
+var associations = &associationTable{m: map[netip.Addr][]*association{}}
+
+// association is the UDP association of a client, it lives as long as its TCP control connection
+type association struct {
+	ip      netip.Addr
+	session *auth.Session
+
+	// port is the port of the client sending the packets, 0 means the port is unknown
+	// until the first packet, the fields are guarded by the table
+	port   uint16
+	source net.Addr
+}
+
+// newAssociation returns the association of the control connection, the port is the one in the
+// request if the client sends the packets from the IP of the control connection
+func newAssociation(control net.Addr, requested socks5.Addr, session *auth.Session) *association {
+	addrPort, err := netip.ParseAddrPort(control.String())
+	if err != nil {
+		return nil
+	}
+
+	a := &association{ip: addrPort.Addr().Unmap(), session: session}
+	if addr := requested.UDPAddr(); addr != nil {
+		if ip, ok := netip.AddrFromSlice(addr.IP); ok && ip.Unmap() == a.ip {
+			a.port = uint16(addr.Port)
+		}
+	}
+	return a
+}
+
+type associationTable struct {
+	mux sync.Mutex
+	m   map[netip.Addr][]*association
+}
+
+func (t *associationTable) add(a *association) {
+	t.mux.Lock()
+	t.m[a.ip] = append(t.m[a.ip], a)
+	t.mux.Unlock()
+}
+
+// remove removes the association and closes its UDP session
+func (t *associationTable) remove(a *association) {
+	t.mux.Lock()
+	list := t.m[a.ip]
+	for i, item := range list {
+		if item == a {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(t.m, a.ip)
+	} else {
+		t.m[a.ip] = list
+	}
+	source := a.source
+	t.mux.Unlock()
+
+	if source != nil {
+		tunnel.CloseUDP(source)
+	}
+}
+
+// lookup returns the association of the source, the association with unknown port is pinned
+// to the port of the source
+func (t *associationTable) lookup(source net.Addr) *association {
+	udpAddr, ok := source.(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+	addrPort := udpAddr.AddrPort()
+	ip := addrPort.Addr().Unmap()
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	var unpinned *association
+	for _, a := range t.m[ip] {
+		if a.port == addrPort.Port() {
+			a.source = source
+			return a
+		}
+		if a.port == 0 && unpinned == nil {
+			unpinned = a
+		}
+	}
+	if unpinned != nil {
+		unpinned.port = addrPort.Port()
+		unpinned.source = source
+	}
+	return unpinned
+}
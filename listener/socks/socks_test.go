@@ -0,0 +1,277 @@
+package socks
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	"github.com/Dreamacro/clash/adapter/outbound"
+	"github.com/Dreamacro/clash/component/auth"
+	C "github.com/Dreamacro/clash/constant"
+	authStore "github.com/Dreamacro/clash/listener/auth"
+	"github.com/Dreamacro/clash/transport/proxyprotocol"
+	"github.com/Dreamacro/clash/transport/socks5"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBind(t *testing.T) {
+	tcpIn := make(chan C.ConnContext, 1)
+	l, err := New("127.0.0.2:0", tcpIn, nil, nil)
+	require.NoError(t, err)
+	defer l.Close()
+
+	control, err := net.Dial("tcp", l.Address())
+	require.NoError(t, err)
+	defer control.Close()
+
+	bound := make(chan socks5.Addr, 1)
+	go func() {
+		addr, err := socks5.ClientHandshake(control, socks5.ParseAddr("127.0.0.1:0"), socks5.CmdBind, nil)
+		assert.NoError(t, err)
+		bound <- addr
+	}()
+
+	var bindCtx C.BindContext
+	select {
+	case ctx := <-tcpIn:
+		var ok bool
+		bindCtx, ok = ctx.(C.BindContext)
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("BIND request not received")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bl, err := outbound.NewDirect().BindContext(ctx, bindCtx.Metadata())
+	require.NoError(t, err)
+	defer bl.Close()
+	require.NoError(t, bindCtx.Reply(bl.Addr(), nil))
+
+	// DIRECT listens on the address of the control connection rather than the one routing to the remote
+	addr := <-bound
+	assert.Equal(t, bl.Addr().String(), addr.String())
+	assert.Equal(t, "127.0.0.2", addr.UDPAddr().IP.String())
+
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	remote, err := dialer.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	defer remote.Close()
+
+	accepted, err := bl.Accept()
+	require.NoError(t, err)
+	defer accepted.Close()
+	require.NoError(t, bindCtx.Reply(accepted.RemoteAddr(), nil))
+
+	peer, err := socks5.ReadReply(control)
+	require.NoError(t, err)
+	assert.Equal(t, remote.LocalAddr().String(), peer.String())
+}
+
+func TestBind_Unsupported(t *testing.T) {
+	tcpIn := make(chan C.ConnContext, 1)
+	l, err := New("127.0.0.1:0", tcpIn, nil, nil)
+	require.NoError(t, err)
+	defer l.Close()
+
+	control, err := net.Dial("tcp", l.Address())
+	require.NoError(t, err)
+	defer control.Close()
+
+	go func() {
+		ctx := <-tcpIn
+		_, err := outbound.NewReject().BindContext(context.Background(), ctx.Metadata())
+		ctx.(C.BindContext).Reply(nil, err)
+	}()
+
+	_, err = socks5.ClientHandshake(control, socks5.ParseAddr("127.0.0.1:0"), socks5.CmdBind, nil)
+	assert.Equal(t, socks5.ErrCommandNotSupported, err)
+}
+
+func TestProxyProtocol(t *testing.T) {
+	tcpIn := make(chan C.ConnContext, 1)
+	l, err := New("127.0.0.1:0", tcpIn, nil, proxyprotocol.NewServer(proxyprotocol.ModeRequire, nil))
+	require.NoError(t, err)
+	defer l.Close()
+
+	addr := netip.MustParseAddrPort(l.Address())
+	for _, version := range []int{1, 2} {
+		proxy := outbound.NewSocks5(outbound.Socks5Option{
+			Server:        addr.Addr().String(),
+			Port:          int(addr.Port()),
+			ProxyProtocol: version,
+		})
+		metadata := &C.Metadata{
+			NetWork: C.TCP,
+			SrcIP:   net.ParseIP("192.168.1.2"),
+			SrcPort: 5678,
+			Host:    "example.com",
+			DstPort: 443,
+		}
+		go proxy.DialContext(context.Background(), metadata)
+
+		select {
+		case ctx := <-tcpIn:
+			assert.Equal(t, "192.168.1.2:5678", ctx.Metadata().SourceAddress())
+			assert.Equal(t, "example.com:443", ctx.Metadata().RemoteAddress())
+			ctx.Conn().Close()
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection not received")
+		}
+	}
+
+	// the connections without the header are rejected
+	control, err := net.Dial("tcp", l.Address())
+	require.NoError(t, err)
+	defer control.Close()
+	_, err = socks5.ClientHandshake(control, socks5.ParseAddr("example.com:443"), socks5.CmdConnect, nil)
+	assert.Error(t, err)
+}
+
+func TestProxyProtocol_IPFilter(t *testing.T) {
+	tcpIn := make(chan C.ConnContext, 1)
+	filter := inbound.NewIPFilter(nil, []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")})
+	l, err := New("127.0.0.1:0", tcpIn, filter, proxyprotocol.NewServer(proxyprotocol.ModeRequire, nil))
+	require.NoError(t, err)
+	defer l.Close()
+
+	addr := netip.MustParseAddrPort(l.Address())
+	proxy := outbound.NewSocks5(outbound.Socks5Option{
+		Server:        addr.Addr().String(),
+		Port:          int(addr.Port()),
+		ProxyProtocol: 2,
+	})
+	dial := func(source string) error {
+		metadata := &C.Metadata{
+			NetWork: C.TCP,
+			SrcIP:   net.ParseIP(source),
+			SrcPort: 5678,
+			Host:    "example.com",
+			DstPort: 443,
+		}
+		c, err := proxy.DialContext(context.Background(), metadata)
+		if err == nil {
+			c.Close()
+		}
+		return err
+	}
+
+	// the source in the header is checked rather than the loopback address of the proxy
+	assert.Error(t, dial("192.168.1.2"))
+
+	go dial("10.0.0.2")
+	select {
+	case ctx := <-tcpIn:
+		assert.Equal(t, "10.0.0.2:5678", ctx.Metadata().SourceAddress())
+		ctx.Conn().Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not received")
+	}
+}
+
+func TestUDPAssociate(t *testing.T) {
+	authStore.SetAuthenticator(auth.NewAuthenticator([]auth.AuthUser{{User: "alice", Pass: "alice-password"}}))
+	defer authStore.SetAuthenticator(nil)
+
+	udpIn := make(chan *inbound.PacketAdapter, 1)
+	l, err := New("127.0.0.1:0", make(chan C.ConnContext), nil, nil)
+	require.NoError(t, err)
+	defer l.Close()
+	ul, err := NewUDP(l.Address(), udpIn, nil)
+	require.NoError(t, err)
+	defer ul.Close()
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := net.ResolveUDPAddr("udp", ul.Address())
+	require.NoError(t, err)
+
+	packet, err := socks5.EncodeUDPPacket(socks5.ParseAddr("1.1.1.1:53"), []byte("query"))
+	require.NoError(t, err)
+	receive := func() *inbound.PacketAdapter {
+		_, err := client.WriteTo(packet, server)
+		require.NoError(t, err)
+		select {
+		case p := <-udpIn:
+			return p
+		case <-time.After(200 * time.Millisecond):
+			return nil
+		}
+	}
+
+	// the packets without association are dropped with authentication
+	assert.Nil(t, receive())
+
+	control, err := net.Dial("tcp", l.Address())
+	require.NoError(t, err)
+	requested := socks5.AddrFromStdAddrPort(netip.AddrPortFrom(netip.IPv4Unspecified(), 0))
+	_, err = socks5.ClientHandshake(control, requested, socks5.CmdUDPAssociate, &socks5.User{Username: "alice", Password: "alice-password"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		p := receive()
+		if p == nil {
+			return false
+		}
+		defer p.Drop()
+		return p.Metadata().InboundUser == "alice" && string(p.Data()) == "query"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the association is closed with the control connection
+	control.Close()
+	require.Eventually(t, func() bool {
+		associations.mux.Lock()
+		defer associations.mux.Unlock()
+		return len(associations.m) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, receive())
+}
+
+// proxyAuthenticator sends the connections of alice to the office proxy
+type proxyAuthenticator struct{}
+
+func (proxyAuthenticator) Verify(user string, pass string) bool { return true }
+
+func (proxyAuthenticator) Users() []string { return []string{"alice", "bob"} }
+
+func (proxyAuthenticator) VerifyProxy(user string, pass string) (string, error) {
+	if user == "alice" {
+		return "office", nil
+	}
+	return "", nil
+}
+
+func TestRoutingAdditions(t *testing.T) {
+	authStore.SetAuthenticator(proxyAuthenticator{})
+	defer authStore.SetAuthenticator(nil)
+
+	tcpIn := make(chan C.ConnContext, 1)
+	l, err := New("127.0.0.1:0", tcpIn, nil, nil, inbound.WithSpecialRules("lan"), inbound.WithSpecialProxy("inbound"))
+	require.NoError(t, err)
+	defer l.Close()
+
+	for user, proxy := range map[string]string{
+		"alice": "office",  // the proxy of the session is kept
+		"bob":   "inbound", // the proxy of the inbound
+	} {
+		conn, err := net.Dial("tcp", l.Address())
+		require.NoError(t, err)
+		defer conn.Close()
+		go socks5.ClientHandshake(conn, socks5.ParseAddr("example.com:443"), socks5.CmdConnect, &socks5.User{Username: user, Password: "password"})
+
+		select {
+		case ctx := <-tcpIn:
+			assert.Equal(t, user, ctx.Metadata().InboundUser)
+			assert.Equal(t, proxy, ctx.Metadata().SpecialProxy, user)
+			assert.Equal(t, "lan", ctx.Metadata().SpecialRules, user)
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection not received")
+		}
+	}
+}
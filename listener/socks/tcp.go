@@ -1,13 +1,16 @@
 package socks
 
 import (
+	"errors"
 	"io"
 	"net"
 
 	"github.com/Dreamacro/clash/adapter/inbound"
 	N "github.com/Dreamacro/clash/common/net"
+	"github.com/Dreamacro/clash/component/auth"
 	C "github.com/Dreamacro/clash/constant"
 	authStore "github.com/Dreamacro/clash/listener/auth"
+	"github.com/Dreamacro/clash/transport/proxyprotocol"
 	"github.com/Dreamacro/clash/transport/socks4"
 	"github.com/Dreamacro/clash/transport/socks5"
 )
@@ -34,7 +37,7 @@ func (l *Listener) Close() error {
 	return l.listener.Close()
 }
 
-func New(addr string, in chan<- C.ConnContext) (C.Listener, error) {
+func New(addr string, in chan<- C.ConnContext, filter *inbound.IPFilter, pp *proxyprotocol.Server, additions ...inbound.Addition) (C.Listener, error) {
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -53,16 +56,21 @@ func New(addr string, in chan<- C.ConnContext) (C.Listener, error) {
 				}
 				continue
 			}
-			go handleSocks(c, in)
+			go handleSocks(c, in, filter, pp, additions)
 		}
 	}()
 
 	return sl, nil
 }
 
-func handleSocks(conn net.Conn, in chan<- C.ConnContext) {
+func handleSocks(conn net.Conn, in chan<- C.ConnContext, filter *inbound.IPFilter, pp *proxyprotocol.Server, additions []inbound.Addition) {
 	conn.(*net.TCPConn).SetKeepAlive(true)
-	bufConn := N.NewBufferedConn(conn)
+	c, ok := inbound.AcceptProxied(conn, filter, pp)
+	if !ok {
+		return
+	}
+
+	bufConn := N.NewBufferedConn(c)
 	head, err := bufConn.Peek(1)
 	if err != nil {
 		conn.Close()
@@ -71,33 +79,68 @@ func handleSocks(conn net.Conn, in chan<- C.ConnContext) {
 
 	switch head[0] {
 	case socks4.Version:
-		HandleSocks4(bufConn, in)
+		HandleSocks4(bufConn, in, additions...)
 	case socks5.Version:
-		HandleSocks5(bufConn, in)
+		HandleSocks5(bufConn, in, additions...)
 	default:
 		conn.Close()
 	}
 }
 
-func HandleSocks4(conn net.Conn, in chan<- C.ConnContext) {
-	addr, _, err := socks4.ServerHandshake(conn, authStore.Authenticator())
+func HandleSocks4(conn net.Conn, in chan<- C.ConnContext, additions ...inbound.Addition) {
+	addr, _, session, err := socks4.ServerHandshake(conn, authStore.Authenticator())
 	if err != nil {
 		conn.Close()
 		return
 	}
-	in <- inbound.NewSocket(socks5.ParseAddr(addr), conn, C.SOCKS4)
+	ctx := inbound.NewSocket(socks5.ParseAddr(addr), conn, C.SOCKS4, additions...)
+	authStore.ApplySession(ctx.Metadata(), session)
+	in <- ctx
 }
 
-func HandleSocks5(conn net.Conn, in chan<- C.ConnContext) {
-	target, command, err := socks5.ServerHandshake(conn, authStore.Authenticator())
+func HandleSocks5(conn net.Conn, in chan<- C.ConnContext, additions ...inbound.Addition) {
+	target, command, session, err := socks5.ServerHandshake(conn, authStore.Authenticator())
 	if err != nil {
 		conn.Close()
 		return
 	}
 	if command == socks5.CmdUDPAssociate {
-		defer conn.Close()
-		io.Copy(io.Discard, conn)
+		handleUDPAssociate(conn, target, session)
+		return
+	}
+	ctx := inbound.NewSocket(target, conn, C.SOCKS5, additions...)
+	authStore.ApplySession(ctx.Metadata(), session)
+	if command == socks5.CmdBind {
+		in <- &bindContext{ConnContext: ctx}
 		return
 	}
-	in <- inbound.NewSocket(target, conn, C.SOCKS5)
+	in <- ctx
+}
+
+// handleUDPAssociate keeps the UDP association until the control connection is closed
+func handleUDPAssociate(conn net.Conn, target socks5.Addr, session *auth.Session) {
+	defer conn.Close()
+
+	if a := newAssociation(conn.RemoteAddr(), target, session); a != nil {
+		associations.add(a)
+		defer associations.remove(a)
+	}
+	io.Copy(io.Discard, conn)
+}
+
+// bindContext replies the BIND request by the addresses of the tunnel
+type bindContext struct {
+	C.ConnContext
+}
+
+// Reply implements C.BindContext
+func (c *bindContext) Reply(addr net.Addr, err error) error {
+	if err != nil {
+		rep := socks5.ErrGeneralFailure
+		if errors.Is(err, errors.ErrUnsupported) {
+			rep = socks5.ErrCommandNotSupported
+		}
+		return socks5.WriteReply(c.Conn(), rep, nil)
+	}
+	return socks5.WriteReply(c.Conn(), socks5.ReplySucceeded, socks5.ParseAddrToSocksAddr(addr))
 }
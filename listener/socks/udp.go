@@ -7,6 +7,7 @@ import (
 	"github.com/Dreamacro/clash/common/pool"
 	"github.com/Dreamacro/clash/common/sockopt"
 	C "github.com/Dreamacro/clash/constant"
+	authStore "github.com/Dreamacro/clash/listener/auth"
 	"github.com/Dreamacro/clash/log"
 	"github.com/Dreamacro/clash/transport/socks5"
 )
@@ -33,7 +34,7 @@ func (l *UDPListener) Close() error {
 	return l.packetConn.Close()
 }
 
-func NewUDP(addr string, in chan<- *inbound.PacketAdapter) (C.Listener, error) {
+func NewUDP(addr string, in chan<- *inbound.PacketAdapter, filter *inbound.IPFilter, additions ...inbound.Addition) (C.Listener, error) {
 	l, err := net.ListenPacket("udp", addr)
 	if err != nil {
 		return nil, err
@@ -58,14 +59,26 @@ func NewUDP(addr string, in chan<- *inbound.PacketAdapter) (C.Listener, error) {
 				}
 				continue
 			}
-			handleSocksUDP(l, in, buf[:n], remoteAddr)
+			if !inbound.AllowedPacket(remoteAddr, filter) {
+				pool.Put(buf)
+				continue
+			}
+			handleSocksUDP(l, in, buf[:n], remoteAddr, additions)
 		}
 	}()
 
 	return sl, nil
 }
 
-func handleSocksUDP(pc net.PacketConn, in chan<- *inbound.PacketAdapter, buf []byte, addr net.Addr) {
+func handleSocksUDP(pc net.PacketConn, in chan<- *inbound.PacketAdapter, buf []byte, addr net.Addr, additions []inbound.Addition) {
+	// the packets without association are only allowed without authentication
+	a := associations.lookup(addr)
+	if a == nil && authStore.Authenticator() != nil {
+		log.Debugln("[SOCKS5] packet from %s without UDP association dropped", addr.String())
+		pool.Put(buf)
+		return
+	}
+
 	target, payload, err := socks5.DecodeUDPPacket(buf)
 	if err != nil {
 		// Unresolved UDP packet, return buffer to the pool
@@ -78,8 +91,12 @@ func handleSocksUDP(pc net.PacketConn, in chan<- *inbound.PacketAdapter, buf []b
 		payload: payload,
 		bufRef:  buf,
 	}
+	adapter := inbound.NewPacket(target, pc.LocalAddr(), packet, C.SOCKS5, additions...)
+	if a != nil {
+		authStore.ApplySession(adapter.Metadata(), a.session)
+	}
 	select {
-	case in <- inbound.NewPacket(target, pc.LocalAddr(), packet, C.SOCKS5):
+	case in <- adapter:
 	default:
 	}
 }
@@ -0,0 +1,23 @@
+package stream
+
+import (
+	"net"
+	"strconv"
+
+	"go.uber.org/atomic"
+)
+
+var streamID = atomic.NewUint64(0)
+
+// PacketAddr returns the source address of the packets relayed by a stream.
+// The packets are keyed by their source in the NAT table, the zone of the
+// address is unique per stream so that the streams sharing a connection,
+// e.g. the streams of HTTP/2, don't share their NAT entries
+func PacketAddr(conn net.Conn) net.Addr {
+	addr := &net.UDPAddr{IP: net.IPv4zero}
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		addr.IP, addr.Port = tcpAddr.IP, tcpAddr.Port
+	}
+	addr.Zone = "stream" + strconv.FormatUint(streamID.Inc(), 10)
+	return addr
+}
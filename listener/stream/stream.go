@@ -0,0 +1,154 @@
+package stream
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/log"
+	"github.com/Dreamacro/clash/transport/gun"
+	"github.com/Dreamacro/clash/transport/vmess"
+
+	"golang.org/x/net/http2"
+)
+
+// Listen listens on the bind address of the inbound, the accepted streams are
+// decrypted by TLS and unwrapped from the WebSocket or gRPC transport if configured,
+// TLS is required by Trojan which doesn't encrypt the streams itself
+func Listen(config C.Inbound) (net.Listener, error) {
+	if config.Type == C.InboundTypeTrojan && config.Certificate == "" {
+		return nil, errors.New("TLS certificate is required by trojan")
+	}
+
+	var tlsConfig *tls.Config
+	if config.Certificate != "" {
+		cert, err := tls.LoadX509KeyPair(config.Certificate, config.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("load TLS certificate error: %w", err)
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	switch config.Network {
+	case "grpc":
+		if tlsConfig == nil {
+			return nil, errors.New("TLS certificate is required by grpc network")
+		}
+		tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+	case "ws":
+		if tlsConfig != nil {
+			tlsConfig.NextProtos = []string{"http/1.1"}
+		}
+	case "", "tcp":
+		if tlsConfig != nil {
+			tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		}
+	default:
+		return nil, fmt.Errorf("not support network: %s", config.Network)
+	}
+
+	l, err := net.Listen("tcp", config.BindAddress)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	switch config.Network {
+	case "ws":
+		wsConfig := &vmess.WebsocketServerConfig{
+			Path:                config.WSOpts.Path,
+			EarlyDataHeaderName: config.WSOpts.EarlyDataHeaderName,
+		}
+		return newHTTPListener(l, func(hl *httpListener, w http.ResponseWriter, r *http.Request) {
+			conn, err := vmess.StreamWebsocketServerConn(w, r, wsConfig)
+			if err != nil {
+				log.Debugln("[WebSocket] upgrade %s from %s failed: %s", r.URL.Path, r.RemoteAddr, err)
+				return
+			}
+			hl.push(conn)
+		}), nil
+	case "grpc":
+		path := gun.Path(config.GrpcOpts.GrpcServiceName)
+		return newHTTPListener(l, func(hl *httpListener, w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != path {
+				http.NotFound(w, r)
+				return
+			}
+			conn := gun.NewServerConn(w, r)
+			if !hl.push(conn) {
+				return
+			}
+			select {
+			case <-conn.Done():
+			case <-r.Context().Done():
+				conn.Close()
+			}
+		}), nil
+	default:
+		return l, nil
+	}
+}
+
+// httpListener accepts the streams of an HTTP server
+type httpListener struct {
+	net.Listener
+	server *http.Server
+	conns  chan net.Conn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newHTTPListener(l net.Listener, handle func(hl *httpListener, w http.ResponseWriter, r *http.Request)) *httpListener {
+	hl := &httpListener{
+		Listener: l,
+		conns:    make(chan net.Conn),
+		closed:   make(chan struct{}),
+	}
+	hl.server = &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handle(hl, w, r)
+		}),
+	}
+	http2.ConfigureServer(hl.server, &http2.Server{})
+	go hl.server.Serve(l)
+	return hl
+}
+
+// push passes the stream to Accept, it returns false if the listener is closed
+func (hl *httpListener) push(conn net.Conn) bool {
+	select {
+	case hl.conns <- conn:
+		return true
+	case <-hl.closed:
+		conn.Close()
+		return false
+	}
+}
+
+// Accept implements net.Listener
+func (hl *httpListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-hl.conns:
+		return conn, nil
+	case <-hl.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener
+func (hl *httpListener) Close() error {
+	hl.closeOnce.Do(func() {
+		close(hl.closed)
+	})
+	return hl.server.Close()
+}
@@ -30,13 +30,13 @@ func (l *Listener) Close() error {
 	return l.listener.Close()
 }
 
-func (l *Listener) handleTProxy(conn net.Conn, in chan<- C.ConnContext) {
+func (l *Listener) handleTProxy(conn net.Conn, in chan<- C.ConnContext, additions []inbound.Addition) {
 	target := socks5.ParseAddrToSocksAddr(conn.LocalAddr())
 	conn.(*net.TCPConn).SetKeepAlive(true)
-	in <- inbound.NewSocket(target, conn, C.TPROXY)
+	in <- inbound.NewSocket(target, conn, C.TPROXY, additions...)
 }
 
-func New(addr string, in chan<- C.ConnContext) (C.Listener, error) {
+func New(addr string, in chan<- C.ConnContext, filter *inbound.IPFilter, additions ...inbound.Addition) (C.Listener, error) {
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -67,7 +67,11 @@ func New(addr string, in chan<- C.ConnContext) (C.Listener, error) {
 				}
 				continue
 			}
-			go rl.handleTProxy(c, in)
+			if !inbound.Allowed(c.RemoteAddr(), filter) {
+				c.Close()
+				continue
+			}
+			go rl.handleTProxy(c, in, additions)
 		}
 	}()
 
@@ -32,7 +32,7 @@ func (l *UDPListener) Close() error {
 	return l.packetConn.Close()
 }
 
-func NewUDP(addr string, in chan<- *inbound.PacketAdapter) (C.Listener, error) {
+func NewUDP(addr string, in chan<- *inbound.PacketAdapter, filter *inbound.IPFilter, additions ...inbound.Addition) (C.Listener, error) {
 	l, err := net.ListenPacket("udp", addr)
 	if err != nil {
 		return nil, err
@@ -68,6 +68,11 @@ func NewUDP(addr string, in chan<- *inbound.PacketAdapter) (C.Listener, error) {
 				continue
 			}
 
+			if !inbound.AllowedPacket(net.UDPAddrFromAddrPort(lAddr), filter) {
+				pool.Put(buf)
+				continue
+			}
+
 			rAddr, err := getOrigDst(oob[:oobn])
 			if err != nil {
 				continue
@@ -77,21 +82,21 @@ func NewUDP(addr string, in chan<- *inbound.PacketAdapter) (C.Listener, error) {
 				// try to unmap 4in6 address
 				lAddr = netip.AddrPortFrom(lAddr.Addr().Unmap(), lAddr.Port())
 			}
-			handlePacketConn(in, buf[:n], lAddr, rAddr)
+			handlePacketConn(in, buf[:n], lAddr, rAddr, additions)
 		}
 	}()
 
 	return rl, nil
 }
 
-func handlePacketConn(in chan<- *inbound.PacketAdapter, buf []byte, lAddr, rAddr netip.AddrPort) {
+func handlePacketConn(in chan<- *inbound.PacketAdapter, buf []byte, lAddr, rAddr netip.AddrPort, additions []inbound.Addition) {
 	target := socks5.AddrFromStdAddrPort(rAddr)
 	pkt := &packet{
 		lAddr: lAddr,
 		buf:   buf,
 	}
 	select {
-	case in <- inbound.NewPacket(target, target.UDPAddr(), pkt, C.TPROXY):
+	case in <- inbound.NewPacket(target, target.UDPAddr(), pkt, C.TPROXY, additions...):
 	default:
 	}
 }
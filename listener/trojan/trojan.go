@@ -0,0 +1,151 @@
+package trojan
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	"github.com/Dreamacro/clash/common/pool"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/listener/stream"
+	"github.com/Dreamacro/clash/log"
+	"github.com/Dreamacro/clash/transport/socks5"
+	"github.com/Dreamacro/clash/transport/trojan"
+
+	"github.com/samber/lo"
+)
+
+type Listener struct {
+	listener net.Listener
+	addr     string
+	closed   bool
+}
+
+// RawAddress implements C.Listener
+func (l *Listener) RawAddress() string {
+	return l.addr
+}
+
+// Address implements C.Listener
+func (l *Listener) Address() string {
+	return l.listener.Addr().String()
+}
+
+// Close implements C.Listener
+func (l *Listener) Close() error {
+	l.closed = true
+	return l.listener.Close()
+}
+
+func New(config C.Inbound, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter) (C.Listener, error) {
+	users := lo.Map(config.Users, func(u C.InboundUser, _ int) trojan.User {
+		return trojan.User{Name: u.Name, Password: u.Password}
+	})
+	if config.Password != "" {
+		users = append(users, trojan.User{Password: config.Password})
+	}
+	if len(users) == 0 {
+		return nil, errors.New("password or users is required")
+	}
+	s := trojan.NewServer(users)
+
+	l, err := stream.Listen(config)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := inbound.NewIPFilter(config.LanAllowedIPs, config.LanDisallowedIPs)
+	additions := inbound.RoutingAdditions(config)
+	tl := &Listener{
+		listener: l,
+		addr:     config.BindAddress,
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				if tl.closed {
+					break
+				}
+				continue
+			}
+			if !inbound.Allowed(c.RemoteAddr(), filter) {
+				c.Close()
+				continue
+			}
+			go handleTrojan(s, c, tcpIn, udpIn, additions)
+		}
+	}()
+
+	return tl, nil
+}
+
+func handleTrojan(s *trojan.Server, conn net.Conn, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter, additions []inbound.Addition) {
+	// the TLS handshake is done by the first read
+	conn.SetReadDeadline(time.Now().Add(C.DefaultTLSTimeout))
+	command, target, user, err := s.ReadHeader(conn)
+	if err != nil {
+		log.Debugln("[Trojan] handshake from %s failed: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if command == trojan.CommandTCP {
+		ctx := inbound.NewSocket(target, conn, C.TROJAN, additions...)
+		ctx.Metadata().InboundUser = user
+		tcpIn <- ctx
+		return
+	}
+
+	defer conn.Close()
+	addr := stream.PacketAddr(conn)
+	for {
+		buf := pool.Get(pool.UDPBufferSize)
+		target, n, err := trojan.ReadServerPacket(conn, buf)
+		if err != nil {
+			pool.Put(buf)
+			return
+		}
+
+		pkt := &packet{
+			conn:    conn,
+			rAddr:   addr,
+			payload: buf[:n],
+			bufRef:  buf,
+		}
+		adapter := inbound.NewPacket(target, conn.LocalAddr(), pkt, C.TROJAN, additions...)
+		adapter.Metadata().InboundUser = user
+		select {
+		case udpIn <- adapter:
+		default:
+			pkt.Drop()
+		}
+	}
+}
+
+type packet struct {
+	conn    net.Conn
+	rAddr   net.Addr
+	payload []byte
+	bufRef  []byte
+}
+
+func (c *packet) Data() []byte {
+	return c.payload
+}
+
+// WriteBack write UDP packet with source(ip, port) = `addr`
+func (c *packet) WriteBack(b []byte, addr net.Addr) (n int, err error) {
+	return trojan.WritePacket(c.conn, socks5.ParseAddrToSocksAddr(addr), b)
+}
+
+// LocalAddr returns the source IP/Port of UDP Packet
+func (c *packet) LocalAddr() net.Addr {
+	return c.rAddr
+}
+
+func (c *packet) Drop() {
+	pool.Put(c.bufRef)
+}
@@ -0,0 +1,167 @@
+package trojan
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	"github.com/Dreamacro/clash/adapter/outbound"
+	"github.com/Dreamacro/clash/common/pool"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+	return certFile, keyFile
+}
+
+func newTestPair(t *testing.T, config C.Inbound, option outbound.TrojanOption) (*outbound.Trojan, chan C.ConnContext, chan *inbound.PacketAdapter) {
+	config.Type = C.InboundTypeTrojan
+	config.BindAddress = "127.0.0.1:0"
+	config.Certificate, config.PrivateKey = writeCertificate(t, t.TempDir())
+	config.Users = []C.InboundUser{{Name: "alice", Password: "alice-password"}}
+
+	tcpIn, udpIn := make(chan C.ConnContext, 1), make(chan *inbound.PacketAdapter, 1)
+	l, err := New(config, tcpIn, udpIn)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	host, port, _ := net.SplitHostPort(l.Address())
+	option.Name = "trojan"
+	option.Server = host
+	option.Port, _ = strconv.Atoi(port)
+	option.Password = "alice-password"
+	option.SNI = "example.com"
+	option.SkipCertVerify = true
+	option.UDP = true
+	tr, err := outbound.NewTrojan(option)
+	require.NoError(t, err)
+	return tr, tcpIn, udpIn
+}
+
+func testTCP(t *testing.T, config C.Inbound, option outbound.TrojanOption) {
+	tr, tcpIn, _ := newTestPair(t, config, option)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tr.DialContext(ctx, &C.Metadata{NetWork: C.TCP, Host: "example.com", DstPort: 443})
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	var cc C.ConnContext
+	select {
+	case cc = <-tcpIn:
+	case <-ctx.Done():
+		t.Fatal("no connection accepted")
+	}
+	defer cc.Conn().Close()
+	assert.Equal(t, "example.com", cc.Metadata().Host)
+	assert.Equal(t, C.Port(443), cc.Metadata().DstPort)
+	assert.Equal(t, C.TROJAN, cc.Metadata().Type)
+	assert.Equal(t, "alice", cc.Metadata().InboundUser)
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(cc.Conn(), buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = cc.Conn().Write([]byte("pong"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+}
+
+func TestTrojan_TCP(t *testing.T) {
+	testTCP(t, C.Inbound{}, outbound.TrojanOption{})
+}
+
+func TestTrojan_WebSocket(t *testing.T) {
+	testTCP(t, C.Inbound{Network: "ws", WSOpts: C.InboundWSOptions{Path: "/trojan"}}, outbound.TrojanOption{
+		Network: "ws",
+		WSOpts:  outbound.WSOptions{Path: "/trojan"},
+	})
+}
+
+func TestTrojan_Grpc(t *testing.T) {
+	testTCP(t, C.Inbound{Network: "grpc", GrpcOpts: C.InboundGrpcOptions{GrpcServiceName: "trojan"}}, outbound.TrojanOption{
+		Network:  "grpc",
+		GrpcOpts: outbound.GrpcOptions{GrpcServiceName: "trojan"},
+	})
+}
+
+func TestTrojan_UDP(t *testing.T) {
+	tr, _, udpIn := newTestPair(t, C.Inbound{}, outbound.TrojanOption{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	target := &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 53}
+	pc, err := tr.ListenPacketContext(ctx, &C.Metadata{NetWork: C.UDP, DstIP: target.IP, DstPort: 53})
+	require.NoError(t, err)
+	defer pc.Close()
+	_, err = pc.WriteTo([]byte("query"), target)
+	require.NoError(t, err)
+
+	var pkt *inbound.PacketAdapter
+	select {
+	case pkt = <-udpIn:
+	case <-ctx.Done():
+		t.Fatal("no packet accepted")
+	}
+	defer pkt.Drop()
+	assert.Equal(t, "query", string(pkt.Data()))
+	assert.Equal(t, "1.1.1.1:53", pkt.Metadata().RemoteAddress())
+	assert.Equal(t, "alice", pkt.Metadata().InboundUser)
+
+	_, err = pkt.WriteBack([]byte("answer"), target)
+	require.NoError(t, err)
+	buf := make([]byte, pool.UDPBufferSize)
+	n, addr, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "answer", string(buf[:n]))
+	assert.Equal(t, target.String(), addr.String())
+}
+
+func TestTrojan_RequireTLS(t *testing.T) {
+	_, err := New(C.Inbound{
+		Type:        C.InboundTypeTrojan,
+		BindAddress: "127.0.0.1:0",
+		Password:    "password",
+	}, nil, nil)
+	assert.Error(t, err)
+}
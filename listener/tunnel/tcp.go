@@ -67,6 +67,11 @@ func New(addr, target, proxy string, in chan<- C.ConnContext) (*Listener, error)
 				}
 				continue
 			}
+			// the tunnels are only checked with the global lists
+			if !inbound.Allowed(c.RemoteAddr(), nil) {
+				c.Close()
+				continue
+			}
 			go rl.handleTCP(c, in)
 		}
 	}()
@@ -62,6 +62,10 @@ func NewUDP(addr, target, proxy string, in chan<- *inbound.PacketAdapter) (*Pack
 				}
 				continue
 			}
+			if !inbound.AllowedPacket(remoteAddr, nil) {
+				pool.Put(buf)
+				continue
+			}
 			sl.handleUDP(l, in, buf[:n], remoteAddr)
 		}
 	}()
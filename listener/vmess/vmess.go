@@ -0,0 +1,172 @@
+package vmess
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	"github.com/Dreamacro/clash/common/pool"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/listener/stream"
+	"github.com/Dreamacro/clash/log"
+	"github.com/Dreamacro/clash/transport/socks5"
+	"github.com/Dreamacro/clash/transport/vmess"
+
+	"github.com/samber/lo"
+)
+
+type Listener struct {
+	listener net.Listener
+	addr     string
+	closed   bool
+}
+
+// RawAddress implements C.Listener
+func (l *Listener) RawAddress() string {
+	return l.addr
+}
+
+// Address implements C.Listener
+func (l *Listener) Address() string {
+	return l.listener.Addr().String()
+}
+
+// Close implements C.Listener
+func (l *Listener) Close() error {
+	l.closed = true
+	return l.listener.Close()
+}
+
+func New(config C.Inbound, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter) (C.Listener, error) {
+	if len(config.Users) == 0 {
+		return nil, errors.New("users is required")
+	}
+	s, err := vmess.NewServer(lo.Map(config.Users, func(u C.InboundUser, _ int) vmess.ServerUser {
+		return vmess.ServerUser{Name: u.Name, UUID: u.UUID}
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := stream.Listen(config)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := inbound.NewIPFilter(config.LanAllowedIPs, config.LanDisallowedIPs)
+	additions := inbound.RoutingAdditions(config)
+	vl := &Listener{
+		listener: l,
+		addr:     config.BindAddress,
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				if vl.closed {
+					break
+				}
+				continue
+			}
+			if !inbound.Allowed(c.RemoteAddr(), filter) {
+				c.Close()
+				continue
+			}
+			go handleVmess(s, c, tcpIn, udpIn, additions)
+		}
+	}()
+
+	return vl, nil
+}
+
+func handleVmess(s *vmess.Server, conn net.Conn, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter, additions []inbound.Addition) {
+	// the TLS handshake is done by the first read
+	conn.SetReadDeadline(time.Now().Add(C.DefaultTLSTimeout))
+	c, dst, user, err := s.NewConn(conn)
+	if err != nil {
+		log.Debugln("[Vmess] handshake from %s failed: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	target := socksAddr(dst)
+	if !dst.UDP {
+		ctx := inbound.NewSocket(target, c, C.VMESS, additions...)
+		ctx.Metadata().InboundUser = user
+		tcpIn <- ctx
+		return
+	}
+
+	// the packets of a stream are sent to the same destination
+	defer c.Close()
+	addr := stream.PacketAddr(conn)
+	for {
+		buf := pool.Get(pool.UDPBufferSize)
+		n, err := c.Read(buf)
+		if err != nil {
+			pool.Put(buf)
+			return
+		}
+
+		pkt := &packet{
+			conn:    c,
+			rAddr:   addr,
+			payload: buf[:n],
+			bufRef:  buf,
+		}
+		adapter := inbound.NewPacket(target, conn.LocalAddr(), pkt, C.VMESS, additions...)
+		adapter.Metadata().InboundUser = user
+		select {
+		case udpIn <- adapter:
+		default:
+			pkt.Drop()
+		}
+	}
+}
+
+// socksAddr converts the destination of a request to socks5.Addr
+func socksAddr(dst *vmess.DstAddr) socks5.Addr {
+	var atyp byte
+	switch dst.AddrType {
+	case vmess.AtypIPv4:
+		atyp = socks5.AtypIPv4
+	case vmess.AtypIPv6:
+		atyp = socks5.AtypIPv6
+	default:
+		atyp = socks5.AtypDomainName
+	}
+
+	addr := make(socks5.Addr, 0, 1+len(dst.Addr)+2)
+	addr = append(addr, atyp)
+	addr = append(addr, dst.Addr...)
+	return binary.BigEndian.AppendUint16(addr, uint16(dst.Port))
+}
+
+type packet struct {
+	conn    net.Conn
+	rAddr   net.Addr
+	payload []byte
+	bufRef  []byte
+}
+
+func (c *packet) Data() []byte {
+	return c.payload
+}
+
+// WriteBack write UDP packet with source(ip, port) = `addr`, the source
+// is always the destination of the stream
+func (c *packet) WriteBack(b []byte, addr net.Addr) (n int, err error) {
+	return c.conn.Write(b)
+}
+
+// LocalAddr returns the source IP/Port of UDP Packet
+func (c *packet) LocalAddr() net.Addr {
+	return c.rAddr
+}
+
+func (c *packet) Drop() {
+	pool.Put(c.bufRef)
+}
@@ -0,0 +1,204 @@
+package vmess
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	"github.com/Dreamacro/clash/adapter/outbound"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUUID = "b831381d-6324-4d53-ad4f-8cda48b30811"
+
+// writeCertificate writes a self-signed certificate and its key to dir
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+	return certFile, keyFile
+}
+
+func newTestPair(t *testing.T, config C.Inbound, option outbound.VmessOption) (*outbound.Vmess, chan C.ConnContext, chan *inbound.PacketAdapter) {
+	config.Type = C.InboundTypeVmess
+	config.BindAddress = "127.0.0.1:0"
+	config.Users = []C.InboundUser{{Name: "alice", UUID: testUUID}}
+	if option.TLS {
+		config.Certificate, config.PrivateKey = writeCertificate(t, t.TempDir())
+	}
+
+	tcpIn, udpIn := make(chan C.ConnContext, 1), make(chan *inbound.PacketAdapter, 1)
+	l, err := New(config, tcpIn, udpIn)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	host, port, _ := net.SplitHostPort(l.Address())
+	option.Name = "vmess"
+	option.Server = host
+	option.Port, _ = strconv.Atoi(port)
+	option.UUID = testUUID
+	option.ServerName = "example.com"
+	option.SkipCertVerify = true
+	option.UDP = true
+	v, err := outbound.NewVmess(option)
+	require.NoError(t, err)
+	return v, tcpIn, udpIn
+}
+
+func testTCP(t *testing.T, config C.Inbound, option outbound.VmessOption) {
+	v, tcpIn, _ := newTestPair(t, config, option)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := v.DialContext(ctx, &C.Metadata{NetWork: C.TCP, Host: "example.com", DstPort: 443})
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	var cc C.ConnContext
+	select {
+	case cc = <-tcpIn:
+	case <-ctx.Done():
+		t.Fatal("no connection accepted")
+	}
+	defer cc.Conn().Close()
+	assert.Equal(t, "example.com", cc.Metadata().Host)
+	assert.Equal(t, C.Port(443), cc.Metadata().DstPort)
+	assert.Equal(t, C.VMESS, cc.Metadata().Type)
+	assert.Equal(t, "alice", cc.Metadata().InboundUser)
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(cc.Conn(), buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = cc.Conn().Write([]byte("pong"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+}
+
+func TestVmess_Cipher(t *testing.T) {
+	for _, cipher := range []string{"aes-128-gcm", "chacha20-poly1305", "none", "zero"} {
+		t.Run(cipher, func(t *testing.T) {
+			testTCP(t, C.Inbound{}, outbound.VmessOption{Cipher: cipher})
+		})
+	}
+}
+
+func TestVmess_TLS(t *testing.T) {
+	testTCP(t, C.Inbound{}, outbound.VmessOption{Cipher: "auto", TLS: true})
+}
+
+func TestVmess_WebSocket(t *testing.T) {
+	testTCP(t, C.Inbound{Network: "ws", WSOpts: C.InboundWSOptions{Path: "/vmess"}}, outbound.VmessOption{
+		Cipher:  "auto",
+		Network: "ws",
+		WSOpts:  outbound.WSOptions{Path: "/vmess"},
+	})
+}
+
+func TestVmess_WebSocketEarlyData(t *testing.T) {
+	testTCP(t, C.Inbound{Network: "ws", WSOpts: C.InboundWSOptions{Path: "/vmess", EarlyDataHeaderName: "Sec-WebSocket-Protocol"}}, outbound.VmessOption{
+		Cipher:  "auto",
+		TLS:     true,
+		Network: "ws",
+		WSOpts:  outbound.WSOptions{Path: "/vmess", MaxEarlyData: 2048, EarlyDataHeaderName: "Sec-WebSocket-Protocol"},
+	})
+}
+
+func TestVmess_Grpc(t *testing.T) {
+	testTCP(t, C.Inbound{Network: "grpc", GrpcOpts: C.InboundGrpcOptions{GrpcServiceName: "vmess"}}, outbound.VmessOption{
+		Cipher:   "auto",
+		TLS:      true,
+		Network:  "grpc",
+		GrpcOpts: outbound.GrpcOptions{GrpcServiceName: "vmess"},
+	})
+}
+
+func TestVmess_UDP(t *testing.T) {
+	v, _, udpIn := newTestPair(t, C.Inbound{}, outbound.VmessOption{Cipher: "auto"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	target := &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1).To4(), Port: 53}
+	pc, err := v.ListenPacketContext(ctx, &C.Metadata{NetWork: C.UDP, DstIP: target.IP, DstPort: 53})
+	require.NoError(t, err)
+	defer pc.Close()
+	_, err = pc.WriteTo([]byte("query"), target)
+	require.NoError(t, err)
+
+	var pkt *inbound.PacketAdapter
+	select {
+	case pkt = <-udpIn:
+	case <-ctx.Done():
+		t.Fatal("no packet accepted")
+	}
+	defer pkt.Drop()
+	assert.Equal(t, "query", string(pkt.Data()))
+	assert.Equal(t, "1.1.1.1:53", pkt.Metadata().RemoteAddress())
+	assert.Equal(t, "alice", pkt.Metadata().InboundUser)
+
+	_, err = pkt.WriteBack([]byte("answer"), target)
+	require.NoError(t, err)
+	buf := make([]byte, 64)
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "answer", string(buf[:n]))
+}
+
+func TestVmess_InvalidUser(t *testing.T) {
+	tcpIn := make(chan C.ConnContext, 1)
+	config := C.Inbound{Type: C.InboundTypeVmess, BindAddress: "127.0.0.1:0", Users: []C.InboundUser{{Name: "bob", UUID: "6c3b6e2c-8a1f-4c5e-9f0a-1d2e3f4a5b6c"}}}
+	l, err := New(config, tcpIn, nil)
+	require.NoError(t, err)
+	defer l.Close()
+
+	host, port, _ := net.SplitHostPort(l.Address())
+	p, _ := strconv.Atoi(port)
+	v, err := outbound.NewVmess(outbound.VmessOption{Name: "vmess", Server: host, Port: p, UUID: testUUID, Cipher: "auto"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := v.DialContext(ctx, &C.Metadata{NetWork: C.TCP, Host: "example.com", DstPort: 443})
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+
+	_, err = conn.Read(make([]byte, 4))
+	assert.Error(t, err)
+	assert.Len(t, tcpIn, 0)
+}
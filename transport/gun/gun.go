@@ -43,8 +43,7 @@ type Conn struct {
 	once      sync.Once
 	close     *atomic.Bool
 	err       error
-	remain    int
-	br        *bufio.Reader
+	reader    *frameReader
 
 	// deadlines
 	deadline *time.Timer
@@ -65,7 +64,7 @@ func (g *Conn) initRequest() {
 
 	if !g.close.Load() {
 		g.response = response
-		g.br = bufio.NewReader(response.Body)
+		g.reader = &frameReader{br: bufio.NewReader(response.Body)}
 	} else {
 		response.Body.Close()
 	}
@@ -77,26 +76,38 @@ func (g *Conn) Read(b []byte) (n int, err error) {
 		return 0, g.err
 	}
 
-	if g.remain > 0 {
-		size := g.remain
+	if g.reader == nil {
+		return 0, net.ErrClosed
+	}
+
+	return g.reader.Read(b)
+}
+
+// frameReader reads the payloads of the gun frames
+type frameReader struct {
+	br     *bufio.Reader
+	remain int
+}
+
+func (r *frameReader) Read(b []byte) (n int, err error) {
+	if r.remain > 0 {
+		size := r.remain
 		if len(b) < size {
 			size = len(b)
 		}
 
-		n, err = io.ReadFull(g.br, b[:size])
-		g.remain -= n
+		n, err = io.ReadFull(r.br, b[:size])
+		r.remain -= n
 		return
-	} else if g.response == nil {
-		return 0, net.ErrClosed
 	}
 
 	// 0x00 grpclength(uint32) 0x0A uleb128 payload
-	_, err = g.br.Discard(6)
+	_, err = r.br.Discard(6)
 	if err != nil {
 		return 0, err
 	}
 
-	protobufPayloadLen, err := binary.ReadUvarint(g.br)
+	protobufPayloadLen, err := binary.ReadUvarint(r.br)
 	if err != nil {
 		return 0, ErrInvalidLength
 	}
@@ -106,20 +117,21 @@ func (g *Conn) Read(b []byte) (n int, err error) {
 		size = len(b)
 	}
 
-	n, err = io.ReadFull(g.br, b[:size])
+	n, err = io.ReadFull(r.br, b[:size])
 	if err != nil {
 		return
 	}
 
 	remain := int(protobufPayloadLen) - n
 	if remain > 0 {
-		g.remain = remain
+		r.remain = remain
 	}
 
 	return n, nil
 }
 
-func (g *Conn) Write(b []byte) (n int, err error) {
+// writeFrame writes b as a gun frame
+func writeFrame(w io.Writer, b []byte) error {
 	protobufHeader := [binary.MaxVarintLen64 + 1]byte{0x0A}
 	varuintSize := binary.PutUvarint(protobufHeader[1:], uint64(len(b)))
 	grpcHeader := make([]byte, 5)
@@ -132,7 +144,12 @@ func (g *Conn) Write(b []byte) (n int, err error) {
 	buf.PutSlice(protobufHeader[:varuintSize+1])
 	buf.PutSlice(b)
 
-	_, err = g.writer.Write(buf.Bytes())
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (g *Conn) Write(b []byte) (n int, err error) {
+	err = writeFrame(g.writer, b)
 	if err == io.ErrClosedPipe && g.err != nil {
 		err = g.err
 	}
@@ -0,0 +1,125 @@
+package gun
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// ServerConn is the stream of a gun request on the server side
+type ServerConn struct {
+	reader *frameReader
+	body   io.Closer
+	writer http.ResponseWriter
+	local  net.Addr
+	remote net.Addr
+
+	mux    sync.Mutex
+	closed bool
+	done   chan struct{}
+
+	// deadlines
+	deadline *time.Timer
+}
+
+// Path returns the path of the requests to the service
+func Path(serviceName string) string {
+	if serviceName == "" {
+		serviceName = "GunService"
+	}
+	return fmt.Sprintf("/%s/Tun", serviceName)
+}
+
+// NewServerConn responds to a gun request, the handler must not return
+// until the stream is closed, see ServerConn.Done
+func NewServerConn(w http.ResponseWriter, r *http.Request) *ServerConn {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status")
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	c := &ServerConn{
+		reader: &frameReader{br: bufio.NewReader(r.Body)},
+		body:   r.Body,
+		writer: w,
+		local:  &net.TCPAddr{IP: net.IPv4zero, Port: 0},
+		remote: &net.TCPAddr{IP: net.IPv4zero, Port: 0},
+		done:   make(chan struct{}),
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		c.local = addr
+	}
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		c.remote = net.TCPAddrFromAddrPort(addrPort)
+	}
+	return c
+}
+
+// Done is closed when the stream is closed
+func (g *ServerConn) Done() <-chan struct{} {
+	return g.done
+}
+
+func (g *ServerConn) Read(b []byte) (int, error) {
+	return g.reader.Read(b)
+}
+
+func (g *ServerConn) Write(b []byte) (int, error) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.closed {
+		return 0, net.ErrClosed
+	}
+
+	if err := writeFrame(g.writer, b); err != nil {
+		return 0, err
+	}
+	if f, ok := g.writer.(http.Flusher); ok {
+		f.Flush()
+	}
+	return len(b), nil
+}
+
+func (g *ServerConn) Close() error {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.closed {
+		return nil
+	}
+
+	g.closed = true
+	g.writer.Header().Set("Grpc-Status", "0")
+	close(g.done)
+	return g.body.Close()
+}
+
+func (g *ServerConn) LocalAddr() net.Addr                { return g.local }
+func (g *ServerConn) RemoteAddr() net.Addr               { return g.remote }
+func (g *ServerConn) SetReadDeadline(t time.Time) error  { return g.SetDeadline(t) }
+func (g *ServerConn) SetWriteDeadline(t time.Time) error { return g.SetDeadline(t) }
+
+func (g *ServerConn) SetDeadline(t time.Time) error {
+	if t.IsZero() {
+		if g.deadline != nil {
+			g.deadline.Stop()
+		}
+		return nil
+	}
+
+	d := time.Until(t)
+	if g.deadline != nil {
+		g.deadline.Reset(d)
+		return nil
+	}
+	g.deadline = time.AfterFunc(d, func() {
+		g.Close()
+	})
+	return nil
+}
@@ -0,0 +1,211 @@
+// Package proxyprotocol implements the PROXY protocol v1 and v2 of HAProxy, which carries the
+// addresses of the client connection through the proxies and the load balancers.
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	// v1MaxLength is the max length of a v1 header including the CRLF
+	v1MaxLength = 107
+
+	v2HeaderLength = 16
+
+	v2Version = 0x20
+	v2Local   = 0x00
+	v2Proxy   = 0x01
+
+	v2FamilyTCP4 = 0x11
+	v2FamilyTCP6 = 0x21
+)
+
+var (
+	v1Signature = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// ErrNoHeader is returned if the connection doesn't start with a PROXY protocol header
+	ErrNoHeader = errors.New("no PROXY protocol header")
+)
+
+// Header is the PROXY protocol header
+type Header struct {
+	Version int
+
+	// Local means the connection is made by the proxy itself, e.g. a health check,
+	// the addresses are unknown and the ones of the connection should be used
+	Local bool
+
+	Source      netip.AddrPort
+	Destination netip.AddrPort
+}
+
+// NewHeader returns the header of the addresses, it's local if the addresses are invalid or
+// in the different families
+func NewHeader(version int, source netip.AddrPort, destination netip.AddrPort) *Header {
+	source = netip.AddrPortFrom(source.Addr().Unmap(), source.Port())
+	destination = netip.AddrPortFrom(destination.Addr().Unmap(), destination.Port())
+	local := !source.IsValid() || !destination.IsValid() || source.Addr().Is4() != destination.Addr().Is4()
+	if local {
+		return &Header{Version: version, Local: true}
+	}
+	return &Header{Version: version, Source: source, Destination: destination}
+}
+
+// Encode returns the header in the wire format of its version
+func (h *Header) Encode() []byte {
+	if h.Version == 1 {
+		if h.Local {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		proto := "TCP4"
+		if h.Source.Addr().Is6() {
+			proto = "TCP6"
+		}
+		return []byte(fmt.Sprintf(
+			"PROXY %s %s %s %d %d\r\n",
+			proto, h.Source.Addr(), h.Destination.Addr(), h.Source.Port(), h.Destination.Port(),
+		))
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, v2HeaderLength+36))
+	buf.Write(v2Signature)
+	if h.Local {
+		buf.Write([]byte{v2Version | v2Local, 0, 0, 0})
+		return buf.Bytes()
+	}
+
+	family := byte(v2FamilyTCP4)
+	if h.Source.Addr().Is6() {
+		family = v2FamilyTCP6
+	}
+	src, dst := h.Source.Addr().AsSlice(), h.Destination.Addr().AsSlice()
+	buf.Write([]byte{v2Version | v2Proxy, family})
+	binary.Write(buf, binary.BigEndian, uint16(len(src)+len(dst)+4))
+	buf.Write(src)
+	buf.Write(dst)
+	binary.Write(buf, binary.BigEndian, h.Source.Port())
+	binary.Write(buf, binary.BigEndian, h.Destination.Port())
+	return buf.Bytes()
+}
+
+// Read reads the header at the start of the reader, ErrNoHeader is returned without consuming
+// anything if there is no header. Only the first bytes of the signatures are waited for, so
+// it doesn't block the protocols in which the client waits for the server first.
+func Read(r *bufio.Reader) (*Header, error) {
+	head, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch head[0] {
+	case v1Signature[0]:
+		return readV1(r)
+	case v2Signature[0]:
+		return readV2(r)
+	default:
+		return nil, ErrNoHeader
+	}
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	if head, err := r.Peek(len(v1Signature)); err != nil || !bytes.Equal(head, v1Signature) {
+		return nil, ErrNoHeader
+	}
+
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) > v1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("invalid PROXY protocol v1 header")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &Header{Version: 1, Local: true}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY protocol v1 header: %q", line)
+	}
+
+	source, err := parseV1Addr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+	destination, err := parseV1Addr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+	return &Header{Version: 1, Source: source, Destination: destination}, nil
+}
+
+func parseV1Addr(ip string, port string, is4 bool) (netip.AddrPort, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() != is4 {
+		return netip.AddrPort{}, fmt.Errorf("invalid PROXY protocol v1 address: %s", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid PROXY protocol v1 port: %s", port)
+	}
+	return netip.AddrPortFrom(addr, uint16(p)), nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	if head, err := r.Peek(len(v2Signature)); err != nil || !bytes.Equal(head, v2Signature) {
+		return nil, ErrNoHeader
+	}
+
+	header := make([]byte, v2HeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]&0xf0 != v2Version {
+		return nil, fmt.Errorf("unsupported PROXY protocol version: %#x", header[12]>>4)
+	}
+
+	// the TLVs following the addresses are skipped
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch header[12] & 0x0f {
+	case v2Local:
+		return &Header{Version: 2, Local: true}, nil
+	case v2Proxy:
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol command: %#x", header[12]&0x0f)
+	}
+
+	var size int
+	switch header[13] {
+	case v2FamilyTCP4:
+		size = 4
+	case v2FamilyTCP6:
+		size = 16
+	default:
+		// the other families, e.g. UDP and unix sockets, carry no usable addresses of TCP
+		return &Header{Version: 2, Local: true}, nil
+	}
+	if len(payload) < size*2+4 {
+		return nil, errors.New("invalid PROXY protocol v2 addresses")
+	}
+
+	src, _ := netip.AddrFromSlice(payload[:size])
+	dst, _ := netip.AddrFromSlice(payload[size : size*2])
+	return &Header{
+		Version:     2,
+		Source:      netip.AddrPortFrom(src, binary.BigEndian.Uint16(payload[size*2:])),
+		Destination: netip.AddrPortFrom(dst, binary.BigEndian.Uint16(payload[size*2+2:])),
+	}, nil
+}
@@ -0,0 +1,105 @@
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeader_RoundTrip(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		for _, header := range []*Header{
+			NewHeader(version, netip.MustParseAddrPort("192.168.1.2:5678"), netip.MustParseAddrPort("10.0.0.1:7890")),
+			NewHeader(version, netip.MustParseAddrPort("[2001:db8::2]:5678"), netip.MustParseAddrPort("[2001:db8::1]:7890")),
+			NewHeader(version, netip.MustParseAddrPort("192.168.1.2:5678"), netip.MustParseAddrPort("[2001:db8::1]:7890")),
+			NewHeader(version, netip.AddrPort{}, netip.MustParseAddrPort("10.0.0.1:7890")),
+		} {
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(header.Encode()), strings.NewReader("GET / HTTP/1.1\r\n")))
+			parsed, err := Read(r)
+			require.NoError(t, err)
+			assert.Equal(t, header, parsed)
+
+			rest, _ := io.ReadAll(r)
+			assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	for _, data := range []string{"\x05\x01\x00", "POST / HTTP/1.1\r\n", "\r\n\r\n\x00\r\nQUIT\x0b"} {
+		r := bufio.NewReader(strings.NewReader(data))
+		_, err := Read(r)
+		assert.ErrorIs(t, err, ErrNoHeader, data)
+
+		rest, _ := io.ReadAll(r)
+		assert.Equal(t, data, string(rest))
+	}
+
+	for _, data := range []string{
+		"PROXY TCP4 192.168.1.2 10.0.0.1 5678\r\n",
+		"PROXY TCP4 2001:db8::2 10.0.0.1 5678 7890\r\n",
+		"PROXY TCP4 192.168.1.2 10.0.0.1 5678 7890\n",
+		"PROXY TCP4 192.168.1.2 10.0.0.1 5678 78900\r\n",
+	} {
+		_, err := Read(bufio.NewReader(strings.NewReader(data)))
+		assert.Error(t, err, data)
+	}
+
+	header, err := Read(bufio.NewReader(strings.NewReader("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n")))
+	require.NoError(t, err)
+	assert.True(t, header.Local)
+}
+
+func TestServer_Handshake(t *testing.T) {
+	handshake := func(server *Server, source string, data []byte) (net.Conn, error) {
+		client, conn := net.Pipe()
+		go func() {
+			client.Write(data)
+			client.Close()
+		}()
+		return server.Handshake(&addrConn{Conn: conn, remote: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(source))})
+	}
+	header := NewHeader(2, netip.MustParseAddrPort("1.2.3.4:5678"), netip.MustParseAddrPort("10.0.0.1:7890")).Encode()
+
+	c, err := handshake(NewServer(ModeAccept, nil), "127.0.0.1:1234", header)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4:5678", c.RemoteAddr().String())
+	assert.Equal(t, "10.0.0.1:7890", c.LocalAddr().String())
+
+	c, err = handshake(NewServer(ModeAccept, nil), "127.0.0.1:1234", []byte{5, 1, 0})
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:1234", c.RemoteAddr().String())
+	data, _ := io.ReadAll(c)
+	assert.Equal(t, []byte{5, 1, 0}, data)
+
+	// the header of an untrusted source is not read
+	c, err = handshake(NewServer(ModeAccept, nil), "192.168.1.2:1234", header)
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.2:1234", c.RemoteAddr().String())
+
+	_, err = handshake(NewServer(ModeRequire, nil), "127.0.0.1:1234", []byte{5, 1, 0})
+	assert.ErrorIs(t, err, ErrNoHeader)
+
+	_, err = handshake(NewServer(ModeRequire, nil), "192.168.1.2:1234", header)
+	assert.Error(t, err)
+
+	c, err = handshake(NewServer(ModeRequire, []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")}), "192.168.1.2:1234", header)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4:5678", c.RemoteAddr().String())
+}
+
+type addrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.remote
+}
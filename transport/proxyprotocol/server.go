@@ -0,0 +1,111 @@
+package proxyprotocol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	N "github.com/Dreamacro/clash/common/net"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+const (
+	// ModeAccept parses the header if it's sent by a trusted source
+	ModeAccept = "accept"
+
+	// ModeRequire requires the header sent by a trusted source
+	ModeRequire = "require"
+)
+
+// defaultTrusted is the trusted sources if none is set, the proxies on the same host
+var defaultTrusted = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+// Server parses the headers of the connections accepted by an inbound
+type Server struct {
+	require bool
+	trusted []netip.Prefix
+}
+
+// NewServer returns the server of the mode, it's nil and accepts the connections as they are
+// if the mode is empty
+func NewServer(mode string, trusted []netip.Prefix) *Server {
+	if mode == "" {
+		return nil
+	}
+	if len(trusted) == 0 {
+		trusted = defaultTrusted
+	}
+	return &Server{require: mode == ModeRequire, trusted: trusted}
+}
+
+// Handshake reads the header of the connection, the returned connection has the addresses in
+// the header. The header of an untrusted source is not read, such connection is rejected in
+// the require mode or returned as it is otherwise.
+func (s *Server) Handshake(c net.Conn) (net.Conn, error) {
+	if s == nil {
+		return c, nil
+	}
+
+	if !s.isTrusted(c.RemoteAddr()) {
+		if s.require {
+			return nil, fmt.Errorf("PROXY protocol from untrusted source %s", c.RemoteAddr())
+		}
+		return c, nil
+	}
+
+	bufConn := N.NewBufferedConn(c)
+	c.SetReadDeadline(time.Now().Add(C.DefaultTCPTimeout))
+	header, err := Read(bufConn.Reader())
+	c.SetReadDeadline(time.Time{})
+	if err != nil {
+		if errors.Is(err, ErrNoHeader) && !s.require {
+			return bufConn, nil
+		}
+		return nil, err
+	}
+
+	if header.Local {
+		return bufConn, nil
+	}
+	return &Conn{
+		BufferedConn: bufConn,
+		remote:       net.TCPAddrFromAddrPort(header.Source),
+		local:        net.TCPAddrFromAddrPort(header.Destination),
+	}, nil
+}
+
+func (s *Server) isTrusted(addr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := addrPort.Addr().Unmap()
+	for _, prefix := range s.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is the connection with the addresses in the header
+type Conn struct {
+	*N.BufferedConn
+	remote net.Addr
+	local  net.Addr
+}
+
+// RemoteAddr returns the source address in the header
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// LocalAddr returns the destination address in the header
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
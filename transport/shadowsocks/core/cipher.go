@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/Dreamacro/clash/transport/shadowsocks/shadowaead"
+	"github.com/Dreamacro/clash/transport/shadowsocks/shadowaead2022"
 	"github.com/Dreamacro/clash/transport/shadowsocks/shadowstream"
 )
 
@@ -72,12 +73,18 @@ func ListCipher() []string {
 	for k := range streamList {
 		l = append(l, k)
 	}
+	l = append(l, shadowaead2022.AES128GCM, shadowaead2022.AES256GCM, shadowaead2022.Chacha20Poly1305)
 	sort.Strings(l)
 	return l
 }
 
 // PickCipher returns a Cipher of the given name. Derive key from password if given key is empty.
 func PickCipher(name string, key []byte, password string) (Cipher, error) {
+	// the password of Shadowsocks 2022 is the base64 encoded keys
+	if shadowaead2022.IsMethod(name) {
+		return shadowaead2022.NewCipher(name, password)
+	}
+
 	name = strings.ToUpper(name)
 
 	switch name {
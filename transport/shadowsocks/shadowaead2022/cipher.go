@@ -0,0 +1,164 @@
+package shadowaead2022
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zeebo/blake3"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	AES128GCM        = "2022-blake3-aes-128-gcm"
+	AES256GCM        = "2022-blake3-aes-256-gcm"
+	Chacha20Poly1305 = "2022-blake3-chacha20-poly1305"
+
+	headerTypeClient = 0
+	headerTypeServer = 1
+
+	// maxTimeDiff is the maximum difference between the timestamp of a header and the local time
+	maxTimeDiff = 30 * time.Second
+
+	maxPayloadSize = 0xFFFF
+	maxPaddingSize = 900
+
+	identityHeaderSize = aes.BlockSize
+)
+
+// now returns the time of the headers, it's fixed by the tests of the reference vectors
+var now = time.Now
+
+var (
+	ErrBadHeader     = errors.New("bad header")
+	ErrBadTimestamp  = errors.New("bad timestamp")
+	ErrReplay        = errors.New("salt or packet replayed")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrShortPacket   = errors.New("short packet")
+	ErrMissingTarget = errors.New("missing target address")
+)
+
+// Method is a Shadowsocks 2022 method
+type Method struct {
+	name    string
+	keySize int
+	newAEAD func(key []byte) (cipher.AEAD, error)
+}
+
+var methods = map[string]*Method{
+	AES128GCM:        {name: AES128GCM, keySize: 16, newAEAD: aesGCM},
+	AES256GCM:        {name: AES256GCM, keySize: 32, newAEAD: aesGCM},
+	Chacha20Poly1305: {name: Chacha20Poly1305, keySize: 32, newAEAD: chacha20poly1305.New},
+}
+
+// IsMethod returns if name is a Shadowsocks 2022 method
+func IsMethod(name string) bool {
+	_, ok := methods[strings.ToLower(name)]
+	return ok
+}
+
+// MethodByName returns the Shadowsocks 2022 method of name
+func MethodByName(name string) (*Method, error) {
+	if m, ok := methods[strings.ToLower(name)]; ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported method %s", name)
+}
+
+// Name returns the name of the method
+func (m *Method) Name() string { return m.name }
+
+// MultiUser returns if the method supports the extensible identity headers
+func (m *Method) MultiUser() bool { return m.name != Chacha20Poly1305 }
+
+// ParseKey decodes a base64 encoded pre-shared key
+func (m *Method) ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+	if len(key) != m.keySize {
+		return nil, fmt.Errorf("key size error: need %d bytes", m.keySize)
+	}
+	return key, nil
+}
+
+// ParsePassword decodes the pre-shared keys of a client separated by ":",
+// the leading ones are the identity keys of the servers and the last one is the user key
+func (m *Method) ParsePassword(password string) ([][]byte, error) {
+	parts := strings.Split(password, ":")
+	if len(parts) > 1 && !m.MultiUser() {
+		return nil, fmt.Errorf("%s doesn't support multiple users", m.name)
+	}
+
+	keys := make([][]byte, 0, len(parts))
+	for _, part := range parts {
+		key, err := m.ParseKey(part)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (m *Method) sessionAEAD(key, salt []byte) (cipher.AEAD, error) {
+	return m.newAEAD(deriveKey("shadowsocks 2022 session subkey", key, salt))
+}
+
+// udpAEAD returns the AEAD of the packets of chacha20-poly1305,
+// which are sealed with the pre-shared key directly
+func (m *Method) udpAEAD(key []byte) (cipher.AEAD, error) {
+	return chacha20poly1305.NewX(key)
+}
+
+func deriveKey(context string, key, salt []byte) []byte {
+	material := make([]byte, 0, len(key)+len(salt))
+	material = append(material, key...)
+	material = append(material, salt...)
+
+	subkey := make([]byte, len(key))
+	blake3.DeriveKey(context, material, subkey)
+	return subkey
+}
+
+// identityCipher returns the block cipher of the identity header of a stream
+func identityCipher(key, salt []byte) (cipher.Block, error) {
+	return aes.NewCipher(deriveKey("shadowsocks 2022 identity subkey", key, salt))
+}
+
+// keyHash returns the hash of a user key carried in the identity headers
+func keyHash(key []byte) (hash [identityHeaderSize]byte) {
+	sum := blake3.Sum256(key)
+	copy(hash[:], sum[:])
+	return
+}
+
+func aesGCM(key []byte) (cipher.AEAD, error) {
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(blk)
+}
+
+func checkTimestamp(ts uint64) error {
+	diff := now().Sub(time.Unix(int64(ts), 0))
+	if diff > maxTimeDiff || diff < -maxTimeDiff {
+		return ErrBadTimestamp
+	}
+	return nil
+}
+
+func increment(b []byte) {
+	for i := range b {
+		b[i]++
+		if b[i] != 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package shadowaead2022
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/Dreamacro/clash/transport/socks5"
+
+	"go.uber.org/atomic"
+)
+
+// Cipher is the client side of Shadowsocks 2022
+type Cipher struct {
+	method *Method
+	keys   [][]byte
+}
+
+// NewCipher returns a client with the pre-shared keys in password
+func NewCipher(method, password string) (*Cipher, error) {
+	m, err := MethodByName(method)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := m.ParsePassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{method: m, keys: keys}, nil
+}
+
+// StreamConn wraps a stream, the first write must start with the target address
+func (c *Cipher) StreamConn(conn net.Conn) net.Conn {
+	return &clientConn{Conn: conn, method: c.method, keys: c.keys}
+}
+
+// PacketConn wraps a packet conn, the packets start with the target or the source address
+func (c *Cipher) PacketConn(pc net.PacketConn) net.PacketConn {
+	conn := &packetConn{PacketConn: pc, cipher: c, packetID: atomic.NewUint64(0)}
+	var id [8]byte
+	rand.Read(id[:])
+	conn.sessionID = binary.BigEndian.Uint64(id[:])
+	return conn
+}
+
+type packetConn struct {
+	net.PacketConn
+	cipher    *Cipher
+	sessionID uint64
+	packetID  *atomic.Uint64
+
+	initOnce   sync.Once
+	initErr    error
+	blocks     []cipher.Block
+	udpAEAD    cipher.AEAD
+	clientAEAD cipher.AEAD
+
+	mux             sync.Mutex
+	serverSessionID uint64
+	serverAEAD      cipher.AEAD
+	window          *slidingWindow
+}
+
+func (c *packetConn) init() error {
+	c.initOnce.Do(func() {
+		m, keys := c.cipher.method, c.cipher.keys
+		if !m.MultiUser() {
+			c.udpAEAD, c.initErr = m.udpAEAD(keys[0])
+			return
+		}
+
+		for _, key := range keys {
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				c.initErr = err
+				return
+			}
+			c.blocks = append(c.blocks, block)
+		}
+
+		var id [8]byte
+		binary.BigEndian.PutUint64(id[:], c.sessionID)
+		c.clientAEAD, c.initErr = m.sessionAEAD(keys[len(keys)-1], id[:])
+	})
+	return c.initErr
+}
+
+// WriteTo encrypts b, which starts with the target address
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if err := c.init(); err != nil {
+		return 0, err
+	}
+
+	target := socks5.SplitAddr(b)
+	if target == nil {
+		return 0, ErrMissingTarget
+	}
+	payload := b[len(target):]
+
+	var header [packetHeaderSize]byte
+	binary.BigEndian.PutUint64(header[:8], c.sessionID)
+	binary.BigEndian.PutUint64(header[8:], c.packetID.Inc()-1)
+	size := bodySize(headerTypeClient, target, payload)
+
+	if c.udpAEAD != nil {
+		buf := make([]byte, udpNonceSize, udpNonceSize+packetHeaderSize+size+c.udpAEAD.Overhead())
+		if _, err := rand.Read(buf); err != nil {
+			return 0, err
+		}
+		buf = append(buf, header[:]...)
+		buf = appendBody(buf, headerTypeClient, 0, target, payload)
+		sealed := c.udpAEAD.Seal(buf[udpNonceSize:udpNonceSize], buf[:udpNonceSize], buf[udpNonceSize:], nil)
+		_, err := c.PacketConn.WriteTo(buf[:udpNonceSize+len(sealed)], addr)
+		return len(b), err
+	}
+
+	prefix := packetHeaderSize + identityHeaderSize*(len(c.blocks)-1)
+	buf := make([]byte, prefix, prefix+size+c.clientAEAD.Overhead())
+	buf = appendBody(buf, headerTypeClient, 0, target, payload)
+	sealed := c.clientAEAD.Seal(buf[prefix:prefix], header[4:], buf[prefix:], nil)
+
+	for i := 0; i < len(c.blocks)-1; i++ {
+		hash := keyHash(c.cipher.keys[i+1])
+		subtle.XORBytes(hash[:], hash[:], header[:])
+		eih := buf[packetHeaderSize+identityHeaderSize*i:]
+		c.blocks[i].Encrypt(eih[:identityHeaderSize], hash[:])
+	}
+	c.blocks[0].Encrypt(buf[:packetHeaderSize], header[:])
+
+	_, err := c.PacketConn.WriteTo(buf[:prefix+len(sealed)], addr)
+	return len(b), err
+}
+
+// ReadFrom decrypts a packet into b, which starts with the source address
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if err := c.init(); err != nil {
+		return 0, nil, err
+	}
+
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var header [packetHeaderSize]byte
+	var body []byte
+	var aead cipher.AEAD
+	if c.udpAEAD != nil {
+		if n < udpNonceSize+packetHeaderSize+c.udpAEAD.Overhead() {
+			return 0, nil, ErrShortPacket
+		}
+		plaintext, err := c.udpAEAD.Open(b[udpNonceSize:udpNonceSize], b[:udpNonceSize], b[udpNonceSize:n], nil)
+		if err != nil {
+			return 0, nil, err
+		}
+		copy(header[:], plaintext)
+		body = plaintext[packetHeaderSize:]
+	} else {
+		if n < packetHeaderSize {
+			return 0, nil, ErrShortPacket
+		}
+		c.blocks[len(c.blocks)-1].Decrypt(header[:], b[:packetHeaderSize])
+		if aead, err = c.serverSession(binary.BigEndian.Uint64(header[:8])); err != nil {
+			return 0, nil, err
+		}
+		if body, err = aead.Open(b[packetHeaderSize:packetHeaderSize], header[4:], b[packetHeaderSize:n], nil); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	clientSessionID, target, payload, err := parseBody(body, headerTypeServer)
+	if err != nil {
+		return 0, nil, err
+	}
+	if clientSessionID != c.sessionID {
+		return 0, nil, ErrBadHeader
+	}
+	if !c.checkPacketID(binary.BigEndian.Uint64(header[:8]), binary.BigEndian.Uint64(header[8:]), aead) {
+		return 0, nil, ErrReplay
+	}
+
+	copy(b, target)
+	copy(b[len(target):], payload)
+	return len(target) + len(payload), addr, nil
+}
+
+// serverSession returns the AEAD of the server session id
+func (c *packetConn) serverSession(id uint64) (cipher.AEAD, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.serverAEAD != nil && c.serverSessionID == id {
+		return c.serverAEAD, nil
+	}
+
+	var salt [8]byte
+	binary.BigEndian.PutUint64(salt[:], id)
+	return c.cipher.method.sessionAEAD(c.cipher.keys[len(c.cipher.keys)-1], salt[:])
+}
+
+// checkPacketID switches to the server session of the authenticated packet and checks the packet id
+func (c *packetConn) checkPacketID(serverSessionID, packetID uint64, aead cipher.AEAD) bool {
+	c.mux.Lock()
+	if c.window == nil || c.serverSessionID != serverSessionID {
+		c.serverSessionID = serverSessionID
+		c.serverAEAD = aead
+		c.window = &slidingWindow{}
+	}
+	window := c.window
+	c.mux.Unlock()
+
+	return window.Check(packetID)
+}
@@ -0,0 +1,85 @@
+package shadowaead2022
+
+import (
+	"sync"
+	"time"
+)
+
+// saltTTL is how long the salts are remembered, it's twice the allowed time difference
+const saltTTL = 2 * maxTimeDiff
+
+// saltFilter rejects the salts seen in the last minute
+type saltFilter struct {
+	mux   sync.Mutex
+	salts map[string]time.Time
+	purge time.Time
+}
+
+func newSaltFilter() *saltFilter {
+	return &saltFilter{salts: map[string]time.Time{}}
+}
+
+// Check records salt and returns false if it was seen before
+func (f *saltFilter) Check(salt []byte) bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	now := time.Now()
+	if now.Sub(f.purge) > saltTTL {
+		for s, t := range f.salts {
+			if now.Sub(t) > saltTTL {
+				delete(f.salts, s)
+			}
+		}
+		f.purge = now
+	}
+
+	if t, ok := f.salts[string(salt)]; ok && now.Sub(t) <= saltTTL {
+		return false
+	}
+	f.salts[string(salt)] = now
+	return true
+}
+
+const (
+	blockBits  = 64
+	ringBlocks = 32
+	windowSize = (ringBlocks - 1) * blockBits
+)
+
+// slidingWindow rejects the replayed and too old packet ids, it's the anti-replay
+// algorithm of RFC 6479
+type slidingWindow struct {
+	mux  sync.Mutex
+	last uint64
+	ring [ringBlocks]uint64
+}
+
+// Check records id and returns false if it was seen before or is out of the window
+func (w *slidingWindow) Check(id uint64) bool {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	block := id / blockBits
+	if id > w.last {
+		current := w.last / blockBits
+		diff := block - current
+		if diff > ringBlocks {
+			diff = ringBlocks
+		}
+		for i := current + 1; i <= current+diff; i++ {
+			w.ring[i%ringBlocks] = 0
+		}
+		w.last = id
+	} else if w.last-id > windowSize {
+		return false
+	}
+
+	index := block % ringBlocks
+	bit := uint64(1) << (id % blockBits)
+	if w.ring[index]&bit != 0 {
+		return false
+	}
+	w.ring[index] |= bit
+	return true
+}
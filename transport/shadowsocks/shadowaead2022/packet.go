@@ -0,0 +1,68 @@
+package shadowaead2022
+
+import (
+	"encoding/binary"
+
+	"github.com/Dreamacro/clash/transport/socks5"
+)
+
+const (
+	// packetHeaderSize is the size of the session id and the packet id
+	packetHeaderSize = 16
+	// udpNonceSize is the nonce size of the XChaCha20-Poly1305 packets
+	udpNonceSize = 24
+)
+
+// bodySize returns the size of the plaintext body of a packet without padding
+func bodySize(headerType byte, target, payload []byte) int {
+	size := 1 + 8 + 2 + len(target) + len(payload)
+	if headerType == headerTypeServer {
+		size += 8
+	}
+	return size
+}
+
+// appendBody appends the plaintext body of a packet without padding
+func appendBody(dst []byte, headerType byte, clientSessionID uint64, target, payload []byte) []byte {
+	dst = append(dst, headerType)
+	dst = binary.BigEndian.AppendUint64(dst, uint64(now().Unix()))
+	if headerType == headerTypeServer {
+		dst = binary.BigEndian.AppendUint64(dst, clientSessionID)
+	}
+	dst = binary.BigEndian.AppendUint16(dst, 0)
+	dst = append(dst, target...)
+	return append(dst, payload...)
+}
+
+// parseBody parses the plaintext body of a packet, the client session id is only carried by the server packets
+func parseBody(b []byte, headerType byte) (clientSessionID uint64, target socks5.Addr, payload []byte, err error) {
+	size := 1 + 8
+	if headerType == headerTypeServer {
+		size += 8
+	}
+	if len(b) < size+2 {
+		return 0, nil, nil, ErrShortPacket
+	}
+	if b[0] != headerType {
+		return 0, nil, nil, ErrBadHeader
+	}
+	if err = checkTimestamp(binary.BigEndian.Uint64(b[1:9])); err != nil {
+		return
+	}
+	if headerType == headerTypeServer {
+		clientSessionID = binary.BigEndian.Uint64(b[9:17])
+	}
+
+	b = b[size:]
+	padding := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < padding {
+		return 0, nil, nil, ErrShortPacket
+	}
+	b = b[padding:]
+
+	if target = socks5.SplitAddr(b); target == nil {
+		return 0, nil, nil, ErrMissingTarget
+	}
+	return clientSessionID, target, b[len(target):], nil
+}
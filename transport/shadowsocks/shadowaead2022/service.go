@@ -0,0 +1,322 @@
+package shadowaead2022
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/Dreamacro/clash/common/cache"
+	"github.com/Dreamacro/clash/transport/socks5"
+
+	"go.uber.org/atomic"
+)
+
+// sessionTimeout is how long the idle UDP sessions are kept, in seconds
+const sessionTimeout = 300
+
+// User is a user of a multi-user server
+type User struct {
+	Name string
+	// Key is the base64 encoded pre-shared key of the user
+	Key string
+}
+
+type user struct {
+	name  string
+	key   []byte
+	block cipher.Block
+}
+
+// Service is the server side of Shadowsocks 2022
+type Service struct {
+	method   *Method
+	key      []byte
+	block    cipher.Block
+	udpAEAD  cipher.AEAD
+	users    map[[identityHeaderSize]byte]*user
+	salts    *saltFilter
+	sessions *cache.LruCache
+}
+
+// NewService returns a server with the base64 encoded pre-shared key,
+// the users are identified by the identity headers if any
+func NewService(method string, key string, users []User) (*Service, error) {
+	m, err := MethodByName(method)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) != 0 && !m.MultiUser() {
+		return nil, fmt.Errorf("%s doesn't support multiple users", m.name)
+	}
+
+	s := &Service{
+		method:   m,
+		users:    map[[identityHeaderSize]byte]*user{},
+		salts:    newSaltFilter(),
+		sessions: cache.New(cache.WithAge(sessionTimeout), cache.WithUpdateAgeOnGet()),
+	}
+	if s.key, err = m.ParseKey(key); err != nil {
+		return nil, err
+	}
+	if m.MultiUser() {
+		s.block, err = aes.NewCipher(s.key)
+	} else {
+		s.udpAEAD, err = m.udpAEAD(s.key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		key, err := m.ParseKey(u.Key)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Name, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		s.users[keyHash(key)] = &user{name: u.Name, key: key, block: block}
+	}
+	return s, nil
+}
+
+// NewConn reads the request header of an accepted stream,
+// it returns the stream with the target address and the name of the user
+func (s *Service) NewConn(conn net.Conn) (net.Conn, socks5.Addr, string, error) {
+	salt := make([]byte, s.method.keySize)
+	if _, err := io.ReadFull(conn, salt); err != nil {
+		return nil, nil, "", err
+	}
+
+	key, name := s.key, ""
+	if len(s.users) != 0 {
+		var hash [identityHeaderSize]byte
+		if _, err := io.ReadFull(conn, hash[:]); err != nil {
+			return nil, nil, "", err
+		}
+		block, err := identityCipher(s.key, salt)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		block.Decrypt(hash[:], hash[:])
+
+		u, ok := s.users[hash]
+		if !ok {
+			return nil, nil, "", ErrUserNotFound
+		}
+		key, name = u.key, u.name
+	}
+
+	aead, err := s.method.sessionAEAD(key, salt)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	r := newChunkReader(conn, aead)
+
+	fixed, err := r.open(1 + 8 + 2)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if fixed[0] != headerTypeClient {
+		return nil, nil, "", ErrBadHeader
+	}
+	if err := checkTimestamp(binary.BigEndian.Uint64(fixed[1:9])); err != nil {
+		return nil, nil, "", err
+	}
+	if !s.salts.Check(salt) {
+		return nil, nil, "", ErrReplay
+	}
+
+	variable, err := r.open(int(binary.BigEndian.Uint16(fixed[9:])))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	target := socks5.SplitAddr(variable)
+	if target == nil {
+		return nil, nil, "", ErrMissingTarget
+	}
+	rest := variable[len(target):]
+	if len(rest) < 2 || len(rest)-2 < int(binary.BigEndian.Uint16(rest)) {
+		return nil, nil, "", ErrBadHeader
+	}
+	r.left = rest[2+int(binary.BigEndian.Uint16(rest)):]
+
+	c := &serverConn{
+		Conn:        conn,
+		method:      s.method,
+		key:         key,
+		requestSalt: salt,
+		r:           r,
+	}
+	// the address is overwritten by the next reads
+	return c, append(socks5.Addr{}, target...), name, nil
+}
+
+// PacketSession is a UDP session of a client
+type PacketSession struct {
+	service         *Service
+	user            *user
+	clientSessionID uint64
+	serverSessionID uint64
+	packetID        *atomic.Uint64
+	window          slidingWindow
+	clientAEAD      cipher.AEAD
+	serverAEAD      cipher.AEAD
+}
+
+// User returns the name of the user of the session
+func (s *PacketSession) User() string {
+	if s.user == nil {
+		return ""
+	}
+	return s.user.name
+}
+
+// UnpackPacket decrypts a packet in place, it returns the session of the client
+// with the target address and the payload
+func (s *Service) UnpackPacket(pkt []byte) (*PacketSession, socks5.Addr, []byte, error) {
+	if !s.method.MultiUser() {
+		return s.unpackChacha(pkt)
+	}
+
+	if len(pkt) < packetHeaderSize {
+		return nil, nil, nil, ErrShortPacket
+	}
+	var header [packetHeaderSize]byte
+	s.block.Decrypt(header[:], pkt[:packetHeaderSize])
+	body := pkt[packetHeaderSize:]
+
+	var u *user
+	if len(s.users) != 0 {
+		if len(body) < identityHeaderSize {
+			return nil, nil, nil, ErrShortPacket
+		}
+		var hash [identityHeaderSize]byte
+		s.block.Decrypt(hash[:], body[:identityHeaderSize])
+		subtle.XORBytes(hash[:], hash[:], header[:])
+
+		var ok bool
+		if u, ok = s.users[hash]; !ok {
+			return nil, nil, nil, ErrUserNotFound
+		}
+		body = body[identityHeaderSize:]
+	}
+
+	session, err := s.session(binary.BigEndian.Uint64(header[:8]), u)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	plaintext, err := session.clientAEAD.Open(body[:0], header[4:], body, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return s.accept(session, binary.BigEndian.Uint64(header[8:]), plaintext)
+}
+
+func (s *Service) unpackChacha(pkt []byte) (*PacketSession, socks5.Addr, []byte, error) {
+	if len(pkt) < udpNonceSize+packetHeaderSize+s.udpAEAD.Overhead() {
+		return nil, nil, nil, ErrShortPacket
+	}
+	plaintext, err := s.udpAEAD.Open(pkt[udpNonceSize:udpNonceSize], pkt[:udpNonceSize], pkt[udpNonceSize:], nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	session, err := s.session(binary.BigEndian.Uint64(plaintext[:8]), nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return s.accept(session, binary.BigEndian.Uint64(plaintext[8:packetHeaderSize]), plaintext[packetHeaderSize:])
+}
+
+// accept checks the packet id and parses the body of an authenticated packet
+func (s *Service) accept(session *PacketSession, packetID uint64, body []byte) (*PacketSession, socks5.Addr, []byte, error) {
+	_, target, payload, err := parseBody(body, headerTypeClient)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !session.window.Check(packetID) {
+		return nil, nil, nil, ErrReplay
+	}
+
+	s.sessions.Set(session.clientSessionID, session)
+	return session, target, payload, nil
+}
+
+// session returns the session of the client session id, the session is created
+// if it doesn't exist or belongs to another user
+func (s *Service) session(clientSessionID uint64, u *user) (*PacketSession, error) {
+	if elm, ok := s.sessions.Get(clientSessionID); ok {
+		if session := elm.(*PacketSession); session.user == u {
+			return session, nil
+		}
+	}
+
+	session := &PacketSession{
+		service:         s,
+		user:            u,
+		clientSessionID: clientSessionID,
+		packetID:        atomic.NewUint64(0),
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	session.serverSessionID = binary.BigEndian.Uint64(id[:])
+
+	if s.method.MultiUser() {
+		key := s.key
+		if u != nil {
+			key = u.key
+		}
+
+		var err error
+		binary.BigEndian.PutUint64(id[:], clientSessionID)
+		if session.clientAEAD, err = s.method.sessionAEAD(key, id[:]); err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint64(id[:], session.serverSessionID)
+		if session.serverAEAD, err = s.method.sessionAEAD(key, id[:]); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// Pack encrypts a packet to the client with the source address
+func (s *PacketSession) Pack(source socks5.Addr, payload []byte) ([]byte, error) {
+	var header [packetHeaderSize]byte
+	binary.BigEndian.PutUint64(header[:8], s.serverSessionID)
+	binary.BigEndian.PutUint64(header[8:], s.packetID.Inc()-1)
+	size := bodySize(headerTypeServer, source, payload)
+
+	if !s.service.method.MultiUser() {
+		aead := s.service.udpAEAD
+		buf := make([]byte, udpNonceSize, udpNonceSize+packetHeaderSize+size+aead.Overhead())
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		buf = append(buf, header[:]...)
+		buf = appendBody(buf, headerTypeServer, s.clientSessionID, source, payload)
+		sealed := aead.Seal(buf[udpNonceSize:udpNonceSize], buf[:udpNonceSize], buf[udpNonceSize:], nil)
+		return buf[:udpNonceSize+len(sealed)], nil
+	}
+
+	buf := make([]byte, packetHeaderSize, packetHeaderSize+size+s.serverAEAD.Overhead())
+	buf = appendBody(buf, headerTypeServer, s.clientSessionID, source, payload)
+	sealed := s.serverAEAD.Seal(buf[packetHeaderSize:packetHeaderSize], header[4:], buf[packetHeaderSize:], nil)
+
+	// the responses of a user are encrypted with the key of the user
+	block := s.service.block
+	if s.user != nil {
+		block = s.user.block
+	}
+	block.Encrypt(buf[:packetHeaderSize], header[:])
+	return buf[:packetHeaderSize+len(sealed)], nil
+}
@@ -0,0 +1,189 @@
+package shadowaead2022
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/Dreamacro/clash/transport/socks5"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(size int) string {
+	key := make([]byte, size)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func streamRoundTrip(t *testing.T, s *Service, c *Cipher) string {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	target := socks5.ParseAddr("example.com:443")
+	go func() {
+		conn := c.StreamConn(client)
+		conn.Write(append(append([]byte{}, target...), "hello"...))
+
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(conn, buf); err == nil {
+			conn.Write(buf)
+		}
+	}()
+
+	conn, addr, user, err := s.NewConn(server)
+	require.NoError(t, err)
+	assert.Equal(t, target, addr)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	_, err = conn.Write([]byte("world"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(buf))
+	return user
+}
+
+func TestShadowAEAD2022_Stream(t *testing.T) {
+	for _, method := range []string{AES128GCM, AES256GCM, Chacha20Poly1305} {
+		m, _ := MethodByName(method)
+		key := newKey(m.keySize)
+
+		s, err := NewService(method, key, nil)
+		require.NoError(t, err)
+		c, err := NewCipher(method, key)
+		require.NoError(t, err)
+
+		assert.Equal(t, "", streamRoundTrip(t, s, c), method)
+	}
+}
+
+func TestShadowAEAD2022_MultiUser(t *testing.T) {
+	serverKey, aliceKey, bobKey := newKey(16), newKey(16), newKey(16)
+	s, err := NewService(AES128GCM, serverKey, []User{{Name: "alice", Key: aliceKey}, {Name: "bob", Key: bobKey}})
+	require.NoError(t, err)
+
+	c, err := NewCipher(AES128GCM, serverKey+":"+bobKey)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", streamRoundTrip(t, s, c))
+
+	// unknown user
+	c, err = NewCipher(AES128GCM, serverKey+":"+newKey(16))
+	require.NoError(t, err)
+	client, server := net.Pipe()
+	defer client.Close()
+	go c.StreamConn(client).Write(socks5.ParseAddr("example.com:443"))
+	_, _, _, err = s.NewConn(server)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	_, err = NewService(Chacha20Poly1305, newKey(32), []User{{Name: "alice", Key: newKey(32)}})
+	assert.Error(t, err)
+}
+
+func TestShadowAEAD2022_Replay(t *testing.T) {
+	key := newKey(16)
+	s, err := NewService(AES128GCM, key, nil)
+	require.NoError(t, err)
+	c, err := NewCipher(AES128GCM, key)
+	require.NoError(t, err)
+
+	// record the request of a client
+	client, server := net.Pipe()
+	go func() {
+		c.StreamConn(client).Write(socks5.ParseAddr("example.com:443"))
+		client.Close()
+	}()
+	request, err := io.ReadAll(server)
+	require.NoError(t, err)
+
+	for i, expected := range []error{nil, ErrReplay} {
+		client, server := net.Pipe()
+		go func() {
+			client.Write(request)
+			client.Close()
+		}()
+		_, _, _, err = s.NewConn(server)
+		if expected == nil {
+			assert.NoError(t, err, i)
+		} else {
+			assert.ErrorIs(t, err, expected, i)
+		}
+	}
+}
+
+func TestShadowAEAD2022_Packet(t *testing.T) {
+	for _, method := range []string{AES128GCM, Chacha20Poly1305} {
+		m, _ := MethodByName(method)
+		serverKey, userKey := newKey(m.keySize), newKey(m.keySize)
+
+		var users []User
+		password := serverKey
+		if m.MultiUser() {
+			users = []User{{Name: "alice", Key: userKey}}
+			password += ":" + userKey
+		}
+		s, err := NewService(method, serverKey, users)
+		require.NoError(t, err)
+		c, err := NewCipher(method, password)
+		require.NoError(t, err)
+
+		serverConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer serverConn.Close()
+		rawConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		clientConn := c.PacketConn(rawConn)
+		defer clientConn.Close()
+
+		target := socks5.ParseAddr("1.1.1.1:53")
+		_, err = clientConn.WriteTo(append(append([]byte{}, target...), "query"...), serverConn.LocalAddr())
+		require.NoError(t, err)
+
+		buf := make([]byte, 2048)
+		n, addr, err := serverConn.ReadFrom(buf)
+		require.NoError(t, err)
+		pkt := append([]byte{}, buf[:n]...)
+
+		session, addr2, payload, err := s.UnpackPacket(buf[:n])
+		require.NoError(t, err, method)
+		assert.Equal(t, target, addr2)
+		assert.Equal(t, "query", string(payload))
+		if m.MultiUser() {
+			assert.Equal(t, "alice", session.User())
+		}
+
+		// the replayed packet is rejected
+		_, _, _, err = s.UnpackPacket(pkt)
+		assert.ErrorIs(t, err, ErrReplay)
+
+		resp, err := session.Pack(target, []byte("answer"))
+		require.NoError(t, err)
+		_, err = serverConn.WriteTo(resp, addr)
+		require.NoError(t, err)
+
+		n, _, err = clientConn.ReadFrom(buf)
+		require.NoError(t, err)
+		source := socks5.SplitAddr(buf[:n])
+		assert.Equal(t, target, source)
+		assert.Equal(t, "answer", string(buf[len(source):n]))
+	}
+}
+
+func TestShadowAEAD2022_SlidingWindow(t *testing.T) {
+	w := &slidingWindow{}
+	assert.True(t, w.Check(0))
+	assert.False(t, w.Check(0))
+	assert.True(t, w.Check(10))
+	assert.True(t, w.Check(5))
+	assert.True(t, w.Check(windowSize+100))
+	assert.False(t, w.Check(5))
+	assert.True(t, w.Check(windowSize+99))
+}
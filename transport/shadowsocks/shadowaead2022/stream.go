@@ -0,0 +1,263 @@
+package shadowaead2022
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	mathRand "math/rand"
+	"net"
+
+	"github.com/Dreamacro/clash/transport/socks5"
+)
+
+// chunkReader decrypts the length-prefixed chunks of a stream
+type chunkReader struct {
+	io.Reader
+	aead  cipher.AEAD
+	nonce []byte
+	buf   []byte
+	left  []byte // decrypted payload not read yet
+}
+
+func newChunkReader(r io.Reader, aead cipher.AEAD) *chunkReader {
+	return &chunkReader{
+		Reader: r,
+		aead:   aead,
+		nonce:  make([]byte, aead.NonceSize()),
+		buf:    make([]byte, maxPayloadSize+aead.Overhead()),
+	}
+}
+
+// open reads and decrypts a record with size bytes of plaintext,
+// the result is valid until the next call
+func (r *chunkReader) open(size int) ([]byte, error) {
+	buf := r.buf[:size+r.aead.Overhead()]
+	if _, err := io.ReadFull(r.Reader, buf); err != nil {
+		return nil, err
+	}
+	b, err := r.aead.Open(buf[:0], r.nonce, buf, nil)
+	increment(r.nonce)
+	return b, err
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.left) == 0 {
+		b, err := r.open(2)
+		if err != nil {
+			return 0, err
+		}
+		if r.left, err = r.open(int(binary.BigEndian.Uint16(b))); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.left)
+	r.left = r.left[n:]
+	return n, nil
+}
+
+// chunkWriter encrypts the writes into length-prefixed chunks
+type chunkWriter struct {
+	io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+	buf   []byte
+}
+
+func newChunkWriter(w io.Writer, aead cipher.AEAD) *chunkWriter {
+	return &chunkWriter{Writer: w, aead: aead, nonce: make([]byte, aead.NonceSize())}
+}
+
+// seal appends the record of plaintext to dst
+func (w *chunkWriter) seal(dst, plaintext []byte) []byte {
+	dst = w.aead.Seal(dst, w.nonce, plaintext, nil)
+	increment(w.nonce)
+	return dst
+}
+
+func (w *chunkWriter) Write(p []byte) (n int, err error) {
+	var size [2]byte
+	for n < len(p) {
+		chunk := p[n:min(n+maxPayloadSize, len(p))]
+		binary.BigEndian.PutUint16(size[:], uint16(len(chunk)))
+		w.buf = w.seal(w.buf[:0], size[:])
+		w.buf = w.seal(w.buf, chunk)
+		if _, err = w.Writer.Write(w.buf); err != nil {
+			return
+		}
+		n += len(chunk)
+	}
+	return
+}
+
+// clientConn is the stream of a client, the first write must start with the target address
+type clientConn struct {
+	net.Conn
+	method *Method
+	keys   [][]byte
+	salt   []byte
+	r      *chunkReader
+	w      *chunkWriter
+}
+
+func (c *clientConn) Write(p []byte) (int, error) {
+	if c.w != nil {
+		return c.w.Write(p)
+	}
+
+	target := socks5.SplitAddr(p)
+	if target == nil {
+		return 0, ErrMissingTarget
+	}
+	payload := p[len(target):]
+
+	salt := make([]byte, c.method.keySize)
+	if _, err := rand.Read(salt); err != nil {
+		return 0, err
+	}
+	aead, err := c.method.sessionAEAD(c.keys[len(c.keys)-1], salt)
+	if err != nil {
+		return 0, err
+	}
+	w := newChunkWriter(c.Conn, aead)
+
+	buf := append([]byte{}, salt...)
+	for i := 0; i < len(c.keys)-1; i++ {
+		block, err := identityCipher(c.keys[i], salt)
+		if err != nil {
+			return 0, err
+		}
+		hash := keyHash(c.keys[i+1])
+		block.Encrypt(hash[:], hash[:])
+		buf = append(buf, hash[:]...)
+	}
+
+	// the request without payload is padded
+	padding := 0
+	if len(payload) == 0 {
+		padding = 1 + mathRand.Intn(maxPaddingSize)
+	}
+	first := payload[:min(len(payload), maxPayloadSize-len(target)-2)]
+
+	variable := make([]byte, 0, len(target)+2+padding+len(first))
+	variable = append(variable, target...)
+	variable = binary.BigEndian.AppendUint16(variable, uint16(padding))
+	variable = append(variable, make([]byte, padding)...)
+	variable = append(variable, first...)
+
+	fixed := []byte{headerTypeClient}
+	fixed = binary.BigEndian.AppendUint64(fixed, uint64(now().Unix()))
+	fixed = binary.BigEndian.AppendUint16(fixed, uint16(len(variable)))
+
+	buf = w.seal(buf, fixed)
+	buf = w.seal(buf, variable)
+	if _, err := c.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	c.salt = salt
+	c.w = w
+
+	if rest := payload[len(first):]; len(rest) != 0 {
+		n, err := w.Write(rest)
+		return len(p) - len(rest) + n, err
+	}
+	return len(p), nil
+}
+
+func (c *clientConn) Read(p []byte) (int, error) {
+	if c.r == nil {
+		if err := c.readResponse(); err != nil {
+			return 0, err
+		}
+	}
+	return c.r.Read(p)
+}
+
+// readResponse reads the header of the response and its first chunk
+func (c *clientConn) readResponse() error {
+	if c.salt == nil {
+		return ErrMissingTarget
+	}
+
+	salt := make([]byte, c.method.keySize)
+	if _, err := io.ReadFull(c.Conn, salt); err != nil {
+		return err
+	}
+	aead, err := c.method.sessionAEAD(c.keys[len(c.keys)-1], salt)
+	if err != nil {
+		return err
+	}
+	r := newChunkReader(c.Conn, aead)
+
+	fixed, err := r.open(1 + 8 + len(c.salt) + 2)
+	if err != nil {
+		return err
+	}
+	if fixed[0] != headerTypeServer || !bytes.Equal(fixed[9:9+len(c.salt)], c.salt) {
+		return ErrBadHeader
+	}
+	if err := checkTimestamp(binary.BigEndian.Uint64(fixed[1:9])); err != nil {
+		return err
+	}
+
+	if r.left, err = r.open(int(binary.BigEndian.Uint16(fixed[9+len(c.salt):]))); err != nil {
+		return err
+	}
+	c.r = r
+	return nil
+}
+
+// serverConn is an accepted stream with the request header read
+type serverConn struct {
+	net.Conn
+	method      *Method
+	key         []byte
+	requestSalt []byte
+	r           *chunkReader
+	w           *chunkWriter
+}
+
+func (c *serverConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *serverConn) Write(p []byte) (int, error) {
+	if c.w != nil {
+		return c.w.Write(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	salt := make([]byte, c.method.keySize)
+	if _, err := rand.Read(salt); err != nil {
+		return 0, err
+	}
+	aead, err := c.method.sessionAEAD(c.key, salt)
+	if err != nil {
+		return 0, err
+	}
+	w := newChunkWriter(c.Conn, aead)
+
+	// the first chunk is sent with the response header
+	first := p[:min(len(p), maxPayloadSize)]
+	fixed := []byte{headerTypeServer}
+	fixed = binary.BigEndian.AppendUint64(fixed, uint64(now().Unix()))
+	fixed = append(fixed, c.requestSalt...)
+	fixed = binary.BigEndian.AppendUint16(fixed, uint16(len(first)))
+
+	buf := append([]byte{}, salt...)
+	buf = w.seal(buf, fixed)
+	buf = w.seal(buf, first)
+	if _, err := c.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	c.w = w
+
+	if rest := p[len(first):]; len(rest) != 0 {
+		n, err := w.Write(rest)
+		return len(first) + n, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,178 @@
+package shadowaead2022
+
+import (
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/transport/socks5"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The vectors are recorded from sing-shadowsocks v0.2.6 with the time fixed at vectorTime,
+// crypto/rand replaced by a counter and the keys below. The TCP requests connect to
+// example.com:443 with "hello" and are answered with "world", the UDP requests are "query"
+// to 1.1.1.1:443 and answered with "answer".
+const (
+	vectorServerKey = "AAECAwQFBgcICQoLDA0ODw=="                     // 0x00..0x0f
+	vectorUserKey   = "ICEiIyQlJicoKSorLC0uLw=="                     // 0x20..0x2f
+	vectorChachaKey = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=" // 0x00..0x1f
+
+	vectorTCPRequest     = "000102030405060708090a0b0c0d0e0f35862b4f511b18084f6adad33d239c3037c8b30e5e7a339683724b47f80442785a13da7d260949dbf55d2d9a86c330ba9a49c89487329db8d9f189f6a996e55da4bd5fcab24a1b66dc7ad015cacb427a20e2c5ec3e623d49e89b49e889545c213c0006b3298a31eed9d03dcdecc8c5aa69fea0db53ec12fb26fe5f20b0f60704511809af3be4e096cc4da0a1540a7d187f0edb163b7a184255384fd6a2a57502026f673c293bd0c688484c7cf141d4785cb072756d10867fb67e06df220ca907d74a243d669b9d21746652594c90a814efe7848977de9b9d30ba17dd0fd0ae91d69be1c37c5a4f216966a85fe99a06a34a3e7eed42e221fe560a3fdb7317a829d386c177a7dea463c9566e5bba1111785d4e9636d4653270b37afbb6511adbdd2dbcafbe1efada02462f8d1a85b12fe998ba8b4f948b4b985e6d71d05184da462b50080e2e30fcf3b21ed7f51cd265f43e8ffb0e3feb5ab0a61f07c71b749ff88514c62ef8dd07182765170935484f79fa564a57bc1cf91fe9d1c828673a7a15d032eb71efb6369e94c9d4e79f1f825845c44f5effacafe3556a48f0bfb2ba5c7e95083c31f148ec7d5f54638f2b299d76c16c130c48817b22f30d081dd5c9"
+	vectorTCPResponse    = "101112131415161718191a1b1c1d1e1ff72b42ac395d4aead07a7272ee8e6ea4bfff79f2f75da9084c5f6fffd56ff78104d1d025000f20a5c6606b95fa1b29c57e262922f9ae671d67b5496c5d2a0436"
+	vectorTCPEIHRequest  = "202122232425262728292a2b2c2d2e2f28cd5a20f71480fe5988574cad4509d250a1cc0924a50050ec752ebb0fb6b6b9a455b297b6bbe1b7045acde03d5627c2355b928a128cfcc0234eac63b72fb6a184f9a8ed4620273e23d738b017b26542a34446d053533f30585bc7876930c4c8abfa007b73f06b1bd0142e639f4c61c57c97e9de2f861307fafee7b83feb77c81ec267a376c5"
+	vectorTCPEIHResponse = "303132333435363738393a3b3c3d3e3f19886b887bd9e804451820517e869a79aecbbe9163fa883f770ceaff5c1ef0ceca58d313633bac4c5a870dc6c6e119440892c532fdad857b0ea1e1e87979cb7c"
+
+	vectorUDPRequest        = "4aca2ece059d23088aadfcab8b6cf7963178787e429d3731ef8cef08cbe2fa82662a7609477ea2ebcfff196ed33209a18eccb1913566e2"
+	vectorUDPResponse       = "c3025fcfaade5bdc2e1f8f473e44b8eee13ca2c038dc791e8e96d1cec6ea56c259380e5c6e7c09db574babe075991fed2ce0da9ed7275603536e36547c12666c"
+	vectorUDPEIHRequest     = "6f49e0a214c8314eed5426d062dfdbc68741b03df75766ab1d706439b7497c6da78206eea457b8eda3a8f6fe4c1fed0ce5e1c6cb8e86ac766edd85ad2b11b0e1939d03e7479250"
+	vectorUDPEIHResponse    = "774c80fa261fcbc5b5538f68a587fadf55a593b22f7abfbeb669d72363f20f19cef03fe57bfcbfc78fca937d55af1ba4dc37385007f728274041a86b1c6dca15"
+	vectorUDPChachaRequest  = "2e61d0337c4f2e4adb2344fa9def8cdca4417053f76a78fea3b7c85a2c29d9596ce7f53501c08f2d66055c09c2c1ea8ec6f84d45e7a298d11c985ba1810dc4a75c8b1cd479fbe801c076618d76ef30"
+	vectorUDPChachaResponse = "4d14dc6e98f8edf4163e8a2b6b0b0f35215ea842ac30fcbc952a308525660e1f9ea89a631f9d0c22d4b83a8bebf184235cfc65f1940da54baa79edc33e84fe0f4861c65d8ea1b61bd68ed277b2aaa17326dc33adc36522c6"
+)
+
+var vectorTime = time.Unix(1700000000, 0)
+
+func withVectorTime(t *testing.T) {
+	now = func() time.Time { return vectorTime }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func decodeVector(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// pipeConn returns a stream which reads b
+func pipeConn(b []byte) net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		client.Write(b)
+		client.Close()
+	}()
+	return server
+}
+
+// vectorPacketConn records the written packets and reads the packets of in
+type vectorPacketConn struct {
+	net.PacketConn
+	in      [][]byte
+	written [][]byte
+}
+
+func (c *vectorPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.written = append(c.written, append([]byte{}, b...))
+	return len(b), nil
+}
+
+func (c *vectorPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if len(c.in) == 0 {
+		return 0, nil, io.EOF
+	}
+	n := copy(b, c.in[0])
+	c.in = c.in[1:]
+	return n, &net.UDPAddr{}, nil
+}
+
+func TestShadowAEAD2022_TCPVectors(t *testing.T) {
+	withVectorTime(t)
+
+	for _, tt := range []struct {
+		name     string
+		password string
+		users    []User
+		request  string
+		response string
+	}{
+		{"single user", vectorServerKey, nil, vectorTCPRequest, vectorTCPResponse},
+		{"identity header", vectorServerKey + ":" + vectorUserKey, []User{{Name: "alice", Key: vectorUserKey}}, vectorTCPEIHRequest, vectorTCPEIHResponse},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewService(AES128GCM, vectorServerKey, tt.users)
+			require.NoError(t, err)
+			request := decodeVector(t, tt.request)
+
+			conn, addr, user, err := s.NewConn(pipeConn(request))
+			require.NoError(t, err)
+			assert.Equal(t, socks5.ParseAddr("example.com:443"), addr)
+			if tt.users != nil {
+				assert.Equal(t, "alice", user)
+			}
+			buf := make([]byte, 5)
+			_, err = io.ReadFull(conn, buf)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", string(buf))
+
+			// the response carries the salt of the request
+			c, err := NewCipher(AES128GCM, tt.password)
+			require.NoError(t, err)
+			client := c.StreamConn(pipeConn(decodeVector(t, tt.response))).(*clientConn)
+			client.salt = request[:c.method.keySize]
+			_, err = io.ReadFull(client, buf)
+			require.NoError(t, err)
+			assert.Equal(t, "world", string(buf))
+		})
+	}
+}
+
+func TestShadowAEAD2022_UDPVectors(t *testing.T) {
+	withVectorTime(t)
+
+	for _, tt := range []struct {
+		name      string
+		method    string
+		key       string
+		users     []User
+		sessionID uint64
+		request   string
+		response  string
+	}{
+		{"separate header", AES128GCM, vectorServerKey, nil, 0x4041424344454647, vectorUDPRequest, vectorUDPResponse},
+		{"identity header", AES128GCM, vectorServerKey, []User{{Name: "alice", Key: vectorUserKey}}, 0x5051525354555657, vectorUDPEIHRequest, vectorUDPEIHResponse},
+		{"chacha20-poly1305", Chacha20Poly1305, vectorChachaKey, nil, 0x302e20ad5ac736d6, vectorUDPChachaRequest, vectorUDPChachaResponse},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewService(tt.method, tt.key, tt.users)
+			require.NoError(t, err)
+			target := socks5.ParseAddr("1.1.1.1:443")
+
+			session, addr, payload, err := s.UnpackPacket(decodeVector(t, tt.request))
+			require.NoError(t, err)
+			assert.Equal(t, tt.sessionID, session.clientSessionID)
+			assert.Equal(t, target, addr)
+			assert.Equal(t, "query", string(payload))
+			if tt.users != nil {
+				assert.Equal(t, "alice", session.User())
+			}
+
+			password := tt.key
+			if tt.users != nil {
+				password += ":" + vectorUserKey
+			}
+			c, err := NewCipher(tt.method, password)
+			require.NoError(t, err)
+			pc := &vectorPacketConn{in: [][]byte{decodeVector(t, tt.response)}}
+			client := c.PacketConn(pc).(*packetConn)
+			client.sessionID = tt.sessionID
+
+			// the AES packets have no random parts without padding
+			_, err = client.WriteTo(append(append([]byte{}, target...), "query"...), &net.UDPAddr{})
+			require.NoError(t, err)
+			if tt.method != Chacha20Poly1305 {
+				assert.Equal(t, tt.request, hex.EncodeToString(pc.written[0]))
+			}
+
+			buf := make([]byte, 2048)
+			n, _, err := client.ReadFrom(buf)
+			require.NoError(t, err)
+			source := socks5.SplitAddr(buf[:n])
+			assert.Equal(t, target, source)
+			assert.Equal(t, "answer", string(buf[len(source):n]))
+		})
+	}
+}
@@ -41,7 +41,8 @@ var (
 	ErrRequestUnknownCode      = errors.New("request failed with unknown code")
 )
 
-func ServerHandshake(rw io.ReadWriter, authenticator auth.Authenticator) (addr string, command Command, err error) {
+// ServerHandshake reads the request of the client, the session is nil if the authenticator is nil
+func ServerHandshake(rw io.ReadWriter, authenticator auth.Authenticator) (addr string, command Command, session *auth.Session, err error) {
 	var req [8]byte
 	if _, err = io.ReadFull(rw, req[:]); err != nil {
 		return
@@ -86,7 +87,7 @@ func ServerHandshake(rw io.ReadWriter, authenticator auth.Authenticator) (addr s
 	}
 
 	// SOCKS4 only support USERID auth.
-	if authenticator == nil || authenticator.Verify(string(userID), "") {
+	if session, err = auth.Authenticate(authenticator, string(userID), ""); err == nil {
 		code = RequestGranted
 	} else {
 		code = RequestIdentdMismatched
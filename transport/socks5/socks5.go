@@ -89,6 +89,7 @@ func (a Addr) UDPAddr() *net.UDPAddr {
 
 // SOCKS errors as defined in RFC 1928 section 6.
 const (
+	ReplySucceeded          = Error(0)
 	ErrGeneralFailure       = Error(1)
 	ErrConnectionNotAllowed = Error(2)
 	ErrNetworkUnreachable   = Error(3)
@@ -107,8 +108,9 @@ type User struct {
 	Password string
 }
 
-// ServerHandshake fast-tracks SOCKS initialization to get target address to connect on server side.
-func ServerHandshake(rw net.Conn, authenticator auth.Authenticator) (addr Addr, command Command, err error) {
+// ServerHandshake fast-tracks SOCKS initialization to get target address to connect on server side,
+// the session is nil if the authenticator is nil. The replies of CmdBind are left to the caller.
+func ServerHandshake(rw net.Conn, authenticator auth.Authenticator) (addr Addr, command Command, session *auth.Session, err error) {
 	// Read RFC 1928 for request and reply structure and sizes.
 	buf := make([]byte, MaxAddrLen)
 	// read VER, NMETHODS, METHODS
@@ -161,7 +163,7 @@ func ServerHandshake(rw net.Conn, authenticator auth.Authenticator) (addr Addr,
 		pass := string(authBuf[:passLen])
 
 		// Verify
-		if ok := authenticator.Verify(user, pass); !ok {
+		if session, err = auth.Authenticate(authenticator, user, pass); err != nil {
 			rw.Write([]byte{1, 1})
 			err = ErrAuth
 			return
@@ -195,11 +197,9 @@ func ServerHandshake(rw net.Conn, authenticator auth.Authenticator) (addr Addr,
 		if localAddr == nil {
 			err = ErrAddressNotSupported
 		} else {
-			// write VER REP RSV ATYP BND.ADDR BND.PORT
-			_, err = rw.Write(bytes.Join([][]byte{{5, 0, 0}, localAddr}, []byte{}))
+			err = WriteReply(rw, ReplySucceeded, localAddr)
 		}
 	case CmdBind:
-		fallthrough
 	default:
 		err = ErrCommandNotSupported
 	}
@@ -207,6 +207,31 @@ func ServerHandshake(rw net.Conn, authenticator auth.Authenticator) (addr Addr,
 	return
 }
 
+// WriteReply writes the reply of a request, the address is zero if it's nil.
+func WriteReply(w io.Writer, rep Error, addr Addr) error {
+	if addr == nil {
+		addr = Addr{AtypIPv4, 0, 0, 0, 0, 0, 0}
+	}
+	// write VER REP RSV ATYP BND.ADDR BND.PORT
+	_, err := w.Write(bytes.Join([][]byte{{5, byte(rep), 0}, addr}, []byte{}))
+	return err
+}
+
+// ReadReply reads the reply of a request, it returns the error of a failed reply.
+func ReadReply(r io.Reader) (Addr, error) {
+	buf := make([]byte, MaxAddrLen)
+
+	// VER, REP, RSV
+	if _, err := io.ReadFull(r, buf[:3]); err != nil {
+		return nil, err
+	}
+	if rep := Error(buf[1]); rep != ReplySucceeded {
+		return nil, rep
+	}
+
+	return ReadAddr(r, buf)
+}
+
 // ClientHandshake fast-tracks SOCKS initialization to get target address to connect on client side.
 func ClientHandshake(rw io.ReadWriter, addr Addr, command Command, user *User) (Addr, error) {
 	buf := make([]byte, MaxAddrLen)
@@ -264,12 +289,7 @@ func ClientHandshake(rw io.ReadWriter, addr Addr, command Command, user *User) (
 		return nil, err
 	}
 
-	// VER, REP, RSV
-	if _, err := io.ReadFull(rw, buf[:3]); err != nil {
-		return nil, err
-	}
-
-	return ReadAddr(rw, buf)
+	return ReadReply(rw)
 }
 
 func ReadAddr(r io.Reader, b []byte) (Addr, error) {
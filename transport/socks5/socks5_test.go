@@ -0,0 +1,45 @@
+package socks5
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientHandshake_Reply(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		rep  Error
+		err  error
+	}{
+		{"succeeded", ReplySucceeded, nil},
+		{"general failure", ErrGeneralFailure, ErrGeneralFailure},
+		{"connection refused", ErrConnectionRefused, ErrConnectionRefused},
+		{"command not supported", ErrCommandNotSupported, ErrCommandNotSupported},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				defer server.Close()
+				buf := make([]byte, MaxAddrLen)
+				server.Read(buf) // VER, NMETHODS, METHODS
+				server.Write([]byte{5, 0})
+				server.Read(buf) // VER, CMD, RSV, ADDR
+				WriteReply(server, tt.rep, ParseAddr("1.2.3.4:5678"))
+			}()
+
+			addr, err := ClientHandshake(client, ParseAddr("example.com:443"), CmdConnect, nil)
+			if tt.err != nil {
+				// the REP of a failed request is the error, its address is ignored
+				assert.Equal(t, tt.err, err)
+				assert.Nil(t, addr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "1.2.3.4:5678", addr.String())
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package trojan
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/Dreamacro/clash/transport/socks5"
+)
+
+var ErrInvalidPassword = errors.New("invalid password")
+
+// User is a user of the server
+type User struct {
+	Name     string
+	Password string
+}
+
+// Server authenticates the requests of the trojan clients
+type Server struct {
+	// hex encoded hash of the password to the name of the user
+	users map[string]string
+}
+
+// NewServer returns a server of the users
+func NewServer(users []User) *Server {
+	s := &Server{users: map[string]string{}}
+	for _, u := range users {
+		s.users[string(hexSha224([]byte(u.Password)))] = u.Name
+	}
+	return s
+}
+
+// ReadHeader reads the request header written by Trojan.WriteHeader,
+// it returns the command with the target address and the name of the user
+func (s *Server) ReadHeader(r io.Reader) (Command, socks5.Addr, string, error) {
+	buf := make([]byte, 56+2+1)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, "", err
+	}
+
+	name, ok := s.users[string(buf[:56])]
+	if !ok || !bytes.Equal(buf[56:58], crlf) {
+		return 0, nil, "", ErrInvalidPassword
+	}
+
+	command := buf[58]
+	if command != CommandTCP && command != CommandUDP {
+		return 0, nil, "", errors.New("unsupported command")
+	}
+
+	addr, err := socks5.ReadAddr(r, make([]byte, socks5.MaxAddrLen))
+	if err != nil {
+		return 0, nil, "", err
+	}
+	if _, err := io.ReadFull(r, buf[:2]); err != nil {
+		return 0, nil, "", err
+	}
+	return command, addr, name, nil
+}
@@ -1,6 +1,7 @@
 package trojan
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"crypto/tls"
@@ -196,6 +197,35 @@ func ReadPacket(r io.Reader, payload []byte) (net.Addr, int, int, error) {
 	return uAddr, length, total - length, nil
 }
 
+// ReadServerPacket reads a packet of a client into payload,
+// it returns the target address and the size of the payload
+func ReadServerPacket(r io.Reader, payload []byte) (socks5.Addr, int, error) {
+	addr, err := socks5.ReadAddr(r, make([]byte, socks5.MaxAddrLen))
+	if err != nil {
+		return nil, 0, errors.New("read addr error")
+	}
+
+	var buf [4]byte
+	if _, err = io.ReadFull(r, buf[:]); err != nil {
+		return nil, 0, errors.New("read length error")
+	}
+
+	if !bytes.Equal(buf[2:], crlf) {
+		return nil, 0, errors.New("read crlf error")
+	}
+
+	total := int(binary.BigEndian.Uint16(buf[:2]))
+	if total > maxLength || total > len(payload) {
+		return nil, 0, errors.New("packet invalid")
+	}
+
+	if _, err = io.ReadFull(r, payload[:total]); err != nil {
+		return nil, 0, errors.New("read packet error")
+	}
+
+	return addr, total, nil
+}
+
 func New(option *Option) *Trojan {
 	return &Trojan{option, hexSha224([]byte(option.Password))}
 }
@@ -0,0 +1,31 @@
+package trojan
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Dreamacro/clash/transport/socks5"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadServerPacket(t *testing.T) {
+	target := socks5.ParseAddr("1.1.1.1:53")
+	buf := &bytes.Buffer{}
+	_, err := WritePacket(buf, target, []byte("query"))
+	require.NoError(t, err)
+	packet := buf.Bytes()
+
+	payload := make([]byte, maxLength)
+	addr, n, err := ReadServerPacket(bytes.NewReader(packet), payload)
+	require.NoError(t, err)
+	assert.Equal(t, target, addr)
+	assert.Equal(t, "query", string(payload[:n]))
+
+	// the CRLF after the length is replaced
+	invalid := append([]byte{}, packet...)
+	invalid[len(target)+2] = 'x'
+	_, _, err = ReadServerPacket(bytes.NewReader(invalid), payload)
+	assert.Error(t, err)
+}
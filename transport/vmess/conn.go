@@ -193,6 +193,40 @@ func hashTimestamp(t time.Time) []byte {
 	return md5hash.Sum(nil)
 }
 
+// newBodyAEAD returns the AEAD of the body encrypted by security, nil if the body is plaintext
+func newBodyAEAD(security Security, key []byte) cipher.AEAD {
+	switch security {
+	case SecurityAES128GCM:
+		block, _ := aes.NewCipher(key)
+		aead, _ := cipher.NewGCM(block)
+		return aead
+	case SecurityCHACHA20POLY1305:
+		chachaKey := make([]byte, 32)
+		t := md5.Sum(key)
+		copy(chachaKey, t[:])
+		t = md5.Sum(chachaKey[:16])
+		copy(chachaKey[16:], t[:])
+		aead, _ := chacha20poly1305.New(chachaKey)
+		return aead
+	default:
+		return nil
+	}
+}
+
+func newBodyReader(conn net.Conn, security Security, key, iv []byte) io.Reader {
+	if aead := newBodyAEAD(security, key); aead != nil {
+		return newAEADReader(conn, aead, iv)
+	}
+	return newChunkReader(conn)
+}
+
+func newBodyWriter(conn net.Conn, security Security, key, iv []byte) io.Writer {
+	if aead := newBodyAEAD(security, key); aead != nil {
+		return newAEADWriter(conn, aead, iv)
+	}
+	return newChunkWriter(conn)
+}
+
 // newConn return a Conn instance
 func newConn(conn net.Conn, id *ID, dst *DstAddr, security Security, isAead bool) (*Conn, error) {
 	randBytes := make([]byte, 33)
@@ -234,32 +268,9 @@ func newConn(conn net.Conn, id *ID, dst *DstAddr, security Security, isAead bool
 			reader = newChunkReader(conn)
 			writer = newChunkWriter(conn)
 		}
-	case SecurityNone:
-		reader = newChunkReader(conn)
-		writer = newChunkWriter(conn)
-	case SecurityAES128GCM:
-		block, _ := aes.NewCipher(reqBodyKey[:])
-		aead, _ := cipher.NewGCM(block)
-		writer = newAEADWriter(conn, aead, reqBodyIV[:])
-
-		block, _ = aes.NewCipher(respBodyKey[:])
-		aead, _ = cipher.NewGCM(block)
-		reader = newAEADReader(conn, aead, respBodyIV[:])
-	case SecurityCHACHA20POLY1305:
-		key := make([]byte, 32)
-		t := md5.Sum(reqBodyKey[:])
-		copy(key, t[:])
-		t = md5.Sum(key[:16])
-		copy(key[16:], t[:])
-		aead, _ := chacha20poly1305.New(key)
-		writer = newAEADWriter(conn, aead, reqBodyIV[:])
-
-		t = md5.Sum(respBodyKey[:])
-		copy(key, t[:])
-		t = md5.Sum(key[:16])
-		copy(key[16:], t[:])
-		aead, _ = chacha20poly1305.New(key)
-		reader = newAEADReader(conn, aead, respBodyIV[:])
+	default:
+		writer = newBodyWriter(conn, security, reqBodyKey, reqBodyIV)
+		reader = newBodyReader(conn, security, respBodyKey, respBodyIV)
 	}
 
 	c := &Conn{
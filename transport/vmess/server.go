@@ -0,0 +1,275 @@
+package vmess
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/common/cache"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// maxAuthIDTimeDiff is the max difference between the time of the auth id and now, in seconds
+const maxAuthIDTimeDiff = 120
+
+var (
+	ErrInvalidUser    = errors.New("invalid user")
+	ErrReplayedAuthID = errors.New("replayed auth id")
+	ErrInvalidHeader  = errors.New("invalid request header")
+)
+
+// ServerUser is a user of the server
+type ServerUser struct {
+	Name string
+	UUID string
+}
+
+type serverUser struct {
+	name   string
+	cmdKey [16]byte
+	authID cipher.Block
+}
+
+// Server is the server side of VMess, it accepts the requests with the AEAD header
+type Server struct {
+	users []*serverUser
+
+	mux     sync.Mutex
+	authIDs *cache.LruCache
+}
+
+// NewServer returns a server of the users
+func NewServer(users []ServerUser) (*Server, error) {
+	s := &Server{authIDs: cache.New(cache.WithAge(maxAuthIDTimeDiff * 2))}
+	for _, u := range users {
+		uid, err := uuid.FromString(u.UUID)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Name, err)
+		}
+
+		su := &serverUser{name: u.Name}
+		copy(su.cmdKey[:], newID(&uid).CmdKey)
+		su.authID, _ = aes.NewCipher(kdf(su.cmdKey[:], kdfSaltConstAuthIDEncryptionKey)[:16])
+		s.users = append(s.users, su)
+	}
+	return s, nil
+}
+
+// NewConn reads the request header of an accepted stream,
+// it returns the stream with the destination and the name of the user
+func (s *Server) NewConn(conn net.Conn) (net.Conn, *DstAddr, string, error) {
+	var authID [16]byte
+	if _, err := io.ReadFull(conn, authID[:]); err != nil {
+		return nil, nil, "", err
+	}
+	user, err := s.authenticate(authID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	header, err := openVMessAEADHeader(user.cmdKey, authID, conn)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	c, dst, err := newServerConn(conn, header)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return c, dst, user.name, nil
+}
+
+// authenticate returns the user of the auth id
+func (s *Server) authenticate(authID [16]byte) (*serverUser, error) {
+	var plain [16]byte
+	for _, u := range s.users {
+		u.authID.Decrypt(plain[:], authID[:])
+		if crc32.ChecksumIEEE(plain[:12]) != binary.BigEndian.Uint32(plain[12:]) {
+			continue
+		}
+
+		diff := time.Now().Unix() - int64(binary.BigEndian.Uint64(plain[:8]))
+		if diff > maxAuthIDTimeDiff || diff < -maxAuthIDTimeDiff {
+			return nil, ErrInvalidUser
+		}
+
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		if s.authIDs.Exist(authID) {
+			return nil, ErrReplayedAuthID
+		}
+		s.authIDs.Set(authID, struct{}{})
+		return u, nil
+	}
+	return nil, ErrInvalidUser
+}
+
+// openVMessAEADHeader reads the header sealed by sealVMessAEADHeader after the auth id
+func openVMessAEADHeader(key [16]byte, authID [16]byte, r io.Reader) ([]byte, error) {
+	// encrypted length and connection nonce
+	buf := make([]byte, 18+8)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	connectionNonce := string(buf[18:])
+
+	lengthKey := kdf(key[:], kdfSaltConstVMessHeaderPayloadLengthAEADKey, string(authID[:]), connectionNonce)[:16]
+	lengthNonce := kdf(key[:], kdfSaltConstVMessHeaderPayloadLengthAEADIV, string(authID[:]), connectionNonce)[:12]
+	block, _ := aes.NewCipher(lengthKey)
+	aead, _ := cipher.NewGCM(block)
+	length, err := aead.Open(nil, lengthNonce, buf[:18], authID[:])
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	headerKey := kdf(key[:], kdfSaltConstVMessHeaderPayloadAEADKey, string(authID[:]), connectionNonce)[:16]
+	headerNonce := kdf(key[:], kdfSaltConstVMessHeaderPayloadAEADIV, string(authID[:]), connectionNonce)[:12]
+	block, _ = aes.NewCipher(headerKey)
+	aead, _ = cipher.NewGCM(block)
+
+	header := make([]byte, int(binary.BigEndian.Uint16(length))+aead.Overhead())
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header, err = aead.Open(header[:0], headerNonce, header, authID[:]); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return header, nil
+}
+
+// ServerConn is an accepted stream with the request header read
+type ServerConn struct {
+	net.Conn
+	reader      io.Reader
+	writer      io.Writer
+	respV       byte
+	respBodyKey []byte
+	respBodyIV  []byte
+
+	sent bool
+}
+
+// newServerConn parses the request header and sets up the body of the stream
+func newServerConn(conn net.Conn, header []byte) (*ServerConn, *DstAddr, error) {
+	// Ver IV Key V Opt P|Sec Reserve Cmd Port AddrType
+	if len(header) < 41+4 || header[0] != Version {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	fnv1a := fnv.New32a()
+	fnv1a.Write(header[:len(header)-4])
+	if fnv1a.Sum32() != binary.BigEndian.Uint32(header[len(header)-4:]) {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	reqBodyIV, reqBodyKey := header[1:17], header[17:33]
+	respV, option := header[33], header[34]
+	security := header[35] & 0x0F
+
+	if option&^OptionChunkStream != 0 {
+		return nil, nil, fmt.Errorf("unsupported request option: %d", option)
+	}
+	switch security {
+	case SecurityAES128GCM, SecurityCHACHA20POLY1305, SecurityNone:
+	default:
+		return nil, nil, fmt.Errorf("unsupported security type: %d", security)
+	}
+
+	dst := &DstAddr{
+		Port:     uint(binary.BigEndian.Uint16(header[38:40])),
+		AddrType: header[40],
+	}
+	switch header[37] {
+	case CommandTCP:
+	case CommandUDP:
+		dst.UDP = true
+	default:
+		return nil, nil, fmt.Errorf("unsupported command: %d", header[37])
+	}
+
+	addr := header[41 : len(header)-4]
+	var size int
+	switch dst.AddrType {
+	case AtypIPv4:
+		size = net.IPv4len
+	case AtypIPv6:
+		size = net.IPv6len
+	case AtypDomainName:
+		if len(addr) == 0 {
+			return nil, nil, ErrInvalidHeader
+		}
+		size = 1 + int(addr[0])
+	default:
+		return nil, nil, ErrInvalidHeader
+	}
+	// the rest is the padding
+	if len(addr)-size != int(header[35]>>4) {
+		return nil, nil, ErrInvalidHeader
+	}
+	dst.Addr = append([]byte{}, addr[:size]...)
+
+	bodyKey := sha256.Sum256(reqBodyKey)
+	bodyIV := sha256.Sum256(reqBodyIV)
+	c := &ServerConn{
+		Conn:        conn,
+		respV:       respV,
+		respBodyKey: bodyKey[:16],
+		respBodyIV:  bodyIV[:16],
+	}
+
+	if option&OptionChunkStream == 0 {
+		// only the plaintext body can be sent without chunks
+		if security != SecurityNone {
+			return nil, nil, ErrInvalidHeader
+		}
+		c.reader, c.writer = conn, conn
+	} else {
+		c.reader = newBodyReader(conn, security, append([]byte{}, reqBodyKey...), append([]byte{}, reqBodyIV...))
+		c.writer = newBodyWriter(conn, security, c.respBodyKey, c.respBodyIV)
+	}
+	return c, dst, nil
+}
+
+func (sc *ServerConn) Read(b []byte) (int, error) {
+	return sc.reader.Read(b)
+}
+
+// Write sends the response header before the first write
+func (sc *ServerConn) Write(b []byte) (int, error) {
+	if !sc.sent {
+		if err := sc.sendResponse(); err != nil {
+			return 0, err
+		}
+		sc.sent = true
+	}
+	return sc.writer.Write(b)
+}
+
+func (sc *ServerConn) sendResponse() error {
+	// V Opt Cmd CmdLen
+	header := []byte{sc.respV, 0, 0, 0}
+
+	lengthKey := kdf(sc.respBodyKey, kdfSaltConstAEADRespHeaderLenKey)[:16]
+	lengthIV := kdf(sc.respBodyIV, kdfSaltConstAEADRespHeaderLenIV)[:12]
+	block, _ := aes.NewCipher(lengthKey)
+	aead, _ := cipher.NewGCM(block)
+	buf := aead.Seal(nil, lengthIV, binary.BigEndian.AppendUint16(nil, uint16(len(header))), nil)
+
+	payloadKey := kdf(sc.respBodyKey, kdfSaltConstAEADRespHeaderPayloadKey)[:16]
+	payloadIV := kdf(sc.respBodyIV, kdfSaltConstAEADRespHeaderPayloadIV)[:12]
+	block, _ = aes.NewCipher(payloadKey)
+	aead, _ = cipher.NewGCM(block)
+	buf = aead.Seal(buf, payloadIV, header, nil)
+
+	_, err := sc.Conn.Write(buf)
+	return err
+}
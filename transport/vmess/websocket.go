@@ -317,3 +317,68 @@ func StreamWebsocketConn(conn net.Conn, c *WebsocketConfig) (net.Conn, error) {
 
 	return streamWebsocketConn(conn, c, nil)
 }
+
+// WebsocketServerConfig is the config of the WebSocket transport on the server side
+type WebsocketServerConfig struct {
+	Path                string
+	EarlyDataHeaderName string
+}
+
+var websocketUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4 * 1024,
+	WriteBufferSize: 4 * 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// StreamWebsocketServerConn upgrades the request of a WebSocket client, the early data
+// sent in the header or after the path by StreamWebsocketConn is read first
+func StreamWebsocketServerConn(w http.ResponseWriter, r *http.Request, c *WebsocketServerConfig) (net.Conn, error) {
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+
+	var earlyData []byte
+	responseHeader := http.Header{}
+	switch {
+	case r.URL.Path == path && c.EarlyDataHeaderName != "":
+		if value := r.Header.Get(c.EarlyDataHeaderName); value != "" {
+			data, err := base64.RawURLEncoding.DecodeString(value)
+			if err != nil {
+				http.Error(w, "invalid early data", http.StatusBadRequest)
+				return nil, fmt.Errorf("decode early data error: %w", err)
+			}
+			earlyData = data
+			if http.CanonicalHeaderKey(c.EarlyDataHeaderName) == "Sec-Websocket-Protocol" {
+				responseHeader.Set("Sec-WebSocket-Protocol", value)
+			}
+		}
+	case r.URL.Path == path:
+	case strings.HasPrefix(r.URL.Path, path):
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(r.URL.Path, path))
+		if err != nil {
+			http.NotFound(w, r)
+			return nil, fmt.Errorf("unexpected path %s", r.URL.Path)
+		}
+		earlyData = data
+	default:
+		http.NotFound(w, r)
+		return nil, fmt.Errorf("unexpected path %s", r.URL.Path)
+	}
+
+	wsConn, err := websocketUpgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &websocketConn{
+		conn:       wsConn,
+		remoteAddr: wsConn.RemoteAddr(),
+	}
+	if len(earlyData) != 0 {
+		conn.reader = bytes.NewReader(earlyData)
+	}
+	return conn, nil
+}
@@ -1,6 +1,7 @@
 package statistic
 
 import (
+	"net/netip"
 	"sync"
 	"time"
 
@@ -17,6 +18,7 @@ func init() {
 		downloadBlip:  atomic.NewInt64(0),
 		uploadTotal:   atomic.NewInt64(0),
 		downloadTotal: atomic.NewInt64(0),
+		fakeIPs:       map[netip.Addr]int{},
 	}
 
 	go DefaultManager.handle()
@@ -30,14 +32,35 @@ type Manager struct {
 	downloadBlip  *atomic.Int64
 	uploadTotal   *atomic.Int64
 	downloadTotal *atomic.Int64
+
+	// fakeIPs counts the active connections of the fake ips
+	fakeIPMux sync.Mutex
+	fakeIPs   map[netip.Addr]int
 }
 
 func (m *Manager) Join(c tracker) {
 	m.connections.Store(c.ID(), c)
+
+	if ip := c.info().Metadata.FakeIP; ip.IsValid() {
+		m.fakeIPMux.Lock()
+		m.fakeIPs[ip]++
+		m.fakeIPMux.Unlock()
+	}
 }
 
 func (m *Manager) Leave(c tracker) {
-	m.connections.Delete(c.ID())
+	// the connection may be closed more than once
+	if _, loaded := m.connections.LoadAndDelete(c.ID()); !loaded {
+		return
+	}
+
+	if ip := c.info().Metadata.FakeIP; ip.IsValid() {
+		m.fakeIPMux.Lock()
+		if m.fakeIPs[ip]--; m.fakeIPs[ip] <= 0 {
+			delete(m.fakeIPs, ip)
+		}
+		m.fakeIPMux.Unlock()
+	}
 }
 
 func (m *Manager) PushUploaded(size int64) {
@@ -68,6 +91,13 @@ func (m *Manager) Snapshot() *Snapshot {
 	}
 }
 
+// FakeIPInUse reports whether the fake ip is the destination of any active connection
+func (m *Manager) FakeIPInUse(ip netip.Addr) bool {
+	m.fakeIPMux.Lock()
+	defer m.fakeIPMux.Unlock()
+	return m.fakeIPs[ip] > 0
+}
+
 func (m *Manager) ResetStatistic() {
 	m.uploadTemp.Store(0)
 	m.uploadBlip.Store(0)
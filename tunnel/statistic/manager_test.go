@@ -0,0 +1,39 @@
+package statistic
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapter/outbound"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_FakeIPInUse(t *testing.T) {
+	m := &Manager{fakeIPs: map[netip.Addr]int{}}
+	fakeIP := netip.MustParseAddr("198.18.0.2")
+
+	newTracker := func(metadata *C.Metadata) *tcpTracker {
+		left, right := net.Pipe()
+		t.Cleanup(func() { right.Close() })
+		return NewTCPTracker(outbound.NewConn(left, outbound.NewDirect()), m, metadata, nil, nil)
+	}
+
+	first := newTracker(&C.Metadata{FakeIP: fakeIP})
+	second := newTracker(&C.Metadata{FakeIP: fakeIP})
+	other := newTracker(&C.Metadata{})
+	assert.True(t, m.FakeIPInUse(fakeIP))
+	assert.False(t, m.FakeIPInUse(netip.MustParseAddr("198.18.0.3")))
+
+	// closing a connection twice doesn't release the fake ip of the others
+	first.Close()
+	first.Close()
+	other.Close()
+	assert.True(t, m.FakeIPInUse(fakeIP))
+
+	second.Close()
+	assert.False(t, m.FakeIPInUse(fakeIP))
+	assert.Empty(t, m.fakeIPs)
+}
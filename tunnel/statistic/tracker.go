@@ -2,6 +2,7 @@ package statistic
 
 import (
 	"net"
+	"sync"
 	"time"
 
 	C "github.com/Dreamacro/clash/constant"
@@ -13,6 +14,7 @@ import (
 type tracker interface {
 	ID() string
 	Close() error
+	info() *trackerInfo
 }
 
 type trackerInfo struct {
@@ -26,10 +28,16 @@ type trackerInfo struct {
 	RulePayload   string        `json:"rulePayload"`
 }
 
+func (ti *trackerInfo) info() *trackerInfo {
+	return ti
+}
+
 type tcpTracker struct {
 	C.Conn `json:"-"`
 	*trackerInfo
 	manager *Manager
+	user    *User
+	release sync.Once
 }
 
 func (tt *tcpTracker) ID() string {
@@ -37,32 +45,82 @@ func (tt *tcpTracker) ID() string {
 }
 
 func (tt *tcpTracker) Read(b []byte) (int, error) {
-	n, err := tt.Conn.Read(b)
+	if tt.user == nil {
+		n, err := tt.Conn.Read(b)
+		tt.pushDownloaded(n)
+		return n, err
+	}
+
+	if err := tt.user.check(); err != nil {
+		return 0, err
+	}
+	limiter := tt.user.downloadLimiter
+	n, err := tt.Conn.Read(b[:min(len(b), limiter.Burst())])
+	tt.pushDownloaded(n)
+	waitN(limiter, n)
+	return n, err
+}
+
+func (tt *tcpTracker) Write(b []byte) (int, error) {
+	if tt.user == nil {
+		n, err := tt.Conn.Write(b)
+		tt.pushUploaded(n)
+		return n, err
+	}
+
+	// write in the chunks allowed by the rate limiter
+	limiter := tt.user.uploadLimiter
+	written := 0
+	for written < len(b) {
+		if err := tt.user.check(); err != nil {
+			return written, err
+		}
+
+		chunk := b[written:min(len(b), written+limiter.Burst())]
+		waitN(limiter, len(chunk))
+		n, err := tt.Conn.Write(chunk)
+		tt.pushUploaded(n)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (tt *tcpTracker) pushDownloaded(n int) {
 	download := int64(n)
 	tt.manager.PushDownloaded(download)
 	tt.DownloadTotal.Add(download)
-	return n, err
+	if tt.user != nil {
+		tt.user.download.Add(download)
+	}
 }
 
-func (tt *tcpTracker) Write(b []byte) (int, error) {
-	n, err := tt.Conn.Write(b)
+func (tt *tcpTracker) pushUploaded(n int) {
 	upload := int64(n)
 	tt.manager.PushUploaded(upload)
 	tt.UploadTotal.Add(upload)
-	return n, err
+	if tt.user != nil {
+		tt.user.upload.Add(upload)
+	}
 }
 
 func (tt *tcpTracker) Close() error {
 	tt.manager.Leave(tt)
+	tt.release.Do(tt.user.Release)
 	return tt.Conn.Close()
 }
 
-func NewTCPTracker(conn C.Conn, manager *Manager, metadata *C.Metadata, rule C.Rule) *tcpTracker {
+// NewTCPTracker tracks the connection, the connection of the user acquired by UserManager.Acquire
+// is released once the tracker is closed, the user may be nil
+func NewTCPTracker(conn C.Conn, manager *Manager, metadata *C.Metadata, rule C.Rule, user *User) *tcpTracker {
 	uuid, _ := uuid.NewV4()
 
 	t := &tcpTracker{
 		Conn:    conn,
 		manager: manager,
+		user:    user,
 		trackerInfo: &trackerInfo{
 			UUID:          uuid,
 			Start:         time.Now(),
@@ -87,39 +145,72 @@ type udpTracker struct {
 	C.PacketConn `json:"-"`
 	*trackerInfo
 	manager *Manager
+	user    *User
+	release sync.Once
 }
 
 func (ut *udpTracker) ID() string {
 	return ut.UUID.String()
 }
 
+// ReadFrom drops the packets over the download rate of the user
 func (ut *udpTracker) ReadFrom(b []byte) (int, net.Addr, error) {
-	n, addr, err := ut.PacketConn.ReadFrom(b)
-	download := int64(n)
-	ut.manager.PushDownloaded(download)
-	ut.DownloadTotal.Add(download)
-	return n, addr, err
+	for {
+		if err := ut.user.check(); err != nil {
+			return 0, nil, err
+		}
+
+		n, addr, err := ut.PacketConn.ReadFrom(b)
+		if err == nil && ut.user != nil && !ut.user.downloadLimiter.AllowN(time.Now(), n) {
+			continue
+		}
+
+		download := int64(n)
+		ut.manager.PushDownloaded(download)
+		ut.DownloadTotal.Add(download)
+		if ut.user != nil {
+			ut.user.download.Add(download)
+		}
+		return n, addr, err
+	}
 }
 
+// WriteTo drops the packets over the upload rate of the user
 func (ut *udpTracker) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if ut.user != nil {
+		if err := ut.user.check(); err != nil {
+			return 0, err
+		}
+		if !ut.user.uploadLimiter.AllowN(time.Now(), len(b)) {
+			return len(b), nil
+		}
+	}
+
 	n, err := ut.PacketConn.WriteTo(b, addr)
 	upload := int64(n)
 	ut.manager.PushUploaded(upload)
 	ut.UploadTotal.Add(upload)
+	if ut.user != nil {
+		ut.user.upload.Add(upload)
+	}
 	return n, err
 }
 
 func (ut *udpTracker) Close() error {
 	ut.manager.Leave(ut)
+	ut.release.Do(ut.user.Release)
 	return ut.PacketConn.Close()
 }
 
-func NewUDPTracker(conn C.PacketConn, manager *Manager, metadata *C.Metadata, rule C.Rule) *udpTracker {
+// NewUDPTracker tracks the packet connection, the connection of the user acquired by
+// UserManager.Acquire is released once the tracker is closed, the user may be nil
+func NewUDPTracker(conn C.PacketConn, manager *Manager, metadata *C.Metadata, rule C.Rule, user *User) *udpTracker {
 	uuid, _ := uuid.NewV4()
 
 	ut := &udpTracker{
 		PacketConn: conn,
 		manager:    manager,
+		user:       user,
 		trackerInfo: &trackerInfo{
 			UUID:          uuid,
 			Start:         time.Now(),
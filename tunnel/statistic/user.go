@@ -0,0 +1,371 @@
+package statistic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/clash/component/profile/cachefile"
+	"github.com/Dreamacro/clash/log"
+
+	"go.uber.org/atomic"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// minBurst is the min burst of the rate limiters in bytes, it's large enough for any UDP packet
+	minBurst = 64 * 1024
+
+	// persistInterval is the interval of persisting the usage to the cache file
+	persistInterval = 5 * time.Minute
+
+	// userIdleTimeout is the time after which the users without any quota and connection are evicted
+	userIdleTimeout = time.Hour
+)
+
+var (
+	ErrTooManyConnections = errors.New("too many connections")
+	ErrQuotaExceeded      = errors.New("monthly quota exceeded")
+)
+
+var DefaultUserManager = NewUserManager()
+
+// UserQuota is the limits of an authenticated user, the zero values are unlimited
+type UserQuota struct {
+	MaxConnections int   `json:"maxConnections"`
+	UploadRate     int64 `json:"uploadRate"`
+	DownloadRate   int64 `json:"downloadRate"`
+	MonthlyQuota   int64 `json:"monthlyQuota"`
+}
+
+// UserSnapshot is the quota and the usage of a user in the current month
+type UserSnapshot struct {
+	Name        string    `json:"name"`
+	Quota       UserQuota `json:"quota"`
+	Connections int64     `json:"connections"`
+	Month       string    `json:"month"`
+	Upload      int64     `json:"upload"`
+	Download    int64     `json:"download"`
+}
+
+// userUsage is the persisted usage of a user
+type userUsage struct {
+	Month    string `json:"month"`
+	Upload   int64  `json:"upload"`
+	Download int64  `json:"download"`
+}
+
+// User is an authenticated user with its quota and usage
+type User struct {
+	name string
+
+	mux   sync.Mutex
+	quota UserQuota
+	month string
+
+	monthlyQuota    *atomic.Int64
+	uploadLimiter   *rate.Limiter
+	downloadLimiter *rate.Limiter
+	connections     *atomic.Int64
+	upload          *atomic.Int64
+	download        *atomic.Int64
+
+	// lastActive is the unix nano time the user last acquired or released a connection
+	lastActive *atomic.Int64
+}
+
+func newUser(name string) *User {
+	return &User{
+		name:            name,
+		month:           time.Now().Format("2006-01"),
+		monthlyQuota:    atomic.NewInt64(0),
+		uploadLimiter:   rate.NewLimiter(rate.Inf, minBurst),
+		downloadLimiter: rate.NewLimiter(rate.Inf, minBurst),
+		connections:     atomic.NewInt64(0),
+		upload:          atomic.NewInt64(0),
+		download:        atomic.NewInt64(0),
+		lastActive:      atomic.NewInt64(time.Now().UnixNano()),
+	}
+}
+
+func setLimit(limiter *rate.Limiter, bytesPerSecond int64) {
+	if bytesPerSecond <= 0 {
+		limiter.SetLimit(rate.Inf)
+		return
+	}
+	limiter.SetLimit(rate.Limit(bytesPerSecond))
+	limiter.SetBurst(max(int(bytesPerSecond), minBurst))
+}
+
+func (u *User) setQuota(quota UserQuota) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	u.quota = quota
+	u.monthlyQuota.Store(quota.MonthlyQuota)
+	setLimit(u.uploadLimiter, quota.UploadRate)
+	setLimit(u.downloadLimiter, quota.DownloadRate)
+}
+
+// rollover resets the usage in a new month, the caller must hold the lock
+func (u *User) rollover(now time.Time) {
+	if month := now.Format("2006-01"); month != u.month {
+		u.month = month
+		u.upload.Store(0)
+		u.download.Store(0)
+	}
+}
+
+// exceeded reports whether the monthly quota is used up
+func (u *User) exceeded() bool {
+	quota := u.monthlyQuota.Load()
+	return quota > 0 && u.upload.Load()+u.download.Load() >= quota
+}
+
+// check returns the error if the user can't transfer any more
+func (u *User) check() error {
+	if u != nil && u.exceeded() {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (u *User) acquire() error {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	u.rollover(time.Now())
+	if u.exceeded() {
+		return ErrQuotaExceeded
+	}
+	if limit := u.quota.MaxConnections; limit > 0 && u.connections.Load() >= int64(limit) {
+		return ErrTooManyConnections
+	}
+	u.connections.Inc()
+	return nil
+}
+
+// Release releases the connection acquired by UserManager.Acquire
+func (u *User) Release() {
+	if u != nil {
+		u.connections.Dec()
+		u.lastActive.Store(time.Now().UnixNano())
+	}
+}
+
+// idle reports whether the user has neither quota nor connection since userIdleTimeout before now
+func (u *User) idle(now time.Time) bool {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	return u.quota == UserQuota{} && u.connections.Load() == 0 &&
+		now.Sub(time.Unix(0, u.lastActive.Load())) >= userIdleTimeout
+}
+
+// waitN waits for the limiter to transfer n bytes, n must not be greater than the burst
+func waitN(limiter *rate.Limiter, n int) {
+	limiter.WaitN(context.Background(), n)
+}
+
+func (u *User) snapshot() UserSnapshot {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	u.rollover(time.Now())
+	return UserSnapshot{
+		Name:        u.name,
+		Quota:       u.quota,
+		Connections: u.connections.Load(),
+		Month:       u.month,
+		Upload:      u.upload.Load(),
+		Download:    u.download.Load(),
+	}
+}
+
+// UserManager keeps the quotas and the usage of the authenticated users
+type UserManager struct {
+	mux     sync.Mutex
+	users   map[string]*User
+	quotas  map[string]UserQuota
+	evicted time.Time
+
+	persistOnce sync.Once
+	loaded      atomic.Bool
+}
+
+func NewUserManager() *UserManager {
+	return &UserManager{
+		users:  map[string]*User{},
+		quotas: map[string]UserQuota{},
+	}
+}
+
+// user returns the user of the name, it's created with the configured quota if not exist
+func (m *UserManager) user(name string) *User {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.evicted) >= userIdleTimeout {
+		m.evictIdle(now)
+	}
+
+	u, ok := m.users[name]
+	if !ok {
+		u = newUser(name)
+		u.setQuota(m.quotas[name])
+		m.users[name] = u
+	}
+	// keep the user from being evicted before it acquires the connection
+	u.lastActive.Store(now.UnixNano())
+	return u
+}
+
+// evictIdle removes the idle users, e.g. the ones accepted by the authentication
+// callout without any quota, their usage is dropped. The caller must hold the lock
+func (m *UserManager) evictIdle(now time.Time) {
+	m.evicted = now
+	for name, u := range m.users {
+		if _, ok := m.quotas[name]; !ok && u.idle(now) {
+			delete(m.users, name)
+		}
+	}
+}
+
+// Acquire acquires a connection of the user, it returns nil if the name is empty,
+// the connection must be released by User.Release
+func (m *UserManager) Acquire(name string) (*User, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	u := m.user(name)
+	if err := u.acquire(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// SetQuotas replaces the quotas of all the users, the usage is kept
+func (m *UserManager) SetQuotas(quotas map[string]UserQuota) {
+	m.mux.Lock()
+	m.quotas = quotas
+	for name := range quotas {
+		if _, ok := m.users[name]; !ok {
+			m.users[name] = newUser(name)
+		}
+	}
+	for name, u := range m.users {
+		u.setQuota(quotas[name])
+	}
+	m.mux.Unlock()
+}
+
+// SetQuota replaces the quota of the user until the quotas are replaced by SetQuotas
+func (m *UserManager) SetQuota(name string, quota UserQuota) {
+	m.user(name).setQuota(quota)
+}
+
+// ResetUsage resets the usage of the user in the current month
+func (m *UserManager) ResetUsage(name string) bool {
+	m.mux.Lock()
+	u, ok := m.users[name]
+	m.mux.Unlock()
+	if !ok {
+		return false
+	}
+
+	u.upload.Store(0)
+	u.download.Store(0)
+	return true
+}
+
+// User returns the snapshot of the user
+func (m *UserManager) User(name string) (UserSnapshot, bool) {
+	m.mux.Lock()
+	u, ok := m.users[name]
+	m.mux.Unlock()
+	if !ok {
+		return UserSnapshot{}, false
+	}
+	return u.snapshot(), true
+}
+
+// Users returns the snapshots of all the users sorted by name
+func (m *UserManager) Users() []UserSnapshot {
+	m.mux.Lock()
+	users := make([]*User, 0, len(m.users))
+	for _, u := range m.users {
+		users = append(users, u)
+	}
+	m.mux.Unlock()
+
+	snapshots := make([]UserSnapshot, 0, len(users))
+	for _, u := range users {
+		snapshots = append(snapshots, u.snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name < snapshots[j].Name
+	})
+	return snapshots
+}
+
+// usage returns the usage of the users to persist
+func (m *UserManager) usage() map[string][]byte {
+	entries := map[string][]byte{}
+	for _, s := range m.Users() {
+		buf, _ := json.Marshal(userUsage{Month: s.Month, Upload: s.Upload, Download: s.Download})
+		entries[s.Name] = buf
+	}
+	return entries
+}
+
+// loadUsage restores the persisted usage of the users, the usage of the past months is dropped
+func (m *UserManager) loadUsage(entries map[string][]byte) {
+	for name, entry := range entries {
+		usage := userUsage{}
+		if err := json.Unmarshal(entry, &usage); err != nil {
+			continue
+		}
+
+		u := m.user(name)
+		u.mux.Lock()
+		if usage.Month == u.month {
+			u.upload.Store(usage.Upload)
+			u.download.Store(usage.Download)
+		}
+		u.mux.Unlock()
+	}
+}
+
+// Persist loads the usage from the cache file and persists it periodically, it only works once
+func (m *UserManager) Persist() {
+	m.persistOnce.Do(func() {
+		entries := cachefile.Cache().UsersUsage()
+		m.loadUsage(entries)
+		m.loaded.Store(true)
+		log.Debugln("[Statistic] usage of %d users loaded", len(entries))
+
+		go func() {
+			ticker := time.NewTicker(persistInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				m.Save()
+			}
+		}()
+	})
+}
+
+// Save persists the usage of the users to the cache file, it does nothing until the usage is loaded by Persist
+func (m *UserManager) Save() {
+	if !m.loaded.Load() {
+		return
+	}
+	if entries := m.usage(); len(entries) != 0 {
+		cachefile.Cache().SetUsersUsage(entries)
+	}
+}
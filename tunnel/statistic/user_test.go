@@ -0,0 +1,130 @@
+package statistic
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Dreamacro/clash/adapter/outbound"
+	C "github.com/Dreamacro/clash/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserManager_MaxConnections(t *testing.T) {
+	m := NewUserManager()
+	m.SetQuotas(map[string]UserQuota{"alice": {MaxConnections: 1}})
+
+	user, err := m.Acquire("")
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	user, err = m.Acquire("alice")
+	require.NoError(t, err)
+	_, err = m.Acquire("alice")
+	assert.ErrorIs(t, err, ErrTooManyConnections)
+
+	user.Release()
+	_, err = m.Acquire("alice")
+	assert.NoError(t, err)
+
+	// the users without quota are tracked without limits
+	for i := 0; i < 3; i++ {
+		_, err = m.Acquire("bob")
+		assert.NoError(t, err)
+	}
+	snapshot, ok := m.User("bob")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), snapshot.Connections)
+}
+
+func TestUserManager_MonthlyQuota(t *testing.T) {
+	m := NewUserManager()
+	m.SetQuotas(map[string]UserQuota{"alice": {MonthlyQuota: 8}})
+
+	user, err := m.Acquire("alice")
+	require.NoError(t, err)
+
+	left, right := net.Pipe()
+	defer right.Close()
+	tt := NewTCPTracker(outbound.NewConn(left, outbound.NewDirect()), DefaultManager, &C.Metadata{InboundUser: "alice"}, nil, user)
+
+	go io.Copy(io.Discard, right)
+	_, err = tt.Write([]byte("12345678"))
+	require.NoError(t, err)
+	_, err = tt.Write([]byte("9"))
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	_, err = m.Acquire("alice")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// closing twice releases the connection once
+	tt.Close()
+	tt.Close()
+	snapshot, _ := m.User("alice")
+	assert.Equal(t, int64(0), snapshot.Connections)
+	assert.Equal(t, int64(8), snapshot.Upload)
+
+	assert.True(t, m.ResetUsage("alice"))
+	_, err = m.Acquire("alice")
+	assert.NoError(t, err)
+}
+
+func TestUserManager_Usage(t *testing.T) {
+	m := NewUserManager()
+	user, err := m.Acquire("alice")
+	require.NoError(t, err)
+	user.upload.Store(10)
+	user.download.Store(20)
+
+	entries := m.usage()
+	require.Contains(t, entries, "alice")
+
+	// the usage of the past months is dropped
+	stale, _ := json.Marshal(userUsage{Month: "2000-01", Upload: 1, Download: 2})
+	entries["bob"] = stale
+
+	restored := NewUserManager()
+	restored.loadUsage(entries)
+
+	snapshot, ok := restored.User("alice")
+	require.True(t, ok)
+	assert.Equal(t, int64(10), snapshot.Upload)
+	assert.Equal(t, int64(20), snapshot.Download)
+	assert.Equal(t, time.Now().Format("2006-01"), snapshot.Month)
+
+	snapshot, ok = restored.User("bob")
+	require.True(t, ok)
+	assert.Equal(t, int64(0), snapshot.Upload+snapshot.Download)
+}
+
+func TestUserManager_EvictIdle(t *testing.T) {
+	m := NewUserManager()
+	m.SetQuotas(map[string]UserQuota{"alice": {MaxConnections: 1}})
+
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		user, err := m.Acquire(name)
+		require.NoError(t, err)
+		if name != "carol" {
+			user.Release()
+		}
+	}
+	m.SetQuota("dave", UserQuota{UploadRate: 1024})
+
+	m.mux.Lock()
+	m.evictIdle(time.Now().Add(userIdleTimeout - time.Minute))
+	assert.Len(t, m.users, 4)
+
+	// only bob has neither quota nor connection
+	m.evictIdle(time.Now().Add(userIdleTimeout))
+	m.mux.Unlock()
+
+	names := []string{}
+	for _, s := range m.Users() {
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, []string{"alice", "carol", "dave"}, names)
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/Dreamacro/clash/adapter/inbound"
 	"github.com/Dreamacro/clash/component/nat"
+	"github.com/Dreamacro/clash/component/pac"
 	P "github.com/Dreamacro/clash/component/process"
 	"github.com/Dreamacro/clash/component/resolver"
 	C "github.com/Dreamacro/clash/constant"
@@ -27,8 +28,10 @@ var (
 	udpQueue  = make(chan *inbound.PacketAdapter, 200)
 	natTable  = nat.New()
 	rules     []C.Rule
+	subRules  map[string][]C.Rule
 	proxies   = make(map[string]C.Proxy)
 	providers map[string]provider.ProxyProvider
+	ruleSets  map[string]provider.RuleProvider
 	configMux sync.RWMutex
 
 	// Outbound Rule
@@ -37,6 +40,9 @@ var (
 	// default timeout for UDP session
 	udpTimeout = 60 * time.Second
 
+	// timeout of the remote connecting to the address of a BIND request
+	bindTimeout = 60 * time.Second
+
 	// experimental feature
 	UDPFallbackMatch = atomic.NewBool(false)
 )
@@ -60,11 +66,38 @@ func Rules() []C.Rule {
 	return rules
 }
 
+// SubRules return the named sub rule sets
+func SubRules() map[string][]C.Rule {
+	return subRules
+}
+
 // UpdateRules handle update rules
-func UpdateRules(newRules []C.Rule) {
+func UpdateRules(newRules []C.Rule, newSubRules map[string][]C.Rule) {
 	configMux.Lock()
 	rules = newRules
+	subRules = newSubRules
 	configMux.Unlock()
+
+	pac.Update(newRules)
+}
+
+// CloseUDP closes the UDP session of the source, the inbounds call it once the source is gone
+func CloseUDP(source net.Addr) {
+	if pc := natTable.Get(source.String()); pc != nil {
+		pc.Close()
+	}
+}
+
+// PAC returns the PAC script of the mode sending the proxied connections to the proxy
+func PAC(proxy string) []byte {
+	switch Mode() {
+	case Global:
+		return pac.Fixed(proxy)
+	case Direct:
+		return pac.Fixed("")
+	default:
+		return pac.Script(proxy)
+	}
 }
 
 // Proxies return all proxies
@@ -85,6 +118,20 @@ func UpdateProxies(newProxies map[string]C.Proxy, newProviders map[string]provid
 	configMux.Unlock()
 }
 
+// RuleProviders return all rule providers
+func RuleProviders() map[string]provider.RuleProvider {
+	return ruleSets
+}
+
+// UpdateRuleProviders replaces the rule providers and returns the replaced ones
+func UpdateRuleProviders(newRuleProviders map[string]provider.RuleProvider) map[string]provider.RuleProvider {
+	configMux.Lock()
+	defer configMux.Unlock()
+	replaced := ruleSets
+	ruleSets = newRuleProviders
+	return replaced
+}
+
 // Mode return current mode
 func Mode() TunnelMode {
 	return mode
@@ -136,6 +183,10 @@ func preHandleMetadata(metadata *C.Metadata) error {
 			metadata.Host = host
 			metadata.DNSMode = C.DNSMapping
 			if resolver.FakeIPEnabled() {
+				if resolver.IsFakeIP(metadata.DstIP) {
+					metadata.FakeIP, _ = netip.AddrFromSlice(metadata.DstIP)
+					metadata.FakeIP = metadata.FakeIP.Unmap()
+				}
 				metadata.DstIP = nil
 				metadata.DNSMode = C.DNSFakeIP
 			} else if node := resolver.DefaultHosts.Search(host); node != nil {
@@ -250,10 +301,17 @@ func handleUDPConn(packet *inbound.PacketAdapter) {
 			return
 		}
 
+		user, err := statistic.DefaultUserManager.Acquire(metadata.InboundUser)
+		if err != nil {
+			log.Warnln("[UDP] %s --> %s rejected, user %s: %s", metadata.SourceAddress(), metadata.RemoteAddress(), metadata.InboundUser, err.Error())
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), C.DefaultUDPTimeout)
 		defer cancel()
 		rawPc, err := proxy.ListenPacketContext(ctx, metadata.Pure())
 		if err != nil {
+			user.Release()
 			if rule == nil {
 				log.Warnln(
 					"[UDP] dial %s %s --> %s error: %s",
@@ -268,7 +326,7 @@ func handleUDPConn(packet *inbound.PacketAdapter) {
 			return
 		}
 		pCtx.InjectPacketConn(rawPc)
-		pc := statistic.NewUDPTracker(rawPc, statistic.DefaultManager, metadata, rule)
+		pc := statistic.NewUDPTracker(rawPc, statistic.DefaultManager, metadata, rule, user)
 
 		switch true {
 		case metadata.SpecialProxy != "":
@@ -323,10 +381,22 @@ func handleTCPConn(connCtx C.ConnContext) {
 		return
 	}
 
+	user, err := statistic.DefaultUserManager.Acquire(metadata.InboundUser)
+	if err != nil {
+		log.Warnln("[TCP] %s --> %s rejected, user %s: %s", metadata.SourceAddress(), metadata.RemoteAddress(), metadata.InboundUser, err.Error())
+		return
+	}
+
+	if bindCtx, ok := connCtx.(C.BindContext); ok {
+		handleBind(bindCtx, proxy, rule, user)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), C.DefaultTCPTimeout)
 	defer cancel()
 	remoteConn, err := proxy.DialContext(ctx, metadata.Pure())
 	if err != nil {
+		user.Release()
 		if rule == nil {
 			log.Warnln(
 				"[TCP] dial %s %s --> %s error: %s",
@@ -340,7 +410,7 @@ func handleTCPConn(connCtx C.ConnContext) {
 		}
 		return
 	}
-	remoteConn = statistic.NewTCPTracker(remoteConn, statistic.DefaultManager, metadata, rule)
+	remoteConn = statistic.NewTCPTracker(remoteConn, statistic.DefaultManager, metadata, rule, user)
 	defer remoteConn.Close()
 
 	switch true {
@@ -370,6 +440,49 @@ func handleTCPConn(connCtx C.ConnContext) {
 	handleSocket(connCtx, remoteConn)
 }
 
+// handleBind listens for the remote by the proxy, the proxy groups are unwrapped as they don't bind
+func handleBind(bindCtx C.BindContext, proxy C.Proxy, rule C.Rule, user *statistic.User) {
+	metadata := bindCtx.Metadata()
+	for next := proxy.Unwrap(metadata); next != nil; next = proxy.Unwrap(metadata) {
+		proxy = next
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), C.DefaultTCPTimeout)
+	defer cancel()
+	l, err := proxy.BindContext(ctx, metadata.Pure())
+	if err != nil {
+		user.Release()
+		bindCtx.Reply(nil, err)
+		log.Warnln("[TCP] bind %s %s --> %s error: %s", proxy.Name(), metadata.SourceAddress(), metadata.RemoteAddress(), err.Error())
+		return
+	}
+	defer l.Close()
+
+	if err := bindCtx.Reply(l.Addr(), nil); err != nil {
+		user.Release()
+		return
+	}
+
+	timer := time.AfterFunc(bindTimeout, func() { l.Close() })
+	remoteConn, err := l.Accept()
+	timer.Stop()
+	if err != nil {
+		user.Release()
+		bindCtx.Reply(nil, err)
+		log.Warnln("[TCP] bind %s %s --> %s accept error: %s", proxy.Name(), metadata.SourceAddress(), metadata.RemoteAddress(), err.Error())
+		return
+	}
+	remoteConn = statistic.NewTCPTracker(remoteConn, statistic.DefaultManager, metadata, rule, user)
+	defer remoteConn.Close()
+
+	if err := bindCtx.Reply(remoteConn.RemoteAddr(), nil); err != nil {
+		return
+	}
+	log.Infoln("[TCP] %s <-- %s bound by %s at %s", metadata.SourceAddress(), remoteConn.RemoteAddr(), remoteConn.Chains().String(), l.Addr())
+
+	handleSocket(bindCtx, remoteConn)
+}
+
 func shouldResolveIP(rule C.Rule, metadata *C.Metadata) bool {
 	return rule.ShouldResolveIP() && metadata.Host != "" && metadata.DstIP == nil
 }
@@ -387,7 +500,15 @@ func match(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
 		resolved = true
 	}
 
-	for _, rule := range rules {
+	matchRules := rules
+	if metadata.SpecialRules != "" {
+		var ok bool
+		if matchRules, ok = subRules[metadata.SpecialRules]; !ok {
+			return nil, nil, fmt.Errorf("sub-rules %s not found", metadata.SpecialRules)
+		}
+	}
+
+	for _, rule := range matchRules {
 		if !resolved && shouldResolveIP(rule, metadata) {
 			ip, err := resolver.ResolveIP(metadata.Host)
 			if err != nil {
@@ -0,0 +1,119 @@
+package tunnel
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/Dreamacro/clash/adapter"
+	"github.com/Dreamacro/clash/adapter/outbound"
+	"github.com/Dreamacro/clash/component/resolver"
+	C "github.com/Dreamacro/clash/constant"
+	R "github.com/Dreamacro/clash/rule"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRule(t *testing.T, tp, payload, target string) C.Rule {
+	rule, err := R.ParseRule(tp, payload, target, nil)
+	require.NoError(t, err)
+	return rule
+}
+
+func TestMatch_SubRules(t *testing.T) {
+	oldRules, oldSubRules := Rules(), SubRules()
+	oldProxies, oldProviders := Proxies(), Providers()
+	t.Cleanup(func() {
+		UpdateRules(oldRules, oldSubRules)
+		UpdateProxies(oldProxies, oldProviders)
+	})
+
+	UpdateProxies(map[string]C.Proxy{
+		"DIRECT": adapter.NewProxy(outbound.NewDirect()),
+		"REJECT": adapter.NewProxy(outbound.NewReject()),
+	}, nil)
+	UpdateRules([]C.Rule{
+		newTestRule(t, "DOMAIN-SUFFIX", "example.com", "DIRECT"),
+		newTestRule(t, "MATCH", "", "REJECT"),
+	}, map[string][]C.Rule{
+		"office": {newTestRule(t, "DOMAIN-SUFFIX", "example.com", "REJECT")},
+	})
+
+	for _, tt := range []struct {
+		name     string
+		metadata *C.Metadata
+		proxy    string
+		matched  bool
+	}{
+		{"global rules", &C.Metadata{Host: "www.example.com"}, "DIRECT", true},
+		{"global rules unmatched", &C.Metadata{Host: "example.org"}, "REJECT", true},
+		{"sub rules", &C.Metadata{Host: "www.example.com", SpecialRules: "office"}, "REJECT", true},
+		// the connections not matched by the sub rules are sent to DIRECT like the global rules
+		{"sub rules unmatched", &C.Metadata{Host: "example.org", SpecialRules: "office"}, "DIRECT", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, rule, err := match(tt.metadata)
+			require.NoError(t, err)
+			assert.Equal(t, tt.proxy, proxy.Name())
+			assert.Equal(t, tt.matched, rule != nil)
+		})
+	}
+
+	_, _, err := match(&C.Metadata{Host: "www.example.com", SpecialRules: "missing"})
+	assert.Error(t, err)
+
+	// the proxy of the inbound takes precedence over the rules
+	proxy, _, err := resolveMetadata(nil, &C.Metadata{Host: "www.example.com", SpecialRules: "office", SpecialProxy: "DIRECT"})
+	require.NoError(t, err)
+	assert.Equal(t, "DIRECT", proxy.Name())
+}
+
+// fakeIPMapper maps the fake ips of the hosts
+type fakeIPMapper map[string]string
+
+func (m fakeIPMapper) FakeIPEnabled() bool  { return true }
+func (m fakeIPMapper) MappingEnabled() bool { return true }
+
+func (m fakeIPMapper) IsFakeIP(ip net.IP) bool {
+	_, exist := m[ip.String()]
+	return exist
+}
+
+func (m fakeIPMapper) IsExistFakeIP(ip net.IP) bool { return m.IsFakeIP(ip) }
+
+func (m fakeIPMapper) FindHostByIP(ip net.IP) (string, bool) {
+	host, exist := m[ip.String()]
+	return host, exist
+}
+
+func TestPreHandleMetadata_FakeIP(t *testing.T) {
+	oldMapper := resolver.DefaultHostMapper
+	t.Cleanup(func() { resolver.DefaultHostMapper = oldMapper })
+	resolver.DefaultHostMapper = fakeIPMapper{
+		"198.18.0.2":        "example.com",
+		"fdfe:dcba:9877::2": "example.org",
+	}
+
+	for _, tt := range []struct {
+		ip     string
+		host   string
+		fakeIP string
+	}{
+		{"198.18.0.2", "example.com", "198.18.0.2"},
+		{"fdfe:dcba:9877::2", "example.org", "fdfe:dcba:9877::2"},
+	} {
+		metadata := &C.Metadata{DstIP: net.ParseIP(tt.ip)}
+		require.NoError(t, preHandleMetadata(metadata))
+		assert.Equal(t, tt.host, metadata.Host)
+		assert.Nil(t, metadata.DstIP)
+		assert.Equal(t, C.DNSFakeIP, metadata.DNSMode)
+		assert.Equal(t, netip.MustParseAddr(tt.fakeIP), metadata.FakeIP)
+	}
+
+	// the destination out of the pools isn't a fake ip
+	metadata := &C.Metadata{DstIP: net.ParseIP("1.1.1.1")}
+	require.NoError(t, preHandleMetadata(metadata))
+	assert.False(t, metadata.FakeIP.IsValid())
+	assert.Equal(t, "", metadata.Host)
+}